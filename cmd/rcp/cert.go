@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+func init() {
+	resources["cert"] = resource{
+		help: "TLS certificates of load balancers",
+		commands: map[string]command{
+			"list":   {"list certificates", listCommand("cert", certTable, "project", (*rustack.Manager).GetCertificates)},
+			"get":    {"show a certificate", getCommand("cert", certTable, (*rustack.Manager).GetCertificate)},
+			"upload": {"upload a PEM certificate, chain and key", certUpload},
+			"rotate": {"replace the certificate, chain and key of a certificate", certRotate},
+			"delete": {"delete a certificate", deleteCommand("cert", (*rustack.Manager).GetCertificate)},
+		},
+	}
+}
+
+var certTable = table{
+	headers: []string{"ID", "NAME", "DOMAINS", "EXPIRES"},
+	row: func(obj interface{}) []string {
+		c := obj.(*rustack.Certificate)
+		domains, expires := "", ""
+		if cert, err := c.X509(); err == nil {
+			domains = strings.Join(cert.DNSNames, ",")
+			if domains == "" {
+				domains = cert.Subject.CommonName
+			}
+			expires = cert.NotAfter.Format(time.RFC3339)
+		}
+		return []string{c.ID, c.Name, domains, expires}
+	},
+}
+
+// readPEM reads the certificate, chain and key files, the chain is optional.
+func readPEM(certFile string, chainFile string, keyFile string) (cert string, chain string, key string, err error) {
+	var b []byte
+	if b, err = os.ReadFile(certFile); err != nil {
+		return
+	}
+	cert = string(b)
+	if chainFile != "" {
+		if b, err = os.ReadFile(chainFile); err != nil {
+			return
+		}
+		chain = string(b)
+	}
+	if b, err = os.ReadFile(keyFile); err != nil {
+		return
+	}
+	key = string(b)
+	return
+}
+
+func certUpload(a *app, args []string) error {
+	fs := a.flagSet("rcp cert upload")
+	var projectID, name, certFile, chainFile, keyFile string
+	fs.StringVar(&projectID, "project", "", "project ID, the profile default if empty")
+	fs.StringVar(&name, "name", "", "name (required)")
+	fs.StringVar(&certFile, "cert", "", "PEM certificate file (required)")
+	fs.StringVar(&chainFile, "chain", "", "PEM intermediate certificates file")
+	fs.StringVar(&keyFile, "key", "", "PEM private key file (required)")
+	if _, err := a.parse(fs, args); err != nil {
+		return err
+	}
+	m, err := a.Manager()
+	if err != nil {
+		return err
+	}
+	projectID = defaultID(m, "project", projectID)
+	if err := required(map[string]string{"project": projectID, "name": name, "cert": certFile, "key": keyFile}); err != nil {
+		return err
+	}
+	cert, chain, key, err := readPEM(certFile, chainFile, keyFile)
+	if err != nil {
+		return err
+	}
+	project, err := m.GetProject(projectID)
+	if err != nil {
+		return err
+	}
+	certificate := rustack.NewCertificate(name, cert, chain, key)
+	if err := project.CreateCertificate(&certificate); err != nil {
+		return err
+	}
+	return a.print(certTable, &certificate)
+}
+
+func certRotate(a *app, args []string) error {
+	fs := a.flagSet("rcp cert rotate")
+	var certFile, chainFile, keyFile string
+	fs.StringVar(&certFile, "cert", "", "PEM certificate file (required)")
+	fs.StringVar(&chainFile, "chain", "", "PEM intermediate certificates file")
+	fs.StringVar(&keyFile, "key", "", "PEM private key file (required)")
+	args, err := a.parse(fs, args, "ID")
+	if err != nil {
+		return err
+	}
+	if err := required(map[string]string{"cert": certFile, "key": keyFile}); err != nil {
+		return err
+	}
+	cert, chain, key, err := readPEM(certFile, chainFile, keyFile)
+	if err != nil {
+		return err
+	}
+	m, err := a.Manager()
+	if err != nil {
+		return err
+	}
+	certificate, err := m.GetCertificate(args[0])
+	if err != nil {
+		return err
+	}
+	if err := certificate.Rotate(cert, chain, key); err != nil {
+		return err
+	}
+	return a.print(certTable, certificate)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+// getCommand returns a command that fetches one object by ID and prints it.
+func getCommand[T any](name string, t table, get func(m *rustack.Manager, id string) (T, error)) func(a *app, args []string) error {
+	return func(a *app, args []string) error {
+		args, err := a.parse(a.flagSet("rcp "+name+" get"), args, "ID")
+		if err != nil {
+			return err
+		}
+		m, err := a.Manager()
+		if err != nil {
+			return err
+		}
+		obj, err := get(m, args[0])
+		if err != nil {
+			return err
+		}
+		return a.print(t, obj)
+	}
+}
+
+// deleteCommand returns a command that fetches one object by ID and deletes
+// it.
+func deleteCommand[T interface{ Delete() error }](name string, get func(m *rustack.Manager, id string) (T, error)) func(a *app, args []string) error {
+	return func(a *app, args []string) error {
+		args, err := a.parse(a.flagSet("rcp "+name+" delete"), args, "ID")
+		if err != nil {
+			return err
+		}
+		m, err := a.Manager()
+		if err != nil {
+			return err
+		}
+		obj, err := get(m, args[0])
+		if err != nil {
+			return err
+		}
+		if err := obj.Delete(); err != nil {
+			return err
+		}
+		return a.done("deleted %s %s", name, args[0])
+	}
+}
+
+// listCommand returns a command that lists objects filtered by a flag with
+// the parent ID, e.g. --vdc or --project.
+func listCommand[T any](name string, t table, parent string, list func(m *rustack.Manager, extraArgs ...rustack.Arguments) ([]T, error)) func(a *app, args []string) error {
+	return func(a *app, args []string) error {
+		fs := a.flagSet("rcp " + name + " list")
+		var parentID, tags string
+		fs.StringVar(&parentID, parent, "", parent+" ID, the profile default if empty")
+		fs.StringVar(&tags, "tags", "", "comma separated tags")
+		if _, err := a.parse(fs, args); err != nil {
+			return err
+		}
+		m, err := a.Manager()
+		if err != nil {
+			return err
+		}
+		filter := rustack.Arguments{}
+		if parentID = defaultID(m, parent, parentID); parentID != "" {
+			filter[parent] = parentID
+		}
+		if len(splitList(tags)) > 0 {
+			filter["tags"] = tags
+		}
+		items, err := list(m, filter)
+		if err != nil {
+			return err
+		}
+		objs := make([]interface{}, len(items))
+		for i, item := range items {
+			objs[i] = item
+		}
+		return a.print(t, objs...)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+func init() {
+	resources["disk"] = resource{
+		help: "disks",
+		commands: map[string]command{
+			"list":   {"list disks", listCommand("disk", diskTable, "vdc", (*rustack.Manager).GetDisks)},
+			"get":    {"show a disk", getCommand("disk", diskTable, (*rustack.Manager).GetDisk)},
+			"create": {"create a disk", diskCreate},
+			"resize": {"resize a disk", diskResize},
+			"attach": {"attach a disk to a virtual machine", diskAttach(true)},
+			"detach": {"detach a disk from its virtual machine", diskAttach(false)},
+			"delete": {"delete a disk", deleteCommand("disk", (*rustack.Manager).GetDisk)},
+		},
+	}
+}
+
+var diskTable = table{
+	headers: []string{"ID", "NAME", "SIZE", "STORAGE PROFILE", "VM", "TAGS"},
+	row: func(obj interface{}) []string {
+		disk := obj.(*rustack.Disk)
+		storageProfile, vm := "", ""
+		if disk.StorageProfile != nil {
+			storageProfile = disk.StorageProfile.Name
+		}
+		if disk.Vm != nil {
+			vm = disk.Vm.Name
+		}
+		return []string{disk.ID, disk.Name, strconv.Itoa(disk.Size), storageProfile, vm, tagNames(disk.Tags)}
+	},
+}
+
+func diskCreate(a *app, args []string) error {
+	fs := a.flagSet("rcp disk create")
+	var vdcID, name, storageProfileID string
+	var size int
+	fs.StringVar(&vdcID, "vdc", "", "VDC ID, the profile default if empty")
+	fs.StringVar(&name, "name", "", "name (required)")
+	fs.StringVar(&storageProfileID, "storage-profile", "", "storage profile ID (required)")
+	fs.IntVar(&size, "size", 10, "size in GB")
+	if _, err := a.parse(fs, args); err != nil {
+		return err
+	}
+	m, err := a.Manager()
+	if err != nil {
+		return err
+	}
+	vdcID = defaultID(m, "vdc", vdcID)
+	if err := required(map[string]string{"vdc": vdcID, "name": name, "storage-profile": storageProfileID}); err != nil {
+		return err
+	}
+	vdc, err := m.GetVdc(vdcID)
+	if err != nil {
+		return err
+	}
+	disk := rustack.NewDisk(name, size, &rustack.StorageProfile{ID: storageProfileID})
+	if err := vdc.CreateDisk(&disk); err != nil {
+		return err
+	}
+	return a.print(diskTable, &disk)
+}
+
+func diskResize(a *app, args []string) error {
+	args, err := a.parse(a.flagSet("rcp disk resize"), args, "ID", "SIZE")
+	if err != nil {
+		return err
+	}
+	size, err := strconv.Atoi(args[1])
+	if err != nil {
+		return err
+	}
+	m, err := a.Manager()
+	if err != nil {
+		return err
+	}
+	disk, err := m.GetDisk(args[0])
+	if err != nil {
+		return err
+	}
+	if err := disk.Resize(size); err != nil {
+		return err
+	}
+	return a.print(diskTable, disk)
+}
+
+func diskAttach(attach bool) func(a *app, args []string) error {
+	return func(a *app, args []string) error {
+		name := "rcp disk detach"
+		if attach {
+			name = "rcp disk attach"
+		}
+		args, err := a.parse(a.flagSet(name), args, "DISK_ID", "VM_ID")
+		if err != nil {
+			return err
+		}
+		m, err := a.Manager()
+		if err != nil {
+			return err
+		}
+		disk, err := m.GetDisk(args[0])
+		if err != nil {
+			return err
+		}
+		vm, err := m.GetVm(args[1])
+		if err != nil {
+			return err
+		}
+		if attach {
+			err = vm.AttachDisk(disk)
+		} else {
+			err = vm.DetachDisk(disk)
+		}
+		if err != nil {
+			return err
+		}
+		return a.done("%s: disk %s, vm %s", name[4:], disk.ID, vm.ID)
+	}
+}
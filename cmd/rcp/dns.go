@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+func init() {
+	resources["dns"] = resource{
+		help: "DNS zones and records",
+		commands: map[string]command{
+			"list":    {"list DNS zones", listCommand("dns", dnsTable, "project", (*rustack.Manager).GetDnss)},
+			"get":     {"show a DNS zone", getCommand("dns", dnsTable, (*rustack.Manager).GetDns)},
+			"records": {"list records of a DNS zone", dnsRecords},
+			"delete":  {"delete a DNS zone", deleteCommand("dns", (*rustack.Manager).GetDns)},
+		},
+	}
+}
+
+var dnsTable = table{
+	headers: []string{"ID", "NAME", "TAGS"},
+	row: func(obj interface{}) []string {
+		dns := obj.(*rustack.Dns)
+		return []string{dns.ID, dns.Name, tagNames(dns.Tags)}
+	},
+}
+
+var dnsRecordTable = table{
+	headers: []string{"ID", "HOST", "TYPE", "DATA", "TTL"},
+	row: func(obj interface{}) []string {
+		record := obj.(*rustack.DnsRecord)
+		return []string{record.ID, record.Host, record.Type, record.Data, strconv.Itoa(record.Ttl)}
+	},
+}
+
+func dnsRecords(a *app, args []string) error {
+	args, err := a.parse(a.flagSet("rcp dns records"), args, "ID")
+	if err != nil {
+		return err
+	}
+	m, err := a.Manager()
+	if err != nil {
+		return err
+	}
+	records, err := m.GetDnsRecords(args[0])
+	if err != nil {
+		return err
+	}
+	objs := make([]interface{}, len(records))
+	for i, record := range records {
+		objs[i] = record
+	}
+	return a.print(dnsRecordTable, objs...)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rustack-cloud-platform/rcp-go/drift"
+)
+
+func init() {
+	resources["drift"] = resource{
+		help: "drift detection against recorded snapshots",
+		commands: map[string]command{
+			"record": {"record a snapshot of a project", driftRecord},
+			"check":  {"compare a snapshot with the live state, fails on drift", driftCheck},
+		},
+	}
+}
+
+func driftRecord(a *app, args []string) error {
+	fs := a.flagSet("rcp drift record")
+	project := fs.String("project", "", "project ID")
+	args, err := a.parse(fs, args, "FILE")
+	if err != nil {
+		return err
+	}
+	m, err := a.Manager()
+	if err != nil {
+		return err
+	}
+	*project = defaultID(m, "project", *project)
+	if err := required(map[string]string{"project": *project}); err != nil {
+		return err
+	}
+	snapshot, err := drift.Record(context.Background(), m, *project)
+	if err != nil {
+		return err
+	}
+	if err := snapshot.Save(args[0]); err != nil {
+		return err
+	}
+	return a.done("Recorded %d VMs, %d firewall templates, %d load balancers and %d DNS zones to %s",
+		len(snapshot.Vms), len(snapshot.FirewallTemplates), len(snapshot.LoadBalancers), len(snapshot.DnsZones), args[0])
+}
+
+func driftCheck(a *app, args []string) error {
+	args, err := a.parse(a.flagSet("rcp drift check"), args, "FILE")
+	if err != nil {
+		return err
+	}
+	snapshot, err := drift.Load(args[0])
+	if err != nil {
+		return err
+	}
+	m, err := a.Manager()
+	if err != nil {
+		return err
+	}
+	report, err := drift.Detect(context.Background(), m, snapshot)
+	if err != nil {
+		return err
+	}
+	if a.output == "table" {
+		err = report.Print(a.stdout)
+	} else {
+		err = a.print(table{}, report)
+	}
+	if err != nil {
+		return err
+	}
+	if report.HasDrift() {
+		return fmt.Errorf("%d resources drifted", len(report.Differences))
+	}
+	return nil
+}
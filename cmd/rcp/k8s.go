@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+func init() {
+	resources["k8s"] = resource{
+		help: "Kubernetes clusters",
+		commands: map[string]command{
+			"list":       {"list clusters", listCommand("k8s", k8sTable, "vdc", (*rustack.Manager).ListKubernetes)},
+			"get":        {"show a cluster", getCommand("k8s", k8sTable, (*rustack.Manager).GetKubernetes)},
+			"kubeconfig": {"download the kubeconfig of a cluster", k8sKubeconfig},
+			"delete":     {"delete a cluster", deleteCommand("k8s", (*rustack.Manager).GetKubernetes)},
+		},
+	}
+}
+
+var k8sTable = table{
+	headers: []string{"ID", "NAME", "NODES", "NODE CPU", "NODE RAM", "TAGS"},
+	row: func(obj interface{}) []string {
+		k8s := obj.(*rustack.Kubernetes)
+		return []string{k8s.ID, k8s.Name, strconv.Itoa(k8s.NodesCount), strconv.Itoa(k8s.NodeCpu), strconv.Itoa(k8s.NodeRam), tagNames(k8s.Tags)}
+	},
+}
+
+func k8sKubeconfig(a *app, args []string) error {
+	fs := a.flagSet("rcp k8s kubeconfig")
+	var out string
+	var merge bool
+	fs.StringVar(&out, "out", "", "write the config to a file instead of stdout")
+	fs.BoolVar(&merge, "merge", false, "merge the config into $KUBECONFIG or ~/.kube/config and switch to its context")
+	args, err := a.parse(fs, args, "ID")
+	if err != nil {
+		return err
+	}
+	m, err := a.Manager()
+	if err != nil {
+		return err
+	}
+	k8s, err := m.GetKubernetes(args[0])
+	if err != nil {
+		return err
+	}
+	config, err := k8s.GetKubeconfig(context.Background())
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case merge:
+		parsed, err := rustack.ParseKubeconfig(config)
+		if err != nil {
+			return err
+		}
+		if err := rustack.MergeKubeconfig(out, parsed, true); err != nil {
+			return err
+		}
+		return a.done("merged kubeconfig of %s, current context %s", k8s.Name, parsed.CurrentContext)
+	case out != "":
+		if err := rustack.WriteKubeconfig(out, config); err != nil {
+			return err
+		}
+		return a.done("saved %s", out)
+	}
+	_, err = a.stdout.Write(config)
+	return err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+func init() {
+	resources["lb"] = resource{
+		help: "load balancers",
+		commands: map[string]command{
+			"list":   {"list load balancers", listCommand("lb", lbTable, "vdc", (*rustack.Manager).GetLoadBalancers)},
+			"get":    {"show a load balancer", getCommand("lb", lbTable, (*rustack.Manager).GetLoadBalancer)},
+			"pools":  {"list pools of a load balancer", lbPools},
+			"delete": {"delete a load balancer", deleteCommand("lb", (*rustack.Manager).GetLoadBalancer)},
+		},
+	}
+}
+
+var lbTable = table{
+	headers: []string{"ID", "NAME", "ADDRESS", "FLOATING", "TAGS"},
+	row: func(obj interface{}) []string {
+		lb := obj.(*rustack.LoadBalancer)
+		address, floating := "", ""
+		if lb.Port != nil {
+			address = deref(lb.Port.IpAddress)
+		}
+		if lb.Floating != nil {
+			floating = deref(lb.Floating.IpAddress)
+		}
+		return []string{lb.ID, lb.Name, address, floating, tagNames(lb.Tags)}
+	},
+}
+
+var poolTable = table{
+	headers: []string{"ID", "PORT", "PROTOCOL", "METHOD", "MONITOR", "MEMBERS"},
+	row: func(obj interface{}) []string {
+		pool := obj.(*rustack.LoadBalancerPool)
+		members := make([]string, len(pool.Members))
+		for i, member := range pool.Members {
+			name := ""
+			if member.Vm != nil {
+				name = member.Vm.Name
+			}
+			members[i] = name + ":" + strconv.Itoa(member.Port) + "/" + strconv.Itoa(member.Weight)
+			if member.OperatingStatus != "" {
+				members[i] += " (" + member.OperatingStatus + ")"
+			}
+		}
+		monitor := ""
+		if hm := pool.HealthMonitor; hm != nil {
+			monitor = strings.TrimSpace(hm.Type + " " + hm.HttpPath)
+		}
+		return []string{pool.ID, strconv.Itoa(pool.Port), pool.Protocol, pool.Method, monitor, strings.Join(members, ",")}
+	},
+}
+
+func lbPools(a *app, args []string) error {
+	args, err := a.parse(a.flagSet("rcp lb pools"), args, "ID")
+	if err != nil {
+		return err
+	}
+	m, err := a.Manager()
+	if err != nil {
+		return err
+	}
+	lb, err := m.GetLoadBalancer(args[0])
+	if err != nil {
+		return err
+	}
+	pools, err := lb.GetPools()
+	if err != nil {
+		return err
+	}
+	objs := make([]interface{}, len(pools))
+	for i, pool := range pools {
+		objs[i] = pool
+	}
+	return a.print(poolTable, objs...)
+}
@@ -0,0 +1,171 @@
+// Command rcp is a command line client for the Rustack cloud platform built
+// on the rustack SDK.
+//
+// Usage:
+//
+//	rcp [-o table|json|yaml] [--profile name] <resource> <command> [flags] [args]
+//
+// The connection is configured by a profile in ~/.config/rustack/config.yaml
+// and the RUSTACK_TOKEN, RUSTACK_BASE_URL and RUSTACK_PROFILE variables, see
+// rustack.LoadConfig. When --vdc or --project is omitted the profile default is
+// used.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+type command struct {
+	usage string
+	run   func(a *app, args []string) error
+}
+
+type resource struct {
+	help     string
+	commands map[string]command
+}
+
+var resources = map[string]resource{}
+
+type app struct {
+	stdout  io.Writer
+	stderr  io.Writer
+	output  string
+	profile string
+	token   string
+	baseURL string
+	wait    bool
+	noWait  bool
+	manager *rustack.Manager
+}
+
+func main() {
+	a := &app{stdout: os.Stdout, stderr: os.Stderr, output: "table", wait: true}
+	if err := a.run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "rcp:", err)
+		os.Exit(1)
+	}
+}
+
+func (a *app) run(args []string) error {
+	fs := a.flagSet("rcp")
+	fs.Usage = func() { a.usage(fs) }
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		a.usage(fs)
+		return fmt.Errorf("resource is required")
+	}
+
+	res, ok := resources[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown resource %q", args[0])
+	}
+	if len(args) < 2 {
+		a.resourceUsage(args[0], res)
+		return fmt.Errorf("command is required")
+	}
+	cmd, ok := res.commands[args[1]]
+	if !ok {
+		a.resourceUsage(args[0], res)
+		return fmt.Errorf("unknown command %q for %s", args[1], args[0])
+	}
+	return cmd.run(a, args[2:])
+}
+
+// flagSet returns a flag set with the global flags registered, so that they
+// can be given both before and after the command.
+func (a *app) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.StringVar(&a.output, "o", a.output, "output format: table, json or yaml")
+	fs.StringVar(&a.output, "output", a.output, "output format: table, json or yaml")
+	fs.StringVar(&a.profile, "profile", a.profile, "configuration profile")
+	fs.StringVar(&a.token, "token", a.token, "API token, overrides the profile")
+	fs.StringVar(&a.baseURL, "base-url", a.baseURL, "API base URL, overrides the profile")
+	fs.BoolVar(&a.wait, "wait", a.wait, "wait for started jobs to finish")
+	fs.BoolVar(&a.noWait, "no-wait", a.noWait, "do not wait for started jobs")
+	return fs
+}
+
+// parse parses command flags and checks the number of positional arguments.
+func (a *app) parse(fs *flag.FlagSet, args []string, positional ...string) ([]string, error) {
+	fs.Usage = func() {
+		fmt.Fprintf(a.stderr, "Usage: %s [flags] %s\n", fs.Name(), strings.Join(positional, " "))
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != len(positional) {
+		fs.Usage()
+		return nil, fmt.Errorf("expected %d argument(s), got %d", len(positional), fs.NArg())
+	}
+	return fs.Args(), nil
+}
+
+func (a *app) Manager() (*rustack.Manager, error) {
+	if a.manager != nil {
+		return a.manager, nil
+	}
+	m, err := a.newManager()
+	if err != nil {
+		return nil, err
+	}
+	if a.noWait {
+		a.wait = false
+	}
+	if !a.wait {
+		m = m.WithAsync()
+	}
+	a.manager = m
+	return m, nil
+}
+
+// reportJobs prints the jobs started in --no-wait mode.
+func (a *app) reportJobs() {
+	if a.manager == nil || !a.manager.IsAsync() {
+		return
+	}
+	for _, job := range a.manager.Jobs() {
+		fmt.Fprintf(a.stderr, "started job %s (%s %s)\n", job.ID, job.Method, job.Path)
+	}
+}
+
+func (a *app) usage(fs *flag.FlagSet) {
+	fmt.Fprintln(a.stderr, "Usage: rcp [flags] <resource> <command> [flags] [args]")
+	fmt.Fprintln(a.stderr)
+	fmt.Fprintln(a.stderr, "Resources:")
+	names := make([]string, 0, len(resources))
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(a.stderr, "  %-10s %s\n", name, resources[name].help)
+	}
+	fmt.Fprintln(a.stderr)
+	fmt.Fprintln(a.stderr, "Flags:")
+	fs.PrintDefaults()
+}
+
+func (a *app) resourceUsage(name string, res resource) {
+	fmt.Fprintf(a.stderr, "Usage: rcp %s <command> [flags] [args]\n\nCommands:\n", name)
+	commands := make([]string, 0, len(res.commands))
+	for cmd := range res.commands {
+		commands = append(commands, cmd)
+	}
+	sort.Strings(commands)
+	for _, cmd := range commands {
+		fmt.Fprintf(a.stderr, "  %-12s %s\n", cmd, res.commands[cmd].usage)
+	}
+}
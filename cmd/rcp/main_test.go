@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+type testItem struct {
+	ID   string   `json:"id"`
+	Name string   `json:"vm_name"`
+	Tags []string `json:"tags"`
+}
+
+var testTable = table{
+	headers: []string{"ID", "NAME"},
+	row: func(obj interface{}) []string {
+		item := obj.(*testItem)
+		return []string{item.ID, item.Name}
+	},
+}
+
+func TestPrint(t *testing.T) {
+	one := &testItem{ID: "1", Name: "web", Tags: []string{"prod"}}
+	two := &testItem{ID: "22", Name: "database"}
+
+	tests := []struct {
+		output string
+		objs   []interface{}
+		want   string
+	}{
+		{"table", []interface{}{one, two}, "ID  NAME\n1   web\n22  database\n"},
+		{"table", nil, "ID  NAME\n"},
+		{"json", []interface{}{one}, "{\n  \"id\": \"1\",\n  \"vm_name\": \"web\",\n  \"tags\": [\n    \"prod\"\n  ]\n}\n"},
+		{"json", []interface{}{one, two}, "[\n  {\n    \"id\": \"1\",\n    \"vm_name\": \"web\",\n    \"tags\": [\n      \"prod\"\n    ]\n  },\n  {\n    \"id\": \"22\",\n    \"vm_name\": \"database\",\n    \"tags\": null\n  }\n]\n"},
+		// YAML keys are the JSON names.
+		{"yaml", []interface{}{one}, "id: \"1\"\ntags:\n- prod\nvm_name: web\n"},
+		{"yaml", []interface{}{one, two}, "- id: \"1\"\n  tags:\n  - prod\n  vm_name: web\n- id: \"22\"\n  tags: null\n  vm_name: database\n"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %d", tt.output, len(tt.objs)), func(t *testing.T) {
+			var out bytes.Buffer
+			a := &app{stdout: &out, stderr: &out, output: tt.output}
+			if err := a.print(testTable, tt.objs...); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Fatalf("got\n%s\nwant\n%s", out.String(), tt.want)
+			}
+		})
+	}
+
+	a := &app{stdout: &bytes.Buffer{}, output: "xml"}
+	if err := a.print(testTable, one); err == nil {
+		t.Fatal("expected an unknown format error")
+	}
+}
+
+func TestDone(t *testing.T) {
+	for output, want := range map[string]string{"table": "deleted vm 1\n", "json": "", "yaml": ""} {
+		var out bytes.Buffer
+		a := &app{stdout: &out, output: output}
+		if err := a.done("deleted %s %s", "vm", "1"); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != want {
+			t.Errorf("%s: got %q, want %q", output, out.String(), want)
+		}
+	}
+}
+
+func TestWaitFlags(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("RUSTACK_PROFILE", "")
+
+	tests := []struct {
+		args  []string
+		async bool
+	}{
+		{nil, false},
+		{[]string{"--wait"}, false},
+		{[]string{"--no-wait"}, true},
+		{[]string{"--wait=false"}, true},
+		{[]string{"--wait", "--no-wait"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.args), func(t *testing.T) {
+			a := &app{stdout: &bytes.Buffer{}, stderr: &bytes.Buffer{}, output: "table", wait: true}
+			args := append([]string{"--token", "token", "--base-url", "http://127.0.0.1:1"}, tt.args...)
+			if err := a.flagSet("rcp").Parse(args); err != nil {
+				t.Fatal(err)
+			}
+			m, err := a.Manager()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.IsAsync() != tt.async {
+				t.Fatalf("async %v, want %v", m.IsAsync(), tt.async)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+func init() {
+	resources["network"] = resource{
+		help: "networks",
+		commands: map[string]command{
+			"list":   {"list networks", listCommand("network", networkTable, "vdc", (*rustack.Manager).GetNetworks)},
+			"get":    {"show a network", getCommand("network", networkTable, (*rustack.Manager).GetNetwork)},
+			"create": {"create a network", networkCreate},
+			"delete": {"delete a network", deleteCommand("network", (*rustack.Manager).GetNetwork)},
+		},
+	}
+}
+
+var networkTable = table{
+	headers: []string{"ID", "NAME", "VDC", "SUBNETS", "TAGS"},
+	row: func(obj interface{}) []string {
+		network := obj.(*rustack.Network)
+		subnets := make([]string, len(network.Subnets))
+		for i, subnet := range network.Subnets {
+			subnets[i] = subnet.CIDR
+		}
+		return []string{network.ID, network.Name, network.Vdc.Name, strings.Join(subnets, ","), tagNames(network.Tags)}
+	},
+}
+
+func networkCreate(a *app, args []string) error {
+	fs := a.flagSet("rcp network create")
+	var vdcID, name, cidr, gateway, startIP, endIP string
+	var dhcp bool
+	fs.StringVar(&vdcID, "vdc", "", "VDC ID, the profile default if empty")
+	fs.StringVar(&name, "name", "", "name (required)")
+	fs.StringVar(&cidr, "cidr", "", "subnet CIDR, no subnet is created if empty")
+	fs.StringVar(&gateway, "gateway", "", "subnet gateway")
+	fs.StringVar(&startIP, "start-ip", "", "first address of the DHCP range")
+	fs.StringVar(&endIP, "end-ip", "", "last address of the DHCP range")
+	fs.BoolVar(&dhcp, "dhcp", true, "enable DHCP")
+	if _, err := a.parse(fs, args); err != nil {
+		return err
+	}
+	m, err := a.Manager()
+	if err != nil {
+		return err
+	}
+	vdcID = defaultID(m, "vdc", vdcID)
+	if err := required(map[string]string{"vdc": vdcID, "name": name}); err != nil {
+		return err
+	}
+	vdc, err := m.GetVdc(vdcID)
+	if err != nil {
+		return err
+	}
+	network := rustack.NewNetwork(name)
+	if err := vdc.CreateNetwork(&network); err != nil {
+		return err
+	}
+	if cidr != "" {
+		subnet := rustack.NewSubnet(cidr, gateway, startIP, endIP, dhcp)
+		if err := network.CreateSubnet(&subnet); err != nil {
+			return err
+		}
+		network.Subnets = append(network.Subnets, subnet)
+	}
+	return a.print(networkTable, &network)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+)
+
+// table describes how a list of objects is rendered in table output.
+type table struct {
+	headers []string
+	row     func(obj interface{}) []string
+}
+
+func (a *app) print(t table, objs ...interface{}) error {
+	defer a.reportJobs()
+
+	switch a.output {
+	case "table":
+		w := tabwriter.NewWriter(a.stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, strings.Join(t.headers, "\t"))
+		for _, obj := range objs {
+			fmt.Fprintln(w, strings.Join(t.row(obj), "\t"))
+		}
+		return w.Flush()
+	case "json":
+		var v interface{} = objs
+		if len(objs) == 1 {
+			v = objs[0]
+		}
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(a.stdout, string(b))
+		return err
+	case "yaml":
+		var v interface{} = objs
+		if len(objs) == 1 {
+			v = objs[0]
+		}
+		// Go through JSON so that the keys match the API field names.
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var generic interface{}
+		if err := yaml.Unmarshal(b, &generic); err != nil {
+			return err
+		}
+		b, err = yaml.Marshal(generic)
+		if err != nil {
+			return err
+		}
+		_, err = a.stdout.Write(b)
+		return err
+	}
+	return fmt.Errorf("unknown output format %q", a.output)
+}
+
+// done prints a short confirmation for commands without output objects.
+func (a *app) done(format string, args ...interface{}) error {
+	defer a.reportJobs()
+	if a.output != "table" {
+		return nil
+	}
+	_, err := fmt.Fprintf(a.stdout, format+"\n", args...)
+	return err
+}
+
+func tagNames(tags interface{}) string {
+	b, _ := json.Marshal(tags)
+	var parsed []struct {
+		Name string `json:"name"`
+	}
+	json.Unmarshal(b, &parsed)
+	names := make([]string, len(parsed))
+	for i, tag := range parsed {
+		names[i] = tag.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func sortedStrings(values []string) []string {
+	sort.Strings(values)
+	return values
+}
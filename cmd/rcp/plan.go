@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rustack-cloud-platform/rcp-go/plan"
+)
+
+func init() {
+	resources["plan"] = resource{
+		help: "declarative infrastructure specs",
+		commands: map[string]command{
+			"show":  {"show the changes a spec makes", planShow},
+			"apply": {"apply a spec", planApply},
+		},
+	}
+}
+
+func planShow(a *app, args []string) error {
+	args, err := a.parse(a.flagSet("rcp plan show"), args, "FILE")
+	if err != nil {
+		return err
+	}
+	p, err := a.buildPlan(context.Background(), args[0])
+	if err != nil {
+		return err
+	}
+	return p.Print(a.stdout)
+}
+
+func planApply(a *app, args []string) error {
+	fs := a.flagSet("rcp plan apply")
+	parallelism := fs.Int("parallelism", plan.DefaultParallelism, "number of changes applied at once")
+	keep := fs.Bool("keep-on-failure", false, "keep resources created before a failure")
+	args, err := a.parse(fs, args, "FILE")
+	if err != nil {
+		return err
+	}
+	if a.noWait || !a.wait {
+		return fmt.Errorf("plans wait for every change, --no-wait is not supported")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	p, err := a.buildPlan(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if err := p.Print(a.stdout); err != nil {
+		return err
+	}
+	if p.Empty() {
+		return nil
+	}
+
+	fmt.Fprintln(a.stdout)
+	result, err := p.Apply(ctx, plan.ApplyOptions{
+		Parallelism:   *parallelism,
+		KeepOnFailure: *keep,
+		OnEvent: func(e plan.Event) {
+			switch e.Type {
+			case plan.EventDone:
+				fmt.Fprintf(a.stdout, "%s: %s done\n", e.Change.Address, e.Change.Action)
+			case plan.EventFailed, plan.EventRollbackFailed:
+				fmt.Fprintf(a.stderr, "%s: %v\n", e.Change.Address, e.Err)
+			case plan.EventRollback:
+				fmt.Fprintf(a.stdout, "%s: rolled back\n", e.Change.Address)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return a.done("Applied %d changes.", len(result.Applied))
+}
+
+func (a *app) buildPlan(ctx context.Context, path string) (*plan.Plan, error) {
+	spec, err := plan.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := a.Manager()
+	if err != nil {
+		return nil, err
+	}
+	return plan.Build(ctx, m, spec)
+}
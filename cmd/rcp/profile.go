@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+// newManager builds a manager from the selected profile, the --token and
+// --base-url flags take precedence over the profile and the environment.
+func (a *app) newManager() (*rustack.Manager, error) {
+	config, err := rustack.LoadConfig(a.profile)
+	if err != nil {
+		return nil, err
+	}
+	if a.token != "" {
+		config.Token = a.token
+	}
+	if a.baseURL != "" {
+		config.BaseURL = a.baseURL
+	}
+	return config.NewManager()
+}
+
+// defaultID returns the profile's default ID for a --project or --vdc flag
+// left empty.
+func defaultID(m *rustack.Manager, parent string, id string) string {
+	if id != "" {
+		return id
+	}
+	switch parent {
+	case "project":
+		return m.DefaultProject
+	case "vdc":
+		return m.DefaultVdc
+	}
+	return ""
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+func init() {
+	resources["project"] = resource{
+		help: "projects",
+		commands: map[string]command{
+			"export":   {"export every resource of a project as one document", projectExport},
+			"teardown": {"delete a project with everything in it", projectTeardown},
+		},
+	}
+}
+
+func projectExport(a *app, args []string) error {
+	fs := a.flagSet("rcp project export")
+	project := fs.String("project", "", "project ID")
+	file := fs.String("file", "", "write to FILE instead of stdout")
+	if _, err := a.parse(fs, args); err != nil {
+		return err
+	}
+	m, err := a.Manager()
+	if err != nil {
+		return err
+	}
+	*project = defaultID(m, "project", *project)
+	if err := required(map[string]string{"project": *project}); err != nil {
+		return err
+	}
+	inventory, err := m.ExportProject(*project)
+	if err != nil {
+		return err
+	}
+
+	// A whole project does not fit in a table, it is exported as YAML.
+	var b []byte
+	switch a.output {
+	case "json":
+		b, err = inventory.JSON()
+		b = append(b, '\n')
+	case "yaml", "table":
+		b, err = inventory.YAML()
+	default:
+		return fmt.Errorf("unknown output format %q", a.output)
+	}
+	if err != nil {
+		return err
+	}
+	if *file == "" {
+		_, err = a.stdout.Write(b)
+		return err
+	}
+	if err := os.WriteFile(*file, b, 0644); err != nil {
+		return err
+	}
+	return a.done("Exported project %s to %s", inventory.Project.Name, *file)
+}
+
+var deleteOutcomeTable = table{
+	headers: []string{"KIND", "ID", "NAME", "STATUS", "ERROR"},
+	row: func(obj interface{}) []string {
+		o := obj.(rustack.DeleteOutcome)
+		msg := ""
+		if o.Err != nil {
+			msg = o.Err.Error()
+		}
+		return []string{string(o.Resource.Kind), o.Resource.ID, o.Resource.Name, string(o.Status), msg}
+	},
+}
+
+func projectTeardown(a *app, args []string) error {
+	fs := a.flagSet("rcp project teardown")
+	dryRun := fs.Bool("dry-run", false, "only list what would be deleted")
+	parallelism := fs.Int("parallelism", 4, "number of resources deleted at once")
+	args, err := a.parse(fs, args, "ID")
+	if err != nil {
+		return err
+	}
+	m, err := a.Manager()
+	if err != nil {
+		return err
+	}
+	project, err := m.GetProject(args[0])
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	result, err := project.DeleteRecursive(ctx, rustack.DeleteOptions{DryRun: *dryRun, Parallelism: *parallelism})
+	if result != nil {
+		outcomes := make([]interface{}, len(result.Outcomes))
+		for i, o := range result.Outcomes {
+			outcomes[i] = o
+		}
+		if printErr := a.print(deleteOutcomeTable, outcomes...); printErr != nil && err == nil {
+			err = printErr
+		}
+	}
+	return err
+}
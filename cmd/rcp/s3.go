@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+func init() {
+	resources["s3"] = resource{
+		help: "S3 storages and buckets",
+		commands: map[string]command{
+			"list":     {"list S3 storages", listCommand("s3", s3Table, "project", (*rustack.Manager).GetS3Storages)},
+			"get":      {"show an S3 storage", getCommand("s3", s3Table, (*rustack.Manager).GetS3Storage)},
+			"buckets":  {"list buckets of an S3 storage", s3Buckets},
+			"delete":   {"delete an S3 storage", deleteCommand("s3", (*rustack.Manager).GetS3Storage)},
+			"objects":  {"list objects of a bucket", s3Objects},
+			"upload":   {"upload a file, or stdin, to an object", s3Upload},
+			"download": {"download an object to a file, or stdout", s3Download},
+			"remove":   {"delete an object", s3Remove},
+			"presign":  {"print a temporary URL of an object", s3Presign},
+		},
+	}
+}
+
+var s3Table = table{
+	headers: []string{"ID", "NAME", "ENDPOINT", "BACKEND", "TAGS"},
+	row: func(obj interface{}) []string {
+		s3 := obj.(*rustack.S3Storage)
+		return []string{s3.ID, s3.Name, s3.ClientEndpoint, s3.Backend, tagNames(s3.Tags)}
+	},
+}
+
+var bucketTable = table{
+	headers: []string{"ID", "NAME", "EXTERNAL NAME"},
+	row: func(obj interface{}) []string {
+		bucket := obj.(*rustack.S3StorageBucket)
+		return []string{bucket.ID, bucket.Name, bucket.ExternalName}
+	},
+}
+
+func s3Buckets(a *app, args []string) error {
+	args, err := a.parse(a.flagSet("rcp s3 buckets"), args, "ID")
+	if err != nil {
+		return err
+	}
+	m, err := a.Manager()
+	if err != nil {
+		return err
+	}
+	buckets, err := m.GetBuckets(args[0])
+	if err != nil {
+		return err
+	}
+	objs := make([]interface{}, len(buckets))
+	for i, bucket := range buckets {
+		objs[i] = bucket
+	}
+	return a.print(bucketTable, objs...)
+}
+
+var objectTable = table{
+	headers: []string{"KEY", "SIZE", "MODIFIED"},
+	row: func(obj interface{}) []string {
+		o := obj.(*rustack.S3Object)
+		return []string{o.Key, strconv.FormatInt(o.Size, 10), o.LastModified.Format(time.RFC3339)}
+	},
+}
+
+// objectClient returns the object client of the storage and the external
+// name of the bucket, given by ID, name or external name.
+func (a *app) objectClient(storageID string, bucketName string) (*rustack.S3Client, string, error) {
+	m, err := a.Manager()
+	if err != nil {
+		return nil, "", err
+	}
+	s3, err := m.GetS3Storage(storageID)
+	if err != nil {
+		return nil, "", err
+	}
+	buckets, err := s3.GetBuckets()
+	if err != nil {
+		return nil, "", err
+	}
+	for _, bucket := range buckets {
+		if bucket.ID == bucketName || bucket.Name == bucketName || bucket.ExternalName == bucketName {
+			return s3.ObjectClient(), bucket.ExternalName, nil
+		}
+	}
+	return nil, "", fmt.Errorf("bucket %q not found in S3 storage %s", bucketName, s3.Name)
+}
+
+func s3Objects(a *app, args []string) error {
+	fs := a.flagSet("rcp s3 objects")
+	prefix := fs.String("prefix", "", "list keys starting with PREFIX only")
+	args, err := a.parse(fs, args, "ID", "BUCKET")
+	if err != nil {
+		return err
+	}
+	client, bucket, err := a.objectClient(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	objects, err := client.ListObjects(context.Background(), bucket, *prefix)
+	if err != nil {
+		return err
+	}
+	objs := make([]interface{}, len(objects))
+	for i := range objects {
+		objs[i] = &objects[i]
+	}
+	return a.print(objectTable, objs...)
+}
+
+func s3Upload(a *app, args []string) error {
+	fs := a.flagSet("rcp s3 upload")
+	var file, contentType string
+	fs.StringVar(&file, "file", "", "file to upload, stdin if empty")
+	fs.StringVar(&contentType, "content-type", "", "content type of the object")
+	args, err := a.parse(fs, args, "ID", "BUCKET", "KEY")
+	if err != nil {
+		return err
+	}
+	client, bucket, err := a.objectClient(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	var body io.Reader = os.Stdin
+	size := int64(-1)
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		body, size = f, info.Size()
+	}
+	opts := rustack.S3PutOptions{ContentType: contentType}
+	if _, err := client.PutObject(context.Background(), bucket, args[2], body, size, opts); err != nil {
+		return err
+	}
+	return a.done("uploaded %s", args[2])
+}
+
+func s3Download(a *app, args []string) error {
+	fs := a.flagSet("rcp s3 download")
+	out := fs.String("out", "", "write the object to a file instead of stdout")
+	args, err := a.parse(fs, args, "ID", "BUCKET", "KEY")
+	if err != nil {
+		return err
+	}
+	client, bucket, err := a.objectClient(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	body, _, err := client.GetObject(context.Background(), bucket, args[2])
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if *out == "" {
+		_, err = io.Copy(a.stdout, body)
+		return err
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return a.done("saved %s", *out)
+}
+
+func s3Remove(a *app, args []string) error {
+	args, err := a.parse(a.flagSet("rcp s3 remove"), args, "ID", "BUCKET", "KEY")
+	if err != nil {
+		return err
+	}
+	client, bucket, err := a.objectClient(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if err := client.DeleteObject(context.Background(), bucket, args[2]); err != nil {
+		return err
+	}
+	return a.done("removed %s", args[2])
+}
+
+func s3Presign(a *app, args []string) error {
+	fs := a.flagSet("rcp s3 presign")
+	expires := fs.Duration("expires", time.Hour, "validity of the URL, at most 168h")
+	put := fs.Bool("put", false, "sign an upload instead of a download")
+	args, err := a.parse(fs, args, "ID", "BUCKET", "KEY")
+	if err != nil {
+		return err
+	}
+	client, bucket, err := a.objectClient(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	presign := client.PresignGetObject
+	if *put {
+		presign = client.PresignPutObject
+	}
+	u, err := presign(bucket, args[2], *expires)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(a.stdout, u)
+	return err
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+func init() {
+	resources["tag"] = resource{
+		help: "search resources by tags",
+		commands: map[string]command{
+			"find": {"list resources carrying all the tags", tagFind},
+		},
+	}
+}
+
+var taggedTable = table{
+	headers: []string{"KIND", "ID", "NAME", "TAGS"},
+	row: func(obj interface{}) []string {
+		r := obj.(rustack.TaggedResource)
+		return []string{string(r.Kind), r.ID, r.Name, strings.Join(r.Tags, ",")}
+	},
+}
+
+func tagFind(a *app, args []string) error {
+	fs := a.flagSet("rcp tag find")
+	tags := fs.String("tags", "", "comma separated tags, all must match")
+	kinds := fs.String("kinds", "", "comma separated kinds, e.g. vm,disk, all when empty")
+	if _, err := a.parse(fs, args); err != nil {
+		return err
+	}
+	if err := required(map[string]string{"tags": *tags}); err != nil {
+		return err
+	}
+	m, err := a.Manager()
+	if err != nil {
+		return err
+	}
+	var resourceKinds []rustack.ResourceKind
+	for _, kind := range splitList(*kinds) {
+		resourceKinds = append(resourceKinds, rustack.ResourceKind(kind))
+	}
+	found, err := m.FindByTags(context.Background(), splitList(*tags), resourceKinds...)
+	if err != nil {
+		return err
+	}
+	objs := make([]interface{}, len(found))
+	for i, r := range found {
+		objs[i] = r
+	}
+	return a.print(taggedTable, objs...)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+func init() {
+	resources["vm"] = resource{
+		help: "virtual machines",
+		commands: map[string]command{
+			"list":      {"list virtual machines", vmList},
+			"get":       {"show a virtual machine", getCommand("vm", vmTable, (*rustack.Manager).GetVm)},
+			"create":    {"create a virtual machine", vmCreate},
+			"power-on":  {"power on a virtual machine", vmState("power-on")},
+			"power-off": {"power off a virtual machine", vmState("power-off")},
+			"reboot":    {"reboot a virtual machine", vmState("reboot")},
+			"console":   {"expose the console of a virtual machine on a local port", vmConsole},
+			"delete":    {"delete a virtual machine", deleteCommand("vm", (*rustack.Manager).GetVm)},
+		},
+	}
+}
+
+var vmTable = table{
+	headers: []string{"ID", "NAME", "CPU", "RAM", "POWER", "VDC", "TAGS"},
+	row: func(obj interface{}) []string {
+		vm := obj.(*rustack.Vm)
+		vdc := ""
+		if vm.Vdc != nil {
+			vdc = vm.Vdc.Name
+		}
+		return []string{vm.ID, vm.Name, strconv.Itoa(vm.Cpu), strconv.FormatFloat(vm.Ram, 'f', -1, 64), strconv.FormatBool(vm.Power), vdc, tagNames(vm.Tags)}
+	},
+}
+
+func vmList(a *app, args []string) error {
+	fs := a.flagSet("rcp vm list")
+	var filter rustack.VmFilter
+	var tags string
+	fs.StringVar(&filter.Vdc, "vdc", "", "VDC ID, the profile default if empty")
+	fs.StringVar(&filter.Name, "name", "", "name")
+	fs.StringVar(&tags, "tags", "", "comma separated tags")
+	fs.StringVar(&filter.Sort, "sort", "", "sort fields")
+	if _, err := a.parse(fs, args); err != nil {
+		return err
+	}
+	filter.Tags = splitList(tags)
+
+	m, err := a.Manager()
+	if err != nil {
+		return err
+	}
+	filter.Vdc = defaultID(m, "vdc", filter.Vdc)
+	filterArgs, err := filter.Arguments()
+	if err != nil {
+		return err
+	}
+	vms, err := m.GetVms(filterArgs)
+	if err != nil {
+		return err
+	}
+	objs := make([]interface{}, len(vms))
+	for i, vm := range vms {
+		objs[i] = vm
+	}
+	return a.print(vmTable, objs...)
+}
+
+func vmCreate(a *app, args []string) error {
+	fs := a.flagSet("rcp vm create")
+	var (
+		vdcID, name, templateID, networkID, storageProfileID, floating, tags string
+		cpu, diskSize                                                        int
+		ram                                                                  float64
+	)
+	fs.StringVar(&vdcID, "vdc", "", "VDC ID, the profile default if empty")
+	fs.StringVar(&name, "name", "", "name (required)")
+	fs.StringVar(&templateID, "template", "", "template ID (required)")
+	fs.StringVar(&networkID, "network", "", "network ID (required)")
+	fs.StringVar(&storageProfileID, "storage-profile", "", "storage profile ID of the root disk (required)")
+	fs.StringVar(&floating, "floating", "", "floating IP, RANDOM_FIP for a new one")
+	fs.StringVar(&tags, "tags", "", "comma separated tags")
+	fs.IntVar(&cpu, "cpu", 1, "number of CPUs")
+	fs.Float64Var(&ram, "ram", 1, "RAM in GB")
+	fs.IntVar(&diskSize, "disk-size", 10, "root disk size in GB")
+	if _, err := a.parse(fs, args); err != nil {
+		return err
+	}
+	m, err := a.Manager()
+	if err != nil {
+		return err
+	}
+	vdcID = defaultID(m, "vdc", vdcID)
+	if err := required(map[string]string{"vdc": vdcID, "name": name, "template": templateID, "network": networkID, "storage-profile": storageProfileID}); err != nil {
+		return err
+	}
+	vdc, err := m.GetVdc(vdcID)
+	if err != nil {
+		return err
+	}
+	template, err := m.GetTemplate(templateID)
+	if err != nil {
+		return err
+	}
+	network, err := m.GetNetwork(networkID)
+	if err != nil {
+		return err
+	}
+
+	port := rustack.NewPort(network, nil, "")
+	port.IpAddress = nil
+	if err := vdc.CreateEmptyPort(&port); err != nil {
+		return err
+	}
+	disk := rustack.NewDisk("Disk 1", diskSize, &rustack.StorageProfile{ID: storageProfileID})
+
+	var floatingIP *string
+	if floating != "" {
+		floatingIP = &floating
+	}
+	vm := rustack.NewVm(name, cpu, ram, template, nil, nil, []*rustack.Port{&port}, []*rustack.Disk{&disk}, floatingIP)
+	for _, tag := range splitList(tags) {
+		vm.Tags = append(vm.Tags, rustack.Tag{Name: tag})
+	}
+	if err := vdc.CreateVm(&vm); err != nil {
+		return err
+	}
+	return a.print(vmTable, &vm)
+}
+
+func vmState(state string) func(a *app, args []string) error {
+	return func(a *app, args []string) error {
+		args, err := a.parse(a.flagSet("rcp vm "+state), args, "ID")
+		if err != nil {
+			return err
+		}
+		m, err := a.Manager()
+		if err != nil {
+			return err
+		}
+		vm, err := m.GetVm(args[0])
+		if err != nil {
+			return err
+		}
+		switch state {
+		case "power-on":
+			err = vm.PowerOn()
+		case "power-off":
+			err = vm.PowerOff()
+		case "reboot":
+			err = vm.Reboot()
+		}
+		if err != nil {
+			return err
+		}
+		return a.print(vmTable, vm)
+	}
+}
+
+func vmConsole(a *app, args []string) error {
+	fs := a.flagSet("rcp vm console")
+	var listen string
+	fs.StringVar(&listen, "listen", "127.0.0.1:5900", "local address for VNC or SPICE clients")
+	args, err := a.parse(fs, args, "ID")
+	if err != nil {
+		return err
+	}
+	m, err := a.Manager()
+	if err != nil {
+		return err
+	}
+	vm, err := m.GetVm(args[0])
+	if err != nil {
+		return err
+	}
+	console, err := vm.GetConsole()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	proxy, err := console.Proxy(ctx, listen)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stderr, "%s console of %s on %s, press Ctrl+C to stop\n", strings.ToUpper(console.Protocol), vm.Name, proxy.Addr())
+	if console.Password != "" {
+		fmt.Fprintf(a.stderr, "password: %s\n", console.Password)
+	}
+	return proxy.Wait()
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func required(flags map[string]string) error {
+	var missing []string
+	for name, value := range flags {
+		if value == "" {
+			missing = append(missing, "--"+name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required flags: %s", strings.Join(sortedStrings(missing), ", "))
+	}
+	return nil
+}
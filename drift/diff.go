@@ -0,0 +1,282 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+type DriftType string
+
+const (
+	// Changed resources exist in both states with different fields.
+	Changed DriftType = "changed"
+	// Missing resources were recorded but no longer exist.
+	Missing DriftType = "missing"
+	// Added resources exist but were not recorded.
+	Added DriftType = "added"
+)
+
+// Report is the result of a drift check.
+type Report struct {
+	Project     string       `json:"project"`
+	RecordedAt  time.Time    `json:"recorded_at"`
+	CheckedAt   time.Time    `json:"checked_at"`
+	Differences []Difference `json:"differences"`
+}
+
+type Difference struct {
+	Type DriftType `json:"type"`
+	// Kind is vm, disk, port, firewall_template, firewall_rule,
+	// load_balancer, pool, dns_zone or dns_record.
+	Kind string `json:"kind"`
+	ID   string `json:"id"`
+	// Path names the resource and its parents, e.g. "vm web-1/disk data".
+	Path string `json:"path"`
+	// Fields lists the changed fields of a Changed resource.
+	Fields []FieldDiff `json:"fields,omitempty"`
+}
+
+type FieldDiff struct {
+	Field    string      `json:"field"`
+	Recorded interface{} `json:"recorded"`
+	Live     interface{} `json:"live"`
+}
+
+// Detect records the live state of the snapshot's project and compares it
+// with the snapshot.
+func Detect(ctx context.Context, m *rustack.Manager, recorded *Snapshot) (*Report, error) {
+	live, err := Record(ctx, m, recorded.Project)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(recorded, live), nil
+}
+
+// Diff compares two snapshots of the same project. Resources are matched by
+// ID, so a resource deleted and recreated with the same name is reported as
+// missing and added.
+func Diff(recorded *Snapshot, live *Snapshot) *Report {
+	r := &Report{
+		Project:     recorded.Project,
+		RecordedAt:  recorded.RecordedAt,
+		CheckedAt:   live.RecordedAt,
+		Differences: []Difference{},
+	}
+
+	match(r, "", "vm", recorded.Vms, live.Vms,
+		func(v Vm) (string, string) { return v.ID, v.Name },
+		func(path string, old Vm, new Vm) []FieldDiff {
+			var f fieldDiffs
+			f.add("cpu", old.Cpu, new.Cpu)
+			f.add("ram", old.Ram, new.Ram)
+			f.add("tags", old.Tags, new.Tags)
+			match(r, path, "disk", old.Disks, new.Disks,
+				func(d Disk) (string, string) { return d.ID, d.Name },
+				func(_ string, old Disk, new Disk) []FieldDiff {
+					var f fieldDiffs
+					f.add("name", old.Name, new.Name)
+					f.add("size", old.Size, new.Size)
+					f.add("storage_profile", old.StorageProfile, new.StorageProfile)
+					return f
+				})
+			match(r, path, "port", old.Ports, new.Ports,
+				func(p Port) (string, string) { return p.ID, p.Network },
+				func(_ string, old Port, new Port) []FieldDiff {
+					var f fieldDiffs
+					f.add("network", old.Network, new.Network)
+					f.add("ip_address", old.IpAddress, new.IpAddress)
+					f.add("firewall_templates", old.FirewallTemplates, new.FirewallTemplates)
+					return f
+				})
+			return f
+		})
+
+	match(r, "", "firewall_template", recorded.FirewallTemplates, live.FirewallTemplates,
+		func(t FirewallTemplate) (string, string) { return t.ID, t.Name },
+		func(path string, old FirewallTemplate, new FirewallTemplate) []FieldDiff {
+			var f fieldDiffs
+			f.add("name", old.Name, new.Name)
+			match(r, path, "firewall_rule", old.Rules, new.Rules,
+				func(rule FirewallRule) (string, string) { return rule.ID, rule.Name },
+				func(_ string, old FirewallRule, new FirewallRule) []FieldDiff {
+					var f fieldDiffs
+					f.add("name", old.Name, new.Name)
+					f.add("direction", old.Direction, new.Direction)
+					f.add("protocol", old.Protocol, new.Protocol)
+					f.add("destination_ip", old.DestinationIp, new.DestinationIp)
+					f.add("port_min", old.PortMin, new.PortMin)
+					f.add("port_max", old.PortMax, new.PortMax)
+					return f
+				})
+			return f
+		})
+
+	match(r, "", "load_balancer", recorded.LoadBalancers, live.LoadBalancers,
+		func(lb LoadBalancer) (string, string) { return lb.ID, lb.Name },
+		func(path string, old LoadBalancer, new LoadBalancer) []FieldDiff {
+			var f fieldDiffs
+			f.add("name", old.Name, new.Name)
+			match(r, path, "pool", old.Pools, new.Pools,
+				func(p Pool) (string, string) { return p.ID, fmt.Sprint(p.Port) },
+				func(_ string, old Pool, new Pool) []FieldDiff {
+					var f fieldDiffs
+					f.add("port", old.Port, new.Port)
+					f.add("protocol", old.Protocol, new.Protocol)
+					f.add("certificate", old.Certificate, new.Certificate)
+					f.add("method", old.Method, new.Method)
+					f.add("connlimit", old.Connlimit, new.Connlimit)
+					f.add("session_persistence", old.SessionPersistence, new.SessionPersistence)
+					f.add("members", old.Members, new.Members)
+					f.add("health_monitor", old.HealthMonitor, new.HealthMonitor)
+					return f
+				})
+			return f
+		})
+
+	match(r, "", "dns_zone", recorded.DnsZones, live.DnsZones,
+		func(z DnsZone) (string, string) { return z.ID, z.Name },
+		func(path string, old DnsZone, new DnsZone) []FieldDiff {
+			match(r, path, "dns_record", old.Records, new.Records,
+				func(rec DnsRecord) (string, string) { return rec.ID, rec.Type + " " + rec.Host },
+				func(_ string, old DnsRecord, new DnsRecord) []FieldDiff {
+					var f fieldDiffs
+					f.add("type", old.Type, new.Type)
+					f.add("host", old.Host, new.Host)
+					f.add("data", old.Data, new.Data)
+					f.add("ttl", old.Ttl, new.Ttl)
+					f.add("priority", old.Priority, new.Priority)
+					f.add("weight", old.Weight, new.Weight)
+					f.add("port", old.Port, new.Port)
+					return f
+				})
+			return nil
+		})
+
+	return r
+}
+
+// match reports the recorded items missing from live, the live items not
+// recorded and the changed fields of the others. Nested resources are
+// compared by the compare callback, which reports them before the parent.
+func match[T any](r *Report, parent string, kind string, recorded []T, live []T, key func(T) (string, string), compare func(path string, old T, new T) []FieldDiff) {
+	liveByID := make(map[string]T, len(live))
+	for _, item := range live {
+		id, _ := key(item)
+		liveByID[id] = item
+	}
+	recordedIDs := make(map[string]bool, len(recorded))
+
+	for _, old := range recorded {
+		id, name := key(old)
+		recordedIDs[id] = true
+		path := resourcePath(parent, kind, name)
+		new, ok := liveByID[id]
+		if !ok {
+			r.Differences = append(r.Differences, Difference{Type: Missing, Kind: kind, ID: id, Path: path})
+			continue
+		}
+		// Nested differences are appended by compare, keep the parent first.
+		at := len(r.Differences)
+		if fields := compare(path, old, new); len(fields) > 0 {
+			d := Difference{Type: Changed, Kind: kind, ID: id, Path: path, Fields: fields}
+			r.Differences = append(r.Differences[:at], append([]Difference{d}, r.Differences[at:]...)...)
+		}
+	}
+	for _, new := range live {
+		id, name := key(new)
+		if !recordedIDs[id] {
+			r.Differences = append(r.Differences, Difference{Type: Added, Kind: kind, ID: id, Path: resourcePath(parent, kind, name)})
+		}
+	}
+}
+
+func resourcePath(parent string, kind string, name string) string {
+	p := kind + " " + name
+	if parent == "" {
+		return p
+	}
+	return parent + "/" + p
+}
+
+type fieldDiffs []FieldDiff
+
+func (f *fieldDiffs) add(field string, recorded interface{}, live interface{}) {
+	if !reflect.DeepEqual(normalize(recorded), normalize(live)) {
+		*f = append(*f, FieldDiff{Field: field, Recorded: recorded, Live: live})
+	}
+}
+
+// normalize makes nil and empty lists equal, as they are after a round trip
+// through JSON.
+func normalize(value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Slice && v.Len() == 0 {
+		return nil
+	}
+	return value
+}
+
+// HasDrift reports whether any difference was found.
+func (r *Report) HasDrift() bool {
+	return len(r.Differences) > 0
+}
+
+// Print writes the report in a human readable form, one line per resource
+// followed by its changed fields.
+func (r *Report) Print(w io.Writer) error {
+	var b strings.Builder
+	if !r.HasDrift() {
+		fmt.Fprintf(&b, "No drift since %s.\n", r.RecordedAt.Format(time.RFC3339))
+	}
+	for _, d := range r.Differences {
+		fmt.Fprintf(&b, "%s %s (%s)\n", d.Type, d.Path, d.ID)
+		for _, f := range d.Fields {
+			fmt.Fprintf(&b, "    %s: %s -> %s\n", f.Field, formatValue(f.Recorded), formatValue(f.Live))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case *int:
+		if v == nil {
+			return "(none)"
+		}
+		return fmt.Sprint(*v)
+	case string:
+		if v == "" {
+			return `""`
+		}
+	case []PoolMember:
+		members := make([]string, len(v))
+		for i, m := range v {
+			members[i] = memberKey(m)
+		}
+		return "[" + strings.Join(members, ", ") + "]"
+	case *HealthMonitor:
+		if v == nil {
+			return "(none)"
+		}
+		s := fmt.Sprintf("%s every %ds, timeout %ds, %d retries", v.Type, v.Interval, v.Timeout, v.MaxRetries)
+		if v.HttpPath != "" {
+			s += ", path " + v.HttpPath
+		}
+		if v.ExpectedCodes != "" {
+			s += ", expecting " + v.ExpectedCodes
+		}
+		return s
+	}
+	return fmt.Sprint(value)
+}
+
+func memberKey(m PoolMember) string {
+	return fmt.Sprintf("%s:%d/%d", m.Vm, m.Port, m.Weight)
+}
@@ -0,0 +1,150 @@
+package drift
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	recorded := &Snapshot{
+		Project: "project",
+		Vms: []Vm{{
+			ID: "vm", Name: "web-1", Cpu: 1, Ram: 1,
+			Disks: []Disk{{ID: "root", Name: "root", Size: 10}, {ID: "data", Name: "data", Size: 20}},
+		}},
+		FirewallTemplates: []FirewallTemplate{{ID: "fw", Name: "default"}},
+	}
+	live := &Snapshot{
+		Project: "project",
+		Vms: []Vm{{
+			ID: "vm", Name: "web-1", Cpu: 2, Ram: 1, Tags: []string{},
+			Disks: []Disk{{ID: "root", Name: "root", Size: 10}, {ID: "logs", Name: "logs", Size: 5}},
+		}},
+		DnsZones: []DnsZone{{ID: "zone", Name: "example.com."}},
+	}
+
+	r := Diff(recorded, live)
+	want := []Difference{
+		{Type: Changed, Kind: "vm", ID: "vm", Path: "vm web-1", Fields: []FieldDiff{{Field: "cpu", Recorded: 1, Live: 2}}},
+		{Type: Missing, Kind: "disk", ID: "data", Path: "vm web-1/disk data"},
+		{Type: Added, Kind: "disk", ID: "logs", Path: "vm web-1/disk logs"},
+		{Type: Missing, Kind: "firewall_template", ID: "fw", Path: "firewall_template default"},
+		{Type: Added, Kind: "dns_zone", ID: "zone", Path: "dns_zone example.com."},
+	}
+	if !reflect.DeepEqual(r.Differences, want) {
+		t.Fatalf("got %+v", r.Differences)
+	}
+
+	if r := Diff(recorded, recorded); r.HasDrift() {
+		t.Fatalf("got %+v", r.Differences)
+	}
+}
+
+func TestReportPrint(t *testing.T) {
+	recordedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name   string
+		report Report
+		want   string
+	}{
+		{
+			name:   "no drift",
+			report: Report{RecordedAt: recordedAt},
+			want:   "No drift since 2024-01-02T03:04:05Z.\n",
+		},
+		{
+			name: "changed",
+			report: Report{RecordedAt: recordedAt, Differences: []Difference{{
+				Type: Changed, Kind: "pool", ID: "pool", Path: "load_balancer web/pool 80",
+				Fields: []FieldDiff{
+					{Field: "method", Recorded: "ROUND_ROBIN", Live: ""},
+					{Field: "members", Recorded: []PoolMember{{Vm: "vm", Port: 80, Weight: 1}}, Live: []PoolMember{}},
+				},
+			}}},
+			want: "changed load_balancer web/pool 80 (pool)\n" +
+				"    method: ROUND_ROBIN -> \"\"\n" +
+				"    members: [vm:80/1] -> []\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := tt.report.Print(&b); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tt.want {
+				t.Fatalf("got %q, want %q", b.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffPoolCertificate(t *testing.T) {
+	snapshot := func(certificate string) *Snapshot {
+		return &Snapshot{LoadBalancers: []LoadBalancer{{
+			ID: "lb", Name: "web",
+			Pools: []Pool{{ID: "pool", Port: 443, Protocol: "HTTPS", Certificate: certificate}},
+		}}}
+	}
+
+	r := Diff(snapshot("cert-1"), snapshot("cert-2"))
+	want := []Difference{{
+		Type: Changed, Kind: "pool", ID: "pool", Path: "load_balancer web/pool 443",
+		Fields: []FieldDiff{{Field: "certificate", Recorded: "cert-1", Live: "cert-2"}},
+	}}
+	if !reflect.DeepEqual(r.Differences, want) {
+		t.Fatalf("got %+v", r.Differences)
+	}
+
+	if r := Diff(snapshot("cert-1"), snapshot("cert-1")); len(r.Differences) != 0 {
+		t.Fatalf("got %+v", r.Differences)
+	}
+}
+
+func TestDiffPoolHealthMonitor(t *testing.T) {
+	snapshot := func(hm *HealthMonitor) *Snapshot {
+		return &Snapshot{LoadBalancers: []LoadBalancer{{
+			ID: "lb", Name: "web",
+			Pools: []Pool{{ID: "pool", Port: 80, Protocol: "HTTP", HealthMonitor: hm}},
+		}}}
+	}
+	monitor := func(codes string) *HealthMonitor {
+		return &HealthMonitor{Type: "HTTP", Interval: 10, Timeout: 5, MaxRetries: 3, HttpPath: "/health", ExpectedCodes: codes}
+	}
+
+	// Snapshots taken before monitors were recorded have none.
+	var old Snapshot
+	if err := json.Unmarshal([]byte(`{"load_balancers": [{"id": "lb", "name": "web", "pools": [{"id": "pool", "port": 80, "protocol": "HTTP"}]}]}`), &old); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		recorded *Snapshot
+		live     *Snapshot
+		want     string
+	}{
+		{"unchanged", snapshot(monitor("200")), snapshot(monitor("200")), ""},
+		{"added", &old, snapshot(monitor("200")), "(none) -> HTTP every 10s, timeout 5s, 3 retries, path /health, expecting 200"},
+		{"changed", snapshot(monitor("200")), snapshot(monitor("200-204")), "expecting 200 -> HTTP every 10s, timeout 5s, 3 retries, path /health, expecting 200-204"},
+		{"removed", snapshot(monitor("200")), snapshot(nil), "expecting 200 -> (none)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Diff(tt.recorded, tt.live)
+			var b strings.Builder
+			r.Print(&b)
+			if tt.want == "" {
+				if len(r.Differences) != 0 {
+					t.Fatalf("got %s", b.String())
+				}
+				return
+			}
+			if len(r.Differences) != 1 || r.Differences[0].Fields[0].Field != "health_monitor" || !strings.Contains(b.String(), tt.want) {
+				t.Fatalf("got %s", b.String())
+			}
+		})
+	}
+}
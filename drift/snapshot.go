@@ -0,0 +1,333 @@
+// Package drift detects changes made to resources outside of automation.
+//
+// Record takes a snapshot of the resources of a project, typically right
+// after a deployment. Detect later compares the snapshot with the live API
+// and reports what was changed, removed or added since:
+//
+//	snapshot, err := drift.Record(ctx, manager, projectID)
+//	err = snapshot.Save("prod.json")
+//	...
+//	snapshot, err := drift.Load("prod.json")
+//	report, err := drift.Detect(ctx, manager, snapshot)
+//	if report.HasDrift() {
+//		report.Print(os.Stdout)
+//	}
+//
+// Nothing is modified, drift only reads from the API.
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+// Snapshot is the recorded state of the resources of a project. Resources
+// are identified by ID, names are kept for reports.
+type Snapshot struct {
+	Project           string             `json:"project"`
+	RecordedAt        time.Time          `json:"recorded_at"`
+	Vms               []Vm               `json:"vms"`
+	FirewallTemplates []FirewallTemplate `json:"firewall_templates"`
+	LoadBalancers     []LoadBalancer     `json:"load_balancers"`
+	DnsZones          []DnsZone          `json:"dns_zones"`
+}
+
+type Vm struct {
+	ID    string   `json:"id"`
+	Name  string   `json:"name"`
+	Vdc   string   `json:"vdc"`
+	Cpu   int      `json:"cpu"`
+	Ram   float64  `json:"ram"`
+	Disks []Disk   `json:"disks"`
+	Ports []Port   `json:"ports"`
+	Tags  []string `json:"tags"`
+}
+
+type Disk struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Size           int    `json:"size"`
+	StorageProfile string `json:"storage_profile"`
+}
+
+type Port struct {
+	ID                string   `json:"id"`
+	Network           string   `json:"network"`
+	IpAddress         string   `json:"ip_address"`
+	FirewallTemplates []string `json:"firewall_templates"`
+}
+
+type FirewallTemplate struct {
+	ID    string         `json:"id"`
+	Name  string         `json:"name"`
+	Rules []FirewallRule `json:"rules"`
+}
+
+type FirewallRule struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Direction     string `json:"direction"`
+	Protocol      string `json:"protocol"`
+	DestinationIp string `json:"destination_ip"`
+	PortMin       *int   `json:"port_min"`
+	PortMax       *int   `json:"port_max"`
+}
+
+type LoadBalancer struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Vdc   string `json:"vdc"`
+	Pools []Pool `json:"pools"`
+}
+
+type Pool struct {
+	ID                 string       `json:"id"`
+	Port               int          `json:"port"`
+	Protocol           string       `json:"protocol"`
+	Certificate        string       `json:"certificate,omitempty"`
+	Method             string       `json:"method"`
+	Connlimit          int          `json:"connlimit"`
+	SessionPersistence string       `json:"session_persistence"`
+	Members            []PoolMember `json:"members"`
+	// HealthMonitor is nil in snapshots taken before monitors were
+	// recorded, or when the pool has none.
+	HealthMonitor *HealthMonitor `json:"health_monitor"`
+}
+
+type HealthMonitor struct {
+	Type          string `json:"type"`
+	Interval      int    `json:"interval"`
+	Timeout       int    `json:"timeout"`
+	MaxRetries    int    `json:"max_retries"`
+	HttpPath      string `json:"http_path,omitempty"`
+	ExpectedCodes string `json:"expected_codes,omitempty"`
+}
+
+type PoolMember struct {
+	// Vm is the ID of the member VM.
+	Vm     string `json:"vm"`
+	Port   int    `json:"port"`
+	Weight int    `json:"weight"`
+}
+
+type DnsZone struct {
+	ID      string      `json:"id"`
+	Name    string      `json:"name"`
+	Records []DnsRecord `json:"records"`
+}
+
+type DnsRecord struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Host     string `json:"host"`
+	Data     string `json:"data"`
+	Ttl      int    `json:"ttl"`
+	Priority int    `json:"priority"`
+	Weight   int    `json:"weight"`
+	Port     int    `json:"port"`
+}
+
+// Record reads the current state of the VMs, firewall templates, load
+// balancers and DNS zones of a project.
+func Record(ctx context.Context, m *rustack.Manager, projectID string) (*Snapshot, error) {
+	project, err := m.GetProject(projectID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot get project %s", projectID)
+	}
+	s := &Snapshot{Project: project.ID, RecordedAt: time.Now().UTC()}
+
+	vdcs, err := m.GetVdcs(rustack.Arguments{"project": project.ID})
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot list vdcs")
+	}
+	firewalls := map[string]bool{}
+	for _, vdc := range vdcs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := s.recordVdc(m, vdc, firewalls); err != nil {
+			return nil, errors.Wrapf(err, "Cannot record vdc %s", vdc.Name)
+		}
+	}
+
+	zones, err := project.GetDnss()
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot list dns zones")
+	}
+	for _, zone := range zones {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		records, err := zone.GetDnsRecords()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Cannot list records of dns zone %s", zone.Name)
+		}
+		z := DnsZone{ID: zone.ID, Name: zone.Name, Records: make([]DnsRecord, 0, len(records))}
+		for _, r := range records {
+			z.Records = append(z.Records, DnsRecord{
+				ID: r.ID, Type: r.Type, Host: r.Host, Data: r.Data,
+				Ttl: r.Ttl, Priority: r.Priority, Weight: r.Weight, Port: r.Port,
+			})
+		}
+		sortByID(z.Records, func(r DnsRecord) string { return r.ID })
+		s.DnsZones = append(s.DnsZones, z)
+	}
+
+	s.sort()
+	return s, nil
+}
+
+func (s *Snapshot) recordVdc(m *rustack.Manager, vdc *rustack.Vdc, firewalls map[string]bool) error {
+	vms, err := vdc.GetVms()
+	if err != nil {
+		return err
+	}
+	for _, vm := range vms {
+		v := Vm{ID: vm.ID, Name: vm.Name, Vdc: vdc.ID, Cpu: vm.Cpu, Ram: vm.Ram, Tags: tagNames(vm.Tags)}
+		v.Disks = make([]Disk, 0, len(vm.Disks))
+		for _, disk := range vm.Disks {
+			d := Disk{ID: disk.ID, Name: disk.Name, Size: disk.Size}
+			if disk.StorageProfile != nil {
+				d.StorageProfile = disk.StorageProfile.Name
+			}
+			v.Disks = append(v.Disks, d)
+		}
+		v.Ports = make([]Port, 0, len(vm.Ports))
+		for _, port := range vm.Ports {
+			p := Port{ID: port.ID, FirewallTemplates: []string{}}
+			if port.Network != nil {
+				p.Network = port.Network.Name
+			}
+			if port.IpAddress != nil {
+				p.IpAddress = *port.IpAddress
+			}
+			for _, fw := range port.FirewallTemplates {
+				p.FirewallTemplates = append(p.FirewallTemplates, fw.Name)
+			}
+			sort.Strings(p.FirewallTemplates)
+			v.Ports = append(v.Ports, p)
+		}
+		sortByID(v.Disks, func(d Disk) string { return d.ID })
+		sortByID(v.Ports, func(p Port) string { return p.ID })
+		s.Vms = append(s.Vms, v)
+	}
+
+	templates, err := vdc.GetFirewallTemplates()
+	if err != nil {
+		return err
+	}
+	for _, fw := range templates {
+		// Shared templates are listed in every VDC.
+		if firewalls[fw.ID] {
+			continue
+		}
+		firewalls[fw.ID] = true
+		rules, err := m.GetFirewallRules(fw.ID)
+		if err != nil {
+			return err
+		}
+		t := FirewallTemplate{ID: fw.ID, Name: fw.Name, Rules: make([]FirewallRule, 0, len(rules))}
+		for _, r := range rules {
+			t.Rules = append(t.Rules, FirewallRule{
+				ID: r.ID, Name: r.Name, Direction: r.Direction, Protocol: r.Protocol,
+				DestinationIp: r.DestinationIp, PortMin: r.DstPortRangeMin, PortMax: r.DstPortRangeMax,
+			})
+		}
+		sortByID(t.Rules, func(r FirewallRule) string { return r.ID })
+		s.FirewallTemplates = append(s.FirewallTemplates, t)
+	}
+
+	lbs, err := vdc.GetLoadBalancers()
+	if err != nil {
+		return err
+	}
+	for _, lb := range lbs {
+		pools, err := lb.GetPools()
+		if err != nil {
+			return err
+		}
+		l := LoadBalancer{ID: lb.ID, Name: lb.Name, Vdc: vdc.ID, Pools: make([]Pool, 0, len(pools))}
+		for _, pool := range pools {
+			p := Pool{
+				ID: pool.ID, Port: pool.Port, Protocol: pool.Protocol, Method: pool.Method,
+				Connlimit: pool.Connlimit, Members: make([]PoolMember, 0, len(pool.Members)),
+			}
+			if pool.Certificate != nil {
+				p.Certificate = pool.Certificate.ID
+			}
+			if pool.SessionPersistence != nil {
+				p.SessionPersistence = *pool.SessionPersistence
+			}
+			if hm := pool.HealthMonitor; hm != nil {
+				p.HealthMonitor = &HealthMonitor{
+					Type: hm.Type, Interval: hm.Interval, Timeout: hm.Timeout, MaxRetries: hm.MaxRetries,
+					HttpPath: hm.HttpPath, ExpectedCodes: hm.ExpectedCodes,
+				}
+			}
+			for _, member := range pool.Members {
+				pm := PoolMember{Port: member.Port, Weight: member.Weight}
+				if member.Vm != nil {
+					pm.Vm = member.Vm.ID
+				}
+				p.Members = append(p.Members, pm)
+			}
+			sort.Slice(p.Members, func(i, j int) bool { return memberKey(p.Members[i]) < memberKey(p.Members[j]) })
+			l.Pools = append(l.Pools, p)
+		}
+		sortByID(l.Pools, func(p Pool) string { return p.ID })
+		s.LoadBalancers = append(s.LoadBalancers, l)
+	}
+	return nil
+}
+
+func (s *Snapshot) sort() {
+	sortByID(s.Vms, func(v Vm) string { return v.ID })
+	sortByID(s.FirewallTemplates, func(f FirewallTemplate) string { return f.ID })
+	sortByID(s.LoadBalancers, func(l LoadBalancer) string { return l.ID })
+	sortByID(s.DnsZones, func(z DnsZone) string { return z.ID })
+}
+
+// Load reads a snapshot saved with Save.
+func Load(path string) (*Snapshot, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot read snapshot %s", path)
+	}
+	var s Snapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, errors.Wrapf(err, "Invalid snapshot %s", path)
+	}
+	return &s, nil
+}
+
+// Save writes the snapshot as indented JSON.
+func (s *Snapshot) Save(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(b, '\n'), 0644); err != nil {
+		return errors.Wrapf(err, "Cannot write snapshot %s", path)
+	}
+	return nil
+}
+
+func tagNames(tags []rustack.Tag) []string {
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortByID[T any](items []T, id func(T) string) {
+	sort.Slice(items, func(i, j int) bool { return id(items[i]) < id(items[j]) })
+}
@@ -0,0 +1,165 @@
+package plan
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const DefaultParallelism = 4
+
+type ApplyOptions struct {
+	// Parallelism is the number of changes applied at once,
+	// DefaultParallelism when zero.
+	Parallelism int
+	// KeepOnFailure disables the rollback of resources created before a
+	// failure.
+	KeepOnFailure bool
+	// OnEvent is called for every change started, finished, failed or
+	// rolled back. Calls come from a single goroutine.
+	OnEvent func(Event)
+}
+
+type EventType string
+
+const (
+	EventStart          EventType = "start"
+	EventDone           EventType = "done"
+	EventFailed         EventType = "failed"
+	EventRollback       EventType = "rollback"
+	EventRollbackFailed EventType = "rollback_failed"
+)
+
+type Event struct {
+	Type   EventType
+	Change *Change
+	Err    error
+}
+
+// Result lists what Apply did, in the order it happened.
+type Result struct {
+	Applied    []*Change
+	Failed     []*Change
+	RolledBack []*Change
+	// Errors holds the error of every failed change and rollback by address.
+	Errors map[string]error
+}
+
+// Apply executes the changes of the plan. Independent changes run in
+// parallel, a change starts once all changes it depends on succeeded.
+//
+// On the first failure, or when ctx is done, no more changes are started.
+// Once running changes finish, the resources created so far are deleted in
+// reverse order, unless KeepOnFailure is set. Updates and deletes are not
+// reverted. A plan can only be applied once.
+func (p *Plan) Apply(ctx context.Context, opts ApplyOptions) (*Result, error) {
+	p.mu.Lock()
+	if p.applied {
+		p.mu.Unlock()
+		return nil, errors.New("Plan was already applied, build a new one")
+	}
+	p.applied = true
+	p.mu.Unlock()
+
+	parallelism := opts.Parallelism
+	if parallelism <= 0 {
+		parallelism = DefaultParallelism
+	}
+	emit := func(t EventType, c *Change, err error) {
+		if opts.OnEvent != nil {
+			opts.OnEvent(Event{Type: t, Change: c, Err: err})
+		}
+	}
+
+	result := &Result{Errors: make(map[string]error)}
+	waiting := make(map[*Change]int, len(p.Changes))
+	dependents := make(map[string][]*Change)
+	var ready []*Change
+	for _, c := range p.Changes {
+		waiting[c] = len(c.DependsOn)
+		for _, dep := range c.DependsOn {
+			dependents[dep] = append(dependents[dep], c)
+		}
+		if len(c.DependsOn) == 0 {
+			ready = append(ready, c)
+		}
+	}
+
+	type outcome struct {
+		change *Change
+		err    error
+	}
+	done := make(chan outcome)
+	running := 0
+	var failure error
+
+	for {
+		for failure == nil && running < parallelism && len(ready) > 0 {
+			if err := ctx.Err(); err != nil {
+				failure = err
+				break
+			}
+			c := ready[0]
+			ready = ready[1:]
+			running++
+			emit(EventStart, c, nil)
+			go func() {
+				done <- outcome{change: c, err: c.run(p.state)}
+			}()
+		}
+		if running == 0 {
+			break
+		}
+
+		out := <-done
+		running--
+		c := out.change
+		if out.err != nil {
+			err := errors.Wrapf(out.err, "Cannot %s %s", c.Action, c.Address)
+			result.Failed = append(result.Failed, c)
+			result.Errors[c.Address] = err
+			emit(EventFailed, c, err)
+			if failure == nil {
+				failure = err
+			}
+			continue
+		}
+		result.Applied = append(result.Applied, c)
+		emit(EventDone, c, nil)
+		for _, next := range dependents[c.Address] {
+			waiting[next]--
+			if waiting[next] == 0 {
+				ready = append(ready, next)
+			}
+		}
+	}
+
+	if failure == nil {
+		return result, nil
+	}
+	if opts.KeepOnFailure {
+		return result, failure
+	}
+
+	var rollbackErrs []string
+	for i := len(result.Applied) - 1; i >= 0; i-- {
+		c := result.Applied[i]
+		if c.Action != Create || c.undo == nil {
+			continue
+		}
+		if err := c.undo(p.state); err != nil {
+			err = errors.Wrapf(err, "Cannot roll back %s", c.Address)
+			result.Errors[c.Address] = err
+			rollbackErrs = append(rollbackErrs, err.Error())
+			emit(EventRollbackFailed, c, err)
+			continue
+		}
+		result.RolledBack = append(result.RolledBack, c)
+		emit(EventRollback, c, nil)
+	}
+	if len(rollbackErrs) > 0 {
+		return result, errors.Errorf("%s\nRollback failed:\n%s", failure, strings.Join(rollbackErrs, "\n"))
+	}
+	return result, failure
+}
@@ -0,0 +1,208 @@
+package plan_test
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rustack-cloud-platform/rcp-go/plan"
+	"github.com/rustack-cloud-platform/rcp-go/rustacktest"
+)
+
+const applySpec = `
+project:
+  name: shop
+vdcs:
+- name: prod
+  hypervisor: VMware
+  networks:
+  - name: a
+    subnets: [{cidr: 10.0.1.0/24}]
+  - name: b
+    subnets: [{cidr: 10.0.2.0/24}]
+  - name: c
+    subnets: [{cidr: 10.0.3.0/24}]
+  firewall_templates:
+  - name: web
+    rules:
+    - {name: http, direction: ingress, protocol: tcp, port_min: 80, port_max: 80}
+`
+
+func buildApplyPlan(t *testing.T) (*rustacktest.Server, *plan.Plan) {
+	t.Helper()
+	s := rustacktest.NewServer()
+	t.Cleanup(s.Close)
+	project := s.Seed("project", map[string]interface{}{"name": "shop"})
+	s.Seed("vdc", map[string]interface{}{"name": "prod", "project": project, "hypervisor": map[string]interface{}{"id": "h", "name": "VMware"}})
+
+	spec, err := plan.Parse([]byte(applySpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := plan.Build(context.Background(), s.Manager(), spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Count(plan.Create); got != 8 {
+		t.Fatalf("plan creates %d resources, want 8:\n%s", got, p)
+	}
+	return s, p
+}
+
+func addresses(changes []*plan.Change) (addrs []string) {
+	for _, c := range changes {
+		addrs = append(addrs, c.Address)
+	}
+	return
+}
+
+func TestApplyOrder(t *testing.T) {
+	s, p := buildApplyPlan(t)
+
+	done := map[string]bool{}
+	running, maxRunning := 0, 0
+	result, err := p.Apply(context.Background(), plan.ApplyOptions{
+		Parallelism: 2,
+		OnEvent: func(e plan.Event) {
+			switch e.Type {
+			case plan.EventStart:
+				for _, dep := range e.Change.DependsOn {
+					if !done[dep] {
+						t.Errorf("%s started before %s", e.Change.Address, dep)
+					}
+				}
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+			case plan.EventDone:
+				done[e.Change.Address] = true
+				running--
+			default:
+				t.Errorf("unexpected %s of %s: %v", e.Type, e.Change.Address, e.Err)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if maxRunning != 2 {
+		t.Fatalf("%d changes ran at once, want 2", maxRunning)
+	}
+	if len(result.Applied) != len(p.Changes) || len(result.Failed) != 0 || len(result.RolledBack) != 0 {
+		t.Fatalf("applied %v, failed %v", addresses(result.Applied), addresses(result.Failed))
+	}
+	if len(s.Objects("network")) != 3 || len(s.Objects("firewall")) != 1 {
+		t.Fatalf("created %d networks and %d firewall templates", len(s.Objects("network")), len(s.Objects("firewall")))
+	}
+
+	if _, err := p.Apply(context.Background(), plan.ApplyOptions{}); err == nil {
+		t.Fatal("plan applied twice")
+	}
+}
+
+func TestApplyRollback(t *testing.T) {
+	s, p := buildApplyPlan(t)
+	var events []string
+	result, err := p.Apply(context.Background(), plan.ApplyOptions{
+		Parallelism: 1,
+		OnEvent: func(e plan.Event) {
+			events = append(events, string(e.Type)+" "+e.Change.Address)
+			// The first subnet fails once the networks and the template
+			// exist.
+			if e.Type == plan.EventStart && e.Change.Kind == "subnet" {
+				s.InjectFault(rustacktest.Fault{Method: http.MethodPost, Path: "v1/network/*", Status: http.StatusBadRequest,
+					Body: map[string]interface{}{"cidr": []string{"Subnet overlaps"}}, Times: 1})
+			}
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "Subnet overlaps") {
+		t.Fatalf("got %v, want the subnet failure", err)
+	}
+
+	applied := []string{"vdc.prod/network.a", "vdc.prod/network.b", "vdc.prod/network.c", "vdc.prod/firewall.web"}
+	if got := addresses(result.Applied); !reflect.DeepEqual(got, applied) {
+		t.Fatalf("applied %v, want %v", got, applied)
+	}
+	if got := addresses(result.Failed); !reflect.DeepEqual(got, []string{"vdc.prod/network.a/subnet.10.0.1.0/24"}) {
+		t.Fatalf("failed %v", got)
+	}
+	// Created resources are deleted in reverse order, nothing else starts.
+	rolledBack := []string{"vdc.prod/firewall.web", "vdc.prod/network.c", "vdc.prod/network.b", "vdc.prod/network.a"}
+	if got := addresses(result.RolledBack); !reflect.DeepEqual(got, rolledBack) {
+		t.Fatalf("rolled back %v, want %v", got, rolledBack)
+	}
+	if got := events[len(events)-5:]; got[0] != "failed vdc.prod/network.a/subnet.10.0.1.0/24" || got[1] != "rollback vdc.prod/firewall.web" {
+		t.Fatalf("events %v", events)
+	}
+	if n, fw := len(s.Objects("network")), len(s.Objects("firewall")); n != 0 || fw != 0 {
+		t.Fatalf("%d networks and %d firewall templates left", n, fw)
+	}
+}
+
+func TestApplyKeepOnFailure(t *testing.T) {
+	s, p := buildApplyPlan(t)
+	s.InjectFault(rustacktest.Fault{Method: http.MethodPost, Path: "v1/firewall", Status: http.StatusBadRequest})
+
+	result, err := p.Apply(context.Background(), plan.ApplyOptions{Parallelism: 1, KeepOnFailure: true})
+	if err == nil {
+		t.Fatal("expected the failure to be reported")
+	}
+	if len(result.RolledBack) != 0 || len(s.Objects("network")) != 3 {
+		t.Fatalf("rolled back %v, %d networks left", addresses(result.RolledBack), len(s.Objects("network")))
+	}
+	if result.Errors["vdc.prod/firewall.web"] == nil {
+		t.Fatalf("errors %v", result.Errors)
+	}
+}
+
+func TestApplyRollbackFailure(t *testing.T) {
+	s, p := buildApplyPlan(t)
+	s.InjectFault(rustacktest.Fault{Method: http.MethodPost, Path: "v1/firewall", Status: http.StatusBadRequest})
+	s.InjectFault(rustacktest.Fault{Method: http.MethodDelete, Path: "v1/network/*", Status: http.StatusBadRequest, Times: 1})
+
+	var failed []string
+	result, err := p.Apply(context.Background(), plan.ApplyOptions{
+		Parallelism: 1,
+		OnEvent: func(e plan.Event) {
+			if e.Type == plan.EventRollbackFailed {
+				failed = append(failed, e.Change.Address)
+			}
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "Rollback failed") {
+		t.Fatalf("got %v, want the rollback failure", err)
+	}
+	// The rollback goes on after a failed delete.
+	if !reflect.DeepEqual(failed, []string{"vdc.prod/network.c"}) || len(result.RolledBack) != 2 {
+		t.Fatalf("rollback failed for %v, rolled back %v", failed, addresses(result.RolledBack))
+	}
+	if len(s.Objects("network")) != 1 {
+		t.Fatalf("%d networks left, want the one that failed to delete", len(s.Objects("network")))
+	}
+}
+
+func TestApplyCanceled(t *testing.T) {
+	s, p := buildApplyPlan(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	result, err := p.Apply(ctx, plan.ApplyOptions{
+		Parallelism: 1,
+		OnEvent: func(e plan.Event) {
+			if e.Type == plan.EventDone && e.Change.Address == "vdc.prod/network.b" {
+				cancel()
+			}
+		},
+	})
+	if err != context.Canceled {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if got := addresses(result.RolledBack); !reflect.DeepEqual(got, []string{"vdc.prod/network.b", "vdc.prod/network.a"}) {
+		t.Fatalf("rolled back %v", got)
+	}
+	if len(s.Objects("network")) != 0 {
+		t.Fatal("networks left after the rollback")
+	}
+}
@@ -0,0 +1,1252 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+// Build fetches the live state of the resources in the spec and returns the
+// changes that make it match the spec. Nothing is modified until the plan is
+// applied.
+func Build(ctx context.Context, m *rustack.Manager, spec *Spec) (*Plan, error) {
+	l, err := fetchLive(ctx, m, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &builder{
+		spec: spec,
+		live: l,
+		plan: &Plan{state: newState(m), index: make(map[string]*Change)},
+	}
+	b.project()
+	for _, vdc := range spec.Vdcs {
+		b.vdc(vdc)
+	}
+	for _, dns := range spec.Dns {
+		b.dns(dns)
+	}
+	if spec.Prune {
+		b.prune()
+	}
+	b.addDeletes()
+	return b.plan, nil
+}
+
+// Deletes run after all creates and updates, children before parents.
+const (
+	rankChild = iota
+	rankInstance
+	rankAttachment
+	rankSubnet
+	rankNetwork
+	rankCount
+)
+
+type builder struct {
+	spec    *Spec
+	live    *live
+	plan    *Plan
+	deletes [rankCount][]*Change
+}
+
+// add appends a change. Dependencies on resources that already exist are
+// dropped, as they are satisfied.
+func (b *builder) add(c *Change, deps ...string) {
+	for _, dep := range deps {
+		if _, ok := b.plan.index[dep]; ok && !contains(c.DependsOn, dep) {
+			c.DependsOn = append(c.DependsOn, dep)
+		}
+	}
+	b.plan.Changes = append(b.plan.Changes, c)
+	b.plan.index[c.Address] = c
+}
+
+func (b *builder) warn(format string, args ...interface{}) {
+	b.plan.Warnings = append(b.plan.Warnings, fmt.Sprintf(format, args...))
+}
+
+func (b *builder) delete(rank int, address string, kind string, run func(s *state) error) {
+	b.deletes[rank] = append(b.deletes[rank], &Change{Address: address, Kind: kind, Action: Delete, run: run})
+}
+
+func (b *builder) addDeletes() {
+	var before []string
+	for _, c := range b.plan.Changes {
+		before = append(before, c.Address)
+	}
+	for _, changes := range b.deletes {
+		sort.Slice(changes, func(i, j int) bool { return changes[i].Address < changes[j].Address })
+		for _, c := range changes {
+			b.add(c, before...)
+		}
+		for _, c := range changes {
+			before = append(before, c.Address)
+		}
+	}
+}
+
+func (b *builder) projectAddress() string {
+	return "project." + b.spec.Project.Name
+}
+
+func (b *builder) project() {
+	spec := b.spec.Project
+	addr := b.projectAddress()
+
+	if project := b.live.project; project != nil {
+		b.plan.state.set(addr, project)
+		var f fields
+		f.addTags(project.Tags, spec.Tags)
+		if len(f) > 0 {
+			b.add(&Change{Address: addr, Kind: "project", Action: Update, Fields: f, run: func(s *state) error {
+				project.Tags = tags(spec.Tags)
+				return project.Update()
+			}})
+		}
+		return
+	}
+
+	b.add(&Change{
+		Address: addr, Kind: "project", Action: Create,
+		Fields: []FieldChange{{Field: "name", New: spec.Name}},
+		run: func(s *state) error {
+			client, err := b.client(s.manager)
+			if err != nil {
+				return err
+			}
+			project := rustack.NewProject(spec.Name)
+			project.Tags = tags(spec.Tags)
+			if err := client.CreateProject(&project); err != nil {
+				return err
+			}
+			s.set(addr, &project)
+			return nil
+		},
+		undo: undoDelete[*rustack.Project](addr),
+	})
+}
+
+func (b *builder) client(m *rustack.Manager) (*rustack.Client, error) {
+	if id := b.spec.Project.Client; id != "" {
+		return m.GetClient(id)
+	}
+	clients, err := m.GetClients()
+	if err != nil {
+		return nil, err
+	}
+	if len(clients) == 0 {
+		return nil, errors.New("No client available to create the project")
+	}
+	return clients[0], nil
+}
+
+func (b *builder) vdc(spec VdcSpec) {
+	addr := "vdc." + spec.Name
+	projectAddr := b.projectAddress()
+
+	lv, ok := b.live.vdcs[spec.Name]
+	if ok {
+		vdc := lv.vdc
+		b.plan.state.set(addr, vdc)
+		if vdc.Hypervisor.ID != spec.Hypervisor && vdc.Hypervisor.Name != spec.Hypervisor {
+			b.warn("%s: hypervisor %s cannot be changed to %s", addr, vdc.Hypervisor.Name, spec.Hypervisor)
+		}
+		var f fields
+		f.addTags(vdc.Tags, spec.Tags)
+		if len(f) > 0 {
+			b.add(&Change{Address: addr, Kind: "vdc", Action: Update, Fields: f, run: func(s *state) error {
+				vdc.Tags = tags(spec.Tags)
+				return vdc.Update()
+			}})
+		}
+	} else {
+		lv = &liveVdc{}
+		b.add(&Change{
+			Address: addr, Kind: "vdc", Action: Create,
+			Fields: []FieldChange{{Field: "hypervisor", New: spec.Hypervisor}},
+			run: func(s *state) error {
+				project, err := lookup[*rustack.Project](s, projectAddr)
+				if err != nil {
+					return err
+				}
+				hypervisors, err := project.GetAvailableHypervisors()
+				if err != nil {
+					return err
+				}
+				var hypervisor *rustack.Hypervisor
+				for _, h := range hypervisors {
+					if h.ID == spec.Hypervisor || h.Name == spec.Hypervisor {
+						hypervisor = h
+					}
+				}
+				if hypervisor == nil {
+					return errors.Errorf("Hypervisor %q is not available in project %s", spec.Hypervisor, project.Name)
+				}
+				vdc := rustack.NewVdc(spec.Name, hypervisor)
+				vdc.Tags = tags(spec.Tags)
+				if err := project.CreateVdc(&vdc); err != nil {
+					return err
+				}
+				s.set(addr, &vdc)
+				return nil
+			},
+			undo: undoDelete[*rustack.Vdc](addr),
+		}, projectAddr)
+	}
+
+	v := &vdcBuilder{builder: b, spec: spec, live: lv, addr: addr}
+	for _, network := range spec.Networks {
+		v.network(network)
+	}
+	for _, fw := range spec.FirewallTemplates {
+		v.firewall(fw)
+	}
+	for _, router := range spec.Routers {
+		v.router(router)
+	}
+	for _, vm := range spec.Vms {
+		v.vm(vm)
+	}
+	for _, disk := range spec.Disks {
+		v.disk(disk)
+	}
+	for _, lb := range spec.LoadBalancers {
+		v.loadBalancer(lb)
+	}
+}
+
+// vdcBuilder adds the changes of the resources in a VDC. Its live state is
+// empty when the VDC is created by the plan.
+type vdcBuilder struct {
+	*builder
+	spec VdcSpec
+	live *liveVdc
+	addr string
+}
+
+func (v *vdcBuilder) networkAddress(name string) string {
+	return address(v.addr, "network."+name)
+}
+
+// networkDeps returns the network and its subnets, which ports on the
+// network need to get an address.
+func (v *vdcBuilder) networkDeps(name string) []string {
+	deps := []string{v.addr, v.networkAddress(name)}
+	for _, network := range v.spec.Networks {
+		if network.Name == name {
+			for _, subnet := range network.Subnets {
+				deps = append(deps, address(v.networkAddress(name), "subnet."+subnet.CIDR))
+			}
+		}
+	}
+	return deps
+}
+
+func (v *vdcBuilder) gateway(network string) string {
+	for _, n := range v.spec.Networks {
+		if n.Name == network && len(n.Subnets) > 0 {
+			return n.Subnets[0].Gateway
+		}
+	}
+	return ""
+}
+
+func (v *vdcBuilder) network(spec NetworkSpec) {
+	addr := v.networkAddress(spec.Name)
+	vdcAddr := v.addr
+
+	network := v.live.networks[spec.Name]
+	if network != nil {
+		v.plan.state.set(addr, network)
+		var f fields
+		if spec.Mtu != nil {
+			f.add("mtu", network.Mtu, spec.Mtu)
+		}
+		f.addTags(network.Tags, spec.Tags)
+		if len(f) > 0 {
+			v.add(&Change{Address: addr, Kind: "network", Action: Update, Fields: f, run: func(s *state) error {
+				if spec.Mtu != nil {
+					network.Mtu = spec.Mtu
+				}
+				if spec.Tags != nil {
+					network.Tags = tags(spec.Tags)
+				}
+				return network.Update()
+			}})
+		}
+	} else {
+		v.add(&Change{
+			Address: addr, Kind: "network", Action: Create,
+			run: func(s *state) error {
+				vdc, err := lookup[*rustack.Vdc](s, vdcAddr)
+				if err != nil {
+					return err
+				}
+				network := rustack.NewNetwork(spec.Name)
+				network.Mtu = spec.Mtu
+				network.Tags = tags(spec.Tags)
+				if err := vdc.CreateNetwork(&network); err != nil {
+					return err
+				}
+				s.set(addr, &network)
+				return nil
+			},
+			undo: undoDelete[*rustack.Network](addr),
+		}, vdcAddr)
+	}
+
+	for _, subnet := range spec.Subnets {
+		v.subnet(addr, v.live.subnets[spec.Name][subnet.CIDR], subnet)
+	}
+}
+
+func (v *vdcBuilder) subnet(networkAddr string, subnet *rustack.Subnet, spec SubnetSpec) {
+	addr := address(networkAddr, "subnet."+spec.CIDR)
+
+	if subnet != nil {
+		v.plan.state.set(addr, subnet)
+		if subnet.Gateway != spec.Gateway || subnet.StartIp != spec.StartIp || subnet.EndIp != spec.EndIp {
+			v.warn("%s: gateway and range cannot be changed without recreating the subnet", addr)
+		}
+		var f fields
+		f.add("dhcp", subnet.IsDHCP, *spec.DHCP)
+		if spec.DnsServers != nil {
+			f.add("dns_servers", dnsServers(subnet.DnsServers), spec.DnsServers)
+		}
+		if len(f) > 0 {
+			v.add(&Change{Address: addr, Kind: "subnet", Action: Update, Fields: f, run: func(s *state) error {
+				subnet.IsDHCP = *spec.DHCP
+				servers := subnet.DnsServers
+				if spec.DnsServers != nil {
+					servers = newDnsServers(spec.DnsServers)
+				}
+				return subnet.UpdateDNSServers(servers)
+			}})
+		}
+		return
+	}
+
+	v.add(&Change{
+		Address: addr, Kind: "subnet", Action: Create,
+		Fields: []FieldChange{{Field: "range", New: spec.StartIp + "-" + spec.EndIp}},
+		run: func(s *state) error {
+			network, err := lookup[*rustack.Network](s, networkAddr)
+			if err != nil {
+				return err
+			}
+			subnet := rustack.NewSubnet(spec.CIDR, spec.Gateway, spec.StartIp, spec.EndIp, *spec.DHCP)
+			if spec.DnsServers != nil {
+				subnet.DnsServers = newDnsServers(spec.DnsServers)
+			}
+			if err := network.CreateSubnet(&subnet); err != nil {
+				return err
+			}
+			s.set(addr, &subnet)
+			return nil
+		},
+		undo: undoDelete[*rustack.Subnet](addr),
+	}, networkAddr)
+}
+
+func (v *vdcBuilder) firewall(spec FirewallTemplateSpec) {
+	addr := address(v.addr, "firewall."+spec.Name)
+	vdcAddr := v.addr
+
+	fw := v.live.firewalls[spec.Name]
+	if fw != nil {
+		v.plan.state.set(addr, fw)
+		var f fields
+		f.addTags(fw.Tags, spec.Tags)
+		if len(f) > 0 {
+			v.add(&Change{Address: addr, Kind: "firewall_template", Action: Update, Fields: f, run: func(s *state) error {
+				fw.Tags = tags(spec.Tags)
+				return fw.UpdateFirewallTemplate()
+			}})
+		}
+	} else {
+		v.add(&Change{
+			Address: addr, Kind: "firewall_template", Action: Create,
+			run: func(s *state) error {
+				vdc, err := lookup[*rustack.Vdc](s, vdcAddr)
+				if err != nil {
+					return err
+				}
+				fw := rustack.NewFirewallTemplate(spec.Name)
+				fw.Tags = tags(spec.Tags)
+				if err := vdc.CreateFirewallTemplate(&fw); err != nil {
+					return err
+				}
+				s.set(addr, &fw)
+				return nil
+			},
+			undo: undoDelete[*rustack.FirewallTemplate](addr),
+		}, vdcAddr)
+	}
+
+	for _, rule := range spec.Rules {
+		v.firewallRule(addr, v.live.rules[spec.Name][rule.Name], rule)
+	}
+}
+
+func (v *vdcBuilder) firewallRule(fwAddr string, rule *rustack.FirewallRule, spec FirewallRuleSpec) {
+	addr := address(fwAddr, "rule."+spec.Name)
+	hasPorts := spec.Protocol == "tcp" || spec.Protocol == "udp"
+
+	if rule != nil {
+		var f fields
+		f.add("direction", rule.Direction, spec.Direction)
+		f.add("protocol", rule.Protocol, spec.Protocol)
+		f.add("destination_ip", rule.DestinationIp, spec.DestinationIp)
+		if hasPorts {
+			f.add("port_min", rule.DstPortRangeMin, &spec.PortMin)
+			f.add("port_max", rule.DstPortRangeMax, &spec.PortMax)
+		}
+		if len(f) > 0 {
+			v.add(&Change{Address: addr, Kind: "firewall_rule", Action: Update, Fields: f, run: func(s *state) error {
+				rule.Direction = spec.Direction
+				rule.Protocol = spec.Protocol
+				rule.DestinationIp = spec.DestinationIp
+				rule.DstPortRangeMin, rule.DstPortRangeMax = nil, nil
+				if hasPorts {
+					rule.DstPortRangeMin, rule.DstPortRangeMax = &spec.PortMin, &spec.PortMax
+				}
+				return rule.Update()
+			}})
+		}
+		return
+	}
+
+	created := []FieldChange{{Field: "direction", New: spec.Direction}, {Field: "protocol", New: spec.Protocol}}
+	if hasPorts {
+		created = append(created, FieldChange{Field: "ports", New: fmt.Sprintf("%d-%d", spec.PortMin, spec.PortMax)})
+	}
+	v.add(&Change{
+		Address: addr, Kind: "firewall_rule", Action: Create, Fields: created,
+		run: func(s *state) error {
+			fw, err := lookup[*rustack.FirewallTemplate](s, fwAddr)
+			if err != nil {
+				return err
+			}
+			rule := rustack.NewFirewallRule(spec.Name, spec.DestinationIp, spec.Direction, spec.Protocol, spec.PortMax, spec.PortMin)
+			if err := fw.CreateFirewallRule(&rule); err != nil {
+				return err
+			}
+			s.set(addr, &rule)
+			return nil
+		},
+		undo: undoDelete[*rustack.FirewallRule](addr),
+	}, fwAddr)
+}
+
+func (v *vdcBuilder) router(spec RouterSpec) {
+	addr := address(v.addr, "router."+spec.Name)
+	vdcAddr := v.addr
+	deps := []string{vdcAddr}
+	for _, network := range spec.Networks {
+		deps = append(deps, v.networkDeps(network)...)
+	}
+
+	router := v.live.routers[spec.Name]
+	if router != nil {
+		v.plan.state.set(addr, router)
+		connected := map[string]bool{}
+		for _, port := range router.Ports {
+			if port.Network != nil {
+				connected[port.Network.Name] = true
+			}
+		}
+		var missing []string
+		for _, network := range spec.Networks {
+			if !connected[network] {
+				missing = append(missing, network)
+			}
+			delete(connected, network)
+		}
+		for network := range connected {
+			v.warn("%s: network %s is not disconnected by plans", addr, network)
+		}
+
+		var f fields
+		if len(missing) > 0 {
+			f = append(f, FieldChange{Field: "networks", Old: nil, New: missing})
+		}
+		f.addTags(router.Tags, spec.Tags)
+		if len(f) > 0 {
+			v.add(&Change{Address: addr, Kind: "router", Action: Update, Fields: f, run: func(s *state) error {
+				for _, name := range missing {
+					network, err := lookup[*rustack.Network](s, v.networkAddress(name))
+					if err != nil {
+						return err
+					}
+					port := rustack.Port{Network: network, IpAddress: stringPtr(v.gateway(name))}
+					if err := router.ConnectPort(&port, false); err != nil {
+						return err
+					}
+				}
+				if spec.Tags != nil {
+					router.Tags = tags(spec.Tags)
+					return router.Update()
+				}
+				return nil
+			}}, deps...)
+		}
+		return
+	}
+
+	var ports []*rustack.Port
+	v.add(&Change{
+		Address: addr, Kind: "router", Action: Create,
+		Fields: []FieldChange{{Field: "networks", New: spec.Networks}},
+		run: func(s *state) error {
+			vdc, err := lookup[*rustack.Vdc](s, vdcAddr)
+			if err != nil {
+				return err
+			}
+			for _, name := range spec.Networks {
+				network, err := lookup[*rustack.Network](s, v.networkAddress(name))
+				if err != nil {
+					return err
+				}
+				port := rustack.Port{Network: network, IpAddress: stringPtr(v.gateway(name))}
+				if err := vdc.CreateEmptyPort(&port); err != nil {
+					deletePorts(ports)
+					return err
+				}
+				ports = append(ports, &port)
+			}
+			router := rustack.NewRouter(spec.Name, stringPtr(spec.Floating))
+			router.Tags = tags(spec.Tags)
+			if err := vdc.CreateRouter(&router, ports...); err != nil {
+				deletePorts(ports)
+				return err
+			}
+			s.set(addr, &router)
+			return nil
+		},
+		undo: func(s *state) error {
+			if err := undoDelete[*rustack.Router](addr)(s); err != nil {
+				return err
+			}
+			return deletePorts(ports)
+		},
+	}, deps...)
+}
+
+func (v *vdcBuilder) vm(spec VmSpec) {
+	addr := address(v.addr, "vm."+spec.Name)
+	vdcAddr := v.addr
+	deps := v.networkDeps(spec.Network)
+	for _, fw := range spec.FirewallTemplates {
+		deps = append(deps, address(vdcAddr, "firewall."+fw))
+	}
+
+	vm := v.live.vms[spec.Name]
+	if vm != nil {
+		v.plan.state.set(addr, vm)
+		v.updateVm(addr, vm, spec, deps)
+		return
+	}
+
+	var port *rustack.Port
+	created := []FieldChange{
+		{Field: "cpu", New: spec.Cpu},
+		{Field: "ram", New: spec.Ram},
+		{Field: "template", New: spec.Template},
+		{Field: "network", New: spec.Network},
+	}
+	for _, disk := range spec.Disks {
+		created = append(created, FieldChange{Field: "disk." + disk.Name, New: disk.Size})
+	}
+	v.add(&Change{
+		Address: addr, Kind: "vm", Action: Create, Fields: created,
+		run: func(s *state) error {
+			vdc, err := lookup[*rustack.Vdc](s, vdcAddr)
+			if err != nil {
+				return err
+			}
+			template, err := s.template(vdc, spec.Template)
+			if err != nil {
+				return err
+			}
+			rootProfile, err := s.storageProfile(vdc, spec.StorageProfile)
+			if err != nil {
+				return err
+			}
+			root := rustack.NewDisk("Disk 1", spec.DiskSize, rootProfile)
+			disks := []*rustack.Disk{&root}
+			for _, diskSpec := range spec.Disks {
+				profile, err := s.storageProfile(vdc, diskSpec.StorageProfile)
+				if err != nil {
+					return err
+				}
+				disk := rustack.NewDisk(diskSpec.Name, diskSpec.Size, profile)
+				disk.Tags = tags(diskSpec.Tags)
+				disks = append(disks, &disk)
+			}
+			network, err := lookup[*rustack.Network](s, v.networkAddress(spec.Network))
+			if err != nil {
+				return err
+			}
+			firewalls, err := v.firewalls(s, spec.FirewallTemplates)
+			if err != nil {
+				return err
+			}
+
+			port = &rustack.Port{Network: network, FirewallTemplates: firewalls, IpAddress: stringPtr(spec.IpAddress)}
+			if err := vdc.CreateEmptyPort(port); err != nil {
+				return err
+			}
+			vm := rustack.NewVm(spec.Name, spec.Cpu, spec.Ram, template, nil, stringPtr(spec.UserData), []*rustack.Port{port}, disks, stringPtr(spec.Floating))
+			vm.Tags = tags(spec.Tags)
+			if err := vdc.CreateVm(&vm); err != nil {
+				deletePorts([]*rustack.Port{port})
+				return err
+			}
+			s.set(addr, &vm)
+			return nil
+		},
+		undo: func(s *state) error {
+			if err := undoDelete[*rustack.Vm](addr)(s); err != nil {
+				return err
+			}
+			return deletePorts([]*rustack.Port{port})
+		},
+	}, deps...)
+}
+
+func (v *vdcBuilder) updateVm(addr string, vm *rustack.Vm, spec VmSpec, deps []string) {
+	if vm.Template != nil && vm.Template.ID != spec.Template && vm.Template.Name != spec.Template {
+		v.warn("%s: template cannot be changed without recreating the vm", addr)
+	}
+
+	var port *rustack.Port
+	for _, p := range vm.Ports {
+		if p.Network != nil && p.Network.Name == spec.Network {
+			port = p
+		}
+	}
+	if port == nil {
+		v.warn("%s: network cannot be changed without recreating the vm", addr)
+	} else if spec.IpAddress != "" && (port.IpAddress == nil || *port.IpAddress != spec.IpAddress) {
+		v.warn("%s: ip address cannot be changed without recreating the vm", addr)
+	}
+
+	var root *rustack.Disk
+	disks := map[string]*rustack.Disk{}
+	for _, disk := range vm.Disks {
+		if disk.IsRoot {
+			root = disk
+		} else {
+			disks[disk.Name] = disk
+		}
+	}
+
+	var f fields
+	f.add("cpu", vm.Cpu, spec.Cpu)
+	f.add("ram", vm.Ram, spec.Ram)
+	f.addTags(vm.Tags, spec.Tags)
+	if port != nil {
+		var live []string
+		for _, fw := range port.FirewallTemplates {
+			live = append(live, fw.Name)
+		}
+		f.add("firewall_templates", sorted(live), sorted(spec.FirewallTemplates))
+	}
+	if root != nil {
+		if spec.DiskSize < root.Size {
+			v.warn("%s: root disk cannot shrink from %d to %d", addr, root.Size, spec.DiskSize)
+		} else {
+			f.add("disk_size", root.Size, spec.DiskSize)
+		}
+	}
+
+	if len(f) > 0 {
+		v.add(&Change{Address: addr, Kind: "vm", Action: Update, Fields: f, run: func(s *state) error {
+			for _, field := range f {
+				switch field.Field {
+				case "firewall_templates":
+					firewalls, err := v.firewalls(s, spec.FirewallTemplates)
+					if err != nil {
+						return err
+					}
+					if err := port.UpdateFirewall(firewalls); err != nil {
+						return err
+					}
+				case "disk_size":
+					if err := root.Resize(spec.DiskSize); err != nil {
+						return err
+					}
+				}
+			}
+			if vm.Cpu == spec.Cpu && vm.Ram == spec.Ram && f.unchanged("tags") {
+				return nil
+			}
+			vm.Cpu, vm.Ram = spec.Cpu, spec.Ram
+			if spec.Tags != nil {
+				vm.Tags = tags(spec.Tags)
+			}
+			return vm.Update()
+		}}, deps...)
+	}
+
+	for _, diskSpec := range spec.Disks {
+		v.vmDisk(addr, vm, disks[diskSpec.Name], diskSpec)
+		delete(disks, diskSpec.Name)
+	}
+	if v.builder.spec.Prune {
+		for name, disk := range disks {
+			disk := disk
+			v.delete(rankChild, address(addr, "disk."+name), "disk", func(s *state) error {
+				return deleteAttachedDisk(vm, disk)
+			})
+		}
+	}
+}
+
+func (v *vdcBuilder) vmDisk(vmAddr string, vm *rustack.Vm, disk *rustack.Disk, spec DiskSpec) {
+	addr := address(vmAddr, "disk."+spec.Name)
+	vdcAddr := v.addr
+
+	if disk != nil {
+		v.updateDisk(addr, disk, spec)
+		return
+	}
+
+	var created *rustack.Disk
+	v.add(&Change{
+		Address: addr, Kind: "disk", Action: Create,
+		Fields: []FieldChange{{Field: "size", New: spec.Size}},
+		run: func(s *state) error {
+			vdc, err := lookup[*rustack.Vdc](s, vdcAddr)
+			if err != nil {
+				return err
+			}
+			profile, err := s.storageProfile(vdc, spec.StorageProfile)
+			if err != nil {
+				return err
+			}
+			disk := rustack.NewDisk(spec.Name, spec.Size, profile)
+			disk.Vm = vm
+			disk.Tags = tags(spec.Tags)
+			if err := vdc.CreateDisk(&disk); err != nil {
+				return err
+			}
+			created = &disk
+			return nil
+		},
+		undo: func(s *state) error {
+			return deleteAttachedDisk(vm, created)
+		},
+	}, vmAddr)
+}
+
+func (v *vdcBuilder) disk(spec DiskSpec) {
+	addr := address(v.addr, "disk."+spec.Name)
+	vdcAddr := v.addr
+
+	if disk := v.live.disks[spec.Name]; disk != nil {
+		v.updateDisk(addr, disk, spec)
+		return
+	}
+
+	v.add(&Change{
+		Address: addr, Kind: "disk", Action: Create,
+		Fields: []FieldChange{{Field: "size", New: spec.Size}},
+		run: func(s *state) error {
+			vdc, err := lookup[*rustack.Vdc](s, vdcAddr)
+			if err != nil {
+				return err
+			}
+			profile, err := s.storageProfile(vdc, spec.StorageProfile)
+			if err != nil {
+				return err
+			}
+			disk := rustack.NewDisk(spec.Name, spec.Size, profile)
+			disk.Tags = tags(spec.Tags)
+			if err := vdc.CreateDisk(&disk); err != nil {
+				return err
+			}
+			s.set(addr, &disk)
+			return nil
+		},
+		undo: undoDelete[*rustack.Disk](addr),
+	}, vdcAddr)
+}
+
+func (v *vdcBuilder) updateDisk(addr string, disk *rustack.Disk, spec DiskSpec) {
+	if disk.StorageProfile != nil && spec.StorageProfile != "" &&
+		disk.StorageProfile.ID != spec.StorageProfile && disk.StorageProfile.Name != spec.StorageProfile {
+		v.warn("%s: storage profile is not changed by plans", addr)
+	}
+	var f fields
+	if spec.Size < disk.Size {
+		v.warn("%s: disk cannot shrink from %d to %d", addr, disk.Size, spec.Size)
+	} else {
+		f.add("size", disk.Size, spec.Size)
+	}
+	f.addTags(disk.Tags, spec.Tags)
+	if len(f) > 0 {
+		v.add(&Change{Address: addr, Kind: "disk", Action: Update, Fields: f, run: func(s *state) error {
+			if spec.Size > disk.Size {
+				disk.Size = spec.Size
+			}
+			if spec.Tags != nil {
+				disk.Tags = tags(spec.Tags)
+			}
+			return disk.Update()
+		}})
+	}
+}
+
+func (v *vdcBuilder) loadBalancer(spec LoadBalancerSpec) {
+	addr := address(v.addr, "lb."+spec.Name)
+	vdcAddr := v.addr
+
+	lb := v.live.lbs[spec.Name]
+	if lb != nil {
+		v.plan.state.set(addr, lb)
+		if lb.Port != nil && lb.Port.Network != nil && lb.Port.Network.Name != spec.Network {
+			v.warn("%s: network cannot be changed without recreating the load balancer", addr)
+		}
+		var f fields
+		f.addTags(lb.Tags, spec.Tags)
+		if len(f) > 0 {
+			v.add(&Change{Address: addr, Kind: "load_balancer", Action: Update, Fields: f, run: func(s *state) error {
+				lb.Tags = tags(spec.Tags)
+				return lb.Update()
+			}})
+		}
+	} else {
+		v.add(&Change{
+			Address: addr, Kind: "load_balancer", Action: Create,
+			Fields: []FieldChange{{Field: "network", New: spec.Network}},
+			run: func(s *state) error {
+				vdc, err := lookup[*rustack.Vdc](s, vdcAddr)
+				if err != nil {
+					return err
+				}
+				network, err := lookup[*rustack.Network](s, v.networkAddress(spec.Network))
+				if err != nil {
+					return err
+				}
+				port := &rustack.Port{Network: network, IpAddress: stringPtr(spec.IpAddress)}
+				var floating *rustack.Port
+				if spec.Floating != "" {
+					floating = &rustack.Port{IpAddress: stringPtr(spec.Floating)}
+				}
+				lb := rustack.NewLoadBalancer(spec.Name, vdc, port, floating)
+				lb.Tags = tags(spec.Tags)
+				if err := lb.Create(); err != nil {
+					return err
+				}
+				s.set(addr, &lb)
+				return nil
+			},
+			undo: undoDelete[*rustack.LoadBalancer](addr),
+		}, v.networkDeps(spec.Network)...)
+	}
+
+	pools := map[int]*rustack.LoadBalancerPool{}
+	for port, pool := range v.live.pools[spec.Name] {
+		pools[port] = pool
+	}
+	for _, pool := range spec.Pools {
+		v.pool(addr, pools[pool.Port], pool)
+		delete(pools, pool.Port)
+	}
+	if v.builder.spec.Prune {
+		for port, pool := range pools {
+			id := pool.ID
+			v.delete(rankChild, address(addr, "pool."+poolName(port)), "pool", func(s *state) error {
+				return lb.DeletePool(id)
+			})
+		}
+	}
+}
+
+func (v *vdcBuilder) pool(lbAddr string, pool *rustack.LoadBalancerPool, spec PoolSpec) {
+	addr := address(lbAddr, "pool."+poolName(spec.Port))
+	deps := []string{lbAddr}
+	var members []string
+	for _, member := range spec.Members {
+		deps = append(deps, address(v.addr, "vm."+member.Vm))
+		members = append(members, fmt.Sprintf("%s:%d/%d", member.Vm, member.Port, member.Weight))
+	}
+	sort.Strings(members)
+
+	newMembers := func(s *state) ([]*rustack.PoolMember, error) {
+		var list []*rustack.PoolMember
+		for _, member := range spec.Members {
+			vm, err := lookup[*rustack.Vm](s, address(v.addr, "vm."+member.Vm))
+			if err != nil {
+				return nil, err
+			}
+			m := rustack.NewLoadBalancerPoolMember(member.Port, member.Weight, vm)
+			list = append(list, &m)
+		}
+		return list, nil
+	}
+
+	if pool != nil {
+		var live []string
+		for _, member := range pool.Members {
+			name := ""
+			if member.Vm != nil {
+				name = member.Vm.Name
+			}
+			live = append(live, fmt.Sprintf("%s:%d/%d", name, member.Port, member.Weight))
+		}
+		sort.Strings(live)
+
+		var f fields
+		f.add("protocol", pool.Protocol, spec.Protocol)
+		f.add("method", pool.Method, spec.Method)
+		f.add("connlimit", pool.Connlimit, spec.Connlimit)
+		f.add("session_persistence", deref(pool.SessionPersistence), spec.SessionPersistence)
+		f.add("members", live, members)
+		f.add("health_monitor", pool.HealthMonitor, healthMonitor(spec.HealthMonitor))
+		if len(f) > 0 {
+			v.add(&Change{Address: addr, Kind: "pool", Action: Update, Fields: f, run: func(s *state) error {
+				lb, err := lookup[*rustack.LoadBalancer](s, lbAddr)
+				if err != nil {
+					return err
+				}
+				if pool.Members, err = newMembers(s); err != nil {
+					return err
+				}
+				pool.Protocol = spec.Protocol
+				pool.Method = spec.Method
+				pool.Connlimit = spec.Connlimit
+				pool.SessionPersistence = stringPtr(spec.SessionPersistence)
+				pool.HealthMonitor = healthMonitor(spec.HealthMonitor)
+				return lb.UpdatePool(pool)
+			}}, deps...)
+		}
+		return
+	}
+
+	created := []FieldChange{{Field: "members", New: members}}
+	if spec.HealthMonitor != nil {
+		created = append(created, FieldChange{Field: "health_monitor", New: healthMonitor(spec.HealthMonitor)})
+	}
+	var createdPool *rustack.LoadBalancerPool
+	v.add(&Change{
+		Address: addr, Kind: "pool", Action: Create, Fields: created,
+		run: func(s *state) error {
+			lb, err := lookup[*rustack.LoadBalancer](s, lbAddr)
+			if err != nil {
+				return err
+			}
+			members, err := newMembers(s)
+			if err != nil {
+				return err
+			}
+			pool := rustack.NewLoadBalancerPool(*lb, spec.Port, spec.Connlimit, members, spec.Method, spec.Protocol, spec.SessionPersistence)
+			pool.HealthMonitor = healthMonitor(spec.HealthMonitor)
+			if err := lb.CreatePool(&pool); err != nil {
+				return err
+			}
+			createdPool = &pool
+			return nil
+		},
+		undo: func(s *state) error {
+			lb, err := lookup[*rustack.LoadBalancer](s, lbAddr)
+			if err != nil {
+				return err
+			}
+			return lb.DeletePool(createdPool.ID)
+		},
+	}, deps...)
+}
+
+func healthMonitor(spec *HealthMonitorSpec) *rustack.HealthMonitor {
+	if spec == nil {
+		return nil
+	}
+	return &rustack.HealthMonitor{
+		Type:          spec.Type,
+		Interval:      spec.Interval,
+		Timeout:       spec.Timeout,
+		MaxRetries:    spec.MaxRetries,
+		HttpPath:      spec.HttpPath,
+		ExpectedCodes: spec.ExpectedCodes,
+	}
+}
+
+func (v *vdcBuilder) firewalls(s *state, names []string) ([]*rustack.FirewallTemplate, error) {
+	firewalls := make([]*rustack.FirewallTemplate, 0, len(names))
+	for _, name := range names {
+		fw, err := lookup[*rustack.FirewallTemplate](s, address(v.addr, "firewall."+name))
+		if err != nil {
+			return nil, err
+		}
+		firewalls = append(firewalls, fw)
+	}
+	return firewalls, nil
+}
+
+func (b *builder) dns(spec DnsSpec) {
+	addr := "dns." + spec.Name
+	projectAddr := b.projectAddress()
+
+	lz, ok := b.live.zones[spec.Name]
+	if ok {
+		b.plan.state.set(addr, lz.dns)
+		var f fields
+		f.addTags(lz.dns.Tags, spec.Tags)
+		if len(f) > 0 {
+			b.warn("%s: tags of dns zones are not changed by plans", addr)
+		}
+	} else {
+		lz = &liveZone{}
+		b.add(&Change{
+			Address: addr, Kind: "dns", Action: Create,
+			run: func(s *state) error {
+				project, err := lookup[*rustack.Project](s, projectAddr)
+				if err != nil {
+					return err
+				}
+				dns := rustack.NewDns(spec.Name)
+				dns.Tags = tags(spec.Tags)
+				if err := project.CreateDns(&dns); err != nil {
+					return err
+				}
+				s.set(addr, &dns)
+				return nil
+			},
+			undo: undoDelete[*rustack.Dns](addr),
+		}, projectAddr)
+	}
+
+	records := map[string]*rustack.DnsRecord{}
+	for key, record := range lz.records {
+		records[key] = record
+	}
+	for _, record := range spec.Records {
+		key := recordKey(record)
+		b.dnsRecord(addr, records[key], record)
+		delete(records, key)
+	}
+	if b.spec.Prune {
+		for key, record := range records {
+			if record.Type == "SOA" || record.Type == "NS" {
+				continue
+			}
+			record := record
+			b.delete(rankChild, address(addr, "record."+key), "dns_record", func(s *state) error {
+				return record.Delete()
+			})
+		}
+	}
+}
+
+func (b *builder) dnsRecord(dnsAddr string, record *rustack.DnsRecord, spec DnsRecordSpec) {
+	addr := address(dnsAddr, "record."+recordKey(spec))
+
+	if record != nil {
+		var f fields
+		f.add("ttl", record.Ttl, spec.Ttl)
+		switch spec.Type {
+		case "MX":
+			f.add("priority", record.Priority, spec.Priority)
+		case "SRV":
+			f.add("priority", record.Priority, spec.Priority)
+			f.add("weight", record.Weight, spec.Weight)
+			f.add("port", record.Port, spec.Port)
+		}
+		if len(f) > 0 {
+			b.add(&Change{Address: addr, Kind: "dns_record", Action: Update, Fields: f, run: func(s *state) error {
+				record.Ttl = spec.Ttl
+				record.Priority, record.Weight, record.Port = spec.Priority, spec.Weight, spec.Port
+				return record.Update()
+			}})
+		}
+		return
+	}
+
+	b.add(&Change{
+		Address: addr, Kind: "dns_record", Action: Create,
+		Fields: []FieldChange{{Field: "ttl", New: spec.Ttl}},
+		run: func(s *state) error {
+			dns, err := lookup[*rustack.Dns](s, dnsAddr)
+			if err != nil {
+				return err
+			}
+			record := rustack.NewDnsRecord(spec.Data, 0, spec.Host, spec.Port, spec.Priority, "", spec.Ttl, spec.Type, spec.Weight)
+			if err := dns.CreateDnsRecord(&record); err != nil {
+				return err
+			}
+			s.set(addr, &record)
+			return nil
+		},
+		undo: undoDelete[*rustack.DnsRecord](addr),
+	}, dnsAddr)
+}
+
+// prune deletes the resources of managed VDCs that are not in the spec.
+// Children of resources in the spec are pruned while building them.
+func (b *builder) prune() {
+	for _, spec := range b.spec.Vdcs {
+		lv, ok := b.live.vdcs[spec.Name]
+		if !ok {
+			continue
+		}
+		vdcAddr := "vdc." + spec.Name
+
+		inSpec := map[string]bool{}
+		for _, n := range spec.Networks {
+			inSpec["network."+n.Name] = true
+			for _, subnet := range n.Subnets {
+				inSpec["network."+n.Name+"/subnet."+subnet.CIDR] = true
+			}
+		}
+		for _, fw := range spec.FirewallTemplates {
+			for _, rule := range fw.Rules {
+				inSpec["firewall."+fw.Name+"/rule."+rule.Name] = true
+			}
+		}
+		for _, r := range spec.Routers {
+			inSpec["router."+r.Name] = true
+		}
+		for _, vm := range spec.Vms {
+			inSpec["vm."+vm.Name] = true
+		}
+		for _, d := range spec.Disks {
+			inSpec["disk."+d.Name] = true
+		}
+		for _, lb := range spec.LoadBalancers {
+			inSpec["lb."+lb.Name] = true
+		}
+
+		for name, network := range lv.networks {
+			network := network
+			if !inSpec["network."+name] {
+				if !network.IsDefault {
+					b.delete(rankNetwork, address(vdcAddr, "network."+name), "network", deleteFunc(network))
+				}
+				continue
+			}
+			for cidr, subnet := range lv.subnets[name] {
+				if !inSpec["network."+name+"/subnet."+cidr] {
+					b.delete(rankSubnet, address(vdcAddr, "network."+name, "subnet."+cidr), "subnet", deleteFunc(subnet))
+				}
+			}
+		}
+		for fw, rules := range lv.rules {
+			for name, rule := range rules {
+				if !inSpec["firewall."+fw+"/rule."+name] {
+					b.delete(rankChild, address(vdcAddr, "firewall."+fw, "rule."+name), "firewall_rule", deleteFunc(rule))
+				}
+			}
+		}
+		for name, router := range lv.routers {
+			if !inSpec["router."+name] && !router.IsDefault {
+				b.delete(rankAttachment, address(vdcAddr, "router."+name), "router", deleteFunc(router))
+			}
+		}
+		for name, vm := range lv.vms {
+			if !inSpec["vm."+name] {
+				b.delete(rankInstance, address(vdcAddr, "vm."+name), "vm", deleteFunc(vm))
+			}
+		}
+		for name, disk := range lv.disks {
+			if !inSpec["disk."+name] {
+				b.delete(rankAttachment, address(vdcAddr, "disk."+name), "disk", deleteFunc(disk))
+			}
+		}
+		for name, lb := range lv.lbs {
+			if !inSpec["lb."+name] {
+				b.delete(rankInstance, address(vdcAddr, "lb."+name), "load_balancer", deleteFunc(lb))
+			}
+		}
+	}
+}
+
+func deleteFunc[T interface{ Delete() error }](obj T) func(s *state) error {
+	return func(s *state) error {
+		return obj.Delete()
+	}
+}
+
+// undoDelete deletes the object a create stored at the address.
+func undoDelete[T interface{ Delete() error }](address string) func(s *state) error {
+	return func(s *state) error {
+		obj, err := lookup[T](s, address)
+		if err != nil {
+			return err
+		}
+		return obj.Delete()
+	}
+}
+
+func deleteAttachedDisk(vm *rustack.Vm, disk *rustack.Disk) error {
+	if disk == nil {
+		return nil
+	}
+	if err := vm.DetachDisk(disk); err != nil && !errors.Is(err, rustack.ErrNotFound) {
+		return err
+	}
+	return disk.Delete()
+}
+
+// deletePorts removes ports created for a resource, ignoring ports that
+// went away with it.
+func deletePorts(ports []*rustack.Port) error {
+	for _, port := range ports {
+		if port == nil || port.ID == "" {
+			continue
+		}
+		if err := port.Delete(); err != nil && !errors.Is(err, rustack.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func dnsServers(servers []*rustack.SubnetDNSServer) []string {
+	list := make([]string, len(servers))
+	for i, server := range servers {
+		list[i] = server.DNSServer
+	}
+	return list
+}
+
+func newDnsServers(list []string) []*rustack.SubnetDNSServer {
+	servers := make([]*rustack.SubnetDNSServer, len(list))
+	for i, server := range list {
+		s := rustack.NewSubnetDNSServer(server)
+		servers[i] = &s
+	}
+	return servers
+}
+
+func (f fields) unchanged(field string) bool {
+	for _, c := range f {
+		if c.Field == field {
+			return false
+		}
+	}
+	return true
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package plan_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rustack-cloud-platform/rcp-go/plan"
+	"github.com/rustack-cloud-platform/rcp-go/rustacktest"
+)
+
+func TestPruneDnsRecords(t *testing.T) {
+	s := rustacktest.NewServer()
+	defer s.Close()
+	project := s.Seed("project", map[string]interface{}{"name": "project"})
+	dns := s.Seed("dns", map[string]interface{}{"name": "example.com.", "project": project})
+	records := "dns/" + dns["id"].(string) + "/record"
+	s.Seed(records, map[string]interface{}{"type": "SOA", "host": "example.com.", "data": "ns.example.com."})
+	keep := s.Seed(records, map[string]interface{}{"type": "A", "host": "www.example.com.", "data": "10.0.0.1", "ttl": 300})
+	for _, data := range []string{"10.0.0.2", "10.0.0.3", "10.0.0.4"} {
+		s.Seed(records, map[string]interface{}{"type": "A", "host": "old.example.com.", "data": data, "ttl": 300})
+	}
+
+	spec := &plan.Spec{
+		Project: plan.ProjectSpec{Name: "project"},
+		Prune:   true,
+		Dns: []plan.DnsSpec{{
+			Name:    "example.com.",
+			Records: []plan.DnsRecordSpec{{Type: "A", Host: "www", Data: "10.0.0.1", Ttl: 300}},
+		}},
+	}
+	p, err := plan.Build(context.Background(), s.Manager(), spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Count(plan.Delete); got != 3 {
+		t.Fatalf("plan deletes %d records, want 3:\n%s", got, p)
+	}
+	if _, err := p.Apply(context.Background(), plan.ApplyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	left := s.Objects(records)
+	if len(left) != 2 {
+		t.Fatalf("%d records left, want the SOA and the kept one", len(left))
+	}
+	for _, record := range left {
+		if record["type"] != "SOA" && record["id"] != keep["id"] {
+			t.Fatalf("record %v not pruned", record["data"])
+		}
+	}
+}
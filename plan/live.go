@@ -0,0 +1,240 @@
+package plan
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+// live is the part of the live state a spec refers to, indexed by name.
+type live struct {
+	project *rustack.Project
+	vdcs    map[string]*liveVdc
+	zones   map[string]*liveZone
+}
+
+type liveVdc struct {
+	vdc       *rustack.Vdc
+	networks  map[string]*rustack.Network
+	subnets   map[string]map[string]*rustack.Subnet
+	firewalls map[string]*rustack.FirewallTemplate
+	rules     map[string]map[string]*rustack.FirewallRule
+	routers   map[string]*rustack.Router
+	vms       map[string]*rustack.Vm
+	disks     map[string]*rustack.Disk
+	lbs       map[string]*rustack.LoadBalancer
+	pools     map[string]map[int]*rustack.LoadBalancerPool
+}
+
+type liveZone struct {
+	dns     *rustack.Dns
+	records map[string]*rustack.DnsRecord
+}
+
+func fetchLive(ctx context.Context, m *rustack.Manager, spec *Spec) (*live, error) {
+	l := &live{vdcs: map[string]*liveVdc{}, zones: map[string]*liveZone{}}
+
+	projects, err := m.GetProjects(rustack.Arguments{"name": spec.Project.Name})
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot list projects")
+	}
+	l.project, err = byName(projects, "project", spec.Project.Name, func(p *rustack.Project) string { return p.Name })
+	if err != nil || l.project == nil {
+		return l, err
+	}
+
+	vdcs, err := m.GetVdcs(rustack.Arguments{"project": l.project.ID})
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot list vdcs")
+	}
+	for _, vdcSpec := range spec.Vdcs {
+		vdc, err := byName(vdcs, "vdc", vdcSpec.Name, func(v *rustack.Vdc) string { return v.Name })
+		if err != nil {
+			return nil, err
+		}
+		if vdc == nil {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		lv, err := fetchVdc(m, vdc, vdcSpec)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Cannot fetch vdc %s", vdc.Name)
+		}
+		l.vdcs[vdc.Name] = lv
+	}
+
+	zones, err := l.project.GetDnss()
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot list dns zones")
+	}
+	for _, dnsSpec := range spec.Dns {
+		dns, err := byName(zones, "dns zone", dnsSpec.Name, func(d *rustack.Dns) string { return d.Name })
+		if err != nil {
+			return nil, err
+		}
+		if dns == nil {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		records, err := dns.GetDnsRecords()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Cannot list records of dns zone %s", dns.Name)
+		}
+		lz := &liveZone{dns: dns, records: map[string]*rustack.DnsRecord{}}
+		for _, record := range records {
+			host := strings.TrimSuffix(strings.TrimSuffix(record.Host, dns.Name), ".")
+			if host == "" {
+				host = "@"
+			}
+			lz.records[record.Type+" "+host+" "+record.Data] = record
+		}
+		l.zones[dns.Name] = lz
+	}
+	return l, nil
+}
+
+func fetchVdc(m *rustack.Manager, vdc *rustack.Vdc, spec VdcSpec) (*liveVdc, error) {
+	lv := &liveVdc{
+		vdc:       vdc,
+		networks:  map[string]*rustack.Network{},
+		subnets:   map[string]map[string]*rustack.Subnet{},
+		firewalls: map[string]*rustack.FirewallTemplate{},
+		rules:     map[string]map[string]*rustack.FirewallRule{},
+		routers:   map[string]*rustack.Router{},
+		vms:       map[string]*rustack.Vm{},
+		disks:     map[string]*rustack.Disk{},
+		lbs:       map[string]*rustack.LoadBalancer{},
+		pools:     map[string]map[int]*rustack.LoadBalancerPool{},
+	}
+
+	networks, err := vdc.GetNetworks()
+	if err != nil {
+		return nil, err
+	}
+	if err := index(lv.networks, networks, "network", func(n *rustack.Network) string { return n.Name }); err != nil {
+		return nil, err
+	}
+	for name, network := range lv.networks {
+		subnets, err := network.GetSubnets()
+		if err != nil {
+			return nil, err
+		}
+		lv.subnets[name] = map[string]*rustack.Subnet{}
+		for _, subnet := range subnets {
+			lv.subnets[name][subnet.CIDR] = subnet
+		}
+	}
+
+	firewalls, err := vdc.GetFirewallTemplates()
+	if err != nil {
+		return nil, err
+	}
+	// Only templates named in the spec are managed, shared templates with
+	// the same name as others are left alone.
+	for _, fwSpec := range spec.FirewallTemplates {
+		fw, err := byName(firewalls, "firewall template", fwSpec.Name, func(f *rustack.FirewallTemplate) string { return f.Name })
+		if err != nil {
+			return nil, err
+		}
+		if fw == nil {
+			continue
+		}
+		lv.firewalls[fw.Name] = fw
+		rules, err := m.GetFirewallRules(fw.ID)
+		if err != nil {
+			return nil, err
+		}
+		lv.rules[fw.Name] = map[string]*rustack.FirewallRule{}
+		if err := index(lv.rules[fw.Name], rules, "firewall rule", func(r *rustack.FirewallRule) string { return r.Name }); err != nil {
+			return nil, err
+		}
+	}
+
+	routers, err := vdc.GetRouters()
+	if err != nil {
+		return nil, err
+	}
+	if err := index(lv.routers, routers, "router", func(r *rustack.Router) string { return r.Name }); err != nil {
+		return nil, err
+	}
+
+	vms, err := vdc.GetVms()
+	if err != nil {
+		return nil, err
+	}
+	if err := index(lv.vms, vms, "vm", func(v *rustack.Vm) string { return v.Name }); err != nil {
+		return nil, err
+	}
+
+	disks, err := vdc.GetDisks()
+	if err != nil {
+		return nil, err
+	}
+	var detached []*rustack.Disk
+	for _, disk := range disks {
+		if disk.Vm == nil {
+			detached = append(detached, disk)
+		}
+	}
+	if err := index(lv.disks, detached, "disk", func(d *rustack.Disk) string { return d.Name }); err != nil {
+		return nil, err
+	}
+
+	lbs, err := vdc.GetLoadBalancers()
+	if err != nil {
+		return nil, err
+	}
+	if err := index(lv.lbs, lbs, "load balancer", func(lb *rustack.LoadBalancer) string { return lb.Name }); err != nil {
+		return nil, err
+	}
+	for name, lb := range lv.lbs {
+		pools, err := lb.GetPools()
+		if err != nil {
+			return nil, err
+		}
+		lv.pools[name] = map[int]*rustack.LoadBalancerPool{}
+		if err := index(lv.pools[name], pools, "pool", func(p *rustack.LoadBalancerPool) int { return p.Port }); err != nil {
+			return nil, err
+		}
+	}
+	return lv, nil
+}
+
+// byName returns the object with exactly the name, nil if there is none.
+// Name filters of the API match substrings.
+func byName[T any](objs []T, kind string, name string, nameOf func(T) string) (found T, err error) {
+	matches := 0
+	for _, obj := range objs {
+		if nameOf(obj) == name {
+			found = obj
+			matches++
+		}
+	}
+	if matches > 1 {
+		err = errors.Errorf("Found %d of %s %q, names must be unique to be managed by a plan", matches, kind, name)
+	}
+	return
+}
+
+func index[K comparable, T any](into map[K]T, objs []T, kind string, keyOf func(T) K) error {
+	for _, obj := range objs {
+		key := keyOf(obj)
+		if _, ok := into[key]; ok {
+			return errors.Errorf("Found several of %s %v, names must be unique to be managed by a plan", kind, key)
+		}
+		into[key] = obj
+	}
+	return nil
+}
+
+func poolName(port int) string {
+	return strconv.Itoa(port)
+}
@@ -0,0 +1,283 @@
+package plan
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+type Action string
+
+const (
+	Create Action = "create"
+	Update Action = "update"
+	Delete Action = "delete"
+)
+
+// Change is a single API operation of a plan.
+type Change struct {
+	// Address identifies the resource by the names of its parents, e.g.
+	// "vdc.prod/network.backend/subnet.10.0.1.0/24".
+	Address string
+	Kind    string
+	Action  Action
+	// Fields lists the differences of an update, or the main attributes of
+	// a created resource.
+	Fields []FieldChange
+	// DependsOn are the addresses of changes that must be applied first.
+	DependsOn []string
+
+	run  func(s *state) error
+	undo func(s *state) error
+}
+
+type FieldChange struct {
+	Field string
+	Old   interface{}
+	New   interface{}
+}
+
+// Plan is the set of changes that brings the live state to a spec.
+type Plan struct {
+	Changes []*Change
+	// Warnings are differences the plan cannot apply, such as a VM template
+	// change that would need the VM to be recreated.
+	Warnings []string
+
+	state   *state
+	index   map[string]*Change
+	mu      sync.Mutex
+	applied bool
+}
+
+// Empty reports whether the live state already matches the spec.
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// Count returns the number of changes with the action.
+func (p *Plan) Count(action Action) int {
+	n := 0
+	for _, c := range p.Changes {
+		if c.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// Print writes a human readable plan: one line per change prefixed with +
+// for creates, ~ for updates and - for deletes, the changed fields, warnings
+// and a summary.
+func (p *Plan) Print(w io.Writer) error {
+	var b strings.Builder
+	for _, c := range p.Changes {
+		fmt.Fprintf(&b, "%s %s\n", c.Action.symbol(), c.Address)
+		for _, f := range c.Fields {
+			switch c.Action {
+			case Create:
+				fmt.Fprintf(&b, "      %s: %s\n", f.Field, formatValue(f.New))
+			case Update:
+				fmt.Fprintf(&b, "      %s: %s -> %s\n", f.Field, formatValue(f.Old), formatValue(f.New))
+			}
+		}
+	}
+	for _, warning := range p.Warnings {
+		fmt.Fprintf(&b, "\nWarning: %s", warning)
+	}
+	if len(p.Warnings) > 0 {
+		b.WriteString("\n")
+	}
+	if p.Empty() {
+		b.WriteString("\nNo changes.\n")
+	} else {
+		fmt.Fprintf(&b, "\nPlan: %d to create, %d to update, %d to delete.\n", p.Count(Create), p.Count(Update), p.Count(Delete))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (p *Plan) String() string {
+	var b strings.Builder
+	p.Print(&b)
+	return b.String()
+}
+
+func (a Action) symbol() string {
+	switch a {
+	case Create:
+		return "+"
+	case Update:
+		return "~"
+	}
+	return "-"
+}
+
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "(none)"
+	case string:
+		if v == "" {
+			return `""`
+		}
+		return v
+	case []string:
+		return "[" + strings.Join(v, ", ") + "]"
+	case *int:
+		if v == nil {
+			return "(none)"
+		}
+		return fmt.Sprint(*v)
+	case *rustack.HealthMonitor:
+		if v == nil {
+			return "(none)"
+		}
+		s := fmt.Sprintf("%s every %ds, timeout %ds, %d retries", v.Type, v.Interval, v.Timeout, v.MaxRetries)
+		if v.HttpPath != "" {
+			s += ", path " + v.HttpPath
+		}
+		if v.ExpectedCodes != "" {
+			s += ", expecting " + v.ExpectedCodes
+		}
+		return s
+	}
+	return fmt.Sprint(value)
+}
+
+// state holds the objects changes work on, keyed by address. Build fills it
+// with live objects and creates add the objects they create, so that
+// children find their parents at apply time.
+type state struct {
+	manager *rustack.Manager
+
+	mu        sync.Mutex
+	objects   map[string]interface{}
+	templates map[string][]*rustack.Template
+	profiles  map[string][]*rustack.StorageProfile
+}
+
+func newState(m *rustack.Manager) *state {
+	return &state{
+		manager:   m,
+		objects:   make(map[string]interface{}),
+		templates: make(map[string][]*rustack.Template),
+		profiles:  make(map[string][]*rustack.StorageProfile),
+	}
+}
+
+func (s *state) set(address string, obj interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[address] = obj
+}
+
+func lookup[T any](s *state, address string) (obj T, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[address].(T)
+	if !ok {
+		err = errors.Errorf("Resource %s is not available", address)
+	}
+	return
+}
+
+// template finds a template of the VDC by ID or name.
+func (s *state) template(vdc *rustack.Vdc, ref string) (*rustack.Template, error) {
+	s.mu.Lock()
+	templates, ok := s.templates[vdc.ID]
+	s.mu.Unlock()
+	if !ok {
+		var err error
+		if templates, err = vdc.GetTemplates(); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		s.templates[vdc.ID] = templates
+		s.mu.Unlock()
+	}
+	for _, t := range templates {
+		if t.ID == ref || t.Name == ref {
+			return t, nil
+		}
+	}
+	return nil, errors.Errorf("Template %q is not available in vdc %s", ref, vdc.Name)
+}
+
+// storageProfile finds a storage profile of the VDC by ID or name.
+func (s *state) storageProfile(vdc *rustack.Vdc, ref string) (*rustack.StorageProfile, error) {
+	s.mu.Lock()
+	profiles, ok := s.profiles[vdc.ID]
+	s.mu.Unlock()
+	if !ok {
+		var err error
+		if profiles, err = vdc.GetStorageProfiles(); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		s.profiles[vdc.ID] = profiles
+		s.mu.Unlock()
+	}
+	for _, p := range profiles {
+		if p.ID == ref || p.Name == ref {
+			return p, nil
+		}
+	}
+	return nil, errors.Errorf("Storage profile %q is not available in vdc %s", ref, vdc.Name)
+}
+
+func address(parts ...string) string {
+	return strings.Join(parts, "/")
+}
+
+func tags(names []string) []rustack.Tag {
+	tags := make([]rustack.Tag, len(names))
+	for i, name := range names {
+		tags[i] = rustack.Tag{Name: name}
+	}
+	return tags
+}
+
+func tagNames(tags []rustack.Tag) []string {
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+	return names
+}
+
+// fields collects the differences of an update.
+type fields []FieldChange
+
+func (f *fields) add(field string, old interface{}, new interface{}) {
+	if formatValue(old) != formatValue(new) {
+		*f = append(*f, FieldChange{Field: field, Old: old, New: new})
+	}
+}
+
+// addTags records a tag difference unless the spec leaves tags unmanaged.
+func (f *fields) addTags(live []rustack.Tag, spec []string) {
+	if spec == nil {
+		return
+	}
+	f.add("tags", sorted(tagNames(live)), sorted(spec))
+}
+
+func sorted(values []string) []string {
+	values = append([]string{}, values...)
+	sort.Strings(values)
+	return values
+}
+
+func stringPtr(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
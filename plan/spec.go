@@ -0,0 +1,510 @@
+// Package plan applies declarative infrastructure specs to Rustack.
+//
+// A spec describes a project and the resources in it:
+//
+//	project:
+//	  name: shop
+//	prune: true
+//	vdcs:
+//	- name: shop-prod
+//	  hypervisor: VMware
+//	  networks:
+//	  - name: backend
+//	    subnets:
+//	    - cidr: 10.0.1.0/24
+//	      gateway: 10.0.1.1
+//	      start_ip: 10.0.1.10
+//	      end_ip: 10.0.1.250
+//	  routers:
+//	  - name: edge
+//	    networks: [backend]
+//	  firewall_templates:
+//	  - name: web
+//	    rules:
+//	    - {name: http, direction: ingress, protocol: tcp, port_min: 80, port_max: 80}
+//	  vms:
+//	  - name: web-1
+//	    cpu: 2
+//	    ram: 4
+//	    template: Ubuntu 22.04
+//	    storage_profile: ssd
+//	    disk_size: 20
+//	    network: backend
+//	    firewall_templates: [web]
+//	    disks:
+//	    - {name: data, size: 50}
+//	  load_balancers:
+//	  - name: front
+//	    network: backend
+//	    floating: RANDOM_FIP
+//	    pools:
+//	    - port: 80
+//	      members: [{vm: web-1, port: 8080}]
+//	      health_monitor: {type: HTTP, http_path: /health}
+//	dns:
+//	- name: shop.example.
+//	  records:
+//	  - {type: A, host: www, data: 203.0.113.10}
+//
+// Build compares a spec with the live state and returns a Plan of create,
+// update and delete changes; Plan.Apply executes them in dependency order.
+// Resources are matched by name within their parent, so renaming a resource
+// in the spec replaces it. Tags left out of a resource are not managed, an
+// empty list removes all tags.
+package plan
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/pkg/errors"
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+type Spec struct {
+	Project ProjectSpec `yaml:"project"`
+	// Prune deletes resources found in the managed VDCs and DNS zones that
+	// are not in the spec. VDCs, zones and the project itself are never
+	// deleted.
+	Prune bool      `yaml:"prune"`
+	Vdcs  []VdcSpec `yaml:"vdcs"`
+	Dns   []DnsSpec `yaml:"dns"`
+}
+
+type ProjectSpec struct {
+	Name string `yaml:"name"`
+	// Client is the ID of the client a new project is created for, the
+	// first available client by default.
+	Client string   `yaml:"client"`
+	Tags   []string `yaml:"tags"`
+}
+
+type VdcSpec struct {
+	Name string `yaml:"name"`
+	// Hypervisor is the name or ID of one of the project's hypervisors.
+	Hypervisor        string                 `yaml:"hypervisor"`
+	Tags              []string               `yaml:"tags"`
+	Networks          []NetworkSpec          `yaml:"networks"`
+	FirewallTemplates []FirewallTemplateSpec `yaml:"firewall_templates"`
+	Routers           []RouterSpec           `yaml:"routers"`
+	Vms               []VmSpec               `yaml:"vms"`
+	Disks             []DiskSpec             `yaml:"disks"`
+	LoadBalancers     []LoadBalancerSpec     `yaml:"load_balancers"`
+}
+
+type NetworkSpec struct {
+	Name    string       `yaml:"name"`
+	Mtu     *int         `yaml:"mtu"`
+	Tags    []string     `yaml:"tags"`
+	Subnets []SubnetSpec `yaml:"subnets"`
+}
+
+type SubnetSpec struct {
+	CIDR string `yaml:"cidr"`
+	// Gateway and the DHCP range default to the first, second and last
+	// addresses of an IPv4 subnet. DHCP is enabled by default.
+	Gateway    string   `yaml:"gateway"`
+	StartIp    string   `yaml:"start_ip"`
+	EndIp      string   `yaml:"end_ip"`
+	DHCP       *bool    `yaml:"dhcp"`
+	DnsServers []string `yaml:"dns_servers"`
+}
+
+type FirewallTemplateSpec struct {
+	Name  string             `yaml:"name"`
+	Tags  []string           `yaml:"tags"`
+	Rules []FirewallRuleSpec `yaml:"rules"`
+}
+
+type FirewallRuleSpec struct {
+	Name string `yaml:"name"`
+	// Direction is "ingress" or "egress".
+	Direction string `yaml:"direction"`
+	// Protocol is tcp, udp, icmp or any. Ports are used by tcp and udp only.
+	Protocol string `yaml:"protocol"`
+	// DestinationIp defaults to 0.0.0.0/0.
+	DestinationIp string `yaml:"destination_ip"`
+	PortMin       int    `yaml:"port_min"`
+	PortMax       int    `yaml:"port_max"`
+}
+
+type RouterSpec struct {
+	Name string `yaml:"name"`
+	// Networks are connected to the router by name.
+	Networks []string `yaml:"networks"`
+	Floating string   `yaml:"floating"`
+	Tags     []string `yaml:"tags"`
+}
+
+type VmSpec struct {
+	Name string  `yaml:"name"`
+	Cpu  int     `yaml:"cpu"`
+	Ram  float64 `yaml:"ram"`
+	// Template and StorageProfile are names or IDs available in the VDC.
+	Template       string `yaml:"template"`
+	StorageProfile string `yaml:"storage_profile"`
+	DiskSize       int    `yaml:"disk_size"`
+	Network        string `yaml:"network"`
+	IpAddress      string `yaml:"ip_address"`
+	// Floating is RANDOM_FIP for a new floating IP or an existing address.
+	Floating          string     `yaml:"floating"`
+	FirewallTemplates []string   `yaml:"firewall_templates"`
+	UserData          string     `yaml:"user_data"`
+	Tags              []string   `yaml:"tags"`
+	Disks             []DiskSpec `yaml:"disks"`
+}
+
+type DiskSpec struct {
+	Name string `yaml:"name"`
+	Size int    `yaml:"size"`
+	// StorageProfile defaults to the one of the VM for VM disks.
+	StorageProfile string   `yaml:"storage_profile"`
+	Tags           []string `yaml:"tags"`
+}
+
+type LoadBalancerSpec struct {
+	Name      string     `yaml:"name"`
+	Network   string     `yaml:"network"`
+	IpAddress string     `yaml:"ip_address"`
+	Floating  string     `yaml:"floating"`
+	Tags      []string   `yaml:"tags"`
+	Pools     []PoolSpec `yaml:"pools"`
+}
+
+type PoolSpec struct {
+	Port               int          `yaml:"port"`
+	Protocol           string       `yaml:"protocol"`
+	Method             string       `yaml:"method"`
+	Connlimit          int          `yaml:"connlimit"`
+	SessionPersistence string       `yaml:"session_persistence"`
+	Members            []MemberSpec `yaml:"members"`
+	// HealthMonitor is removed from the pool when not set.
+	HealthMonitor *HealthMonitorSpec `yaml:"health_monitor"`
+}
+
+// HealthMonitorSpec checks the pool members every 10 seconds with a timeout
+// of 5 and 3 retries unless given. HTTP monitors request / and expect 200
+// by default.
+type HealthMonitorSpec struct {
+	Type          string `yaml:"type"`
+	Interval      int    `yaml:"interval"`
+	Timeout       int    `yaml:"timeout"`
+	MaxRetries    int    `yaml:"max_retries"`
+	HttpPath      string `yaml:"http_path"`
+	ExpectedCodes string `yaml:"expected_codes"`
+}
+
+type MemberSpec struct {
+	Vm     string `yaml:"vm"`
+	Port   int    `yaml:"port"`
+	Weight int    `yaml:"weight"`
+}
+
+type DnsSpec struct {
+	Name    string          `yaml:"name"`
+	Tags    []string        `yaml:"tags"`
+	Records []DnsRecordSpec `yaml:"records"`
+}
+
+type DnsRecordSpec struct {
+	Type string `yaml:"type"`
+	Host string `yaml:"host"`
+	Data string `yaml:"data"`
+	Ttl  int    `yaml:"ttl"`
+	// Priority is used by MX and SRV records, Weight and Port by SRV.
+	Priority int `yaml:"priority"`
+	Weight   int `yaml:"weight"`
+	Port     int `yaml:"port"`
+}
+
+// Load reads and validates a spec file.
+func Load(path string) (*Spec, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot read spec %s", path)
+	}
+	spec, err := Parse(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid spec %s", path)
+	}
+	return spec, nil
+}
+
+// Parse decodes a YAML spec, fills in defaults and validates it.
+func Parse(data []byte) (*Spec, error) {
+	var spec Spec
+	if err := yaml.UnmarshalStrict(data, &spec); err != nil {
+		return nil, err
+	}
+	spec.setDefaults()
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+func (s *Spec) setDefaults() {
+	for i := range s.Vdcs {
+		vdc := &s.Vdcs[i]
+		for j := range vdc.Networks {
+			for k := range vdc.Networks[j].Subnets {
+				vdc.Networks[j].Subnets[k].setDefaults()
+			}
+		}
+		for j := range vdc.FirewallTemplates {
+			for k := range vdc.FirewallTemplates[j].Rules {
+				rule := &vdc.FirewallTemplates[j].Rules[k]
+				if rule.DestinationIp == "" {
+					rule.DestinationIp = "0.0.0.0/0"
+				}
+			}
+		}
+		for j := range vdc.Vms {
+			vm := &vdc.Vms[j]
+			for k := range vm.Disks {
+				if vm.Disks[k].StorageProfile == "" {
+					vm.Disks[k].StorageProfile = vm.StorageProfile
+				}
+			}
+		}
+		for j := range vdc.LoadBalancers {
+			for k := range vdc.LoadBalancers[j].Pools {
+				pool := &vdc.LoadBalancers[j].Pools[k]
+				if pool.Protocol == "" {
+					pool.Protocol = "tcp"
+				}
+				if pool.Method == "" {
+					pool.Method = "ROUND_ROBIN"
+				}
+				for m := range pool.Members {
+					if pool.Members[m].Weight == 0 {
+						pool.Members[m].Weight = 50
+					}
+				}
+				if pool.HealthMonitor != nil {
+					pool.HealthMonitor.setDefaults()
+				}
+			}
+		}
+	}
+	for i := range s.Dns {
+		for j := range s.Dns[i].Records {
+			if s.Dns[i].Records[j].Ttl == 0 {
+				s.Dns[i].Records[j].Ttl = 86400
+			}
+		}
+	}
+}
+
+func (h *HealthMonitorSpec) setDefaults() {
+	h.Type = strings.ToUpper(h.Type)
+	if h.Interval == 0 {
+		h.Interval = 10
+	}
+	if h.Timeout == 0 {
+		h.Timeout = 5
+	}
+	if h.MaxRetries == 0 {
+		h.MaxRetries = 3
+	}
+	if h.Type == rustack.HealthMonitorHTTP {
+		if h.HttpPath == "" {
+			h.HttpPath = "/"
+		}
+		if h.ExpectedCodes == "" {
+			h.ExpectedCodes = "200"
+		}
+	}
+}
+
+func (s *SubnetSpec) setDefaults() {
+	if s.DHCP == nil {
+		dhcp := true
+		s.DHCP = &dhcp
+	}
+	_, ipNet, err := net.ParseCIDR(s.CIDR)
+	if err != nil || ipNet.IP.To4() == nil {
+		return
+	}
+	first := binary.BigEndian.Uint32(ipNet.IP.To4())
+	ones, bits := ipNet.Mask.Size()
+	last := first | (1<<(bits-ones) - 1)
+	if last-first < 4 {
+		return
+	}
+	if s.Gateway == "" {
+		s.Gateway = ipv4(first + 1).String()
+	}
+	if s.StartIp == "" {
+		s.StartIp = ipv4(first + 2).String()
+	}
+	if s.EndIp == "" {
+		s.EndIp = ipv4(last - 1).String()
+	}
+}
+
+func ipv4(n uint32) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, n)
+	return ip
+}
+
+// Validate checks that names are unique within their parent, references
+// point to resources in the spec and required fields are set.
+func (s *Spec) Validate() error {
+	var errs validationErrors
+	if s.Project.Name == "" {
+		errs.add("project: name is required")
+	}
+
+	vdcNames := names{}
+	for _, vdc := range s.Vdcs {
+		at := "vdc " + vdc.Name
+		vdcNames.add(&errs, "vdc", vdc.Name)
+		if vdc.Hypervisor == "" {
+			errs.add("%s: hypervisor is required", at)
+		}
+
+		networks := names{}
+		for _, network := range vdc.Networks {
+			networks.add(&errs, at+": network", network.Name)
+			cidrs := names{}
+			for _, subnet := range network.Subnets {
+				cidrs.add(&errs, at+": network "+network.Name+": subnet", subnet.CIDR)
+				if _, _, err := net.ParseCIDR(subnet.CIDR); err != nil {
+					errs.add("%s: network %s: invalid subnet CIDR %q", at, network.Name, subnet.CIDR)
+				}
+			}
+		}
+
+		firewalls := names{}
+		for _, fw := range vdc.FirewallTemplates {
+			firewalls.add(&errs, at+": firewall template", fw.Name)
+			rules := names{}
+			for _, rule := range fw.Rules {
+				rules.add(&errs, at+": firewall template "+fw.Name+": rule", rule.Name)
+				if rule.Protocol == "" {
+					errs.add("%s: firewall template %s: rule %s: protocol is required", at, fw.Name, rule.Name)
+				}
+				if rule.Direction != "ingress" && rule.Direction != "egress" {
+					errs.add("%s: firewall template %s: rule %s: direction must be ingress or egress", at, fw.Name, rule.Name)
+				}
+			}
+		}
+
+		routers := names{}
+		for _, router := range vdc.Routers {
+			routers.add(&errs, at+": router", router.Name)
+			for _, network := range router.Networks {
+				networks.ref(&errs, at+": router "+router.Name, "network", network)
+			}
+		}
+
+		vms := names{}
+		disks := names{}
+		for _, vm := range vdc.Vms {
+			vms.add(&errs, at+": vm", vm.Name)
+			vmAt := at + ": vm " + vm.Name
+			if vm.Cpu <= 0 || vm.Ram <= 0 || vm.DiskSize <= 0 {
+				errs.add("%s: cpu, ram and disk_size must be positive", vmAt)
+			}
+			if vm.Template == "" || vm.StorageProfile == "" {
+				errs.add("%s: template and storage_profile are required", vmAt)
+			}
+			networks.ref(&errs, vmAt, "network", vm.Network)
+			for _, fw := range vm.FirewallTemplates {
+				firewalls.ref(&errs, vmAt, "firewall template", fw)
+			}
+			vmDisks := names{}
+			for _, disk := range vm.Disks {
+				vmDisks.add(&errs, vmAt+": disk", disk.Name)
+				if disk.Size <= 0 {
+					errs.add("%s: disk %s: size must be positive", vmAt, disk.Name)
+				}
+			}
+		}
+		for _, disk := range vdc.Disks {
+			disks.add(&errs, at+": disk", disk.Name)
+			if disk.Size <= 0 || disk.StorageProfile == "" {
+				errs.add("%s: disk %s: size and storage_profile are required", at, disk.Name)
+			}
+		}
+
+		lbs := names{}
+		for _, lb := range vdc.LoadBalancers {
+			lbs.add(&errs, at+": load balancer", lb.Name)
+			lbAt := at + ": load balancer " + lb.Name
+			networks.ref(&errs, lbAt, "network", lb.Network)
+			ports := map[int]bool{}
+			for _, pool := range lb.Pools {
+				if ports[pool.Port] || pool.Port <= 0 {
+					errs.add("%s: pool ports must be positive and unique, got %d", lbAt, pool.Port)
+				}
+				ports[pool.Port] = true
+				for _, member := range pool.Members {
+					vms.ref(&errs, lbAt, "vm", member.Vm)
+				}
+				if hm := pool.HealthMonitor; hm != nil && hm.Type != rustack.HealthMonitorHTTP && hm.Type != rustack.HealthMonitorTCP && hm.Type != rustack.HealthMonitorPing {
+					errs.add("%s: pool %d: health monitor type must be HTTP, TCP or PING, got %q", lbAt, pool.Port, hm.Type)
+				}
+			}
+		}
+	}
+
+	zones := names{}
+	for _, dns := range s.Dns {
+		zones.add(&errs, "dns zone", dns.Name)
+		if !strings.HasSuffix(dns.Name, ".") {
+			errs.add("dns zone %s: name must end with a dot", dns.Name)
+		}
+		records := names{}
+		for _, record := range dns.Records {
+			records.add(&errs, "dns zone "+dns.Name+": record", recordKey(record))
+			if record.Type == "" || record.Host == "" || record.Data == "" {
+				errs.add("dns zone %s: records need type, host and data", dns.Name)
+			}
+		}
+	}
+
+	return errs.err()
+}
+
+type names map[string]bool
+
+func (n names) add(errs *validationErrors, what string, name string) {
+	if name == "" {
+		errs.add("%s: name is required", what)
+		return
+	}
+	if n[name] {
+		errs.add("%s %s: duplicate name", what, name)
+	}
+	n[name] = true
+}
+
+func (n names) ref(errs *validationErrors, at string, what string, name string) {
+	if !n[name] {
+		errs.add("%s: unknown %s %q", at, what, name)
+	}
+}
+
+type validationErrors []string
+
+func (e *validationErrors) add(format string, args ...interface{}) {
+	*e = append(*e, errors.Errorf(format, args...).Error())
+}
+
+func (e validationErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(e, "\n"))
+}
+
+func recordKey(record DnsRecordSpec) string {
+	return record.Type + " " + record.Host + " " + record.Data
+}
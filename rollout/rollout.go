@@ -0,0 +1,319 @@
+// Package rollout shifts the traffic of a load balancer pool from old VMs to
+// new ones, for blue/green and canary deployments.
+//
+// The weights of the pool members are changed step by step, each step
+// sending a larger share of the traffic to the new VMs. After every step the
+// rollout pauses, then calls the probe; when the probe or a weight change
+// fails, the members are restored as they were before the rollout:
+//
+//	r := rollout.Rollout{
+//		Pool:  pool,
+//		Old:   blue,
+//		New:   green,
+//		Steps: []int{10, 50, 100},
+//		Pause: time.Minute,
+//		Probe: func(ctx context.Context, step rollout.Step) error {
+//			return checkErrorRate(ctx)
+//		},
+//		OnEvent: func(e rollout.Event) { log.Println(e) },
+//	}
+//	result, err := r.Run(ctx)
+//
+// A blue/green switch is a single step of 100. Once all the traffic goes to
+// the new VMs the old ones are removed from the pool, unless KeepOld is set.
+package rollout
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+const DefaultWeight = 100
+
+type Rollout struct {
+	Pool *rustack.LoadBalancerPool
+	// Old are the VMs traffic is moved away from, they have to be members
+	// of the pool. New are the VMs traffic is moved to, they are added to
+	// the pool when not members yet.
+	Old []*rustack.Vm
+	New []*rustack.Vm
+	// Port is the port of the new members, the port of the first old member
+	// when zero.
+	Port int
+	// Steps are the percentages of traffic sent to the new VMs, increasing,
+	// e.g. 5, 25, 50, 100. The rollout ends with both old and new VMs
+	// serving traffic when the last step is below 100.
+	Steps []int
+	// Weight is the weight of the members taking the larger share,
+	// DefaultWeight when zero.
+	Weight int
+	// Pause is the time waited after each step, before the probe.
+	Pause time.Duration
+	// Probe checks the service after each step, an error rolls the rollout
+	// back. It may be nil.
+	Probe func(ctx context.Context, step Step) error
+	// KeepOld leaves the old VMs in the pool with a weight of 0 after the
+	// last step of 100, instead of removing them.
+	KeepOld bool
+	// NoRollback leaves the weights of the failed step in place.
+	NoRollback bool
+	// OnEvent is called for every step, probe, completion and rollback.
+	// Calls come from the goroutine running the rollout.
+	OnEvent func(Event)
+}
+
+// Step is a stage of the rollout.
+type Step struct {
+	// Index is the position of the step in Steps.
+	Index int
+	// Percent is the share of traffic sent to the new VMs.
+	Percent int
+	// OldWeight and NewWeight are the weights of every old and new member.
+	OldWeight int
+	NewWeight int
+}
+
+type EventType string
+
+const (
+	// EventShifted is emitted once the weights of a step are applied.
+	EventShifted        EventType = "shifted"
+	EventProbePassed    EventType = "probe_passed"
+	EventProbeFailed    EventType = "probe_failed"
+	EventShiftFailed    EventType = "shift_failed"
+	EventCompleted      EventType = "completed"
+	EventRollback       EventType = "rollback"
+	EventRollbackFailed EventType = "rollback_failed"
+)
+
+type Event struct {
+	Type EventType
+	Step Step
+	Err  error
+}
+
+func (e Event) String() string {
+	s := fmt.Sprintf("%s step %d: %d%% to new (old weight %d, new weight %d)", e.Type, e.Step.Index+1, e.Step.Percent, e.Step.OldWeight, e.Step.NewWeight)
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+// Result tells how far the rollout went.
+type Result struct {
+	// Steps lists the steps that passed their probe.
+	Steps []Step
+	// Completed is set when all steps passed, RolledBack when the members
+	// were restored after a failure.
+	Completed  bool
+	RolledBack bool
+}
+
+// Run executes the rollout. When ctx is done the running step is treated as
+// failed and the rollout rolled back.
+func (r *Rollout) Run(ctx context.Context) (*Result, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	if err := r.Pool.Reload(); err != nil {
+		return nil, err
+	}
+	original := copyMembers(r.Pool.Members)
+	port, err := r.port(original)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	for i, percent := range r.Steps {
+		step := r.step(i, percent)
+		if err := r.Pool.SetMembers(r.members(original, port, step)); err != nil {
+			err = errors.Wrapf(err, "Cannot shift %d%% of traffic", percent)
+			r.emit(EventShiftFailed, step, err)
+			return r.fail(result, original, step, err)
+		}
+		r.emit(EventShifted, step, nil)
+
+		if err := r.check(ctx, step); err != nil {
+			r.emit(EventProbeFailed, step, err)
+			return r.fail(result, original, step, err)
+		}
+		r.emit(EventProbePassed, step, nil)
+		result.Steps = append(result.Steps, step)
+	}
+
+	last := result.Steps[len(result.Steps)-1]
+	if last.Percent == 100 && !r.KeepOld {
+		members := r.members(original, port, last)
+		kept := members[:0]
+		for _, member := range members {
+			if !containsVm(r.Old, member.Vm) {
+				kept = append(kept, member)
+			}
+		}
+		if err := r.Pool.SetMembers(kept); err != nil {
+			err = errors.Wrap(err, "Cannot remove old members")
+			r.emit(EventShiftFailed, last, err)
+			return result, err
+		}
+	}
+	result.Completed = true
+	r.emit(EventCompleted, last, nil)
+	return result, nil
+}
+
+func (r *Rollout) validate() error {
+	if r.Pool == nil {
+		return errors.New("Rollout requires a pool")
+	}
+	if len(r.Old) == 0 || len(r.New) == 0 {
+		return errors.New("Rollout requires old and new vms")
+	}
+	for _, vm := range r.New {
+		if containsVm(r.Old, vm) {
+			return errors.Errorf("Vm %s is both old and new", vm.Name)
+		}
+	}
+	if len(r.Steps) == 0 {
+		return errors.New("Rollout requires at least one step")
+	}
+	previous := 0
+	for _, percent := range r.Steps {
+		if percent <= previous || percent > 100 {
+			return errors.Errorf("Steps must increase within 1-100, got %v", r.Steps)
+		}
+		previous = percent
+	}
+	return nil
+}
+
+// port returns the port of the new members, checking that all old VMs are
+// members of the pool.
+func (r *Rollout) port(members []*rustack.PoolMember) (int, error) {
+	port := r.Port
+	for _, vm := range r.Old {
+		found := false
+		for _, member := range members {
+			if member.Vm != nil && member.Vm.ID == vm.ID {
+				found = true
+				if port == 0 {
+					port = member.Port
+				}
+			}
+		}
+		if !found {
+			return 0, errors.Errorf("Vm %s is not a member of pool %d", vm.Name, r.Pool.Port)
+		}
+	}
+	return port, nil
+}
+
+// step computes the member weights sending percent of the traffic to the
+// new VMs, whatever the number of old and new VMs.
+func (r *Rollout) step(index int, percent int) Step {
+	weight := r.Weight
+	if weight <= 0 {
+		weight = DefaultWeight
+	}
+	oldShare := float64(100-percent) / float64(len(r.Old))
+	newShare := float64(percent) / float64(len(r.New))
+	scale := float64(weight) / math.Max(oldShare, newShare)
+
+	step := Step{Index: index, Percent: percent}
+	step.OldWeight = int(math.Round(oldShare * scale))
+	step.NewWeight = int(math.Round(newShare * scale))
+	// A small share still gets some traffic.
+	if percent < 100 && step.OldWeight == 0 {
+		step.OldWeight = 1
+	}
+	if step.NewWeight == 0 {
+		step.NewWeight = 1
+	}
+	return step
+}
+
+// members returns the original members with the weights of the step, and
+// the new VMs not in the pool yet. Members of other VMs are kept as they
+// are.
+func (r *Rollout) members(original []*rustack.PoolMember, port int, step Step) []*rustack.PoolMember {
+	members := copyMembers(original)
+	added := make(map[string]bool)
+	for _, member := range members {
+		switch {
+		case containsVm(r.Old, member.Vm):
+			member.Weight = step.OldWeight
+		case containsVm(r.New, member.Vm):
+			member.Weight = step.NewWeight
+			added[member.Vm.ID] = true
+		}
+	}
+	for _, vm := range r.New {
+		if !added[vm.ID] {
+			member := rustack.NewLoadBalancerPoolMember(port, step.NewWeight, vm)
+			members = append(members, &member)
+		}
+	}
+	return members
+}
+
+func (r *Rollout) check(ctx context.Context, step Step) error {
+	timer := time.NewTimer(r.Pause)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+	if r.Probe == nil {
+		return nil
+	}
+	return r.Probe(ctx, step)
+}
+
+func (r *Rollout) fail(result *Result, original []*rustack.PoolMember, step Step, failure error) (*Result, error) {
+	if r.NoRollback {
+		return result, failure
+	}
+	if err := r.Pool.SetMembers(original); err != nil {
+		err = errors.Wrap(err, "Cannot restore members")
+		r.emit(EventRollbackFailed, step, err)
+		return result, errors.Errorf("%s\nRollback failed: %s", failure, err)
+	}
+	result.RolledBack = true
+	r.emit(EventRollback, step, nil)
+	return result, failure
+}
+
+func (r *Rollout) emit(t EventType, step Step, err error) {
+	if r.OnEvent != nil {
+		r.OnEvent(Event{Type: t, Step: step, Err: err})
+	}
+}
+
+func copyMembers(members []*rustack.PoolMember) []*rustack.PoolMember {
+	copied := make([]*rustack.PoolMember, len(members))
+	for i, member := range members {
+		m := *member
+		copied[i] = &m
+	}
+	return copied
+}
+
+func containsVm(vms []*rustack.Vm, vm *rustack.Vm) bool {
+	if vm == nil {
+		return false
+	}
+	for _, v := range vms {
+		if v.ID == vm.ID {
+			return true
+		}
+	}
+	return false
+}
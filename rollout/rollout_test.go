@@ -0,0 +1,239 @@
+package rollout_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rustack-cloud-platform/rcp-go/rollout"
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+	"github.com/rustack-cloud-platform/rcp-go/rustacktest"
+)
+
+// seedRollout seeds a pool with the blue VM as its only member and returns a
+// rollout from blue to green.
+func seedRollout(t *testing.T) (*rustacktest.Server, *rollout.Rollout) {
+	t.Helper()
+	s := rustacktest.NewServer()
+	t.Cleanup(s.Close)
+	m := s.Manager()
+	vdc := s.Seed("vdc", map[string]interface{}{"name": "vdc"})
+	blue := s.Seed("vm", map[string]interface{}{"name": "blue", "vdc": vdc})
+	green := s.Seed("vm", map[string]interface{}{"name": "green", "vdc": vdc})
+	seededLb := s.Seed("lbaas", map[string]interface{}{"name": "lb", "vdc": vdc, "port": map[string]interface{}{"ip_address": "10.0.0.10"}})
+	s.Seed("lbaas/"+seededLb["id"].(string)+"/pool", map[string]interface{}{
+		"port": 80, "protocol": "TCP", "method": "ROUND_ROBIN",
+		"members": []interface{}{map[string]interface{}{"vm": blue, "port": 8080, "weight": 100}},
+	})
+
+	lb, err := m.GetLoadBalancer(seededLb["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pools, err := lb.GetPools()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldVm, err := m.GetVm(blue["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newVm, err := m.GetVm(green["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, &rollout.Rollout{
+		Pool: pools[0],
+		Old:  []*rustack.Vm{oldVm},
+		New:  []*rustack.Vm{newVm},
+	}
+}
+
+// members lists the members of the pool on the server as "vm:port=weight".
+func members(t *testing.T, r *rollout.Rollout) (got []string) {
+	t.Helper()
+	if err := r.Pool.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range r.Pool.Members {
+		got = append(got, fmt.Sprintf("%s:%d=%d", m.Vm.Name, m.Port, m.Weight))
+	}
+	return
+}
+
+// record makes the rollout record its events as "type percent".
+func record(r *rollout.Rollout) *[]string {
+	events := &[]string{}
+	r.OnEvent = func(e rollout.Event) {
+		*events = append(*events, fmt.Sprintf("%s %d", e.Type, e.Step.Percent))
+	}
+	return events
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		keepOld bool
+		want    []string
+	}{
+		{name: "remove old", want: []string{"green:8080=100"}},
+		{name: "keep old", keepOld: true, want: []string{"blue:8080=0", "green:8080=100"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, r := seedRollout(t)
+			r.Steps = []int{10, 50, 100}
+			r.KeepOld = tt.keepOld
+			var probed [][]string
+			r.Probe = func(ctx context.Context, step rollout.Step) error {
+				probed = append(probed, members(t, r))
+				return nil
+			}
+			events := record(r)
+
+			result, err := r.Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Completed || result.RolledBack || len(result.Steps) != 3 {
+				t.Fatalf("got %+v", result)
+			}
+			want := []string{
+				"shifted 10", "probe_passed 10",
+				"shifted 50", "probe_passed 50",
+				"shifted 100", "probe_passed 100",
+				"completed 100",
+			}
+			if !reflect.DeepEqual(*events, want) {
+				t.Fatalf("events %v, want %v", *events, want)
+			}
+			// The probe sees the weights of its step.
+			steps := [][]string{
+				{"blue:8080=100", "green:8080=11"},
+				{"blue:8080=100", "green:8080=100"},
+				{"blue:8080=0", "green:8080=100"},
+			}
+			if !reflect.DeepEqual(probed, steps) {
+				t.Fatalf("probed %v, want %v", probed, steps)
+			}
+			if got := members(t, r); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("members %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunProbeFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		noRollback bool
+		events     []string
+		want       []string
+	}{
+		{
+			name:   "rollback",
+			events: []string{"shifted 10", "probe_passed 10", "shifted 50", "probe_failed 50", "rollback 50"},
+			want:   []string{"blue:8080=100"},
+		},
+		{
+			name:       "no rollback",
+			noRollback: true,
+			events:     []string{"shifted 10", "probe_passed 10", "shifted 50", "probe_failed 50"},
+			want:       []string{"blue:8080=100", "green:8080=100"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, r := seedRollout(t)
+			r.Steps = []int{10, 50, 100}
+			r.NoRollback = tt.noRollback
+			unhealthy := errors.New("error rate above 1%")
+			r.Probe = func(ctx context.Context, step rollout.Step) error {
+				if step.Percent == 50 {
+					return unhealthy
+				}
+				return nil
+			}
+			events := record(r)
+
+			result, err := r.Run(context.Background())
+			if err != unhealthy {
+				t.Fatalf("got %v, want the probe error", err)
+			}
+			if result.Completed || result.RolledBack == tt.noRollback || len(result.Steps) != 1 {
+				t.Fatalf("got %+v", result)
+			}
+			if !reflect.DeepEqual(*events, tt.events) {
+				t.Fatalf("events %v, want %v", *events, tt.events)
+			}
+			if got := members(t, r); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("members %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	_, r := seedRollout(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.Steps = []int{10, 100}
+	r.Pause = time.Hour
+	r.Probe = func(ctx context.Context, step rollout.Step) error {
+		t.Error("probe called after the rollout was canceled")
+		return nil
+	}
+	var events []string
+	r.OnEvent = func(e rollout.Event) {
+		events = append(events, fmt.Sprintf("%s %d", e.Type, e.Step.Percent))
+		// Cancel during the pause following the first shift.
+		if e.Type == rollout.EventShifted {
+			cancel()
+		}
+	}
+
+	result, err := r.Run(ctx)
+	if err != context.Canceled {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if !result.RolledBack || len(result.Steps) != 0 {
+		t.Fatalf("got %+v", result)
+	}
+	if want := []string{"shifted 10", "probe_failed 10", "rollback 10"}; !reflect.DeepEqual(events, want) {
+		t.Fatalf("events %v, want %v", events, want)
+	}
+	if got := members(t, r); !reflect.DeepEqual(got, []string{"blue:8080=100"}) {
+		t.Fatalf("members %v", got)
+	}
+}
+
+func TestRemoveOldFailure(t *testing.T) {
+	s, r := seedRollout(t)
+	var events []rollout.Event
+	r.Steps = []int{100}
+	r.Probe = func(ctx context.Context, step rollout.Step) error {
+		// The removal of the old members fails.
+		s.InjectFault(rustacktest.Fault{
+			Method: http.MethodPatch,
+			Path:   "v1/lbaas/*",
+			Status: http.StatusBadRequest,
+		})
+		return nil
+	}
+	r.OnEvent = func(e rollout.Event) { events = append(events, e) }
+	result, err := r.Run(context.Background())
+	if err == nil || result.Completed {
+		t.Fatalf("got %+v, %v", result, err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("got events %v", events)
+	}
+	e := events[2]
+	if e.Type != rollout.EventShiftFailed || e.Step.Percent != 100 || e.Err == nil {
+		t.Fatalf("got %v", e)
+	}
+}
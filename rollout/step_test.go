@@ -0,0 +1,46 @@
+package rollout
+
+import (
+	"testing"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+func TestStep(t *testing.T) {
+	vms := func(n int) (vms []*rustack.Vm) {
+		for i := 0; i < n; i++ {
+			vms = append(vms, &rustack.Vm{})
+		}
+		return
+	}
+	tests := []struct {
+		old, new  int
+		weight    int
+		percent   int
+		oldWeight int
+		newWeight int
+	}{
+		{old: 1, new: 1, percent: 10, oldWeight: 100, newWeight: 11},
+		{old: 1, new: 1, percent: 30, oldWeight: 100, newWeight: 43},
+		{old: 1, new: 1, percent: 50, oldWeight: 100, newWeight: 100},
+		{old: 1, new: 1, percent: 90, oldWeight: 11, newWeight: 100},
+		{old: 1, new: 1, percent: 100, oldWeight: 0, newWeight: 100},
+		// Shares are per VM: two old VMs at 25% each, one new at 50%.
+		{old: 2, new: 1, percent: 50, oldWeight: 50, newWeight: 100},
+		{old: 3, new: 2, percent: 25, oldWeight: 100, newWeight: 50},
+		{old: 1, new: 3, percent: 50, oldWeight: 100, newWeight: 33},
+		{old: 1, new: 1, weight: 10, percent: 50, oldWeight: 10, newWeight: 10},
+		// Small shares rounding to 0 are given a weight of 1.
+		{old: 1, new: 1, weight: 10, percent: 1, oldWeight: 10, newWeight: 1},
+		{old: 1, new: 1, weight: 10, percent: 99, oldWeight: 1, newWeight: 10},
+		{old: 1, new: 4, weight: 10, percent: 100, oldWeight: 0, newWeight: 10},
+	}
+	for _, tt := range tests {
+		r := &Rollout{Old: vms(tt.old), New: vms(tt.new), Weight: tt.weight}
+		step := r.step(2, tt.percent)
+		if step.Index != 2 || step.Percent != tt.percent || step.OldWeight != tt.oldWeight || step.NewWeight != tt.newWeight {
+			t.Errorf("%d old, %d new, weight %d, %d%%: got old %d, new %d, want old %d, new %d",
+				tt.old, tt.new, tt.weight, tt.percent, step.OldWeight, step.NewWeight, tt.oldWeight, tt.newWeight)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package rustack
+
+import (
+	"context"
+	"reflect"
+	"sync"
+)
+
+// jobList is embedded in resources to keep the jobs started by their last
+// mutating call.
+type jobList struct {
+	jobs []*Job
+}
+
+// Jobs returns the jobs started by the last create, update, delete or action
+// call on the resource. They are finished unless the manager is async.
+func (l *jobList) Jobs() []*Job {
+	return l.jobs
+}
+
+func (l *jobList) setJobs(jobs []*Job) {
+	l.jobs = jobs
+}
+
+type jobHolder interface {
+	setJobs(jobs []*Job)
+}
+
+// recordJobs stores the jobs on target when it is a resource, or a pointer to
+// one, as passed to Request.
+func recordJobs(target interface{}, jobs []*Job) {
+	v := reflect.ValueOf(target)
+	for v.IsValid() && v.Kind() == reflect.Pointer && !v.IsNil() {
+		if holder, ok := v.Interface().(jobHolder); ok {
+			holder.setJobs(jobs)
+			return
+		}
+		v = v.Elem()
+	}
+}
+
+type jobRecorder struct {
+	mu   sync.Mutex
+	jobs []*Job
+}
+
+func (r *jobRecorder) add(jobs []*Job) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs = append(r.jobs, jobs...)
+}
+
+func (r *jobRecorder) take() []*Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	jobs := r.jobs
+	r.jobs = nil
+	return jobs
+}
+
+// WithAsync returns a copy of the manager whose mutating calls return as soon
+// as the API accepts them instead of waiting for the started jobs. Resources
+// fetched or created through the copy inherit this mode. The jobs of a call
+// are returned by the Jobs method of the resource it created, updated or
+// deleted:
+//
+//	am := m.WithAsync()
+//	vdc, _ := am.GetVdc(id)
+//	var jobs []*Job
+//	for _, vm := range vms {
+//		if err := vdc.CreateVm(vm); err != nil {
+//			return err
+//		}
+//		jobs = append(jobs, vm.Jobs()...)
+//	}
+//	err := WaitAll(ctx, jobs...)
+//
+// Calls that depend on the outcome of their own job, such as Snapshot.Revert,
+// LoadBalancer.Update and the pool member changes, still wait for it.
+func (m *Manager) WithAsync() *Manager {
+	newManager := *m
+	newManager.async = &jobRecorder{}
+	return &newManager
+}
+
+func (m *Manager) IsAsync() bool {
+	return m.async != nil
+}
+
+// Jobs returns all jobs started through an async manager since the previous
+// call and forgets them, e.g. to report them once a program is done. Use the
+// Jobs method of the resources to tell which call started which job.
+func (m *Manager) Jobs() []*Job {
+	if m.async == nil {
+		return nil
+	}
+	return m.async.take()
+}
+
+// waiting returns the manager, or a copy of an async manager that waits for
+// jobs, for calls that depend on the outcome of their jobs.
+func (m *Manager) waiting() *Manager {
+	if m.async == nil {
+		return m
+	}
+	newManager := *m
+	newManager.async = nil
+	return &newManager
+}
+
+// deleteResource deletes the resource at path, recording the started jobs on
+// it.
+func (m *Manager) deleteResource(path string, resource jobHolder) error {
+	jobs, err := m.DeleteAsync(path, Defaults(), nil)
+	if err != nil {
+		return err
+	}
+	resource.setJobs(jobs)
+	return m.handleJobs(jobs)
+}
+
+// action performs a request whose response is not decoded, such as attaching
+// a disk, recording the started jobs on the resource it acts on.
+func (m *Manager) action(method string, path string, args interface{}, resource jobHolder) error {
+	jobs, err := m.RequestAsync(method, path, args, nil)
+	if err != nil {
+		return err
+	}
+	resource.setJobs(jobs)
+	return m.handleJobs(jobs)
+}
+
+func (m *Manager) handleJobs(jobs []*Job) error {
+	if m.async != nil {
+		m.async.add(jobs)
+		return nil
+	}
+	return m.waitJobs(jobs)
+}
+
+// JobProgress is reported to the WaitAllFunc callback each time a job
+// finishes.
+type JobProgress struct {
+	Job   *Job
+	Err   error
+	Done  int
+	Total int
+}
+
+// WaitAll waits for all jobs concurrently and returns the first failure.
+func WaitAll(ctx context.Context, jobs ...*Job) error {
+	return WaitAllFunc(ctx, nil, jobs...)
+}
+
+// WaitAllFunc is like WaitAll and additionally calls progress after each job
+// finishes. Calls to progress are serialized.
+func WaitAllFunc(ctx context.Context, progress func(JobProgress), jobs ...*Job) error {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		done     int
+		firstErr error
+	)
+
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job *Job) {
+			defer wg.Done()
+			err := job.Wait(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			done++
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			if progress != nil {
+				progress(JobProgress{Job: job, Err: err, Done: done, Total: len(jobs)})
+			}
+		}(job)
+	}
+	wg.Wait()
+
+	return firstErr
+}
@@ -0,0 +1,145 @@
+package rustack_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+// fakeJobs is an API creating and deleting VDCs, with jobs reporting
+// in_progress on their first poll.
+type fakeJobs struct {
+	mu    sync.Mutex
+	jobs  int
+	polls map[string]int
+}
+
+func (f *fakeJobs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := strings.Trim(r.URL.Path, "/")
+	if id, ok := strings.CutPrefix(path, "v1/job/"); ok {
+		f.polls[id]++
+		status := "done"
+		if f.polls[id] == 1 {
+			status = "in_progress"
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "status": status})
+		return
+	}
+	if r.Method != http.MethodGet {
+		f.jobs++
+		w.Header().Set("X-Esu-Tasks", fmt.Sprintf("job-%d", f.jobs))
+	}
+	switch {
+	case r.Method == http.MethodGet && path == "v1/project/project":
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": "project", "name": "project"})
+	case r.Method == http.MethodPost && path == "v1/vdc":
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": fmt.Sprintf("vdc-%d", f.jobs), "name": "vdc"})
+	case r.Method == http.MethodDelete && strings.HasPrefix(path, "v1/vdc/"):
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeJobs(t *testing.T) *rustack.Manager {
+	t.Helper()
+	srv := httptest.NewServer(&fakeJobs{polls: make(map[string]int)})
+	t.Cleanup(srv.Close)
+	m := rustack.NewManager("token")
+	m.BaseURL = srv.URL
+	m.RetryPolicy.InitialBackoff = time.Millisecond
+	return m
+}
+
+func TestAsyncJobsPerCall(t *testing.T) {
+	am := newFakeJobs(t).WithAsync()
+	hypervisor := &rustack.Hypervisor{ID: "kvm"}
+	p, err := am.GetProject("project")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Concurrent callers each get the jobs of their own call.
+	vdcs := make([]*rustack.Vdc, 4)
+	var wg sync.WaitGroup
+	for i := range vdcs {
+		vdc := rustack.NewVdc("vdc", hypervisor)
+		vdcs[i] = &vdc
+		wg.Add(1)
+		go func(vdc *rustack.Vdc) {
+			defer wg.Done()
+			if err := p.CreateVdc(vdc); err != nil {
+				t.Error(err)
+			}
+		}(vdcs[i])
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	var jobs []*rustack.Job
+	for _, vdc := range vdcs {
+		if len(vdc.Jobs()) != 1 {
+			t.Fatalf("vdc %s has jobs %v", vdc.ID, vdc.Jobs())
+		}
+		job := vdc.Jobs()[0]
+		// The VDC IDs follow the job numbers.
+		if seen[job.ID] || job.Status != rustack.JobPending || job.Path != "v1/vdc" || "vdc-"+strings.TrimPrefix(job.ID, "job-") != vdc.ID {
+			t.Fatalf("unexpected job %+v of vdc %s", job, vdc.ID)
+		}
+		seen[job.ID] = true
+		jobs = append(jobs, job)
+	}
+
+	var progress []int
+	err = rustack.WaitAllFunc(context.Background(), func(p rustack.JobProgress) {
+		progress = append(progress, p.Done)
+	}, jobs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(progress) != len(jobs) || progress[len(progress)-1] != len(jobs) {
+		t.Fatalf("progress %v", progress)
+	}
+	for _, vdc := range vdcs {
+		if vdc.Jobs()[0].Status != rustack.JobDone {
+			t.Fatalf("job not done: %+v", vdc.Jobs()[0])
+		}
+	}
+
+	// Deletes record their jobs on the deleted resource.
+	if err := vdcs[0].Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if len(vdcs[0].Jobs()) != 1 || seen[vdcs[0].Jobs()[0].ID] {
+		t.Fatalf("delete jobs %v", vdcs[0].Jobs())
+	}
+	if got := len(am.Jobs()); got != len(vdcs)+1 {
+		t.Fatalf("manager recorded %d jobs, want %d", got, len(vdcs)+1)
+	}
+}
+
+func TestSyncJobsAreDone(t *testing.T) {
+	m := newFakeJobs(t)
+	p, err := m.GetProject("project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vdc := rustack.NewVdc("vdc", &rustack.Hypervisor{ID: "kvm"})
+	if err := p.CreateVdc(&vdc); err != nil {
+		t.Fatal(err)
+	}
+	if len(vdc.Jobs()) != 1 || vdc.Jobs()[0].Status != rustack.JobDone {
+		t.Fatalf("jobs %v", vdc.Jobs())
+	}
+}
@@ -0,0 +1,225 @@
+package rustack
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// BackupRetention is the number of backups kept. Daily backups are taken
+// every day at the policy time, weekly backups on the policy week day.
+type BackupRetention struct {
+	Daily  int `json:"daily"`
+	Weekly int `json:"weekly"`
+}
+
+// BackupPolicy takes scheduled snapshots of the disks it is attached to,
+// directly or through a VM.
+type BackupPolicy struct {
+	jobList
+	manager *Manager
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Vdc     *Vdc   `json:"vdc"`
+	// Time is the start time of the backups in the "15:04" format, UTC.
+	Time string `json:"time"`
+	// WeekDay is the day of the weekly backups, 0 is Sunday.
+	WeekDay   int             `json:"week_day"`
+	Retention BackupRetention `json:"retention"`
+	Vms       []*Vm           `json:"vms"`
+	Disks     []*Disk         `json:"disks"`
+	Locked    bool            `json:"locked,omitempty"`
+	Tags      []Tag           `json:"tags"`
+}
+
+func NewBackupPolicy(name string, startTime string, retention BackupRetention) BackupPolicy {
+	p := BackupPolicy{Name: name, Time: startTime, Retention: retention}
+	return p
+}
+
+func (m *Manager) GetBackupPolicies(extraArgs ...Arguments) (policies []*BackupPolicy, err error) {
+	args := Defaults()
+	args.merge(extraArgs)
+
+	path := "v1/backup_policy"
+	err = m.GetItems(path, args, &policies)
+	for i := range policies {
+		policies[i].setManager(m)
+	}
+	return
+}
+
+func (v *Vdc) GetBackupPolicies(extraArgs ...Arguments) (policies []*BackupPolicy, err error) {
+	args := Arguments{
+		"vdc": v.ID,
+	}
+	args.merge(extraArgs)
+	policies, err = v.manager.GetBackupPolicies(args)
+	return
+}
+
+func (m *Manager) GetBackupPolicy(id string) (policy *BackupPolicy, err error) {
+	path, _ := url.JoinPath("v1/backup_policy", id)
+	err = m.Get(path, Defaults(), &policy)
+	if err != nil {
+		return
+	}
+	policy.setManager(m)
+	return
+}
+
+func (v *Vdc) CreateBackupPolicy(policy *BackupPolicy) error {
+	if err := policy.validate(); err != nil {
+		return err
+	}
+
+	vms := make([]string, len(policy.Vms))
+	for i, vm := range policy.Vms {
+		vms[i] = vm.ID
+	}
+	disks := make([]string, len(policy.Disks))
+	for i, disk := range policy.Disks {
+		disks[i] = disk.ID
+	}
+	args := &struct {
+		Name      string          `json:"name"`
+		Vdc       string          `json:"vdc"`
+		Time      string          `json:"time"`
+		WeekDay   int             `json:"week_day"`
+		Retention BackupRetention `json:"retention"`
+		Vms       []string        `json:"vms"`
+		Disks     []string        `json:"disks"`
+		Tags      []string        `json:"tags"`
+	}{
+		Name:      policy.Name,
+		Vdc:       v.ID,
+		Time:      policy.Time,
+		WeekDay:   policy.WeekDay,
+		Retention: policy.Retention,
+		Vms:       vms,
+		Disks:     disks,
+		Tags:      convertTagsToNames(policy.Tags),
+	}
+
+	err := v.manager.Request("POST", "v1/backup_policy", args, &policy)
+	if err == nil {
+		policy.setManager(v.manager)
+	}
+
+	return err
+}
+
+func (p *BackupPolicy) Update() error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+
+	path, _ := url.JoinPath("v1/backup_policy", p.ID)
+	args := &struct {
+		Name      string          `json:"name"`
+		Time      string          `json:"time"`
+		WeekDay   int             `json:"week_day"`
+		Retention BackupRetention `json:"retention"`
+		Tags      []string        `json:"tags"`
+	}{
+		Name:      p.Name,
+		Time:      p.Time,
+		WeekDay:   p.WeekDay,
+		Retention: p.Retention,
+		Tags:      convertTagsToNames(p.Tags),
+	}
+
+	err := p.manager.Request("PUT", path, args, p)
+	if err == nil {
+		p.setManager(p.manager)
+	}
+
+	return err
+}
+
+func (p *BackupPolicy) AttachVm(vm *Vm) error {
+	return p.attach("attach", "vm", vm.ID)
+}
+
+func (p *BackupPolicy) DetachVm(vm *Vm) error {
+	return p.attach("detach", "vm", vm.ID)
+}
+
+func (p *BackupPolicy) AttachDisk(disk *Disk) error {
+	return p.attach("attach", "disk", disk.ID)
+}
+
+func (p *BackupPolicy) DetachDisk(disk *Disk) error {
+	return p.attach("detach", "disk", disk.ID)
+}
+
+func (p *BackupPolicy) Delete() error {
+	path, _ := url.JoinPath("v1/backup_policy", p.ID)
+	return p.manager.deleteResource(path, p)
+}
+
+func (p BackupPolicy) WaitLock() (err error) {
+	path, _ := url.JoinPath("v1/backup_policy", p.ID)
+	return loopWaitLock(p.manager, path)
+}
+
+func (p *BackupPolicy) attach(action string, kind string, id string) error {
+	path, _ := url.JoinPath("v1/backup_policy", p.ID, action)
+	args := map[string]string{kind: id}
+	err := p.manager.Request("POST", path, args, p)
+	if err == nil {
+		p.setManager(p.manager)
+	}
+	return err
+}
+
+func (p *BackupPolicy) validate() error {
+	if _, err := time.Parse("15:04", p.Time); err != nil {
+		return errors.Errorf("Backup time must be in the HH:MM format, got %q", p.Time)
+	}
+	if p.Retention.Daily < 0 || p.Retention.Weekly < 0 {
+		return errors.Errorf("Backup retention must not be negative, got %d daily and %d weekly", p.Retention.Daily, p.Retention.Weekly)
+	}
+	if p.Retention.Daily == 0 && p.Retention.Weekly == 0 {
+		return errors.New("Backup retention must keep at least one daily or weekly backup")
+	}
+	if p.WeekDay < 0 || p.WeekDay > 6 {
+		return errors.Errorf("Backup week day must be between 0 and 6, got %d", p.WeekDay)
+	}
+	return nil
+}
+
+func (p *BackupPolicy) setManager(m *Manager) {
+	p.manager = m
+	if p.Vdc != nil {
+		p.Vdc.manager = m
+	}
+	for i := range p.Vms {
+		p.Vms[i].manager = m
+	}
+	for i := range p.Disks {
+		p.Disks[i].manager = m
+	}
+}
+
+func (p *BackupPolicy) TagNames() []string {
+	return convertTagsToNames(p.Tags)
+}
+
+func (p *BackupPolicy) tagPath() string {
+	path, _ := url.JoinPath("v1/backup_policy", p.ID)
+	return path
+}
+
+func (p *BackupPolicy) SetTags(tags ...string) error {
+	return p.manager.setTags(p, tags)
+}
+
+func (p *BackupPolicy) AddTags(tags ...string) error {
+	return p.manager.addTags(p, tags)
+}
+
+func (p *BackupPolicy) RemoveTags(tags ...string) error {
+	return p.manager.removeTags(p, tags)
+}
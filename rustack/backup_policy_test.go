@@ -0,0 +1,90 @@
+package rustack_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+	"github.com/rustack-cloud-platform/rcp-go/rustacktest"
+)
+
+func TestBackupPolicyAttach(t *testing.T) {
+	s := rustacktest.NewServer()
+	defer s.Close()
+	m := s.Manager()
+	seededVdc := s.Seed("vdc", map[string]interface{}{"name": "vdc"})
+	vdc, err := m.GetVdc(seededVdc["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm, err := m.GetVm(s.Seed("vm", map[string]interface{}{"name": "vm", "vdc": seededVdc})["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	disk, err := m.GetDisk(s.Seed("disk", map[string]interface{}{"name": "data", "size": 10, "vdc": seededVdc})["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := rustack.NewBackupPolicy("nightly", "25:00", rustack.BackupRetention{Daily: 7})
+	if err := vdc.CreateBackupPolicy(&invalid); err == nil {
+		t.Fatal("invalid time accepted")
+	}
+	policy := rustack.NewBackupPolicy("nightly", "02:30", rustack.BackupRetention{Daily: 7, Weekly: 4})
+	if err := vdc.CreateBackupPolicy(&policy); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func() (vms []string, disks []string) {
+		for _, vm := range policy.Vms {
+			vms = append(vms, vm.ID)
+		}
+		for _, disk := range policy.Disks {
+			disks = append(disks, disk.ID)
+		}
+		return
+	}
+
+	before := len(s.Requests())
+	if err := policy.AttachVm(vm); err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.AttachDisk(disk); err != nil {
+		t.Fatal(err)
+	}
+	// Attaching twice keeps a single entry.
+	if err := policy.AttachDisk(disk); err != nil {
+		t.Fatal(err)
+	}
+	if vms, disks := ids(); !reflect.DeepEqual(vms, []string{vm.ID}) || !reflect.DeepEqual(disks, []string{disk.ID}) {
+		t.Fatalf("attached vms %v, disks %v", vms, disks)
+	}
+	attach := s.Requests()[before]
+	var body map[string]string
+	json.Unmarshal(attach.Body, &body)
+	if attach.Method != "POST" || attach.Path != "v1/backup_policy/"+policy.ID+"/attach" || !reflect.DeepEqual(body, map[string]string{"vm": vm.ID}) {
+		t.Fatalf("attach request %s %s %s", attach.Method, attach.Path, attach.Body)
+	}
+
+	if err := policy.DetachVm(vm); err != nil {
+		t.Fatal(err)
+	}
+	if vms, disks := ids(); len(vms) != 0 || !reflect.DeepEqual(disks, []string{disk.ID}) {
+		t.Fatalf("after detach vms %v, disks %v", vms, disks)
+	}
+	if err := policy.DetachDisk(disk); err != nil {
+		t.Fatal(err)
+	}
+	if vms, disks := ids(); len(vms) != 0 || len(disks) != 0 {
+		t.Fatalf("after detach vms %v, disks %v", vms, disks)
+	}
+
+	// The policy is left unchanged when the API refuses the change.
+	if err := policy.AttachDisk(&rustack.Disk{ID: "missing"}); err == nil {
+		t.Fatal("missing disk attached")
+	}
+	if policy.Name != "nightly" || len(policy.Disks) != 0 {
+		t.Fatalf("policy changed to %+v", policy)
+	}
+}
@@ -0,0 +1,214 @@
+package rustack
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Certificate is a TLS certificate of a project, used by the HTTPS pools of
+// its load balancers. The private key is sent on upload and rotation only,
+// the API never returns it.
+type Certificate struct {
+	jobList
+	manager *Manager
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Project *Project `json:"project"`
+	Locked  bool     `json:"locked"`
+
+	// Certificate is the PEM encoded leaf certificate and Chain the PEM
+	// encoded intermediates, leaf issuer first.
+	Certificate string `json:"certificate"`
+	Chain       string `json:"chain"`
+	PrivateKey  string `json:"private_key,omitempty"`
+}
+
+func NewCertificate(name string, certPEM string, chainPEM string, keyPEM string) Certificate {
+	c := Certificate{
+		Name:        name,
+		Certificate: certPEM,
+		Chain:       chainPEM,
+		PrivateKey:  keyPEM,
+	}
+	return c
+}
+
+// ValidateCertificate parses the PEM encoded certificate, chain and private
+// key and checks that the key matches the certificate and that the
+// certificate and the chain are valid now. The chain may be empty. Errors
+// match ErrValidation.
+func ValidateCertificate(certPEM string, chainPEM string, keyPEM string) (*x509.Certificate, error) {
+	leaves, err := parseCertificates(certPEM)
+	if err != nil {
+		return nil, errors.Wrapf(ErrValidation, "Invalid certificate: %s", err)
+	}
+	if len(leaves) != 1 {
+		return nil, errors.Wrapf(ErrValidation, "Certificate must hold a single certificate, got %d, put intermediates in the chain", len(leaves))
+	}
+	leaf := leaves[0]
+
+	var chain []*x509.Certificate
+	if strings.TrimSpace(chainPEM) != "" {
+		if chain, err = parseCertificates(chainPEM); err != nil {
+			return nil, errors.Wrapf(ErrValidation, "Invalid chain: %s", err)
+		}
+	}
+
+	if _, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM)); err != nil {
+		if block, _ := pem.Decode([]byte(keyPEM)); block == nil || !strings.Contains(block.Type, "PRIVATE KEY") {
+			return nil, errors.Wrap(ErrValidation, "Invalid private key: no PEM private key found")
+		}
+		return nil, errors.Wrapf(ErrValidation, "Private key does not match the certificate: %s", err)
+	}
+
+	now := time.Now()
+	for _, cert := range append([]*x509.Certificate{leaf}, chain...) {
+		if now.After(cert.NotAfter) {
+			return nil, errors.Wrapf(ErrValidation, "Certificate %q expired on %s", cert.Subject.CommonName, cert.NotAfter.Format(time.RFC3339))
+		}
+		if now.Before(cert.NotBefore) {
+			return nil, errors.Wrapf(ErrValidation, "Certificate %q is not valid before %s", cert.Subject.CommonName, cert.NotBefore.Format(time.RFC3339))
+		}
+	}
+	return leaf, nil
+}
+
+func parseCertificates(data string) (certs []*x509.Certificate, err error) {
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, errors.Errorf("unexpected PEM block %q", block.Type)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM certificate found")
+	}
+	if strings.TrimSpace(string(rest)) != "" {
+		return nil, errors.New("trailing data after the last PEM block")
+	}
+	return certs, nil
+}
+
+// X509 parses the leaf certificate, e.g. to read its names and expiry.
+func (c *Certificate) X509() (*x509.Certificate, error) {
+	certs, err := parseCertificates(c.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	return certs[0], nil
+}
+
+func (m *Manager) GetCertificates(extraArgs ...Arguments) (certificates []*Certificate, err error) {
+	args := Defaults()
+	args.merge(extraArgs)
+
+	path := "v1/certificate"
+	err = m.GetItems(path, args, &certificates)
+	for i := range certificates {
+		certificates[i].manager = m
+	}
+	return
+}
+
+func (m *Manager) IterCertificates(ctx context.Context, args Arguments, opts ...IterOption) *Iterator[*Certificate] {
+	return NewIterator(ctx, m, "v1/certificate", args, func(c *Certificate) {
+		c.manager = m
+	}, opts...)
+}
+
+func (p *Project) GetCertificates(extraArgs ...Arguments) (certificates []*Certificate, err error) {
+	args := Arguments{
+		"project": p.ID,
+	}
+
+	args.merge(extraArgs)
+	certificates, err = p.manager.GetCertificates(args)
+	return
+}
+
+func (m *Manager) GetCertificate(id string) (certificate *Certificate, err error) {
+	path, _ := url.JoinPath("v1/certificate", id)
+	err = m.Get(path, Defaults(), &certificate)
+	if err != nil {
+		return
+	}
+	certificate.manager = m
+	return
+}
+
+// CreateCertificate validates the certificate locally with
+// ValidateCertificate and uploads it.
+func (p *Project) CreateCertificate(certificate *Certificate) (err error) {
+	if _, err = ValidateCertificate(certificate.Certificate, certificate.Chain, certificate.PrivateKey); err != nil {
+		return
+	}
+	args := &struct {
+		Name        string `json:"name"`
+		Project     string `json:"project"`
+		Certificate string `json:"certificate"`
+		Chain       string `json:"chain"`
+		PrivateKey  string `json:"private_key"`
+	}{
+		Name:        certificate.Name,
+		Project:     p.ID,
+		Certificate: certificate.Certificate,
+		Chain:       certificate.Chain,
+		PrivateKey:  certificate.PrivateKey,
+	}
+
+	err = p.manager.Request("POST", "v1/certificate", args, certificate)
+	certificate.manager = p.manager
+	certificate.PrivateKey = ""
+	return
+}
+
+// Rotate replaces the certificate, chain and key in place, so the pools
+// using the certificate serve the new one without being updated. The new
+// material is validated locally first.
+func (c *Certificate) Rotate(certPEM string, chainPEM string, keyPEM string) error {
+	if _, err := ValidateCertificate(certPEM, chainPEM, keyPEM); err != nil {
+		return err
+	}
+	args := &struct {
+		Name        string `json:"name"`
+		Certificate string `json:"certificate"`
+		Chain       string `json:"chain"`
+		PrivateKey  string `json:"private_key"`
+	}{
+		Name:        c.Name,
+		Certificate: certPEM,
+		Chain:       chainPEM,
+		PrivateKey:  keyPEM,
+	}
+	path, _ := url.JoinPath("v1/certificate", c.ID)
+	err := c.manager.Request("PUT", path, args, c)
+	c.PrivateKey = ""
+	return err
+}
+
+func (c *Certificate) Delete() error {
+	path, _ := url.JoinPath("v1/certificate", c.ID)
+	return c.manager.deleteResource(path, c)
+}
+
+func (c Certificate) WaitLock() (err error) {
+	path, _ := url.JoinPath("v1/certificate", c.ID)
+	return loopWaitLock(c.manager, path)
+}
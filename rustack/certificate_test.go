@@ -0,0 +1,115 @@
+package rustack_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  string
+}
+
+// newTestCert issues a certificate valid between notBefore and notAfter,
+// self-signed when parent is nil.
+func newTestCert(t *testing.T, name string, notBefore time.Time, notAfter time.Time, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+	}
+	issuer, signer := template, key
+	if parent != nil {
+		issuer, signer = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key, pem: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))}
+}
+
+func (c *testCert) keyPEM(t *testing.T) string {
+	t.Helper()
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+}
+
+func TestValidateCertificate(t *testing.T) {
+	now := time.Now()
+	valid := func(name string, parent *testCert) *testCert {
+		return newTestCert(t, name, now.Add(-time.Hour), now.Add(24*time.Hour), parent)
+	}
+	ca := valid("ca", nil)
+	leaf := valid("shop.example", ca)
+	other := valid("other.example", ca)
+	expired := newTestCert(t, "expired.example", now.Add(-48*time.Hour), now.Add(-24*time.Hour), ca)
+	future := newTestCert(t, "future.example", now.Add(24*time.Hour), now.Add(48*time.Hour), ca)
+	expiredCA := newTestCert(t, "old ca", now.Add(-48*time.Hour), now.Add(-time.Hour), nil)
+	keyBlock := leaf.keyPEM(t)
+
+	tests := []struct {
+		name  string
+		cert  string
+		chain string
+		key   string
+		err   string
+	}{
+		{name: "valid", cert: leaf.pem, chain: ca.pem, key: keyBlock},
+		{name: "no chain", cert: leaf.pem, key: keyBlock},
+		{name: "mismatched key", cert: leaf.pem, chain: ca.pem, key: other.keyPEM(t), err: "Private key does not match"},
+		{name: "no key", cert: leaf.pem, key: leaf.pem, err: "no PEM private key found"},
+		{name: "expired", cert: expired.pem, key: expired.keyPEM(t), err: `"expired.example" expired`},
+		{name: "not yet valid", cert: future.pem, key: future.keyPEM(t), err: `"future.example" is not valid before`},
+		{name: "not a certificate", cert: keyBlock, key: keyBlock, err: `unexpected PEM block "EC PRIVATE KEY"`},
+		{name: "no certificate", cert: "shop.example", key: keyBlock, err: "no PEM certificate found"},
+		{name: "trailing data", cert: leaf.pem + "garbage", key: keyBlock, err: "trailing data"},
+		{name: "more than one leaf", cert: leaf.pem + ca.pem, key: keyBlock, err: "single certificate, got 2"},
+		{name: "bad chain", cert: leaf.pem, chain: ca.pem + keyBlock, key: keyBlock, err: "Invalid chain"},
+		{name: "expired chain", cert: leaf.pem, chain: expiredCA.pem, key: keyBlock, err: `"old ca" expired`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rustack.ValidateCertificate(tt.cert, tt.chain, tt.key)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Subject.CommonName != "shop.example" {
+					t.Fatalf("got leaf %q", got.Subject.CommonName)
+				}
+				return
+			}
+			if err == nil || !errors.Is(err, rustack.ErrValidation) || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("got %v, want a validation error with %q", err, tt.err)
+			}
+		})
+	}
+}
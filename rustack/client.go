@@ -1,6 +1,7 @@
 package rustack
 
 import (
+	"context"
 	"net/url"
 )
 
@@ -24,6 +25,12 @@ func (m *Manager) GetClients(extraArgs ...Arguments) (clients []*Client, err err
 	return
 }
 
+func (m *Manager) IterClients(ctx context.Context, args Arguments, opts ...IterOption) *Iterator[*Client] {
+	return NewIterator(ctx, m, "v1/client", args, func(client *Client) {
+		client.manager = m
+	}, opts...)
+}
+
 func (m *Manager) GetClient(id string) (client *Client, err error) {
 	path, _ := url.JoinPath("v1/client", id)
 	err = m.Get(path, Defaults(), &client)
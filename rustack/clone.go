@@ -0,0 +1,702 @@
+package rustack
+
+import (
+	"net/netip"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+const randomFloating = "RANDOM_FIP"
+
+type CloneOptions struct {
+	// Name of the new VDC, the name of the source when empty.
+	Name string
+	// Hypervisor of the new VDC, the hypervisor of the source when nil.
+	Hypervisor *Hypervisor
+	// Rename returns the name of a cloned resource from its kind (network,
+	// firewall_template, router, vm, disk, load_balancer or dns_record) and
+	// source name. Names are kept when nil. The host of DNS records is
+	// renamed, so that a copy in the same zone does not clash.
+	Rename func(kind string, name string) string
+	// CIDRs maps source subnets to the subnets of the clone, e.g.
+	// "10.0.1.0/24" to "10.1.1.0/24". Both must have the same prefix length.
+	// Addresses in a mapped subnet keep their host part, other subnets and
+	// addresses are kept as is.
+	CIDRs map[string]string
+	// SkipDataDisks clones VMs with their root disk only and skips disks
+	// not attached to a VM.
+	SkipDataDisks bool
+	// DnsZones maps the names of source DNS zones to the zones the clone's
+	// records are created in. Records of the source project pointing to an
+	// address of the source VDC are copied with the matching address of the
+	// clone. Records are not cloned when empty.
+	DnsZones map[string]*Dns
+}
+
+// CloneResult describes a clone, also when CloneVdc failed half way.
+type CloneResult struct {
+	// Vdc is the new VDC, nil if it could not be created.
+	Vdc *Vdc
+	// IDs maps the ID of every source resource to the ID of its clone.
+	IDs map[string]string
+}
+
+// CloneVdc creates a copy of a VDC in the target project, which may be the
+// source project. Networks, subnets, firewall templates and rules, routers
+// and routes, VMs with their disks, load balancers and pools and DNS records
+// are cloned. Kubernetes clusters, with their VMs and load balancers, are
+// not.
+//
+// VMs are created from the same template, matched by name when the target
+// VDC lists no template with the source ID, and so are storage profiles.
+// Firewall templates available in the new VDC under the same name, such as
+// the default ones, are used instead of copies. VMs, routers and load
+// balancers with a floating IP get a new random one.
+//
+// Nothing is rolled back on failure: the returned result lists what was
+// created so far.
+func CloneVdc(source *Vdc, targetProject *Project, opts CloneOptions) (*CloneResult, error) {
+	c := &cloner{
+		source:    source,
+		opts:      opts,
+		result:    &CloneResult{IDs: make(map[string]string)},
+		cidrs:     make(map[netip.Prefix]netip.Prefix, len(opts.CIDRs)),
+		networks:  make(map[string]*Network),
+		templates: make(map[string]*FirewallTemplate),
+		vms:       make(map[string]*Vm),
+		addresses: make(map[string]string),
+	}
+	for from, to := range opts.CIDRs {
+		src, err := netip.ParsePrefix(from)
+		if err != nil {
+			return c.result, errors.Wrapf(err, "Invalid CIDR %s", from)
+		}
+		dst, err := netip.ParsePrefix(to)
+		if err != nil {
+			return c.result, errors.Wrapf(err, "Invalid CIDR %s", to)
+		}
+		if src.Bits() != dst.Bits() || src.Addr().Is4() != dst.Addr().Is4() {
+			return c.result, errors.Errorf("Cannot map %s to %s, the prefix lengths differ", from, to)
+		}
+		c.cidrs[src.Masked()] = dst.Masked()
+	}
+
+	hypervisor := opts.Hypervisor
+	if hypervisor == nil {
+		hypervisor = &source.Hypervisor
+	}
+	name := opts.Name
+	if name == "" {
+		name = source.Name
+	}
+	vdc := NewVdc(name, hypervisor)
+	vdc.Tags = source.Tags
+	if err := targetProject.CreateVdc(&vdc); err != nil {
+		return c.result, errors.Wrapf(err, "Cannot create vdc %s", name)
+	}
+	if err := vdc.WaitLock(); err != nil {
+		return c.result, err
+	}
+	c.target = &vdc
+	c.result.Vdc = &vdc
+	c.result.IDs[source.ID] = vdc.ID
+
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"firewall templates", c.cloneFirewallTemplates},
+		{"networks", c.cloneNetworks},
+		{"routers", c.cloneRouters},
+		{"vms", c.cloneVms},
+		{"disks", c.cloneDisks},
+		{"load balancers", c.cloneLoadBalancers},
+		{"dns records", c.cloneDnsRecords},
+	}
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			return c.result, errors.Wrapf(err, "Cannot clone %s of vdc %s", step.name, source.Name)
+		}
+	}
+	return c.result, nil
+}
+
+type cloner struct {
+	source *Vdc
+	target *Vdc
+	opts   CloneOptions
+	result *CloneResult
+	cidrs  map[netip.Prefix]netip.Prefix
+
+	// Clones by source ID.
+	networks  map[string]*Network
+	templates map[string]*FirewallTemplate
+	vms       map[string]*Vm
+	// addresses maps the IP addresses of source resources to the addresses
+	// of their clones, for DNS records.
+	addresses map[string]string
+
+	targetTemplates []*Template
+	targetProfiles  []*StorageProfile
+}
+
+func (c *cloner) name(kind string, name string) string {
+	if c.opts.Rename == nil {
+		return name
+	}
+	return c.opts.Rename(kind, name)
+}
+
+func (c *cloner) created(sourceID string, cloneID string) {
+	c.result.IDs[sourceID] = cloneID
+}
+
+// address maps an IP address into the target subnets.
+func (c *cloner) address(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	for src, dst := range c.cidrs {
+		if !src.Contains(addr) {
+			continue
+		}
+		from, to, a := src.Addr().AsSlice(), dst.Addr().AsSlice(), addr.AsSlice()
+		for i := range a {
+			a[i] = to[i] | (a[i] &^ from[i])
+		}
+		mapped, _ := netip.AddrFromSlice(a)
+		return mapped.String()
+	}
+	return ip
+}
+
+// cidr maps a subnet into the target subnets.
+func (c *cloner) cidr(cidr string) string {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return cidr
+	}
+	if dst, ok := c.cidrs[prefix.Masked()]; ok {
+		return dst.String()
+	}
+	return cidr
+}
+
+func (c *cloner) addressPtr(ip *string) *string {
+	if ip == nil {
+		return nil
+	}
+	mapped := c.address(*ip)
+	return &mapped
+}
+
+func (c *cloner) cloneFirewallTemplates() error {
+	sources, err := c.source.GetFirewallTemplates()
+	if err != nil {
+		return err
+	}
+	existing, err := c.target.GetFirewallTemplates()
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]*FirewallTemplate, len(existing))
+	for _, fw := range existing {
+		byName[fw.Name] = fw
+	}
+
+	for _, src := range sources {
+		if fw, ok := byName[src.Name]; ok {
+			c.templates[src.ID] = fw
+			continue
+		}
+		fw := NewFirewallTemplate(c.name("firewall_template", src.Name))
+		fw.Tags = src.Tags
+		if err := c.target.CreateFirewallTemplate(&fw); err != nil {
+			return errors.Wrapf(err, "Cannot create firewall template %s", fw.Name)
+		}
+		c.templates[src.ID] = &fw
+		c.created(src.ID, fw.ID)
+
+		rules, err := c.source.manager.GetFirewallRules(src.ID)
+		if err != nil {
+			return err
+		}
+		for _, r := range rules {
+			rule := FirewallRule{
+				Name: r.Name, DestinationIp: r.DestinationIp, Direction: r.Direction, Protocol: r.Protocol,
+				DstPortRangeMin: r.DstPortRangeMin, DstPortRangeMax: r.DstPortRangeMax,
+			}
+			if err := fw.CreateFirewallRule(&rule); err != nil {
+				return errors.Wrapf(err, "Cannot create firewall rule %s", r.Name)
+			}
+			c.created(r.ID, rule.ID)
+		}
+	}
+	return nil
+}
+
+func (c *cloner) firewallTemplates(port *Port) []*FirewallTemplate {
+	templates := make([]*FirewallTemplate, 0, len(port.FirewallTemplates))
+	for _, fw := range port.FirewallTemplates {
+		if clone, ok := c.templates[fw.ID]; ok {
+			templates = append(templates, clone)
+		}
+	}
+	return templates
+}
+
+func (c *cloner) cloneNetworks() error {
+	sources, err := c.source.GetNetworks()
+	if err != nil {
+		return err
+	}
+	existing, err := c.target.GetNetworks()
+	if err != nil {
+		return err
+	}
+	var defaultNetwork *Network
+	for _, network := range existing {
+		if network.IsDefault {
+			defaultNetwork = network
+		}
+	}
+
+	for _, src := range sources {
+		// The default network of a new VDC is created with a subnet.
+		if src.IsDefault && defaultNetwork != nil {
+			c.networks[src.ID] = defaultNetwork
+			c.created(src.ID, defaultNetwork.ID)
+			if len(defaultNetwork.Subnets) > 0 {
+				continue
+			}
+		} else {
+			network := NewNetwork(c.name("network", src.Name))
+			network.Mtu = src.Mtu
+			network.Tags = src.Tags
+			if err := c.target.CreateNetwork(&network); err != nil {
+				return errors.Wrapf(err, "Cannot create network %s", network.Name)
+			}
+			c.networks[src.ID] = &network
+			c.created(src.ID, network.ID)
+		}
+
+		subnets, err := src.GetSubnets()
+		if err != nil {
+			return err
+		}
+		for _, s := range subnets {
+			subnet := NewSubnet(c.cidr(s.CIDR), c.address(s.Gateway), c.address(s.StartIp), c.address(s.EndIp), s.IsDHCP)
+			for _, dns := range s.DnsServers {
+				server := NewSubnetDNSServer(dns.DNSServer)
+				subnet.DnsServers = append(subnet.DnsServers, &server)
+			}
+			for _, r := range s.SubnetRoutes {
+				route := NewSubnetRoute(c.cidr(r.CIDR), c.address(r.Gateway), r.Metric)
+				subnet.SubnetRoutes = append(subnet.SubnetRoutes, &route)
+			}
+			if err := c.networks[src.ID].CreateSubnet(&subnet); err != nil {
+				return errors.Wrapf(err, "Cannot create subnet %s", subnet.CIDR)
+			}
+			c.created(s.ID, subnet.ID)
+		}
+	}
+	return nil
+}
+
+// port returns a new port of the clone for a source port, or nil when the
+// network of the source port was not cloned.
+func (c *cloner) port(src *Port) *Port {
+	if src.Network == nil {
+		return nil
+	}
+	network, ok := c.networks[src.Network.ID]
+	if !ok {
+		return nil
+	}
+	return &Port{
+		Network:           network,
+		IpAddress:         c.addressPtr(src.IpAddress),
+		FirewallTemplates: c.firewallTemplates(src),
+		Tags:              src.Tags,
+	}
+}
+
+func (c *cloner) floating(src *Port) *Port {
+	if src == nil {
+		return nil
+	}
+	floating := randomFloating
+	return &Port{IpAddress: &floating}
+}
+
+func (c *cloner) cloneRouters() error {
+	sources, err := c.source.GetRouters()
+	if err != nil {
+		return err
+	}
+	existing, err := c.target.GetRouters()
+	if err != nil {
+		return err
+	}
+	var defaultRouter *Router
+	for _, router := range existing {
+		if router.IsDefault {
+			defaultRouter = router
+		}
+	}
+
+	for _, src := range sources {
+		var router *Router
+		if src.IsDefault && defaultRouter != nil {
+			router = defaultRouter
+			connected := map[string]bool{}
+			for _, port := range router.Ports {
+				if port.Network != nil {
+					connected[port.Network.ID] = true
+				}
+			}
+			for _, srcPort := range src.Ports {
+				port := c.port(srcPort)
+				if port == nil || connected[port.Network.ID] {
+					continue
+				}
+				if err := router.ConnectPort(port, false); err != nil {
+					return errors.Wrapf(err, "Cannot connect router %s to network %s", router.Name, port.Network.Name)
+				}
+				c.created(srcPort.ID, port.ID)
+			}
+		} else {
+			var ports []*Port
+			for _, srcPort := range src.Ports {
+				port := c.port(srcPort)
+				if port == nil {
+					continue
+				}
+				if err := c.target.CreateEmptyPort(port); err != nil {
+					return errors.Wrapf(err, "Cannot create port of router %s", src.Name)
+				}
+				ports = append(ports, port)
+				c.created(srcPort.ID, port.ID)
+			}
+			clone := NewRouter(c.name("router", src.Name), nil)
+			clone.Floating = c.floating(src.Floating)
+			clone.Tags = src.Tags
+			if err := c.target.CreateRouter(&clone, ports...); err != nil {
+				return errors.Wrapf(err, "Cannot create router %s", clone.Name)
+			}
+			router = &clone
+		}
+		c.created(src.ID, router.ID)
+		c.mapFloating(src.Floating, router.Floating)
+
+		for _, r := range src.Routes {
+			route := NewRoute(c.cidr(r.Destination), c.address(r.NextHop))
+			if err := router.CreateRoute(&route); err != nil {
+				return errors.Wrapf(err, "Cannot create route to %s", route.Destination)
+			}
+			c.created(r.ID, route.ID)
+		}
+	}
+	return nil
+}
+
+func (c *cloner) mapFloating(src *Port, clone *Port) {
+	if src != nil && src.IpAddress != nil && clone != nil && clone.IpAddress != nil {
+		c.addresses[*src.IpAddress] = *clone.IpAddress
+	}
+}
+
+func (c *cloner) template(src *Template) (*Template, error) {
+	if c.targetTemplates == nil {
+		templates, err := c.target.GetTemplates()
+		if err != nil {
+			return nil, err
+		}
+		c.targetTemplates = templates
+	}
+	return matchByIDOrName(c.targetTemplates, src.ID, src.Name, "template",
+		func(t *Template) (string, string) { return t.ID, t.Name })
+}
+
+func (c *cloner) storageProfile(src *StorageProfile) (*StorageProfile, error) {
+	if c.targetProfiles == nil {
+		profiles, err := c.target.GetStorageProfiles()
+		if err != nil {
+			return nil, err
+		}
+		c.targetProfiles = profiles
+	}
+	return matchByIDOrName(c.targetProfiles, src.ID, src.Name, "storage profile",
+		func(p *StorageProfile) (string, string) { return p.ID, p.Name })
+}
+
+func matchByIDOrName[T any](items []T, id string, name string, kind string, key func(T) (string, string)) (match T, err error) {
+	for _, item := range items {
+		if itemID, _ := key(item); itemID == id {
+			return item, nil
+		}
+	}
+	for _, item := range items {
+		if _, itemName := key(item); itemName == name {
+			return item, nil
+		}
+	}
+	err = errors.Errorf("No %s %s in the target vdc", kind, name)
+	return
+}
+
+func (c *cloner) disk(src *Disk) (*Disk, error) {
+	if src.StorageProfile == nil {
+		return nil, errors.Errorf("Disk %s has no storage profile", src.Name)
+	}
+	profile, err := c.storageProfile(src.StorageProfile)
+	if err != nil {
+		return nil, err
+	}
+	disk := NewDisk(c.name("disk", src.Name), src.Size, profile)
+	disk.Tags = src.Tags
+	return &disk, nil
+}
+
+func (c *cloner) cloneVms() error {
+	sources, err := c.source.GetVms()
+	if err != nil {
+		return err
+	}
+	for _, src := range sources {
+		if src.Kubernetes != nil {
+			continue
+		}
+		if src.Template == nil {
+			return errors.Errorf("Vm %s has no template", src.Name)
+		}
+		template, err := c.template(src.Template)
+		if err != nil {
+			return err
+		}
+
+		// The first disk is the root disk.
+		srcDisks := make([]*Disk, 0, len(src.Disks))
+		for _, d := range src.Disks {
+			if d.IsRoot || !c.opts.SkipDataDisks {
+				srcDisks = append(srcDisks, d)
+			}
+		}
+		sort.SliceStable(srcDisks, func(i, j int) bool { return srcDisks[i].IsRoot && !srcDisks[j].IsRoot })
+		disks := make([]*Disk, 0, len(srcDisks))
+		for _, d := range srcDisks {
+			disk, err := c.disk(d)
+			if err != nil {
+				return err
+			}
+			disks = append(disks, disk)
+		}
+
+		var ports []*Port
+		srcPorts := map[*Port]*Port{}
+		for _, srcPort := range src.Ports {
+			port := c.port(srcPort)
+			if port == nil {
+				continue
+			}
+			if err := c.target.CreateEmptyPort(port); err != nil {
+				return errors.Wrapf(err, "Cannot create port of vm %s", src.Name)
+			}
+			ports = append(ports, port)
+			srcPorts[port] = srcPort
+		}
+
+		vm := NewVm(c.name("vm", src.Name), src.Cpu, src.Ram, template, src.Metadata, src.UserData, ports, disks, nil)
+		vm.Floating = c.floating(src.Floating)
+		vm.Tags = src.Tags
+		if err := c.target.CreateVm(&vm); err != nil {
+			return errors.Wrapf(err, "Cannot create vm %s", vm.Name)
+		}
+		c.vms[src.ID] = &vm
+		c.created(src.ID, vm.ID)
+		c.mapFloating(src.Floating, vm.Floating)
+		for _, port := range ports {
+			c.created(srcPorts[port].ID, port.ID)
+			c.mapFloating(srcPorts[port], port)
+		}
+		clones, err := matchDisks(disks, vm.Disks)
+		if err != nil {
+			return errors.Wrapf(err, "Cannot map disks of vm %s", vm.Name)
+		}
+		for i, d := range srcDisks {
+			c.created(d.ID, clones[i].ID)
+		}
+
+		if !src.Power {
+			if err := vm.PowerOff(); err != nil {
+				return errors.Wrapf(err, "Cannot power off vm %s", vm.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// matchDisks returns the disk of a created vm for each of the requested
+// disks. The API does not keep their order, so disks are matched by name and
+// then by size and storage profile.
+func matchDisks(requested []*Disk, created []*Disk) ([]*Disk, error) {
+	matched := make([]*Disk, len(requested))
+	used := make(map[*Disk]bool, len(created))
+	for i, want := range requested {
+		for _, d := range created {
+			if !used[d] && d.Name == want.Name {
+				matched[i], used[d] = d, true
+				break
+			}
+		}
+	}
+	for i, want := range requested {
+		if matched[i] != nil {
+			continue
+		}
+		for _, d := range created {
+			if !used[d] && d.Size == want.Size && d.StorageProfile != nil && d.StorageProfile.ID == want.StorageProfile.ID {
+				matched[i], used[d] = d, true
+				break
+			}
+		}
+		if matched[i] == nil {
+			return nil, errors.Errorf("No disk matches %s", want.Name)
+		}
+	}
+	return matched, nil
+}
+
+func (c *cloner) cloneDisks() error {
+	if c.opts.SkipDataDisks {
+		return nil
+	}
+	sources, err := c.source.GetDisks()
+	if err != nil {
+		return err
+	}
+	for _, src := range sources {
+		if src.Vm != nil {
+			continue
+		}
+		disk, err := c.disk(src)
+		if err != nil {
+			return err
+		}
+		if err := c.target.CreateDisk(disk); err != nil {
+			return errors.Wrapf(err, "Cannot create disk %s", disk.Name)
+		}
+		c.created(src.ID, disk.ID)
+	}
+	return nil
+}
+
+func (c *cloner) cloneLoadBalancers() error {
+	sources, err := c.source.GetLoadBalancers()
+	if err != nil {
+		return err
+	}
+	for _, src := range sources {
+		if src.Kubernetes != nil || src.Port == nil {
+			continue
+		}
+		port := c.port(src.Port)
+		if port == nil {
+			continue
+		}
+		lb := NewLoadBalancer(c.name("load_balancer", src.Name), c.target, port, c.floating(src.Floating))
+		lb.Tags = src.Tags
+		if err := lb.Create(); err != nil {
+			return errors.Wrapf(err, "Cannot create load balancer %s", lb.Name)
+		}
+		c.created(src.ID, lb.ID)
+		c.mapFloating(src.Floating, lb.Floating)
+		c.mapFloating(src.Port, lb.Port)
+
+		pools, err := src.GetPools()
+		if err != nil {
+			return err
+		}
+		for _, p := range pools {
+			var members []*PoolMember
+			for _, m := range p.Members {
+				if m.Vm == nil || c.vms[m.Vm.ID] == nil {
+					continue
+				}
+				member := NewLoadBalancerPoolMember(m.Port, m.Weight, c.vms[m.Vm.ID])
+				members = append(members, &member)
+			}
+			persistence := ""
+			if p.SessionPersistence != nil {
+				persistence = *p.SessionPersistence
+			}
+			pool := NewLoadBalancerPool(lb, p.Port, p.Connlimit, members, p.Method, p.Protocol, persistence)
+			pool.HealthMonitor = p.HealthMonitor
+			if pool.Certificate, err = c.certificate(p.Certificate); err != nil {
+				return err
+			}
+			if err := lb.CreatePool(&pool); err != nil {
+				return errors.Wrapf(err, "Cannot create pool %d of load balancer %s", p.Port, lb.Name)
+			}
+			c.created(p.ID, pool.ID)
+		}
+	}
+	return nil
+}
+
+// certificate returns the certificate to use in the target project. Private
+// keys cannot be read back, so certificates are not copied to another project
+// but matched by name there.
+func (c *cloner) certificate(src *Certificate) (*Certificate, error) {
+	if src == nil || c.source.Project.ID == c.target.Project.ID {
+		return src, nil
+	}
+	certificates, err := c.target.manager.GetCertificates(Arguments{"project": c.target.Project.ID})
+	if err != nil {
+		return nil, err
+	}
+	for _, certificate := range certificates {
+		if certificate.Name == src.Name {
+			return certificate, nil
+		}
+	}
+	return nil, errors.Errorf("Certificate %s not found in project %s, upload it first", src.Name, c.target.Project.Name)
+}
+
+func (c *cloner) cloneDnsRecords() error {
+	if len(c.opts.DnsZones) == 0 || len(c.addresses) == 0 {
+		return nil
+	}
+	project, err := c.source.manager.GetProject(c.source.Project.ID)
+	if err != nil {
+		return err
+	}
+	zones, err := project.GetDnss()
+	if err != nil {
+		return err
+	}
+	for _, zone := range zones {
+		target, ok := c.opts.DnsZones[zone.Name]
+		if !ok {
+			continue
+		}
+		records, err := zone.GetDnsRecords()
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			data, ok := c.addresses[r.Data]
+			if !ok {
+				continue
+			}
+			record := NewDnsRecord(data, r.Flag, c.name("dns_record", r.Host), r.Port, r.Priority, r.Tag, r.Ttl, r.Type, r.Weight)
+			if err := target.CreateDnsRecord(&record); err != nil {
+				return errors.Wrapf(err, "Cannot create dns record %s %s", record.Type, record.Host)
+			}
+			c.created(r.ID, record.ID)
+		}
+	}
+	return nil
+}
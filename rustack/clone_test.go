@@ -0,0 +1,72 @@
+package rustack
+
+import "testing"
+
+func TestMatchDisks(t *testing.T) {
+	fast := &StorageProfile{ID: "fast"}
+	slow := &StorageProfile{ID: "slow"}
+	requested := []*Disk{
+		{Name: "root", Size: 10, StorageProfile: fast},
+		{Name: "data", Size: 50, StorageProfile: slow},
+		{Name: "logs", Size: 50, StorageProfile: fast},
+	}
+
+	tests := []struct {
+		name    string
+		created []*Disk
+		want    []string
+	}{
+		{
+			name: "by name",
+			created: []*Disk{
+				{ID: "3", Name: "logs", Size: 50, StorageProfile: fast},
+				{ID: "1", Name: "root", Size: 10, StorageProfile: fast},
+				{ID: "2", Name: "data", Size: 50, StorageProfile: slow},
+			},
+			want: []string{"1", "2", "3"},
+		},
+		{
+			name: "renamed by the api",
+			created: []*Disk{
+				{ID: "3", Name: "Disk 3", Size: 50, StorageProfile: fast},
+				{ID: "2", Name: "Disk 2", Size: 50, StorageProfile: slow},
+				{ID: "1", Name: "Disk 1", Size: 10, StorageProfile: fast},
+			},
+			want: []string{"1", "2", "3"},
+		},
+		{
+			name: "missing",
+			created: []*Disk{
+				{ID: "1", Name: "root", Size: 10, StorageProfile: fast},
+				{ID: "2", Name: "data", Size: 50, StorageProfile: slow},
+			},
+		},
+		{
+			name: "different size",
+			created: []*Disk{
+				{ID: "1", Name: "root", Size: 10, StorageProfile: fast},
+				{ID: "2", Name: "data", Size: 50, StorageProfile: slow},
+				{ID: "3", Name: "Disk 3", Size: 60, StorageProfile: fast},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched, err := matchDisks(requested, tt.created)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatal("expected an unmatched disk error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, d := range matched {
+				if d.ID != tt.want[i] {
+					t.Fatalf("disk %s matched %s, want %s", requested[i].Name, d.ID, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package rustack_test
+
+import (
+	"testing"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+	"github.com/rustack-cloud-platform/rcp-go/rustacktest"
+)
+
+func TestCloneVdc(t *testing.T) {
+	s := rustacktest.NewServer()
+	defer s.Close()
+	m := s.Manager()
+
+	project := s.Seed("project", map[string]interface{}{"name": "shop"})
+	prod := s.Seed("vdc", map[string]interface{}{"name": "prod", "project": project["id"], "hypervisor": map[string]interface{}{"id": "h", "name": "VMware"}})
+	vdcID := prod["id"].(string)
+	template := s.Seed("template", map[string]interface{}{"name": "Ubuntu 22.04"})
+	profile := s.Seed("storage_profile", map[string]interface{}{"name": "ssd"})
+	fw := s.Seed("firewall", map[string]interface{}{"name": "web", "vdc": vdcID})
+	rule := s.Seed("firewall/"+fw["id"].(string)+"/rule", map[string]interface{}{"name": "http", "direction": "ingress", "protocol": "tcp"})
+	network := s.Seed("network", map[string]interface{}{"name": "backend", "vdc": vdcID})
+	subnet := s.Seed("network/"+network["id"].(string)+"/subnet", map[string]interface{}{
+		"cidr": "10.0.1.0/24", "gateway": "10.0.1.1", "start_ip": "10.0.1.10", "end_ip": "10.0.1.250", "enable_dhcp": true,
+	})
+	vm := s.Seed("vm", map[string]interface{}{
+		"name": "web", "vdc": vdcID, "cpu": 2, "ram": 4, "power": false, "template": template["id"],
+		"disks": []interface{}{
+			map[string]interface{}{"name": "root", "size": 10, "storage_profile": profile["id"]},
+			map[string]interface{}{"name": "data", "size": 50, "storage_profile": profile["id"]},
+		},
+	})
+	port := s.Seed("port", map[string]interface{}{
+		"vdc": vdcID, "network": network["id"], "ip_address": "10.0.1.20", "vm": vm["id"],
+		"fw_templates": []interface{}{fw["id"]},
+	})
+	archive := s.Seed("disk", map[string]interface{}{"name": "archive", "size": 100, "vdc": vdcID, "storage_profile": profile["id"]})
+
+	source, err := m.GetVdc(vdcID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := m.GetProject(project["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := rustack.CloneVdc(source, target, rustack.CloneOptions{
+		Name:   "stage",
+		Rename: func(kind string, name string) string { return name + "-stage" },
+		CIDRs:  map[string]string{"10.0.1.0/24": "10.1.1.0/24"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Vdc == nil || result.Vdc.Name != "stage" || result.IDs[vdcID] != result.Vdc.ID {
+		t.Fatalf("cloned vdc %+v", result.Vdc)
+	}
+
+	var rootID, dataID string
+	for _, disk := range s.Objects("disk") {
+		if disk["vm"] != nil && disk["vm"].(map[string]interface{})["id"] == vm["id"] {
+			if disk["name"] == "root" {
+				rootID = disk["id"].(string)
+			} else {
+				dataID = disk["id"].(string)
+			}
+		}
+	}
+	// Every source resource maps to a clone of the same kind.
+	clone := func(collection string, id string) map[string]interface{} {
+		t.Helper()
+		cloneID, ok := result.IDs[id]
+		if !ok || cloneID == id {
+			t.Fatalf("%s %s not cloned", collection, id)
+		}
+		obj := s.Object(collection, cloneID)
+		if obj == nil {
+			t.Fatalf("clone %s of %s %s not found", cloneID, collection, id)
+		}
+		return obj
+	}
+	refID := func(value interface{}) interface{} {
+		ref, _ := value.(map[string]interface{})
+		return ref["id"]
+	}
+
+	fwClone := clone("firewall", fw["id"].(string))
+	if fwClone["name"] != "web-stage" || refID(fwClone["vdc"]) != result.Vdc.ID {
+		t.Errorf("firewall template %v", fwClone)
+	}
+	if ruleClone := clone("firewall/"+fwClone["id"].(string)+"/rule", rule["id"].(string)); ruleClone["protocol"] != "tcp" {
+		t.Errorf("firewall rule %v", ruleClone)
+	}
+
+	networkClone := clone("network", network["id"].(string))
+	if networkClone["name"] != "backend-stage" || refID(networkClone["vdc"]) != result.Vdc.ID {
+		t.Errorf("network %v", networkClone)
+	}
+	subnetClone := clone("network/"+networkClone["id"].(string)+"/subnet", subnet["id"].(string))
+	if subnetClone["cidr"] != "10.1.1.0/24" || subnetClone["gateway"] != "10.1.1.1" ||
+		subnetClone["start_ip"] != "10.1.1.10" || subnetClone["end_ip"] != "10.1.1.250" {
+		t.Errorf("subnet %v", subnetClone)
+	}
+
+	vmClone := clone("vm", vm["id"].(string))
+	if vmClone["name"] != "web-stage" || vmClone["power"] != false || refID(vmClone["template"]) != template["id"] ||
+		refID(vmClone["vdc"]) != result.Vdc.ID {
+		t.Errorf("vm %v", vmClone)
+	}
+	for _, tt := range []struct {
+		id   string
+		name string
+		size float64
+	}{{rootID, "root-stage", 10}, {dataID, "data-stage", 50}} {
+		disk := clone("disk", tt.id)
+		if disk["name"] != tt.name || disk["size"] != tt.size || refID(disk["vm"]) != vmClone["id"] {
+			t.Errorf("disk %v, want %s", disk, tt.name)
+		}
+	}
+	if disk := clone("disk", archive["id"].(string)); disk["name"] != "archive-stage" || disk["vm"] != nil || refID(disk["vdc"]) != result.Vdc.ID {
+		t.Errorf("detached disk %v", disk)
+	}
+
+	portClone := clone("port", port["id"].(string))
+	templates, _ := portClone["fw_templates"].([]interface{})
+	if portClone["ip_address"] != "10.1.1.20" || refID(portClone["network"]) != networkClone["id"] ||
+		refID(portClone["connected"]) != vmClone["id"] || len(templates) != 1 || refID(templates[0]) != fwClone["id"] {
+		t.Errorf("port %v", portClone)
+	}
+
+	// The source is left as it was.
+	if vms, err := source.GetVms(); err != nil || len(vms) != 1 || vms[0].ID != vm["id"] {
+		t.Fatalf("source vms %v, %v", vms, err)
+	}
+}
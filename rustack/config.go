@@ -0,0 +1,255 @@
+package rustack
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	EnvToken   = "RUSTACK_TOKEN"
+	EnvBaseURL = "RUSTACK_BASE_URL"
+	EnvProfile = "RUSTACK_PROFILE"
+	// EnvConfig overrides the location of the config file.
+	EnvConfig = "RUSTACK_CONFIG"
+
+	DefaultProfile = "default"
+)
+
+// Config is a connection profile. Profiles are read from
+// ~/.config/rustack/config.yaml:
+//
+//	profile: prod
+//	profiles:
+//	  prod:
+//	    token_command: pass show rustack/prod
+//	    project: 5b6e1c6e-...
+//	    timeout: 30s
+//	  private:
+//	    base_url: https://cloud.example.com
+//	    token: ...
+//	    vdc: 0f3c09b4-...
+//	    job_timeout: 20m
+//	    tls:
+//	      ca_file: /etc/ssl/private-ca.pem
+//
+// The top level profile key selects the profile used when none is given.
+type Config struct {
+	// Profile is the name of the loaded profile.
+	Profile string `yaml:"-"`
+	BaseURL string `yaml:"base_url"`
+	Token   string `yaml:"token"`
+	// TokenCommand is a shell command printing the token, used when Token is
+	// empty.
+	TokenCommand string `yaml:"token_command"`
+	// Project and Vdc are the IDs used by tools when none is given.
+	Project string `yaml:"project"`
+	Vdc     string `yaml:"vdc"`
+	// Timeout limits a single HTTP request.
+	Timeout time.Duration `yaml:"timeout"`
+	// JobTimeout limits waiting for jobs and LockTimeout waiting for locked
+	// objects, zero means the package defaults.
+	JobTimeout  time.Duration `yaml:"job_timeout"`
+	LockTimeout time.Duration `yaml:"lock_timeout"`
+	UserAgent   string        `yaml:"user_agent"`
+	TLS         TLSConfig     `yaml:"tls"`
+}
+
+type TLSConfig struct {
+	// CAFile is a PEM bundle trusted in addition to the system roots.
+	CAFile string `yaml:"ca_file"`
+	// CertFile and KeyFile set a client certificate.
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+type configFile struct {
+	Profile  string             `yaml:"profile"`
+	Profiles map[string]*Config `yaml:"profiles"`
+}
+
+// ConfigPath returns the location of the config file: $RUSTACK_CONFIG or
+// ~/.config/rustack/config.yaml.
+func ConfigPath() (string, error) {
+	if path := os.Getenv(EnvConfig); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrap(err, "Cannot find home directory")
+	}
+	return filepath.Join(home, ".config", "rustack", "config.yaml"), nil
+}
+
+// LoadConfig reads the named profile from the config file and applies
+// RUSTACK_TOKEN and RUSTACK_BASE_URL on top of it. An empty name selects
+// RUSTACK_PROFILE, then the profile set in the file, then "default". A missing
+// config file is not an error unless a profile was requested explicitly.
+func LoadConfig(profile string) (*Config, error) {
+	path, err := ConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	var file configFile
+	b, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, errors.Wrapf(err, "Cannot read config %s", path)
+	default:
+		if err := yaml.UnmarshalStrict(b, &file); err != nil {
+			return nil, errors.Wrapf(err, "Cannot parse config %s", path)
+		}
+	}
+
+	explicit := true
+	if profile == "" {
+		profile = os.Getenv(EnvProfile)
+	}
+	if profile == "" {
+		profile = file.Profile
+	}
+	if profile == "" {
+		profile = DefaultProfile
+		explicit = false
+	}
+
+	config := &Config{}
+	if p, ok := file.Profiles[profile]; ok && p != nil {
+		config = p
+	} else if explicit {
+		return nil, errors.Errorf("Profile %q not found in %s", profile, path)
+	}
+	config.Profile = profile
+
+	if token := os.Getenv(EnvToken); token != "" {
+		config.Token = token
+		config.TokenCommand = ""
+	}
+	if baseURL := os.Getenv(EnvBaseURL); baseURL != "" {
+		config.BaseURL = baseURL
+	}
+	return config, nil
+}
+
+// NewManagerFromEnv returns a manager for the profile selected by the
+// environment, see LoadConfig.
+func NewManagerFromEnv() (*Manager, error) {
+	config, err := LoadConfig("")
+	if err != nil {
+		return nil, err
+	}
+	return config.NewManager()
+}
+
+// NewManager resolves the token and returns a manager configured by the
+// profile.
+func (c *Config) NewManager() (*Manager, error) {
+	token, err := c.token()
+	if err != nil {
+		return nil, err
+	}
+	client, err := c.httpClient()
+	if err != nil {
+		return nil, err
+	}
+
+	m := NewManager(token)
+	m.Client = client
+	if c.BaseURL != "" {
+		m.BaseURL = strings.TrimSuffix(c.BaseURL, "/")
+	}
+	if c.UserAgent != "" {
+		m.UserAgent = c.UserAgent
+	}
+	m.JobTimeout = c.JobTimeout
+	m.LockTimeout = c.LockTimeout
+	m.DefaultProject = c.Project
+	m.DefaultVdc = c.Vdc
+	return m, nil
+}
+
+func (c *Config) token() (string, error) {
+	if c.Token != "" {
+		return c.Token, nil
+	}
+	if c.TokenCommand == "" {
+		return "", errors.Errorf("No API token for profile %q: set %s, token or token_command", c.Profile, EnvToken)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", c.TokenCommand)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.Wrapf(err, "Token command failed: %s", strings.TrimSpace(stderr.String()))
+	}
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return "", errors.Errorf("Token command for profile %q printed nothing", c.Profile)
+	}
+	return token, nil
+}
+
+func (c *Config) httpClient() (*http.Client, error) {
+	if c.Timeout == 0 && c.TLS == (TLSConfig{}) {
+		return http.DefaultClient, nil
+	}
+
+	client := &http.Client{Timeout: c.Timeout}
+	if c.TLS == (TLSConfig{}) {
+		return client, nil
+	}
+
+	tlsConfig, err := c.TLS.build()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	client.Transport = transport
+	return client, nil
+}
+
+func (t TLSConfig) build() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "Cannot read CA file")
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("No certificates found in %s", t.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "Cannot load client certificate")
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
@@ -0,0 +1,290 @@
+package rustack_test
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+func TestUserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{name: "default", want: "Rustack-go"},
+		{name: "profile", userAgent: "deploy-bot/1.0", want: "deploy-bot/1.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var agents []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				agents = append(agents, r.Method+" "+r.UserAgent())
+				mu.Unlock()
+				w.Write([]byte(`{"id": "1", "name": "vdc"}`))
+			}))
+			defer srv.Close()
+
+			config := &rustack.Config{Token: "token", BaseURL: srv.URL, UserAgent: tt.userAgent}
+			m, err := config.NewManager()
+			if err != nil {
+				t.Fatal(err)
+			}
+			vdc, err := m.GetVdc("1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := vdc.Rename("renamed"); err != nil {
+				t.Fatal(err)
+			}
+			if err := vdc.Delete(); err != nil {
+				t.Fatal(err)
+			}
+
+			want := []string{"GET " + tt.want, "PUT " + tt.want, "DELETE " + tt.want}
+			if len(agents) != len(want) {
+				t.Fatalf("got %v", agents)
+			}
+			for i := range want {
+				if agents[i] != want[i] {
+					t.Fatalf("got %v, want %v", agents, want)
+				}
+			}
+		})
+	}
+}
+
+// writeConfig points RUSTACK_CONFIG at a file with the content and clears
+// the other variables.
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if content != "" {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv(rustack.EnvConfig, path)
+	t.Setenv(rustack.EnvProfile, "")
+	t.Setenv(rustack.EnvToken, "")
+	t.Setenv(rustack.EnvBaseURL, "")
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	const file = `
+profile: prod
+profiles:
+  prod:
+    token: prod-token
+    project: p1
+    timeout: 30s
+  dev:
+    base_url: https://dev.example.com
+    token_command: echo dev-token
+    vdc: v1
+`
+	tests := []struct {
+		name    string
+		file    string
+		profile string
+		env     map[string]string
+		want    rustack.Config
+		wantErr bool
+	}{
+		{
+			name: "file default",
+			file: file,
+			want: rustack.Config{Profile: "prod", Token: "prod-token", Project: "p1", Timeout: 30 * time.Second},
+		},
+		{
+			name:    "explicit",
+			file:    file,
+			profile: "dev",
+			want:    rustack.Config{Profile: "dev", BaseURL: "https://dev.example.com", TokenCommand: "echo dev-token", Vdc: "v1"},
+		},
+		{
+			name: "profile variable",
+			file: file,
+			env:  map[string]string{rustack.EnvProfile: "dev"},
+			want: rustack.Config{Profile: "dev", BaseURL: "https://dev.example.com", TokenCommand: "echo dev-token", Vdc: "v1"},
+		},
+		{
+			name:    "argument before variable",
+			file:    file,
+			profile: "prod",
+			env:     map[string]string{rustack.EnvProfile: "dev"},
+			want:    rustack.Config{Profile: "prod", Token: "prod-token", Project: "p1", Timeout: 30 * time.Second},
+		},
+		{
+			name:    "token variable replaces the command",
+			file:    file,
+			profile: "dev",
+			env:     map[string]string{rustack.EnvToken: "env-token", rustack.EnvBaseURL: "https://env.example.com"},
+			want:    rustack.Config{Profile: "dev", BaseURL: "https://env.example.com", Token: "env-token", Vdc: "v1"},
+		},
+		{
+			name: "no file",
+			env:  map[string]string{rustack.EnvToken: "env-token"},
+			want: rustack.Config{Profile: "default", Token: "env-token"},
+		},
+		{
+			name:    "no file with a profile",
+			profile: "prod",
+			wantErr: true,
+		},
+		{
+			name:    "unknown profile",
+			file:    file,
+			profile: "staging",
+			wantErr: true,
+		},
+		{
+			name:    "unknown profile variable",
+			file:    file,
+			env:     map[string]string{rustack.EnvProfile: "staging"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			file:    "profiles:\n  prod:\n    tokn: x\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeConfig(t, tt.file)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			config, err := rustack.LoadConfig(tt.profile)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", config)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*config, tt.want) {
+				t.Fatalf("got %+v, want %+v", *config, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  rustack.Config
+		token   string
+		wantErr string
+	}{
+		{name: "token", config: rustack.Config{Token: "t", TokenCommand: "exit 1"}, token: "t"},
+		{name: "command", config: rustack.Config{TokenCommand: "echo '  secret  '"}, token: "secret"},
+		{name: "failing command", config: rustack.Config{TokenCommand: "echo locked >&2; exit 1"}, wantErr: "locked"},
+		{name: "empty output", config: rustack.Config{Profile: "p", TokenCommand: "true"}, wantErr: "printed nothing"},
+		{name: "no token", config: rustack.Config{Profile: "p"}, wantErr: "No API token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := tt.config.NewManager()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Token != tt.token {
+				t.Fatalf("token %q, want %q", m.Token, tt.token)
+			}
+		})
+	}
+}
+
+func TestNewManagerFromEnv(t *testing.T) {
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte(`{"id": "1", "name": "vdc"}`))
+	}))
+	defer srv.Close()
+
+	writeConfig(t, "profiles:\n  ci:\n    token: file-token\n    project: p1\n    base_url: https://unused.example.com\n")
+	t.Setenv(rustack.EnvProfile, "ci")
+	t.Setenv(rustack.EnvToken, "env-token")
+	t.Setenv(rustack.EnvBaseURL, srv.URL+"/")
+
+	m, err := rustack.NewManagerFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.BaseURL != srv.URL || m.DefaultProject != "p1" {
+		t.Fatalf("base URL %s, project %s", m.BaseURL, m.DefaultProject)
+	}
+	if _, err := m.GetVdc("1"); err != nil {
+		t.Fatal(err)
+	}
+	if auth != "Bearer env-token" {
+		t.Fatalf("authorization %q", auth)
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": "1", "name": "vdc"}`))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600)
+	emptyFile := filepath.Join(dir, "empty.pem")
+	os.WriteFile(emptyFile, []byte("no certificates"), 0600)
+
+	tests := []struct {
+		name       string
+		tls        rustack.TLSConfig
+		configErr  bool
+		requestErr bool
+	}{
+		{name: "ca file", tls: rustack.TLSConfig{CAFile: caFile}},
+		{name: "server name", tls: rustack.TLSConfig{CAFile: caFile, ServerName: "example.com"}},
+		{name: "wrong server name", tls: rustack.TLSConfig{CAFile: caFile, ServerName: "other.org"}, requestErr: true},
+		{name: "insecure", tls: rustack.TLSConfig{InsecureSkipVerify: true}},
+		{name: "untrusted", tls: rustack.TLSConfig{ServerName: "example.com"}, requestErr: true},
+		{name: "missing ca file", tls: rustack.TLSConfig{CAFile: filepath.Join(dir, "missing.pem")}, configErr: true},
+		{name: "empty ca file", tls: rustack.TLSConfig{CAFile: emptyFile}, configErr: true},
+		{name: "bad client certificate", tls: rustack.TLSConfig{CAFile: caFile, CertFile: emptyFile, KeyFile: emptyFile}, configErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &rustack.Config{Token: "token", BaseURL: srv.URL, TLS: tt.tls}
+			m, err := config.NewManager()
+			if (err != nil) != tt.configErr {
+				t.Fatalf("got %v", err)
+			}
+			if err != nil {
+				return
+			}
+			m.RetryPolicy = nil
+			if _, err := m.GetVdc("1"); (err != nil) != tt.requestErr {
+				t.Fatalf("got %v", err)
+			}
+		})
+	}
+}
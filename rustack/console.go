@@ -0,0 +1,224 @@
+package rustack
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ConsoleVNC   = "vnc"
+	ConsoleSpice = "spice"
+)
+
+// Console is a short-lived, single use ticket for the console of a VM. URL
+// is a websocket carrying the raw VNC or SPICE stream.
+type Console struct {
+	manager  *Manager
+	vm       *Vm
+	URL      string `json:"url"`
+	Ticket   string `json:"ticket"`
+	Protocol string `json:"protocol"`
+	// Password is the VNC password expected by the console, if any.
+	Password string `json:"password"`
+}
+
+func (v *Vm) GetConsole() (console *Console, err error) {
+	path, _ := url.JoinPath("v1/vm", v.ID, "console")
+	err = v.manager.Get(path, Defaults(), &console)
+	if err != nil {
+		return
+	}
+	console.manager = v.manager
+	console.vm = v
+	return
+}
+
+// ConsoleProxy exposes a console on a local TCP port, so that standard VNC
+// or SPICE clients can connect to it:
+//
+//	console, err := vm.GetConsole()
+//	proxy, err := console.Proxy(ctx, "127.0.0.1:5900")
+//	defer proxy.Close()
+//	fmt.Println("vncviewer", proxy.Addr())
+//
+// Every client connection opens its own websocket to the console, with a
+// ticket of its own: the first one uses the ticket of the console, the next
+// ones request a new ticket for the VM.
+type ConsoleProxy struct {
+	console  *Console
+	listener net.Listener
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+
+	mu         sync.Mutex
+	err        error
+	ticketUsed bool
+}
+
+// Proxy starts listening on addr, e.g. "127.0.0.1:0" for a random port. The
+// proxy stops when ctx is done or Close is called.
+func (c *Console) Proxy(ctx context.Context, addr string) (*ConsoleProxy, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot listen on %s", addr)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	p := &ConsoleProxy{console: c, listener: listener, ctx: ctx, cancel: cancel}
+	p.wg.Add(1)
+	go p.serve()
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	return p, nil
+}
+
+// Addr returns the local address clients connect to.
+func (p *ConsoleProxy) Addr() string {
+	return p.listener.Addr().String()
+}
+
+// Close stops accepting clients, closes open connections and waits for them
+// to finish.
+func (p *ConsoleProxy) Close() error {
+	p.cancel()
+	p.wg.Wait()
+	return nil
+}
+
+// Wait blocks until the proxy is closed and returns the last error of a
+// client connection, if any.
+func (p *ConsoleProxy) Wait() error {
+	<-p.ctx.Done()
+	p.wg.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func (p *ConsoleProxy) serve() {
+	defer p.wg.Done()
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			if p.ctx.Err() == nil {
+				p.setErr(errors.Wrap(err, "Console proxy accept failed"))
+				p.cancel()
+			}
+			return
+		}
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			if err := p.tunnel(conn); err != nil {
+				p.setErr(err)
+			}
+		}()
+	}
+}
+
+func (p *ConsoleProxy) tunnel(conn net.Conn) error {
+	defer conn.Close()
+
+	c, err := p.ticket()
+	if err != nil {
+		return err
+	}
+	// The ticket is the only credential sent to the console host, the API
+	// token stays with the API.
+	header := http.Header{}
+	header.Set("User-Agent", c.manager.UserAgent)
+	header.Set("Sec-WebSocket-Protocol", "binary")
+	ws, err := dialWebsocket(p.ctx, c.websocketURL(), header, c.manager.tlsConfig())
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+
+	// Unblock the copies below when the proxy is closed.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-p.ctx.Done():
+			conn.Close()
+			ws.conn.Close()
+		case <-done:
+		}
+	}()
+
+	errc := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(ws, conn)
+		errc <- err
+	}()
+	go func() {
+		_, err := io.Copy(conn, ws)
+		errc <- err
+	}()
+
+	// Either side closing ends the session.
+	err = <-errc
+	if err == io.EOF || errors.Is(err, net.ErrClosed) || p.ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// ticket returns the console to connect a new client to. Tickets are single
+// use, so only the first client gets the ticket the proxy was started with.
+func (p *ConsoleProxy) ticket() (*Console, error) {
+	p.mu.Lock()
+	used := p.ticketUsed
+	p.ticketUsed = true
+	p.mu.Unlock()
+
+	if !used {
+		return p.console, nil
+	}
+	if p.console.vm == nil {
+		return nil, errors.New("Console ticket already used")
+	}
+	return p.console.vm.GetConsole()
+}
+
+// websocketURL returns the console URL with the ticket, added as a query
+// parameter when the URL does not carry it already.
+func (c *Console) websocketURL() string {
+	u, err := url.Parse(c.URL)
+	if err != nil || c.Ticket == "" || strings.Contains(c.URL, c.Ticket) {
+		return c.URL
+	}
+	query := u.Query()
+	query.Set("ticket", c.Ticket)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func (p *ConsoleProxy) setErr(err error) {
+	p.mu.Lock()
+	p.err = err
+	p.mu.Unlock()
+}
+
+// tlsConfig returns the TLS settings of the manager's HTTP client, so that
+// websockets trust the same certificates as API requests.
+func (m *Manager) tlsConfig() *tls.Config {
+	if m.Client == nil {
+		return nil
+	}
+	if transport, ok := m.Client.Transport.(*http.Transport); ok {
+		return transport.TLSClientConfig
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package rustack_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustacktest"
+)
+
+func TestConsoleProxy(t *testing.T) {
+	s := rustacktest.NewServer()
+	defer s.Close()
+	vdc := s.Seed("vdc", map[string]interface{}{"name": "vdc"})
+	seeded := s.Seed("vm", map[string]interface{}{"name": "vm", "vdc": vdc})
+
+	vm, err := s.Manager().GetVm(seeded["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	console, err := vm.GetConsole()
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy, err := console.Proxy(context.Background(), "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
+
+	// Every client gets a session of its own, the ticket of the first one
+	// cannot be reused.
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", proxy.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		greeting := make([]byte, len("RFB 003.008\n"))
+		if _, err := io.ReadFull(conn, greeting); err != nil || string(greeting) != "RFB 003.008\n" {
+			t.Fatalf("client %d: greeting %q, %v", i, greeting, err)
+		}
+		conn.Write([]byte("ping"))
+		echo := make([]byte, 4)
+		if _, err := io.ReadFull(conn, echo); err != nil || string(echo) != "ping" {
+			t.Fatalf("client %d: echo %q, %v", i, echo, err)
+		}
+		conn.Close()
+	}
+
+	var tickets []string
+	for _, r := range s.Requests() {
+		ticket, ok := strings.CutPrefix(r.Path, "console/")
+		if !ok {
+			continue
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Fatal("API token sent to the console")
+		}
+		tickets = append(tickets, ticket)
+	}
+	if len(tickets) != 2 || tickets[0] == tickets[1] {
+		t.Fatalf("console tickets %v", tickets)
+	}
+}
@@ -1,11 +1,13 @@
 package rustack
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 )
 
 type Disk struct {
+	jobList
 	manager        *Manager
 	ID             string          `json:"id"`
 	Name           string          `json:"name"`
@@ -17,6 +19,8 @@ type Disk struct {
 	StorageProfile *StorageProfile `json:"storage_profile"`
 	Locked         bool            `json:"locked,omitempty"`
 	Tags           []Tag           `json:"tags"`
+	// Snapshot is the snapshot the disk was restored from.
+	Snapshot *DiskSnapshot `json:"snapshot,omitempty"`
 }
 
 func NewDisk(name string, size int, storageProfile *StorageProfile) Disk {
@@ -24,6 +28,16 @@ func NewDisk(name string, size int, storageProfile *StorageProfile) Disk {
 	return d
 }
 
+// NewDiskFromSnapshot returns a disk restored from the snapshot when created
+// with Vdc.CreateDisk. The size may be left zero to use the snapshot size.
+func NewDiskFromSnapshot(name string, size int, storageProfile *StorageProfile, snapshot *DiskSnapshot) Disk {
+	if size == 0 {
+		size = snapshot.Size
+	}
+	d := Disk{Name: name, Size: size, StorageProfile: storageProfile, Snapshot: snapshot}
+	return d
+}
+
 func (m *Manager) GetDisks(extraArgs ...Arguments) (disks []*Disk, err error) {
 	args := Defaults()
 	args.merge(extraArgs)
@@ -36,6 +50,12 @@ func (m *Manager) GetDisks(extraArgs ...Arguments) (disks []*Disk, err error) {
 	return
 }
 
+func (m *Manager) IterDisks(ctx context.Context, args Arguments, opts ...IterOption) *Iterator[*Disk] {
+	return NewIterator(ctx, m, "v1/disk", args, func(disk *Disk) {
+		disk.manager = m
+	}, opts...)
+}
+
 func (v *Vdc) GetDisks(extraArgs ...Arguments) (disks []*Disk, err error) {
 	args := Arguments{
 		"vdc": v.ID,
@@ -64,7 +84,7 @@ func (v *Vm) AttachDisk(disk *Disk) error {
 		Vm: v.ID,
 	}
 
-	err := v.manager.Request("POST", path, args, nil)
+	err := v.manager.action("POST", path, args, disk)
 	if err != nil {
 		return err
 	}
@@ -76,7 +96,7 @@ func (v *Vm) AttachDisk(disk *Disk) error {
 func (v *Vm) DetachDisk(disk *Disk) error {
 
 	path := fmt.Sprintf("v1/disk/%s/detach", disk.ID)
-	err := v.manager.Request("POST", path, nil, nil)
+	err := v.manager.action("POST", path, nil, disk)
 	if err != nil {
 		return err
 	}
@@ -130,10 +150,31 @@ func (d *Disk) UpdateStorageProfile(storageProfile StorageProfile) error {
 
 func (d *Disk) Delete() error {
 	path, _ := url.JoinPath("v1/disk", d.ID)
-	return d.manager.Delete(path, Defaults(), nil)
+	return d.manager.deleteResource(path, d)
 }
 
 func (d Disk) WaitLock() (err error) {
 	path, _ := url.JoinPath("v1/disk", d.ID)
 	return loopWaitLock(d.manager, path)
 }
+
+func (d *Disk) TagNames() []string {
+	return convertTagsToNames(d.Tags)
+}
+
+func (d *Disk) tagPath() string {
+	path, _ := url.JoinPath("v1/disk", d.ID)
+	return path
+}
+
+func (d *Disk) SetTags(tags ...string) error {
+	return d.manager.setTags(d, tags)
+}
+
+func (d *Disk) AddTags(tags ...string) error {
+	return d.manager.addTags(d, tags)
+}
+
+func (d *Disk) RemoveTags(tags ...string) error {
+	return d.manager.removeTags(d, tags)
+}
@@ -0,0 +1,102 @@
+package rustack
+
+import (
+	"net/url"
+)
+
+const (
+	DiskSnapshotManual = "manual"
+	// DiskSnapshotBackup snapshots are taken by a BackupPolicy and removed
+	// according to its retention.
+	DiskSnapshotBackup = "backup"
+)
+
+type DiskSnapshot struct {
+	jobList
+	manager   *Manager
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Size      int    `json:"size"`
+	Type      string `json:"type"`
+	Disk      *Disk  `json:"disk"`
+	Vdc       *Vdc   `json:"vdc"`
+	CreatedAt string `json:"created_at"`
+	Locked    bool   `json:"locked,omitempty"`
+}
+
+func (d *Disk) CreateSnapshot(name string) (snapshot *DiskSnapshot, err error) {
+	args := &struct {
+		Name string `json:"name"`
+		Disk string `json:"disk"`
+	}{
+		Name: name,
+		Disk: d.ID,
+	}
+
+	err = d.manager.Request("POST", "v1/disk_snapshot", args, &snapshot)
+	if err != nil {
+		return
+	}
+	snapshot.setManager(d.manager)
+	return
+}
+
+func (m *Manager) GetDiskSnapshots(extraArgs ...Arguments) (snapshots []*DiskSnapshot, err error) {
+	args := Defaults()
+	args.merge(extraArgs)
+
+	path := "v1/disk_snapshot"
+	err = m.GetItems(path, args, &snapshots)
+	for i := range snapshots {
+		snapshots[i].setManager(m)
+	}
+	return
+}
+
+func (d *Disk) GetSnapshots(extraArgs ...Arguments) (snapshots []*DiskSnapshot, err error) {
+	args := Arguments{
+		"disk": d.ID,
+	}
+	args.merge(extraArgs)
+	snapshots, err = d.manager.GetDiskSnapshots(args)
+	return
+}
+
+func (v *Vdc) GetDiskSnapshots(extraArgs ...Arguments) (snapshots []*DiskSnapshot, err error) {
+	args := Arguments{
+		"vdc": v.ID,
+	}
+	args.merge(extraArgs)
+	snapshots, err = v.manager.GetDiskSnapshots(args)
+	return
+}
+
+func (m *Manager) GetDiskSnapshot(id string) (snapshot *DiskSnapshot, err error) {
+	path, _ := url.JoinPath("v1/disk_snapshot", id)
+	err = m.Get(path, Defaults(), &snapshot)
+	if err != nil {
+		return
+	}
+	snapshot.setManager(m)
+	return
+}
+
+func (s *DiskSnapshot) Delete() error {
+	path, _ := url.JoinPath("v1/disk_snapshot", s.ID)
+	return s.manager.deleteResource(path, s)
+}
+
+func (s DiskSnapshot) WaitLock() (err error) {
+	path, _ := url.JoinPath("v1/disk_snapshot", s.ID)
+	return loopWaitLock(s.manager, path)
+}
+
+func (s *DiskSnapshot) setManager(m *Manager) {
+	s.manager = m
+	if s.Disk != nil {
+		s.Disk.manager = m
+	}
+	if s.Vdc != nil {
+		s.Vdc.manager = m
+	}
+}
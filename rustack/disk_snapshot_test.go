@@ -0,0 +1,84 @@
+package rustack_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+	"github.com/rustack-cloud-platform/rcp-go/rustacktest"
+)
+
+func TestDiskSnapshotRestore(t *testing.T) {
+	s := rustacktest.NewServer()
+	defer s.Close()
+	m := s.Manager()
+	vdc := s.Seed("vdc", map[string]interface{}{"name": "vdc"})
+	profile := s.Seed("storage_profile", map[string]interface{}{"name": "ssd"})
+	seeded := s.Seed("disk", map[string]interface{}{"name": "data", "size": 20, "vdc": vdc, "storage_profile": profile})
+	disk, err := m.GetDisk(seeded["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := disk.CreateSnapshot("nightly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Size != 20 || snapshot.Type != rustack.DiskSnapshotManual || snapshot.Disk.ID != disk.ID {
+		t.Fatalf("created %+v", snapshot)
+	}
+	s.Seed("disk_snapshot", map[string]interface{}{"name": "auto", "type": rustack.DiskSnapshotBackup, "size": 20, "disk": seeded, "vdc": vdc})
+
+	if snapshots, err := disk.GetSnapshots(); err != nil || len(snapshots) != 2 {
+		t.Fatalf("disk snapshots %v, %v", snapshots, err)
+	}
+	args, err := rustack.DiskSnapshotFilter{Type: rustack.DiskSnapshotBackup}.Arguments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshots, err := m.GetDiskSnapshots(args); err != nil || len(snapshots) != 1 || snapshots[0].Name != "auto" {
+		t.Fatalf("backup snapshots %v, %v", snapshots, err)
+	}
+
+	// A restored disk takes the size of the snapshot unless given.
+	v, err := m.GetVdc(vdc["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := rustack.NewDiskFromSnapshot("restored", 0, disk.StorageProfile, snapshot)
+	before := len(s.Requests())
+	if err := v.CreateDisk(&restored); err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]interface{}
+	json.Unmarshal(s.Requests()[before].Body, &body)
+	if body["snapshot"] != snapshot.ID || body["size"] != float64(20) {
+		t.Fatalf("create body %v", body)
+	}
+	if restored.ID == "" || restored.Snapshot == nil || restored.Snapshot.ID != snapshot.ID {
+		t.Fatalf("restored %+v", restored)
+	}
+
+	if err := snapshot.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Object("disk_snapshot", snapshot.ID) != nil {
+		t.Fatal("snapshot not deleted")
+	}
+}
+
+func TestDiskSnapshotFilter(t *testing.T) {
+	args, err := rustack.DiskSnapshotFilter{Vdc: "v", Disk: "d", Type: rustack.DiskSnapshotManual, ListOptions: rustack.ListOptions{Sort: "-created_at"}}.Arguments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 4 || args["vdc"] != "v" || args["disk"] != "d" || args["type"] != "manual" || args["sort"] != "-created_at" {
+		t.Fatalf("got %v", args)
+	}
+	if _, err := (rustack.DiskSnapshotFilter{Type: "weekly"}).Arguments(); err == nil {
+		t.Fatal("unknown type accepted")
+	}
+	if _, err := (rustack.DiskSnapshotFilter{ListOptions: rustack.ListOptions{Sort: "size"}}).Arguments(); err == nil {
+		t.Fatal("unknown sort field accepted")
+	}
+}
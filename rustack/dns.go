@@ -1,10 +1,12 @@
 package rustack
 
 import (
+	"context"
 	"net/url"
 )
 
 type Dns struct {
+	jobList
 	manager *Manager
 	ID      string   `json:"id"`
 	Name    string   `json:"name"`
@@ -29,6 +31,12 @@ func (m *Manager) GetDnss(extraArgs ...Arguments) (dnss []*Dns, err error) {
 	return
 }
 
+func (m *Manager) IterDnss(ctx context.Context, args Arguments, opts ...IterOption) *Iterator[*Dns] {
+	return NewIterator(ctx, m, "v1/dns", args, func(dns *Dns) {
+		dns.manager = m
+	}, opts...)
+}
+
 func (p *Project) GetDnss(extraArgs ...Arguments) (dns []*Dns, err error) {
 	args := Arguments{
 		"project": p.ID,
@@ -70,5 +78,26 @@ func (p *Project) CreateDns(dns *Dns) (err error) {
 
 func (d *Dns) Delete() error {
 	path, _ := url.JoinPath("v1/dns", d.ID)
-	return d.manager.Delete(path, Defaults(), nil)
+	return d.manager.deleteResource(path, d)
+}
+
+func (d *Dns) TagNames() []string {
+	return convertTagsToNames(d.Tags)
+}
+
+func (d *Dns) tagPath() string {
+	path, _ := url.JoinPath("v1/dns", d.ID)
+	return path
+}
+
+func (d *Dns) SetTags(tags ...string) error {
+	return d.manager.setTags(d, tags)
+}
+
+func (d *Dns) AddTags(tags ...string) error {
+	return d.manager.addTags(d, tags)
+}
+
+func (d *Dns) RemoveTags(tags ...string) error {
+	return d.manager.removeTags(d, tags)
 }
@@ -5,6 +5,7 @@ import (
 )
 
 type DnsRecord struct {
+	jobList
 	manager  *Manager
 	DnsZone  string
 	ID       string `json:"id"`
@@ -31,6 +32,7 @@ func (m *Manager) GetDnsRecords(dns_id string) (dns_records []*DnsRecord, err er
 	err = m.GetItems(path, args, &dns_records)
 	for i := range dns_records {
 		dns_records[i].manager = m
+		dns_records[i].DnsZone = dns_id
 	}
 	return
 }
@@ -147,5 +149,5 @@ func (d *DnsRecord) Update() error {
 
 func (d *DnsRecord) Delete() error {
 	path := fmt.Sprintf("v1/dns/%s/record/%s", d.DnsZone, d.ID)
-	return d.manager.Delete(path, Defaults(), nil)
+	return d.manager.deleteResource(path, d)
 }
@@ -5,28 +5,72 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Sentinel errors matched by RustackApiError through errors.Is.
+var (
+	ErrNotFound      = errors.New("rustack: not found")
+	ErrLocked        = errors.New("rustack: object locked")
+	ErrQuotaExceeded = errors.New("rustack: quota exceeded")
+	ErrValidation    = errors.New("rustack: validation failed")
+	ErrUnauthorized  = errors.New("rustack: unauthorized")
 )
 
+const errorAliasObjectLocked = "object_locked"
+
+// envelopeKeys are the keys of error bodies that are not request fields.
+var envelopeKeys = map[string]bool{
+	"detail":           true,
+	"details":          true,
+	"error_alias":      true,
+	"non_field_errors": true,
+	"code":             true,
+	"message":          true,
+}
+
 type RustackApiError struct {
-	msg          string
-	code         int
-	body         []byte
-	errorAliases []string
+	msg            string
+	code           int
+	body           []byte
+	errorAliases   []string
+	nonFieldErrors []string
+	fieldErrors    map[string][]string
 }
 
 func NewRustackApiError(url string, resp *http.Response) error {
 	body, _ := io.ReadAll(resp.Body)
-	msg := fmt.Sprintf("HTTP request failure on %s:\n%d: %s", url, resp.StatusCode, string(body))
-	var parsedBody struct {
-		ErrorAliases []string `json:"error_alias"`
+	return newRustackApiError(url, resp.StatusCode, body)
+}
+
+func newRustackApiError(url string, code int, body []byte) *RustackApiError {
+	msg := fmt.Sprintf("HTTP request failure on %s:\n%d: %s", url, code, string(body))
+	e := &RustackApiError{
+		msg:         msg,
+		code:        code,
+		body:        body,
+		fieldErrors: make(map[string][]string),
+	}
+
+	var parsedBody map[string]interface{}
+	if err := json.Unmarshal(body, &parsedBody); err != nil {
+		return e
+	}
+	e.errorAliases = errorMessages(parsedBody["error_alias"])
+	e.nonFieldErrors = append(errorMessages(parsedBody["non_field_errors"]), errorMessages(parsedBody["detail"])...)
+	// Other keys only name request fields in validation responses.
+	if code != http.StatusBadRequest && code != http.StatusUnprocessableEntity {
+		return e
 	}
-	json.Unmarshal(body, &parsedBody)
-	return &RustackApiError{
-		msg:          msg,
-		code:         resp.StatusCode,
-		body:         body,
-		errorAliases: parsedBody.ErrorAliases,
+	for key, value := range parsedBody {
+		if !envelopeKeys[key] {
+			collectFieldErrors(e.fieldErrors, key, value)
+		}
 	}
+	return e
 }
 
 func (e *RustackApiError) Error() string          { return e.msg }
@@ -34,3 +78,88 @@ func (e *RustackApiError) Message() string        { return e.msg }
 func (e *RustackApiError) Code() int              { return e.code }
 func (e *RustackApiError) Body() []byte           { return e.body }
 func (e *RustackApiError) ErrorAliases() []string { return e.errorAliases }
+
+// NonFieldErrors returns the messages that are not bound to a request field,
+// including the detail message.
+func (e *RustackApiError) NonFieldErrors() []string { return e.nonFieldErrors }
+
+// FieldErrors returns validation messages keyed by request field. Nested
+// fields are joined with dots, e.g. "disks.0.size".
+func (e *RustackApiError) FieldErrors() map[string][]string { return e.fieldErrors }
+
+// Fields returns the names of the fields with validation errors in sorted
+// order.
+func (e *RustackApiError) Fields() []string {
+	fields := make([]string, 0, len(e.fieldErrors))
+	for field := range e.fieldErrors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func (e *RustackApiError) HasErrorAlias(alias string) bool {
+	for _, a := range e.errorAliases {
+		if a == alias {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *RustackApiError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.code == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.code == http.StatusUnauthorized || e.code == http.StatusForbidden
+	case ErrLocked:
+		return e.code == http.StatusConflict && (len(e.errorAliases) == 0 || e.HasErrorAlias(errorAliasObjectLocked))
+	case ErrQuotaExceeded:
+		for _, alias := range e.errorAliases {
+			if strings.Contains(alias, "quota") {
+				return true
+			}
+		}
+		return false
+	case ErrValidation:
+		return e.code == http.StatusBadRequest || e.code == http.StatusUnprocessableEntity
+	}
+	return false
+}
+
+func errorMessages(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		messages := make([]string, 0, len(v))
+		for _, item := range v {
+			messages = append(messages, fmt.Sprintf("%v", item))
+		}
+		return messages
+	case nil:
+		return nil
+	}
+	return []string{fmt.Sprintf("%v", value)}
+}
+
+func collectFieldErrors(fieldErrors map[string][]string, prefix string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range v {
+			collectFieldErrors(fieldErrors, prefix+"."+key, nested)
+		}
+	case []interface{}:
+		for i, item := range v {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				collectFieldErrors(fieldErrors, fmt.Sprintf("%s.%d", prefix, i), item)
+			default:
+				fieldErrors[prefix] = append(fieldErrors[prefix], fmt.Sprintf("%v", item))
+			}
+		}
+	default:
+		fieldErrors[prefix] = append(fieldErrors[prefix], errorMessages(v)...)
+	}
+}
@@ -0,0 +1,95 @@
+package rustack_test
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+func TestApiErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     interface{}
+		sentinel error
+		fields   map[string][]string
+		nonField []string
+		aliases  []string
+	}{
+		{
+			name:     "not found",
+			status:   http.StatusNotFound,
+			body:     map[string]interface{}{"detail": "Not found."},
+			sentinel: rustack.ErrNotFound,
+			fields:   map[string][]string{},
+			nonField: []string{"Not found."},
+		},
+		{
+			name:   "validation",
+			status: http.StatusBadRequest,
+			body: map[string]interface{}{
+				"name":             []string{"This field is required."},
+				"disks":            []interface{}{map[string]interface{}{"size": []string{"Too small."}}},
+				"non_field_errors": []string{"Invalid request."},
+				"detail":           "Bad request.",
+			},
+			sentinel: rustack.ErrValidation,
+			fields: map[string][]string{
+				"name":         {"This field is required."},
+				"disks.0.size": {"Too small."},
+			},
+			nonField: []string{"Invalid request.", "Bad request."},
+		},
+		{
+			name:     "unprocessable",
+			status:   http.StatusUnprocessableEntity,
+			body:     map[string]interface{}{"cidr": "Invalid network."},
+			sentinel: rustack.ErrValidation,
+			fields:   map[string][]string{"cidr": {"Invalid network."}},
+		},
+		{
+			name:     "conflict",
+			status:   http.StatusConflict,
+			body:     map[string]interface{}{"error_alias": []string{"quota_exceeded"}, "vdc": "in use", "details": map[string]interface{}{"limit": 1}},
+			sentinel: rustack.ErrQuotaExceeded,
+			fields:   map[string][]string{},
+			aliases:  []string{"quota_exceeded"},
+		},
+		{
+			name:     "forbidden",
+			status:   http.StatusForbidden,
+			body:     "not json",
+			sentinel: rustack.ErrUnauthorized,
+			fields:   map[string][]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := scriptedServer(t, response{status: tt.status, body: tt.body})
+
+			err := m.Request("POST", "v1/vdc", map[string]string{"name": ""}, nil)
+			if !errors.Is(err, tt.sentinel) {
+				t.Fatalf("got %v, want %v", err, tt.sentinel)
+			}
+			var apiErr *rustack.RustackApiError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("got %T", err)
+			}
+			if apiErr.Code() != tt.status {
+				t.Errorf("code %d", apiErr.Code())
+			}
+			if !reflect.DeepEqual(apiErr.FieldErrors(), tt.fields) {
+				t.Errorf("fields %v, want %v", apiErr.FieldErrors(), tt.fields)
+			}
+			if !reflect.DeepEqual(apiErr.NonFieldErrors(), tt.nonField) {
+				t.Errorf("non field errors %q, want %q", apiErr.NonFieldErrors(), tt.nonField)
+			}
+			if !reflect.DeepEqual(apiErr.ErrorAliases(), tt.aliases) {
+				t.Errorf("aliases %v, want %v", apiErr.ErrorAliases(), tt.aliases)
+			}
+		})
+	}
+}
@@ -0,0 +1,573 @@
+package rustack
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Inventory is a point in time export of the resources of a project.
+// Resources are listed flat, by kind, and refer to each other by ID, e.g. a
+// subnet has the ID of its network and a disk the ID of its VM. Secrets such
+// as S3 keys are not exported.
+type Inventory struct {
+	ExportedAt time.Time        `json:"exported_at" yaml:"exported_at"`
+	Project    InventoryProject `json:"project" yaml:"project"`
+
+	Vdcs              []InventoryVdc              `json:"vdcs" yaml:"vdcs"`
+	Networks          []InventoryNetwork          `json:"networks" yaml:"networks"`
+	Subnets           []InventorySubnet           `json:"subnets" yaml:"subnets"`
+	Routers           []InventoryRouter           `json:"routers" yaml:"routers"`
+	Routes            []InventoryRoute            `json:"routes" yaml:"routes"`
+	Ports             []InventoryPort             `json:"ports" yaml:"ports"`
+	FirewallTemplates []InventoryFirewallTemplate `json:"firewall_templates" yaml:"firewall_templates"`
+	FirewallRules     []InventoryFirewallRule     `json:"firewall_rules" yaml:"firewall_rules"`
+	Vms               []InventoryVm               `json:"vms" yaml:"vms"`
+	Disks             []InventoryDisk             `json:"disks" yaml:"disks"`
+	LoadBalancers     []InventoryLoadBalancer     `json:"load_balancers" yaml:"load_balancers"`
+	Pools             []InventoryPool             `json:"pools" yaml:"pools"`
+	Kubernetes        []InventoryKubernetes       `json:"kubernetes" yaml:"kubernetes"`
+	DnsZones          []InventoryDnsZone          `json:"dns_zones" yaml:"dns_zones"`
+	DnsRecords        []InventoryDnsRecord        `json:"dns_records" yaml:"dns_records"`
+	S3Storages        []InventoryS3Storage        `json:"s3_storages" yaml:"s3_storages"`
+	S3Buckets         []InventoryS3Bucket         `json:"s3_buckets" yaml:"s3_buckets"`
+}
+
+type InventoryProject struct {
+	ID     string   `json:"id" yaml:"id"`
+	Name   string   `json:"name" yaml:"name"`
+	Client string   `json:"client" yaml:"client"`
+	Tags   []string `json:"tags" yaml:"tags"`
+}
+
+type InventoryVdc struct {
+	ID         string   `json:"id" yaml:"id"`
+	Name       string   `json:"name" yaml:"name"`
+	Hypervisor string   `json:"hypervisor" yaml:"hypervisor"`
+	Tags       []string `json:"tags" yaml:"tags"`
+}
+
+type InventoryNetwork struct {
+	ID        string   `json:"id" yaml:"id"`
+	Vdc       string   `json:"vdc" yaml:"vdc"`
+	Name      string   `json:"name" yaml:"name"`
+	IsDefault bool     `json:"is_default" yaml:"is_default"`
+	Mtu       *int     `json:"mtu" yaml:"mtu"`
+	Tags      []string `json:"tags" yaml:"tags"`
+}
+
+type InventorySubnet struct {
+	ID         string                 `json:"id" yaml:"id"`
+	Network    string                 `json:"network" yaml:"network"`
+	CIDR       string                 `json:"cidr" yaml:"cidr"`
+	Gateway    string                 `json:"gateway" yaml:"gateway"`
+	StartIp    string                 `json:"start_ip" yaml:"start_ip"`
+	EndIp      string                 `json:"end_ip" yaml:"end_ip"`
+	IsDHCP     bool                   `json:"enable_dhcp" yaml:"enable_dhcp"`
+	DnsServers []string               `json:"dns_servers" yaml:"dns_servers"`
+	Routes     []InventorySubnetRoute `json:"subnet_routes" yaml:"subnet_routes"`
+}
+
+type InventorySubnetRoute struct {
+	CIDR    string `json:"cidr" yaml:"cidr"`
+	Gateway string `json:"gateway" yaml:"gateway"`
+	Metric  int    `json:"metric" yaml:"metric"`
+}
+
+type InventoryRouter struct {
+	ID        string `json:"id" yaml:"id"`
+	Vdc       string `json:"vdc" yaml:"vdc"`
+	Name      string `json:"name" yaml:"name"`
+	IsDefault bool   `json:"is_default" yaml:"is_default"`
+	// Floating is the floating IP address, empty without one.
+	Floating string   `json:"floating" yaml:"floating"`
+	Tags     []string `json:"tags" yaml:"tags"`
+}
+
+type InventoryRoute struct {
+	ID          string `json:"id" yaml:"id"`
+	Router      string `json:"router" yaml:"router"`
+	Destination string `json:"destination" yaml:"destination"`
+	NextHop     string `json:"nexthop" yaml:"nexthop"`
+}
+
+type InventoryPort struct {
+	ID        string `json:"id" yaml:"id"`
+	Vdc       string `json:"vdc" yaml:"vdc"`
+	Network   string `json:"network" yaml:"network"`
+	IpAddress string `json:"ip_address" yaml:"ip_address"`
+	// ConnectedType is the kind of the resource the port is attached to,
+	// e.g. vm, router or lbaas, and Connected its ID.
+	ConnectedType     string   `json:"connected_type" yaml:"connected_type"`
+	Connected         string   `json:"connected" yaml:"connected"`
+	FirewallTemplates []string `json:"firewall_templates" yaml:"firewall_templates"`
+	Tags              []string `json:"tags" yaml:"tags"`
+}
+
+type InventoryFirewallTemplate struct {
+	ID   string   `json:"id" yaml:"id"`
+	Name string   `json:"name" yaml:"name"`
+	Tags []string `json:"tags" yaml:"tags"`
+}
+
+type InventoryFirewallRule struct {
+	ID            string `json:"id" yaml:"id"`
+	Template      string `json:"template" yaml:"template"`
+	Name          string `json:"name" yaml:"name"`
+	Direction     string `json:"direction" yaml:"direction"`
+	Protocol      string `json:"protocol" yaml:"protocol"`
+	DestinationIp string `json:"destination_ip" yaml:"destination_ip"`
+	PortMin       *int   `json:"dst_port_range_min" yaml:"dst_port_range_min"`
+	PortMax       *int   `json:"dst_port_range_max" yaml:"dst_port_range_max"`
+}
+
+type InventoryVm struct {
+	ID       string  `json:"id" yaml:"id"`
+	Vdc      string  `json:"vdc" yaml:"vdc"`
+	Name     string  `json:"name" yaml:"name"`
+	Cpu      int     `json:"cpu" yaml:"cpu"`
+	Ram      float64 `json:"ram" yaml:"ram"`
+	Power    bool    `json:"power" yaml:"power"`
+	Template string  `json:"template" yaml:"template"`
+	Floating string  `json:"floating" yaml:"floating"`
+	// Kubernetes is the ID of the cluster the VM is a node of.
+	Kubernetes string   `json:"kubernetes,omitempty" yaml:"kubernetes,omitempty"`
+	Tags       []string `json:"tags" yaml:"tags"`
+}
+
+type InventoryDisk struct {
+	ID             string   `json:"id" yaml:"id"`
+	Vdc            string   `json:"vdc" yaml:"vdc"`
+	Vm             string   `json:"vm" yaml:"vm"`
+	Name           string   `json:"name" yaml:"name"`
+	Size           int      `json:"size" yaml:"size"`
+	IsRoot         bool     `json:"is_root" yaml:"is_root"`
+	StorageProfile string   `json:"storage_profile" yaml:"storage_profile"`
+	Tags           []string `json:"tags" yaml:"tags"`
+}
+
+type InventoryLoadBalancer struct {
+	ID         string   `json:"id" yaml:"id"`
+	Vdc        string   `json:"vdc" yaml:"vdc"`
+	Name       string   `json:"name" yaml:"name"`
+	Port       string   `json:"port" yaml:"port"`
+	Floating   string   `json:"floating" yaml:"floating"`
+	Kubernetes string   `json:"kubernetes,omitempty" yaml:"kubernetes,omitempty"`
+	Tags       []string `json:"tags" yaml:"tags"`
+}
+
+type InventoryPool struct {
+	ID                 string                `json:"id" yaml:"id"`
+	LoadBalancer       string                `json:"load_balancer" yaml:"load_balancer"`
+	Port               int                   `json:"port" yaml:"port"`
+	Protocol           string                `json:"protocol" yaml:"protocol"`
+	Certificate        string                `json:"certificate,omitempty" yaml:"certificate,omitempty"`
+	Method             string                `json:"method" yaml:"method"`
+	Connlimit          int                   `json:"connlimit" yaml:"connlimit"`
+	SessionPersistence string                `json:"session_persistence" yaml:"session_persistence"`
+	Members            []InventoryPoolMember `json:"members" yaml:"members"`
+	HealthMonitor      *InventoryMonitor     `json:"health_monitor" yaml:"health_monitor"`
+}
+
+type InventoryMonitor struct {
+	Type          string `json:"type" yaml:"type"`
+	Interval      int    `json:"interval" yaml:"interval"`
+	Timeout       int    `json:"timeout" yaml:"timeout"`
+	MaxRetries    int    `json:"max_retries" yaml:"max_retries"`
+	HttpPath      string `json:"http_path,omitempty" yaml:"http_path,omitempty"`
+	ExpectedCodes string `json:"expected_codes,omitempty" yaml:"expected_codes,omitempty"`
+}
+
+type InventoryPoolMember struct {
+	ID     string `json:"id" yaml:"id"`
+	Vm     string `json:"vm" yaml:"vm"`
+	Port   int    `json:"port" yaml:"port"`
+	Weight int    `json:"weight" yaml:"weight"`
+}
+
+type InventoryKubernetes struct {
+	ID                 string   `json:"id" yaml:"id"`
+	Vdc                string   `json:"vdc" yaml:"vdc"`
+	Name               string   `json:"name" yaml:"name"`
+	Template           string   `json:"template" yaml:"template"`
+	NodesCount         int      `json:"nodes_count" yaml:"nodes_count"`
+	NodeCpu            int      `json:"node_cpu" yaml:"node_cpu"`
+	NodeRam            int      `json:"node_ram" yaml:"node_ram"`
+	NodeDiskSize       int      `json:"node_disk_size" yaml:"node_disk_size"`
+	NodeStorageProfile string   `json:"node_storage_profile" yaml:"node_storage_profile"`
+	NodePlatform       string   `json:"node_platform" yaml:"node_platform"`
+	Floating           string   `json:"floating" yaml:"floating"`
+	Vms                []string `json:"vms" yaml:"vms"`
+	Tags               []string `json:"tags" yaml:"tags"`
+}
+
+type InventoryDnsZone struct {
+	ID   string   `json:"id" yaml:"id"`
+	Name string   `json:"name" yaml:"name"`
+	Tags []string `json:"tags" yaml:"tags"`
+}
+
+type InventoryDnsRecord struct {
+	ID       string `json:"id" yaml:"id"`
+	Zone     string `json:"dns" yaml:"dns"`
+	Type     string `json:"type" yaml:"type"`
+	Host     string `json:"host" yaml:"host"`
+	Data     string `json:"data" yaml:"data"`
+	Ttl      int    `json:"ttl" yaml:"ttl"`
+	Priority int    `json:"priority" yaml:"priority"`
+	Weight   int    `json:"weight" yaml:"weight"`
+	Port     int    `json:"port" yaml:"port"`
+	Flag     int    `json:"flag" yaml:"flag"`
+	Tag      string `json:"tag" yaml:"tag"`
+}
+
+type InventoryS3Storage struct {
+	ID             string   `json:"id" yaml:"id"`
+	Name           string   `json:"name" yaml:"name"`
+	Backend        string   `json:"backend" yaml:"backend"`
+	ClientEndpoint string   `json:"client_endpoint" yaml:"client_endpoint"`
+	Tags           []string `json:"tags" yaml:"tags"`
+}
+
+type InventoryS3Bucket struct {
+	ID           string `json:"id" yaml:"id"`
+	S3Storage    string `json:"s3_storage" yaml:"s3_storage"`
+	Name         string `json:"name" yaml:"name"`
+	ExternalName string `json:"external_name" yaml:"external_name"`
+}
+
+// ExportProject reads every resource of a project into an Inventory. Lists
+// are sorted by ID so that two exports of an unchanged project are equal
+// apart from ExportedAt.
+func (m *Manager) ExportProject(projectID string) (inventory *Inventory, err error) {
+	project, err := m.GetProject(projectID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot get project %s", projectID)
+	}
+	inventory = &Inventory{
+		ExportedAt: time.Now().UTC(),
+		Project: InventoryProject{
+			ID:     project.ID,
+			Name:   project.Name,
+			Client: project.Client.Id,
+			Tags:   convertTagsToNames(project.Tags),
+		},
+	}
+
+	vdcs, err := m.GetVdcs(Arguments{"project": project.ID})
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot list vdcs")
+	}
+	firewalls := map[string]bool{}
+	for _, vdc := range vdcs {
+		if err = inventory.exportVdc(vdc, firewalls); err != nil {
+			return nil, errors.Wrapf(err, "Cannot export vdc %s", vdc.Name)
+		}
+	}
+
+	zones, err := project.GetDnss()
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot list dns zones")
+	}
+	for _, zone := range zones {
+		inventory.DnsZones = append(inventory.DnsZones, InventoryDnsZone{
+			ID: zone.ID, Name: zone.Name, Tags: convertTagsToNames(zone.Tags),
+		})
+		records, err := zone.GetDnsRecords()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Cannot list records of dns zone %s", zone.Name)
+		}
+		for _, r := range records {
+			inventory.DnsRecords = append(inventory.DnsRecords, InventoryDnsRecord{
+				ID: r.ID, Zone: zone.ID, Type: r.Type, Host: r.Host, Data: r.Data, Ttl: r.Ttl,
+				Priority: r.Priority, Weight: r.Weight, Port: r.Port, Flag: r.Flag, Tag: r.Tag,
+			})
+		}
+	}
+
+	storages, err := project.GetS3Storages()
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot list s3 storages")
+	}
+	for _, s3 := range storages {
+		inventory.S3Storages = append(inventory.S3Storages, InventoryS3Storage{
+			ID: s3.ID, Name: s3.Name, Backend: s3.Backend, ClientEndpoint: s3.ClientEndpoint,
+			Tags: convertTagsToNames(s3.Tags),
+		})
+		buckets, err := s3.GetBuckets()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Cannot list buckets of s3 storage %s", s3.Name)
+		}
+		for _, b := range buckets {
+			inventory.S3Buckets = append(inventory.S3Buckets, InventoryS3Bucket{
+				ID: b.ID, S3Storage: s3.ID, Name: b.Name, ExternalName: b.ExternalName,
+			})
+		}
+	}
+
+	inventory.sort()
+	return inventory, nil
+}
+
+func (i *Inventory) exportVdc(vdc *Vdc, firewalls map[string]bool) error {
+	i.Vdcs = append(i.Vdcs, InventoryVdc{
+		ID: vdc.ID, Name: vdc.Name, Hypervisor: vdc.Hypervisor.ID, Tags: convertTagsToNames(vdc.Tags),
+	})
+
+	networks, err := vdc.GetNetworks()
+	if err != nil {
+		return err
+	}
+	for _, network := range networks {
+		i.Networks = append(i.Networks, InventoryNetwork{
+			ID: network.ID, Vdc: vdc.ID, Name: network.Name, IsDefault: network.IsDefault,
+			Mtu: network.Mtu, Tags: convertTagsToNames(network.Tags),
+		})
+		subnets, err := network.GetSubnets()
+		if err != nil {
+			return err
+		}
+		for _, subnet := range subnets {
+			s := InventorySubnet{
+				ID: subnet.ID, Network: network.ID, CIDR: subnet.CIDR, Gateway: subnet.Gateway,
+				StartIp: subnet.StartIp, EndIp: subnet.EndIp, IsDHCP: subnet.IsDHCP,
+				DnsServers: []string{}, Routes: []InventorySubnetRoute{},
+			}
+			for _, dns := range subnet.DnsServers {
+				s.DnsServers = append(s.DnsServers, dns.DNSServer)
+			}
+			for _, route := range subnet.SubnetRoutes {
+				s.Routes = append(s.Routes, InventorySubnetRoute{CIDR: route.CIDR, Gateway: route.Gateway, Metric: route.Metric})
+			}
+			i.Subnets = append(i.Subnets, s)
+		}
+	}
+
+	routers, err := vdc.GetRouters()
+	if err != nil {
+		return err
+	}
+	for _, router := range routers {
+		i.Routers = append(i.Routers, InventoryRouter{
+			ID: router.ID, Vdc: vdc.ID, Name: router.Name, IsDefault: router.IsDefault,
+			Floating: portAddress(router.Floating), Tags: convertTagsToNames(router.Tags),
+		})
+		for _, route := range router.Routes {
+			i.Routes = append(i.Routes, InventoryRoute{
+				ID: route.ID, Router: router.ID, Destination: route.Destination, NextHop: route.NextHop,
+			})
+		}
+	}
+
+	ports, err := vdc.GetPorts()
+	if err != nil {
+		return err
+	}
+	for _, port := range ports {
+		p := InventoryPort{
+			ID: port.ID, Vdc: vdc.ID, IpAddress: portAddress(port),
+			FirewallTemplates: make([]string, 0, len(port.FirewallTemplates)),
+			Tags:              convertTagsToNames(port.Tags),
+		}
+		if port.Network != nil {
+			p.Network = port.Network.ID
+		}
+		if port.Connected != nil {
+			p.ConnectedType = port.Connected.Type
+			p.Connected = port.Connected.ID
+		}
+		for _, fw := range port.FirewallTemplates {
+			p.FirewallTemplates = append(p.FirewallTemplates, fw.ID)
+		}
+		sort.Strings(p.FirewallTemplates)
+		i.Ports = append(i.Ports, p)
+	}
+
+	templates, err := vdc.GetFirewallTemplates()
+	if err != nil {
+		return err
+	}
+	for _, fw := range templates {
+		// Shared templates are listed in every VDC.
+		if firewalls[fw.ID] {
+			continue
+		}
+		firewalls[fw.ID] = true
+		i.FirewallTemplates = append(i.FirewallTemplates, InventoryFirewallTemplate{
+			ID: fw.ID, Name: fw.Name, Tags: convertTagsToNames(fw.Tags),
+		})
+		rules, err := fw.manager.GetFirewallRules(fw.ID)
+		if err != nil {
+			return err
+		}
+		for _, r := range rules {
+			i.FirewallRules = append(i.FirewallRules, InventoryFirewallRule{
+				ID: r.ID, Template: fw.ID, Name: r.Name, Direction: r.Direction, Protocol: r.Protocol,
+				DestinationIp: r.DestinationIp, PortMin: r.DstPortRangeMin, PortMax: r.DstPortRangeMax,
+			})
+		}
+	}
+
+	vms, err := vdc.GetVms()
+	if err != nil {
+		return err
+	}
+	for _, vm := range vms {
+		v := InventoryVm{
+			ID: vm.ID, Vdc: vdc.ID, Name: vm.Name, Cpu: vm.Cpu, Ram: vm.Ram, Power: vm.Power,
+			Floating: portAddress(vm.Floating), Tags: convertTagsToNames(vm.Tags),
+		}
+		if vm.Template != nil {
+			v.Template = vm.Template.ID
+		}
+		if vm.Kubernetes != nil {
+			v.Kubernetes = vm.Kubernetes.ID
+		}
+		i.Vms = append(i.Vms, v)
+	}
+
+	disks, err := vdc.GetDisks()
+	if err != nil {
+		return err
+	}
+	for _, disk := range disks {
+		d := InventoryDisk{
+			ID: disk.ID, Vdc: vdc.ID, Name: disk.Name, Size: disk.Size, IsRoot: disk.IsRoot,
+			Tags: convertTagsToNames(disk.Tags),
+		}
+		if disk.Vm != nil {
+			d.Vm = disk.Vm.ID
+		}
+		if disk.StorageProfile != nil {
+			d.StorageProfile = disk.StorageProfile.ID
+		}
+		i.Disks = append(i.Disks, d)
+	}
+
+	lbs, err := vdc.GetLoadBalancers()
+	if err != nil {
+		return err
+	}
+	for _, lb := range lbs {
+		l := InventoryLoadBalancer{
+			ID: lb.ID, Vdc: vdc.ID, Name: lb.Name, Floating: portAddress(lb.Floating),
+			Tags: convertTagsToNames(lb.Tags),
+		}
+		if lb.Port != nil {
+			l.Port = lb.Port.ID
+		}
+		if lb.Kubernetes != nil {
+			l.Kubernetes = lb.Kubernetes.ID
+		}
+		i.LoadBalancers = append(i.LoadBalancers, l)
+
+		pools, err := lb.GetPools()
+		if err != nil {
+			return err
+		}
+		for _, pool := range pools {
+			p := InventoryPool{
+				ID: pool.ID, LoadBalancer: lb.ID, Port: pool.Port, Protocol: pool.Protocol,
+				Method: pool.Method, Connlimit: pool.Connlimit,
+				Members: make([]InventoryPoolMember, 0, len(pool.Members)),
+			}
+			if pool.Certificate != nil {
+				p.Certificate = pool.Certificate.ID
+			}
+			if pool.SessionPersistence != nil {
+				p.SessionPersistence = *pool.SessionPersistence
+			}
+			if hm := pool.HealthMonitor; hm != nil {
+				p.HealthMonitor = &InventoryMonitor{
+					Type: hm.Type, Interval: hm.Interval, Timeout: hm.Timeout, MaxRetries: hm.MaxRetries,
+					HttpPath: hm.HttpPath, ExpectedCodes: hm.ExpectedCodes,
+				}
+			}
+			for _, member := range pool.Members {
+				pm := InventoryPoolMember{ID: member.ID, Port: member.Port, Weight: member.Weight}
+				if member.Vm != nil {
+					pm.Vm = member.Vm.ID
+				}
+				p.Members = append(p.Members, pm)
+			}
+			i.Pools = append(i.Pools, p)
+		}
+	}
+
+	clusters, err := vdc.GetKubernetes()
+	if err != nil {
+		return err
+	}
+	for _, k := range clusters {
+		c := InventoryKubernetes{
+			ID: k.ID, Vdc: vdc.ID, Name: k.Name, NodesCount: k.NodesCount, NodeCpu: k.NodeCpu,
+			NodeRam: k.NodeRam, NodeDiskSize: k.NodeDiskSize, Floating: portAddress(k.Floating),
+			Vms: make([]string, 0, len(k.Vms)), Tags: convertTagsToNames(k.Tags),
+		}
+		if k.Template != nil {
+			c.Template = k.Template.ID
+		}
+		if k.NodeStorageProfile != nil {
+			c.NodeStorageProfile = k.NodeStorageProfile.ID
+		}
+		if k.NodePlatform != nil {
+			c.NodePlatform = k.NodePlatform.ID
+		}
+		for _, vm := range k.Vms {
+			c.Vms = append(c.Vms, vm.ID)
+		}
+		sort.Strings(c.Vms)
+		i.Kubernetes = append(i.Kubernetes, c)
+	}
+	return nil
+}
+
+func (i *Inventory) sort() {
+	sortInventory(&i.Vdcs, func(v InventoryVdc) string { return v.ID })
+	sortInventory(&i.Networks, func(n InventoryNetwork) string { return n.ID })
+	sortInventory(&i.Subnets, func(s InventorySubnet) string { return s.ID })
+	sortInventory(&i.Routers, func(r InventoryRouter) string { return r.ID })
+	sortInventory(&i.Routes, func(r InventoryRoute) string { return r.ID })
+	sortInventory(&i.Ports, func(p InventoryPort) string { return p.ID })
+	sortInventory(&i.FirewallTemplates, func(t InventoryFirewallTemplate) string { return t.ID })
+	sortInventory(&i.FirewallRules, func(r InventoryFirewallRule) string { return r.ID })
+	sortInventory(&i.Vms, func(v InventoryVm) string { return v.ID })
+	sortInventory(&i.Disks, func(d InventoryDisk) string { return d.ID })
+	sortInventory(&i.LoadBalancers, func(l InventoryLoadBalancer) string { return l.ID })
+	sortInventory(&i.Pools, func(p InventoryPool) string { return p.ID })
+	sortInventory(&i.Kubernetes, func(k InventoryKubernetes) string { return k.ID })
+	sortInventory(&i.DnsZones, func(z InventoryDnsZone) string { return z.ID })
+	sortInventory(&i.DnsRecords, func(r InventoryDnsRecord) string { return r.ID })
+	sortInventory(&i.S3Storages, func(s InventoryS3Storage) string { return s.ID })
+	sortInventory(&i.S3Buckets, func(b InventoryS3Bucket) string { return b.ID })
+}
+
+// sortInventory sorts items by ID and replaces a nil list with an empty one,
+// so that kinds without resources are exported as [] rather than null.
+func sortInventory[T any](items *[]T, id func(T) string) {
+	if *items == nil {
+		*items = []T{}
+	}
+	list := *items
+	sort.Slice(list, func(i, j int) bool { return id(list[i]) < id(list[j]) })
+}
+
+// JSON returns the inventory as indented JSON.
+func (i *Inventory) JSON() ([]byte, error) {
+	return json.MarshalIndent(i, "", "  ")
+}
+
+// YAML returns the inventory as YAML.
+func (i *Inventory) YAML() ([]byte, error) {
+	return yaml.Marshal(i)
+}
+
+func portAddress(port *Port) string {
+	if port == nil || port.IpAddress == nil {
+		return ""
+	}
+	return *port.IpAddress
+}
@@ -0,0 +1,189 @@
+package rustack_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+	"github.com/rustack-cloud-platform/rcp-go/rustacktest"
+)
+
+// seedProject seeds a project using every exported kind and returns its ID.
+func seedProject(s *rustacktest.Server) string {
+	client := s.Seed("client", map[string]interface{}{"name": "client"})
+	project := s.Seed("project", map[string]interface{}{"name": "shop", "client": client["id"]})
+	projectID := project["id"].(string)
+	hypervisor := map[string]interface{}{"id": "h", "name": "VMware"}
+	prod := s.Seed("vdc", map[string]interface{}{"name": "prod", "project": projectID, "hypervisor": hypervisor})
+	s.Seed("vdc", map[string]interface{}{"name": "stage", "project": projectID, "hypervisor": hypervisor})
+	vdcID := prod["id"].(string)
+
+	profile := s.Seed("storage_profile", map[string]interface{}{"name": "ssd"})
+	network := s.Seed("network", map[string]interface{}{"name": "backend", "vdc": vdcID})
+	s.Seed("network/"+network["id"].(string)+"/subnet", map[string]interface{}{
+		"cidr": "10.0.1.0/24", "gateway": "10.0.1.1", "start_ip": "10.0.1.10", "end_ip": "10.0.1.250",
+	})
+	s.Seed("router", map[string]interface{}{
+		"name": "edge", "vdc": vdcID,
+		"routes": []interface{}{map[string]interface{}{"destination": "10.1.0.0/16", "nexthop": "10.0.1.2"}},
+	})
+
+	// Templates without a VDC are shared and listed in both VDCs.
+	fw := s.Seed("firewall", map[string]interface{}{"name": "web"})
+	s.Seed("firewall/"+fw["id"].(string)+"/rule", map[string]interface{}{"name": "http", "direction": "ingress", "protocol": "tcp"})
+
+	vm := s.Seed("vm", map[string]interface{}{
+		"name": "web", "vdc": vdcID,
+		"disks": []interface{}{
+			map[string]interface{}{"name": "root", "size": 10, "storage_profile": profile["id"]},
+			map[string]interface{}{"name": "data", "size": 50, "storage_profile": profile["id"]},
+		},
+	})
+	s.Seed("port", map[string]interface{}{
+		"vdc": vdcID, "network": network["id"], "vm": vm["id"],
+		"firewall_templates": []interface{}{map[string]interface{}{"id": fw["id"], "name": "web"}},
+	})
+	lb := s.Seed("lbaas", map[string]interface{}{
+		"name": "front", "vdc": vdcID,
+		"port": map[string]interface{}{"vdc": vdcID, "network": network["id"], "ip_address": "10.0.1.5"},
+	})
+	s.Seed("lbaas/"+lb["id"].(string)+"/pool", map[string]interface{}{
+		"port": 80, "protocol": "TCP", "method": "ROUND_ROBIN",
+		"members": []interface{}{map[string]interface{}{"id": "member", "vm": vm, "port": 8080, "weight": 50}},
+	})
+
+	dns := s.Seed("dns", map[string]interface{}{"name": "shop.example.", "project": projectID})
+	s.Seed("dns/"+dns["id"].(string)+"/record", map[string]interface{}{"type": "A", "host": "www", "data": "10.0.1.5"})
+	s3 := s.Seed("s3_storage", map[string]interface{}{"name": "files", "project": projectID, "backend": "minio"})
+	s.Seed("s3_storage/"+s3["id"].(string)+"/bucket", map[string]interface{}{"name": "assets", "external_name": "shop-assets"})
+
+	// Resources of other projects are left out.
+	other := s.Seed("project", map[string]interface{}{"name": "other", "client": client["id"]})
+	otherVdc := s.Seed("vdc", map[string]interface{}{"name": "other", "project": other["id"], "hypervisor": hypervisor})
+	s.Seed("network", map[string]interface{}{"name": "other", "vdc": otherVdc["id"]})
+	return projectID
+}
+
+func ids[T any](items []T, id func(T) string) map[string]bool {
+	set := make(map[string]bool, len(items))
+	for _, item := range items {
+		set[id(item)] = true
+	}
+	return set
+}
+
+func TestExportProject(t *testing.T) {
+	s := rustacktest.NewServer()
+	defer s.Close()
+	m := s.Manager()
+	projectID := seedProject(s)
+
+	inv, err := m.ExportProject(projectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{
+		"vdcs": len(inv.Vdcs), "networks": len(inv.Networks), "subnets": len(inv.Subnets),
+		"routers": len(inv.Routers), "routes": len(inv.Routes), "ports": len(inv.Ports),
+		"firewall templates": len(inv.FirewallTemplates), "firewall rules": len(inv.FirewallRules),
+		"vms": len(inv.Vms), "disks": len(inv.Disks), "load balancers": len(inv.LoadBalancers),
+		"pools": len(inv.Pools), "dns zones": len(inv.DnsZones), "dns records": len(inv.DnsRecords),
+		"s3 storages": len(inv.S3Storages), "s3 buckets": len(inv.S3Buckets),
+	}
+	want := map[string]int{
+		"vdcs": 2, "networks": 1, "subnets": 1, "routers": 1, "routes": 1, "ports": 2,
+		"firewall templates": 1, "firewall rules": 1, "vms": 1, "disks": 2, "load balancers": 1,
+		"pools": 1, "dns zones": 1, "dns records": 1, "s3 storages": 1, "s3 buckets": 1,
+	}
+	for kind, n := range want {
+		if counts[kind] != n {
+			t.Errorf("exported %d %s, want %d", counts[kind], kind, n)
+		}
+	}
+	if inv.Project.ID != projectID || inv.Project.Client == "" {
+		t.Errorf("project %+v", inv.Project)
+	}
+
+	vdcs := ids(inv.Vdcs, func(v rustack.InventoryVdc) string { return v.ID })
+	networks := ids(inv.Networks, func(n rustack.InventoryNetwork) string { return n.ID })
+	routers := ids(inv.Routers, func(r rustack.InventoryRouter) string { return r.ID })
+	ports := ids(inv.Ports, func(p rustack.InventoryPort) string { return p.ID })
+	firewalls := ids(inv.FirewallTemplates, func(f rustack.InventoryFirewallTemplate) string { return f.ID })
+	vms := ids(inv.Vms, func(v rustack.InventoryVm) string { return v.ID })
+	lbs := ids(inv.LoadBalancers, func(l rustack.InventoryLoadBalancer) string { return l.ID })
+	zones := ids(inv.DnsZones, func(z rustack.InventoryDnsZone) string { return z.ID })
+	storages := ids(inv.S3Storages, func(s rustack.InventoryS3Storage) string { return s.ID })
+	connected := map[string]map[string]bool{"vm": vms, "router": routers, "lbaas": lbs}
+
+	ref := func(what string, id string, set map[string]bool) {
+		if !set[id] {
+			t.Errorf("%s refers to %q, which is not exported", what, id)
+		}
+	}
+	for _, n := range inv.Networks {
+		ref("network "+n.Name, n.Vdc, vdcs)
+	}
+	for _, sn := range inv.Subnets {
+		ref("subnet "+sn.CIDR, sn.Network, networks)
+	}
+	for _, r := range inv.Routers {
+		ref("router "+r.Name, r.Vdc, vdcs)
+	}
+	for _, r := range inv.Routes {
+		ref("route "+r.Destination, r.Router, routers)
+	}
+	for _, p := range inv.Ports {
+		ref("port "+p.IpAddress, p.Vdc, vdcs)
+		ref("port "+p.IpAddress, p.Network, networks)
+		ref("port "+p.IpAddress, p.Connected, connected[p.ConnectedType])
+		for _, fw := range p.FirewallTemplates {
+			ref("port "+p.IpAddress, fw, firewalls)
+		}
+	}
+	for _, r := range inv.FirewallRules {
+		ref("firewall rule "+r.Name, r.Template, firewalls)
+	}
+	for _, v := range inv.Vms {
+		ref("vm "+v.Name, v.Vdc, vdcs)
+	}
+	for _, d := range inv.Disks {
+		ref("disk "+d.Name, d.Vdc, vdcs)
+		ref("disk "+d.Name, d.Vm, vms)
+		if d.StorageProfile == "" {
+			t.Errorf("disk %s has no storage profile", d.Name)
+		}
+	}
+	for _, l := range inv.LoadBalancers {
+		ref("load balancer "+l.Name, l.Vdc, vdcs)
+		ref("load balancer "+l.Name, l.Port, ports)
+	}
+	for _, p := range inv.Pools {
+		ref("pool", p.LoadBalancer, lbs)
+		for _, member := range p.Members {
+			ref("pool member", member.Vm, vms)
+		}
+	}
+	for _, r := range inv.DnsRecords {
+		ref("dns record "+r.Host, r.Zone, zones)
+	}
+	for _, b := range inv.S3Buckets {
+		ref("s3 bucket "+b.Name, b.S3Storage, storages)
+	}
+
+	// An unchanged project exports the same document, without secrets.
+	again, err := m.ExportProject(projectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again.ExportedAt = inv.ExportedAt
+	first, _ := inv.JSON()
+	second, _ := again.JSON()
+	if !bytes.Equal(first, second) {
+		t.Fatal("exports of an unchanged project differ")
+	}
+	for _, s3 := range s.Objects("s3_storage") {
+		if bytes.Contains(first, []byte(s3["secret_key"].(string))) {
+			t.Fatal("s3 secret key exported")
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package rustack
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const MaxPageSize = 1000
+
+// Filter is implemented by the typed list filters. Arguments validates the
+// filter and compiles it to query parameters accepted by the list getters
+// and iterators:
+//
+//	args, err := VmFilter{Vdc: vdc.ID, Power: &on, ListOptions: ListOptions{Sort: "-cpu"}}.Arguments()
+//	vms, err := m.GetVms(args)
+type Filter interface {
+	Arguments() (Arguments, error)
+}
+
+// ListOptions controls sorting and page size of a list request.
+type ListOptions struct {
+	// Sort is a comma separated list of fields, prefix a field with "-" for
+	// descending order.
+	Sort string
+	// PageSize is the number of items fetched per request, zero means the
+	// server default.
+	PageSize int
+}
+
+func (o ListOptions) apply(args Arguments, sortable ...string) (Arguments, error) {
+	if o.PageSize < 0 || o.PageSize > MaxPageSize {
+		return nil, errors.Errorf("page size must be between 0 and %d, got %d", MaxPageSize, o.PageSize)
+	}
+	if o.PageSize > 0 {
+		args["limit"] = strconv.Itoa(o.PageSize)
+	}
+
+	if o.Sort == "" {
+		return args, nil
+	}
+	for _, field := range strings.Split(o.Sort, ",") {
+		name := strings.TrimPrefix(strings.TrimSpace(field), "-")
+		if !contains(sortable, name) {
+			return nil, errors.Errorf("cannot sort by %q, allowed fields: %s", name, strings.Join(sortable, ", "))
+		}
+	}
+	args["sort"] = o.Sort
+	return args, nil
+}
+
+type VdcFilter struct {
+	Project string
+	Name    string
+	Tags    []string
+	ListOptions
+}
+
+func (f VdcFilter) Arguments() (Arguments, error) {
+	args := Defaults()
+	setArg(args, "project", f.Project)
+	setArg(args, "name", f.Name)
+	if err := setTagsArg(args, f.Tags); err != nil {
+		return nil, err
+	}
+	return f.apply(args, "name")
+}
+
+type ProjectFilter struct {
+	Client string
+	Name   string
+	Tags   []string
+	ListOptions
+}
+
+func (f ProjectFilter) Arguments() (Arguments, error) {
+	args := Defaults()
+	setArg(args, "client", f.Client)
+	setArg(args, "name", f.Name)
+	if err := setTagsArg(args, f.Tags); err != nil {
+		return nil, err
+	}
+	return f.apply(args, "name")
+}
+
+type VmFilter struct {
+	Vdc  string
+	Name string
+	Tags []string
+	// Power filters by power state when set.
+	Power *bool
+	// Kubernetes is the ID of the cluster the VMs belong to.
+	Kubernetes string
+	ListOptions
+}
+
+func (f VmFilter) Arguments() (Arguments, error) {
+	args := Defaults()
+	setArg(args, "vdc", f.Vdc)
+	setArg(args, "name", f.Name)
+	setArg(args, "kubernetes", f.Kubernetes)
+	if f.Power != nil {
+		args["power"] = strconv.FormatBool(*f.Power)
+	}
+	if err := setTagsArg(args, f.Tags); err != nil {
+		return nil, err
+	}
+	return f.apply(args, "name", "cpu", "ram", "power")
+}
+
+type DiskFilter struct {
+	Vdc            string
+	Vm             string
+	StorageProfile string
+	Name           string
+	Tags           []string
+	ListOptions
+}
+
+func (f DiskFilter) Arguments() (Arguments, error) {
+	args := Defaults()
+	setArg(args, "vdc", f.Vdc)
+	setArg(args, "vm", f.Vm)
+	setArg(args, "storage_profile", f.StorageProfile)
+	setArg(args, "name", f.Name)
+	if err := setTagsArg(args, f.Tags); err != nil {
+		return nil, err
+	}
+	return f.apply(args, "name", "size")
+}
+
+type DiskSnapshotFilter struct {
+	Vdc  string
+	Disk string
+	// Type is DiskSnapshotManual or DiskSnapshotBackup.
+	Type string
+	Name string
+	ListOptions
+}
+
+func (f DiskSnapshotFilter) Arguments() (Arguments, error) {
+	args := Defaults()
+	setArg(args, "vdc", f.Vdc)
+	setArg(args, "disk", f.Disk)
+	switch f.Type {
+	case "", DiskSnapshotManual, DiskSnapshotBackup:
+		setArg(args, "type", f.Type)
+	default:
+		return nil, errors.Errorf("unknown disk snapshot type %q", f.Type)
+	}
+	setArg(args, "name", f.Name)
+	return f.apply(args, "name", "created_at")
+}
+
+type NetworkFilter struct {
+	Vdc  string
+	Name string
+	Tags []string
+	ListOptions
+}
+
+func (f NetworkFilter) Arguments() (Arguments, error) {
+	args := Defaults()
+	setArg(args, "vdc", f.Vdc)
+	setArg(args, "name", f.Name)
+	if err := setTagsArg(args, f.Tags); err != nil {
+		return nil, err
+	}
+	return f.apply(args, "name")
+}
+
+const (
+	PortTypeVm     = "vm"
+	PortTypeRouter = "router"
+	PortTypeLbaas  = "lbaas"
+)
+
+type PortFilter struct {
+	Vdc     string
+	Network string
+	// Type is the type of the connected device: PortTypeVm, PortTypeRouter
+	// or PortTypeLbaas.
+	Type string
+	// External selects floating (external) addresses only.
+	External bool
+	Tags     []string
+	ListOptions
+}
+
+func (f PortFilter) Arguments() (Arguments, error) {
+	args := Defaults()
+	setArg(args, "vdc", f.Vdc)
+	setArg(args, "network", f.Network)
+	switch f.Type {
+	case "", PortTypeVm, PortTypeRouter, PortTypeLbaas:
+		setArg(args, "type", f.Type)
+	default:
+		return nil, errors.Errorf("unknown port type %q", f.Type)
+	}
+	if f.External {
+		args["filter_type"] = "external"
+	}
+	if err := setTagsArg(args, f.Tags); err != nil {
+		return nil, err
+	}
+	return f.apply(args, "ip_address")
+}
+
+type RouterFilter struct {
+	Vdc  string
+	Name string
+	Tags []string
+	ListOptions
+}
+
+func (f RouterFilter) Arguments() (Arguments, error) {
+	args := Defaults()
+	setArg(args, "vdc", f.Vdc)
+	setArg(args, "name", f.Name)
+	if err := setTagsArg(args, f.Tags); err != nil {
+		return nil, err
+	}
+	return f.apply(args, "name")
+}
+
+type LoadBalancerFilter struct {
+	Vdc  string
+	Name string
+	Tags []string
+	ListOptions
+}
+
+func (f LoadBalancerFilter) Arguments() (Arguments, error) {
+	args := Defaults()
+	setArg(args, "vdc", f.Vdc)
+	setArg(args, "name", f.Name)
+	if err := setTagsArg(args, f.Tags); err != nil {
+		return nil, err
+	}
+	return f.apply(args, "name")
+}
+
+type KubernetesFilter struct {
+	Vdc  string
+	Name string
+	Tags []string
+	ListOptions
+}
+
+func (f KubernetesFilter) Arguments() (Arguments, error) {
+	args := Defaults()
+	setArg(args, "vdc", f.Vdc)
+	setArg(args, "name", f.Name)
+	if err := setTagsArg(args, f.Tags); err != nil {
+		return nil, err
+	}
+	return f.apply(args, "name", "nodes_count")
+}
+
+type DnsFilter struct {
+	Project string
+	Name    string
+	Tags    []string
+	ListOptions
+}
+
+func (f DnsFilter) Arguments() (Arguments, error) {
+	args := Defaults()
+	setArg(args, "project", f.Project)
+	setArg(args, "name", f.Name)
+	if err := setTagsArg(args, f.Tags); err != nil {
+		return nil, err
+	}
+	return f.apply(args, "name")
+}
+
+type S3StorageFilter struct {
+	Project string
+	Name    string
+	Tags    []string
+	ListOptions
+}
+
+func (f S3StorageFilter) Arguments() (Arguments, error) {
+	args := Defaults()
+	setArg(args, "project", f.Project)
+	setArg(args, "name", f.Name)
+	if err := setTagsArg(args, f.Tags); err != nil {
+		return nil, err
+	}
+	return f.apply(args, "name")
+}
+
+func setArg(args Arguments, key string, value string) {
+	if value != "" {
+		args[key] = value
+	}
+}
+
+func setTagsArg(args Arguments, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	for _, tag := range tags {
+		if tag == "" || strings.Contains(tag, ",") {
+			return errors.Errorf("invalid tag %q", tag)
+		}
+	}
+	args["tags"] = strings.Join(tags, ",")
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
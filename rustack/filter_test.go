@@ -0,0 +1,76 @@
+package rustack_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+func TestFilterArguments(t *testing.T) {
+	on := true
+	tests := []struct {
+		name   string
+		filter rustack.Filter
+		want   rustack.Arguments
+	}{
+		{
+			name:   "empty",
+			filter: rustack.VdcFilter{},
+			want:   rustack.Arguments{},
+		},
+		{
+			name:   "vdc",
+			filter: rustack.VdcFilter{Project: "p", Name: "prod", Tags: []string{"a", "b"}},
+			want:   rustack.Arguments{"project": "p", "name": "prod", "tags": "a,b"},
+		},
+		{
+			name:   "vm",
+			filter: rustack.VmFilter{Vdc: "v", Power: &on, Kubernetes: "k", ListOptions: rustack.ListOptions{Sort: "-cpu,name", PageSize: 50}},
+			want:   rustack.Arguments{"vdc": "v", "power": "true", "kubernetes": "k", "sort": "-cpu,name", "limit": "50"},
+		},
+		{
+			name:   "external ports",
+			filter: rustack.PortFilter{Network: "n", Type: rustack.PortTypeRouter, External: true},
+			want:   rustack.Arguments{"network": "n", "type": "router", "filter_type": "external"},
+		},
+		{
+			name:   "largest page",
+			filter: rustack.DiskFilter{ListOptions: rustack.ListOptions{PageSize: rustack.MaxPageSize}},
+			want:   rustack.Arguments{"limit": "1000"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := tt.filter.Arguments()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(args, tt.want) {
+				t.Fatalf("got %v, want %v", args, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter rustack.Filter
+	}{
+		{"page size too large", rustack.VdcFilter{ListOptions: rustack.ListOptions{PageSize: rustack.MaxPageSize + 1}}},
+		{"negative page size", rustack.NetworkFilter{ListOptions: rustack.ListOptions{PageSize: -1}}},
+		{"unknown sort field", rustack.VmFilter{ListOptions: rustack.ListOptions{Sort: "size"}}},
+		{"one unknown sort field", rustack.DiskFilter{ListOptions: rustack.ListOptions{Sort: "name,-cpu"}}},
+		{"empty tag", rustack.RouterFilter{Tags: []string{"a", ""}}},
+		{"tag with comma", rustack.DnsFilter{Tags: []string{"a,b"}}},
+		{"unknown port type", rustack.PortFilter{Type: "switch"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if args, err := tt.filter.Arguments(); err == nil {
+				t.Fatalf("got %v, want an error", args)
+			}
+		})
+	}
+}
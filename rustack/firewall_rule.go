@@ -5,6 +5,7 @@ import (
 )
 
 type FirewallRule struct {
+	jobList
 	manager         *Manager
 	TemplateId      string
 	ID              string `json:"id"`
@@ -82,6 +83,10 @@ func (m *Manager) GetFirewallRules(id string) (firewallRules []*FirewallRule, er
 	if err != nil {
 		return
 	}
+	for i := range firewallRules {
+		firewallRules[i].manager = m
+		firewallRules[i].TemplateId = id
+	}
 	return
 }
 
@@ -93,7 +98,7 @@ func (f *FirewallRule) Update() (err error) {
 
 func (f *FirewallRule) Delete() (err error) {
 	path := fmt.Sprintf("v1/firewall/%s/rule/%s", f.TemplateId, f.ID)
-	return f.manager.Delete(path, Defaults(), nil)
+	return f.manager.deleteResource(path, f)
 }
 
 func (f FirewallRule) WaitLock() (err error) {
@@ -6,6 +6,7 @@ import (
 )
 
 type FirewallTemplate struct {
+	jobList
 	manager *Manager
 	ID      string `json:"id"`
 	Name    string `json:"name"`
@@ -54,7 +55,7 @@ func (f *FirewallTemplate) Update(firewallRule *FirewallRule) (err error) {
 
 func (f *FirewallTemplate) Delete() (err error) {
 	path, _ := url.JoinPath("v1/firewall", f.ID)
-	return f.manager.Delete(path, Defaults(), nil)
+	return f.manager.deleteResource(path, f)
 }
 
 func (f *FirewallTemplate) Rename(name string) (err error) {
@@ -96,3 +97,24 @@ func (f FirewallTemplate) WaitLock() (err error) {
 	path, _ := url.JoinPath("v1/firewall", f.ID)
 	return loopWaitLock(f.manager, path)
 }
+
+func (f *FirewallTemplate) TagNames() []string {
+	return convertTagsToNames(f.Tags)
+}
+
+func (f *FirewallTemplate) tagPath() string {
+	path, _ := url.JoinPath("v1/firewall", f.ID)
+	return path
+}
+
+func (f *FirewallTemplate) SetTags(tags ...string) error {
+	return f.manager.setTags(f, tags)
+}
+
+func (f *FirewallTemplate) AddTags(tags ...string) error {
+	return f.manager.addTags(f, tags)
+}
+
+func (f *FirewallTemplate) RemoveTags(tags ...string) error {
+	return f.manager.removeTags(f, tags)
+}
@@ -17,9 +17,9 @@ func (m *Manager) GetFloating(id string) (fip *Floating, err error) {
 }
 
 func (v *Vdc) GetFloatingByAddress(address string) (fip *Floating, err error) {
-	args := Arguments{
-		"vdc":         v.ID,
-		"filter_type": "external",
+	args, err := PortFilter{Vdc: v.ID, External: true}.Arguments()
+	if err != nil {
+		return nil, err
 	}
 	var items []*Floating
 	err = v.manager.GetItems("v1/port", args, &items)
@@ -0,0 +1,304 @@
+package rustack
+
+import (
+	"github.com/pkg/errors"
+)
+
+type ResourceKind string
+
+const (
+	KindProject          ResourceKind = "project"
+	KindVdc              ResourceKind = "vdc"
+	KindNetwork          ResourceKind = "network"
+	KindRouter           ResourceKind = "router"
+	KindPort             ResourceKind = "port"
+	KindFirewallTemplate ResourceKind = "firewall_template"
+	KindVm               ResourceKind = "vm"
+	KindDisk             ResourceKind = "disk"
+	KindLoadBalancer     ResourceKind = "load_balancer"
+	KindKubernetes       ResourceKind = "kubernetes"
+	KindDns              ResourceKind = "dns"
+	KindS3Storage        ResourceKind = "s3_storage"
+	KindCertificate      ResourceKind = "certificate"
+)
+
+// Resource is a node of a DependencyGraph.
+type Resource struct {
+	Kind   ResourceKind `json:"kind"`
+	ID     string       `json:"id"`
+	Name   string       `json:"name"`
+	Locked bool         `json:"locked"`
+	// Object is the resource itself, e.g. a *Vm for KindVm.
+	Object interface{} `json:"-"`
+	// Dependents are the resources referencing this one, which have to be
+	// deleted first.
+	Dependents []*Resource `json:"-"`
+
+	dependencies []*Resource
+}
+
+// DependencyGraph links the resources of a VDC or project to the resources
+// they reference: ports to their network, VMs, routers and load balancers to
+// their ports, load balancers to their member VMs and certificates, attached
+// data disks to their VM, and everything to its VDC and project.
+//
+// Resources removed together with their owner are not part of the graph:
+// subnets, routes, root disks and the VMs and load balancers of Kubernetes
+// clusters. Neither are the default network and router of a VDC, which are
+// removed with the VDC, nor firewall templates.
+type DependencyGraph struct {
+	// Resources lists the resources in the order they were found.
+	Resources []*Resource
+	index     map[string]*Resource
+}
+
+func newDependencyGraph() *DependencyGraph {
+	return &DependencyGraph{index: make(map[string]*Resource)}
+}
+
+// Get returns the resource of the given kind and ID, nil if it is not part of
+// the graph.
+func (g *DependencyGraph) Get(kind ResourceKind, id string) *Resource {
+	return g.index[string(kind)+"/"+id]
+}
+
+func (g *DependencyGraph) add(kind ResourceKind, id string, name string, locked bool, obj interface{}) *Resource {
+	if r := g.Get(kind, id); r != nil {
+		return r
+	}
+	r := &Resource{Kind: kind, ID: id, Name: name, Locked: locked, Object: obj}
+	g.Resources = append(g.Resources, r)
+	g.index[string(kind)+"/"+id] = r
+	return r
+}
+
+// link records that dependent references dependency.
+func (g *DependencyGraph) link(dependent *Resource, dependency *Resource) {
+	if dependent == nil || dependency == nil || dependent == dependency {
+		return
+	}
+	for _, d := range dependency.Dependents {
+		if d == dependent {
+			return
+		}
+	}
+	dependency.Dependents = append(dependency.Dependents, dependent)
+	dependent.dependencies = append(dependent.dependencies, dependency)
+}
+
+// DeleteOrder returns the resources in batches that can be deleted one after
+// the other. Every resource comes after all its dependents, resources of the
+// same batch do not depend on each other.
+func (g *DependencyGraph) DeleteOrder() ([][]*Resource, error) {
+	remaining := make(map[*Resource]int, len(g.Resources))
+	var ready []*Resource
+	for _, r := range g.Resources {
+		remaining[r] = len(r.Dependents)
+		if len(r.Dependents) == 0 {
+			ready = append(ready, r)
+		}
+	}
+
+	var batches [][]*Resource
+	done := 0
+	for len(ready) > 0 {
+		batches = append(batches, ready)
+		done += len(ready)
+		var next []*Resource
+		for _, r := range ready {
+			for _, dep := range r.dependencies {
+				remaining[dep]--
+				if remaining[dep] == 0 {
+					next = append(next, dep)
+				}
+			}
+		}
+		ready = next
+	}
+	if done != len(g.Resources) {
+		return nil, errors.Errorf("Dependency cycle between %d resources", len(g.Resources)-done)
+	}
+	return batches, nil
+}
+
+// DependencyGraph lists the resources of the VDC and the references between
+// them.
+func (v *Vdc) DependencyGraph() (*DependencyGraph, error) {
+	g := newDependencyGraph()
+	if err := g.addVdc(v); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// DependencyGraph lists the resources of the project and of all its VDCs and
+// the references between them.
+func (p *Project) DependencyGraph() (*DependencyGraph, error) {
+	g := newDependencyGraph()
+	project := g.add(KindProject, p.ID, p.Name, p.Locked, p)
+
+	// Certificates go first, so that load balancers of the VDCs can be
+	// linked to them.
+	certificates, err := p.GetCertificates()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range certificates {
+		g.add(KindCertificate, c.ID, c.Name, c.Locked, c)
+	}
+
+	vdcs, err := p.manager.GetVdcs(Arguments{"project": p.ID})
+	if err != nil {
+		return nil, err
+	}
+	for _, vdc := range vdcs {
+		if err := g.addVdc(vdc); err != nil {
+			return nil, err
+		}
+	}
+
+	zones, err := p.GetDnss()
+	if err != nil {
+		return nil, err
+	}
+	for _, zone := range zones {
+		g.add(KindDns, zone.ID, zone.Name, false, zone)
+	}
+	storages, err := p.GetS3Storages()
+	if err != nil {
+		return nil, err
+	}
+	for _, s3 := range storages {
+		g.add(KindS3Storage, s3.ID, s3.Name, s3.Locked, s3)
+	}
+
+	for _, r := range g.Resources {
+		g.link(r, project)
+	}
+	return g, nil
+}
+
+func (g *DependencyGraph) addVdc(vdc *Vdc) error {
+	start := len(g.Resources)
+	root := g.add(KindVdc, vdc.ID, vdc.Name, vdc.Locked, vdc)
+
+	networks, err := vdc.GetNetworks()
+	if err != nil {
+		return errors.Wrapf(err, "Cannot list networks of vdc %s", vdc.Name)
+	}
+	for _, network := range networks {
+		if !network.IsDefault {
+			g.add(KindNetwork, network.ID, network.Name, network.Locked, network)
+		}
+	}
+
+	// Kubernetes clusters remove their VMs and load balancers, with their
+	// ports, but have to go before the networks of these ports.
+	clusters, err := vdc.GetKubernetes()
+	if err != nil {
+		return errors.Wrapf(err, "Cannot list kubernetes clusters of vdc %s", vdc.Name)
+	}
+	owned := map[string]*Resource{}
+	for _, k := range clusters {
+		cluster := g.add(KindKubernetes, k.ID, k.Name, k.Locked, k)
+		for _, vm := range k.Vms {
+			owned[vm.ID] = cluster
+		}
+	}
+
+	vms, err := vdc.GetVms()
+	if err != nil {
+		return errors.Wrapf(err, "Cannot list vms of vdc %s", vdc.Name)
+	}
+	for _, vm := range vms {
+		if vm.Kubernetes != nil {
+			owned[vm.ID] = g.Get(KindKubernetes, vm.Kubernetes.ID)
+			continue
+		}
+		g.add(KindVm, vm.ID, vm.Name, vm.Locked, vm)
+	}
+
+	lbs, err := vdc.GetLoadBalancers()
+	if err != nil {
+		return errors.Wrapf(err, "Cannot list load balancers of vdc %s", vdc.Name)
+	}
+	for _, lb := range lbs {
+		if lb.Kubernetes != nil {
+			owned[lb.ID] = g.Get(KindKubernetes, lb.Kubernetes.ID)
+			continue
+		}
+		r := g.add(KindLoadBalancer, lb.ID, lb.Name, lb.Locked, lb)
+		pools, err := lb.GetPools()
+		if err != nil {
+			return errors.Wrapf(err, "Cannot list pools of load balancer %s", lb.Name)
+		}
+		for _, pool := range pools {
+			for _, member := range pool.Members {
+				if member.Vm != nil {
+					g.link(r, g.Get(KindVm, member.Vm.ID))
+				}
+			}
+			if pool.Certificate != nil {
+				g.link(r, g.Get(KindCertificate, pool.Certificate.ID))
+			}
+		}
+	}
+
+	routers, err := vdc.GetRouters()
+	if err != nil {
+		return errors.Wrapf(err, "Cannot list routers of vdc %s", vdc.Name)
+	}
+	for _, router := range routers {
+		if !router.IsDefault {
+			g.add(KindRouter, router.ID, router.Name, router.Locked, router)
+		}
+	}
+
+	ports, err := vdc.GetPorts()
+	if err != nil {
+		return errors.Wrapf(err, "Cannot list ports of vdc %s", vdc.Name)
+	}
+	for _, port := range ports {
+		var network *Resource
+		if port.Network != nil {
+			network = g.Get(KindNetwork, port.Network.ID)
+		}
+		if port.Connected != nil {
+			if cluster, ok := owned[port.Connected.ID]; ok {
+				g.link(cluster, network)
+				continue
+			}
+		}
+		name := ""
+		if port.IpAddress != nil {
+			name = *port.IpAddress
+		}
+		r := g.add(KindPort, port.ID, name, port.Locked, port)
+		g.link(r, network)
+		if port.Connected != nil {
+			for _, kind := range []ResourceKind{KindVm, KindRouter, KindLoadBalancer} {
+				g.link(g.Get(kind, port.Connected.ID), r)
+			}
+		}
+	}
+
+	disks, err := vdc.GetDisks()
+	if err != nil {
+		return errors.Wrapf(err, "Cannot list disks of vdc %s", vdc.Name)
+	}
+	for _, disk := range disks {
+		if disk.Vm != nil && (disk.IsRoot || owned[disk.Vm.ID] != nil) {
+			continue
+		}
+		r := g.add(KindDisk, disk.ID, disk.Name, disk.Locked, disk)
+		if disk.Vm != nil {
+			// Data disks are detached before their VM is deleted.
+			g.link(r, g.Get(KindVm, disk.Vm.ID))
+		}
+	}
+
+	for _, r := range g.Resources[start:] {
+		g.link(r, root)
+	}
+	return nil
+}
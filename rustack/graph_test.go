@@ -0,0 +1,50 @@
+package rustack
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDeleteOrder(t *testing.T) {
+	g := newDependencyGraph()
+	vdc := g.add(KindVdc, "vdc", "vdc", false, nil)
+	network := g.add(KindNetwork, "network", "network", false, nil)
+	port := g.add(KindPort, "port", "port", false, nil)
+	vm := g.add(KindVm, "vm", "vm", false, nil)
+	disk := g.add(KindDisk, "disk", "disk", false, nil)
+	lb := g.add(KindLoadBalancer, "lb", "lb", false, nil)
+	for _, r := range []*Resource{network, port, vm, disk, lb} {
+		g.link(r, vdc)
+	}
+	g.link(port, network)
+	g.link(vm, port)
+	g.link(disk, vm)
+	g.link(lb, vm)
+	// Links are recorded once.
+	g.link(lb, vm)
+
+	batches, err := g.DeleteOrder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][]string
+	for _, batch := range batches {
+		var ids []string
+		for _, r := range batch {
+			ids = append(ids, r.ID)
+		}
+		got = append(got, ids)
+	}
+	want := [][]string{{"disk", "lb"}, {"vm"}, {"port"}, {"network"}, {"vdc"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// A port referencing a VM that references it can never be deleted,
+	// neither can the resources both reference.
+	g.link(port, vm)
+	if _, err := g.DeleteOrder(); err == nil || !strings.Contains(err.Error(), "between 4 resources") {
+		t.Fatalf("got %v, want a cycle between 4 resources", err)
+	}
+}
@@ -0,0 +1,198 @@
+package rustack
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Iterator walks a paginated list endpoint, fetching pages lazily:
+//
+//	it := m.IterVms(ctx, Arguments{"vdc": vdcID})
+//	defer it.Close()
+//	for it.Next() {
+//		vm := it.Value()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// With Go 1.23 or newer All can be used with range instead.
+type Iterator[T any] struct {
+	manager  *Manager
+	cancel   context.CancelFunc
+	path     string
+	params   url.Values
+	prefetch bool
+	setup    func(T)
+
+	items   []T
+	pos     int
+	page    int
+	fetched int
+	last    bool
+	current T
+	err     error
+	pending chan iteratorPage[T]
+}
+
+type iteratorPage[T any] struct {
+	items []T
+	total int
+	err   error
+}
+
+type IterOption func(*iterOptions)
+
+type iterOptions struct {
+	prefetch bool
+	pageSize int
+}
+
+// WithPrefetch makes the iterator fetch the next page in the background while
+// the current one is consumed.
+func WithPrefetch() IterOption {
+	return func(o *iterOptions) {
+		o.prefetch = true
+	}
+}
+
+// WithPageSize sets the number of items requested per page.
+func WithPageSize(size int) IterOption {
+	return func(o *iterOptions) {
+		o.pageSize = size
+	}
+}
+
+// NewIterator returns an iterator over the list endpoint at path. Setup, if
+// not nil, is called for every item before it is returned, e.g. to bind it
+// to the manager.
+func NewIterator[T any](ctx context.Context, m *Manager, path string, args Arguments, setup func(T), opts ...IterOption) *Iterator[T] {
+	var options iterOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	params := args.ToURLValues()
+	if options.pageSize > 0 {
+		params.Set("limit", strconv.Itoa(options.pageSize))
+	}
+
+	return &Iterator[T]{
+		manager:  m.WithContext(ctx),
+		cancel:   cancel,
+		path:     path,
+		params:   params,
+		prefetch: options.prefetch,
+		setup:    setup,
+		page:     1,
+	}
+}
+
+// Next advances the iterator and reports whether an item is available.
+func (it *Iterator[T]) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	for it.pos >= len(it.items) {
+		if it.last || !it.load() {
+			return false
+		}
+	}
+	it.current = it.items[it.pos]
+	it.pos++
+	if it.setup != nil {
+		it.setup(it.current)
+	}
+	return true
+}
+
+func (it *Iterator[T]) Value() T {
+	return it.current
+}
+
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// Close stops the iterator and cancels a page fetch in progress.
+func (it *Iterator[T]) Close() {
+	it.cancel()
+	it.last = true
+	it.items = nil
+	it.pending = nil
+}
+
+// All returns a function compatible with iter.Seq2[T, error]. An error ends
+// the sequence and is yielded together with the zero value of T. The
+// iterator is closed when the sequence ends or the caller stops early.
+func (it *Iterator[T]) All() func(yield func(T, error) bool) {
+	return func(yield func(T, error) bool) {
+		defer it.Close()
+		for it.Next() {
+			if !yield(it.Value(), nil) {
+				return
+			}
+		}
+		if it.err != nil {
+			var zero T
+			yield(zero, it.err)
+		}
+	}
+}
+
+// Collect reads the remaining items into a slice.
+func (it *Iterator[T]) Collect() ([]T, error) {
+	defer it.Close()
+	var items []T
+	for it.Next() {
+		items = append(items, it.Value())
+	}
+	return items, it.err
+}
+
+func (it *Iterator[T]) load() bool {
+	var page iteratorPage[T]
+	if it.pending != nil {
+		page = <-it.pending
+		it.pending = nil
+	} else {
+		page = it.fetch(it.page)
+	}
+	if page.err != nil {
+		it.err = page.err
+		return false
+	}
+
+	it.page++
+	it.fetched += len(page.items)
+	it.items = page.items
+	it.pos = 0
+
+	if len(page.items) == 0 || it.fetched >= page.total {
+		it.last = true
+	} else if it.prefetch {
+		pending := make(chan iteratorPage[T], 1)
+		go func(page int) {
+			pending <- it.fetch(page)
+		}(it.page)
+		it.pending = pending
+	}
+	return len(page.items) > 0
+}
+
+func (it *Iterator[T]) fetch(page int) iteratorPage[T] {
+	temp, err := it.manager.getPage(it.path, it.params, page)
+	if err != nil {
+		return iteratorPage[T]{err: err}
+	}
+	var items []T
+	if err := json.Unmarshal(temp.Items, &items); err != nil {
+		return iteratorPage[T]{err: errors.Wrapf(err, "JSON items decode failed on %s, page %d:", it.path, page)}
+	}
+	return iteratorPage[T]{items: items, total: temp.Total}
+}
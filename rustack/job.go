@@ -0,0 +1,142 @@
+package rustack
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type JobStatus string
+
+const (
+	JobPending JobStatus = "pending"
+	JobRunning JobStatus = "in_progress"
+	JobDone    JobStatus = "done"
+	JobFailed  JobStatus = "error"
+)
+
+// Job is a background task started by a mutating API call. Its ID is
+// reported in the X-Esu-Tasks response header.
+type Job struct {
+	manager *Manager
+	ID      string    `json:"id"`
+	Status  JobStatus `json:"status"`
+	// Name is the step the job is currently executing, or the step it
+	// failed on.
+	Name string `json:"name"`
+	// Method and Path describe the request that started the job.
+	Method string `json:"-"`
+	Path   string `json:"-"`
+}
+
+// JobError is returned when a job finishes in the error state, or cannot be
+// found. Err is ErrNotFound in the latter case.
+type JobError struct {
+	JobID  string
+	Step   string
+	Status JobStatus
+	Err    error
+}
+
+func (e *JobError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("Job %s: %s", e.JobID, e.Err)
+	}
+	return fmt.Sprintf("Job %s in %s status, step: %s", e.JobID, e.Status, e.Step)
+}
+
+func (e *JobError) Unwrap() error {
+	return e.Err
+}
+
+// Deprecated: use Job.
+type Task = Job
+
+func (j *Job) IsFinished() bool {
+	return j.Status == JobDone || j.Status == JobFailed
+}
+
+func (m *Manager) GetJob(id string) (job *Job, err error) {
+	path, _ := url.JoinPath("v1/job", id)
+	err = m.Get(path, Defaults(), &job)
+	if err != nil {
+		return
+	}
+	job.manager = m
+	return
+}
+
+// WaitJob polls the job until it is finished or ctx is done. A job unknown to
+// the server fails with a JobError matching ErrNotFound, unless the manager
+// has MissingJobsDone set.
+func (m *Manager) WaitJob(ctx context.Context, id string) (*Job, error) {
+	m.log("[rustack] Start waiting job %s...", id)
+
+	cm := m.WithContext(ctx)
+	path, _ := url.JoinPath("v1/job", id)
+	job := &Job{manager: m, ID: id}
+
+	for {
+		err := cm.Get(path, Defaults(), job)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				if m.MissingJobsDone {
+					job.Status = JobDone
+					break
+				}
+				return job, &JobError{JobID: id, Status: job.Status, Err: ErrNotFound}
+			}
+			if ctx.Err() != nil {
+				return job, errors.Wrapf(ctx.Err(), "Waiting job %s", id)
+			}
+			return job, err
+		}
+
+		if job.Status == JobFailed {
+			return job, &JobError{JobID: job.ID, Step: job.Name, Status: job.Status}
+		}
+		if job.Status == JobDone {
+			break
+		}
+
+		if err := SleepWithContext(ctx, RetryTime*time.Millisecond); err != nil {
+			m.log("[rustack] Waiting job %s interrupted: %s", id, err)
+			return job, errors.Wrapf(err, "Waiting job %s", id)
+		}
+	}
+
+	m.log("[rustack] End waiting job %s", id)
+
+	return job, nil
+}
+
+func (j *Job) Wait(ctx context.Context) error {
+	job, err := j.manager.WaitJob(ctx, j.ID)
+	j.Status = job.Status
+	j.Name = job.Name
+	return err
+}
+
+func (m *Manager) newJobs(method string, path string, taskIds string) []*Job {
+	var jobs []*Job
+	for _, id := range parseJobIds(taskIds) {
+		m.log("[rustack] Job %s started by %s %s", id, method, path)
+		jobs = append(jobs, &Job{manager: m, ID: id, Status: JobPending, Method: method, Path: path})
+	}
+	return jobs
+}
+
+func parseJobIds(taskIds string) []string {
+	var ids []string
+	for _, taskId := range strings.Split(taskIds, ",") {
+		taskId = strings.TrimSpace(taskId)
+		if taskId != "" {
+			ids = append(ids, taskId)
+		}
+	}
+	return ids
+}
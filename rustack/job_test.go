@@ -0,0 +1,56 @@
+package rustack_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+func TestWaitJob(t *testing.T) {
+	job := func(status string, name string) response {
+		return response{status: http.StatusOK, body: map[string]interface{}{"id": "job", "status": status, "name": name}}
+	}
+	missing := response{status: http.StatusNotFound, body: map[string]interface{}{"detail": "Not found."}}
+	tests := []struct {
+		name      string
+		responses []response
+		missing   bool
+		done      bool
+		wantStep  string
+		wantPolls int
+	}{
+		{name: "done", responses: []response{job("in_progress", "create_disk"), job("done", "")}, done: true, wantPolls: 2},
+		{name: "failed", responses: []response{job("error", "create_disk")}, wantStep: "create_disk", wantPolls: 1},
+		{name: "missing", responses: []response{missing}, missing: true, wantPolls: 1},
+		{name: "missing opt in", responses: []response{missing}, missing: true, done: true, wantPolls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, requests := scriptedServer(t, tt.responses...)
+			m.MissingJobsDone = tt.done && tt.missing
+
+			job, err := m.WaitJob(context.Background(), "job")
+			var jobErr *rustack.JobError
+			switch {
+			case tt.done:
+				if err != nil || job.Status != rustack.JobDone {
+					t.Fatalf("got %v, %v", job.Status, err)
+				}
+			case tt.missing:
+				if !errors.Is(err, rustack.ErrNotFound) || !errors.As(err, &jobErr) {
+					t.Fatalf("got %v, want a job error for the missing job", err)
+				}
+			default:
+				if !errors.As(err, &jobErr) || jobErr.Step != tt.wantStep || jobErr.Status != rustack.JobFailed {
+					t.Fatalf("got %v", err)
+				}
+			}
+			if got := requests(); got != tt.wantPolls {
+				t.Fatalf("polled %d times, want %d", got, tt.wantPolls)
+			}
+		})
+	}
+}
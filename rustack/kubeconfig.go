@@ -0,0 +1,180 @@
+package rustack
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/pkg/errors"
+)
+
+// Kubeconfig is the parsed form of a kubectl config file. Fields not modelled
+// here are kept in Extra, so that a config survives parsing and marshalling.
+type Kubeconfig struct {
+	ApiVersion     string                 `yaml:"apiVersion"`
+	Kind           string                 `yaml:"kind"`
+	Clusters       []KubeconfigCluster    `yaml:"clusters"`
+	Users          []KubeconfigUser       `yaml:"users"`
+	Contexts       []KubeconfigContext    `yaml:"contexts"`
+	CurrentContext string                 `yaml:"current-context"`
+	Extra          map[string]interface{} `yaml:",inline"`
+}
+
+type KubeconfigCluster struct {
+	Name    string `yaml:"name"`
+	Cluster struct {
+		Server                   string                 `yaml:"server"`
+		CertificateAuthorityData string                 `yaml:"certificate-authority-data,omitempty"`
+		InsecureSkipTLSVerify    bool                   `yaml:"insecure-skip-tls-verify,omitempty"`
+		Extra                    map[string]interface{} `yaml:",inline"`
+	} `yaml:"cluster"`
+}
+
+type KubeconfigUser struct {
+	Name string `yaml:"name"`
+	User struct {
+		Token                 string                 `yaml:"token,omitempty"`
+		ClientCertificateData string                 `yaml:"client-certificate-data,omitempty"`
+		ClientKeyData         string                 `yaml:"client-key-data,omitempty"`
+		Extra                 map[string]interface{} `yaml:",inline"`
+	} `yaml:"user"`
+}
+
+type KubeconfigContext struct {
+	Name    string `yaml:"name"`
+	Context struct {
+		Cluster   string                 `yaml:"cluster"`
+		User      string                 `yaml:"user"`
+		Namespace string                 `yaml:"namespace,omitempty"`
+		Extra     map[string]interface{} `yaml:",inline"`
+	} `yaml:"context"`
+}
+
+// GetKubeconfig downloads the kubectl config of the cluster.
+func (k *Kubernetes) GetKubeconfig(ctx context.Context) (config []byte, err error) {
+	path := fmt.Sprintf("/v1/kubernetes/%s/config", k.ID)
+	err = k.manager.WithContext(ctx).Get(path, Defaults(), &config)
+	return
+}
+
+// GetParsedKubeconfig downloads and parses the kubectl config of the cluster.
+func (k *Kubernetes) GetParsedKubeconfig(ctx context.Context) (*Kubeconfig, error) {
+	b, err := k.GetKubeconfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKubeconfig(b)
+}
+
+func ParseKubeconfig(data []byte) (*Kubeconfig, error) {
+	var config Kubeconfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, errors.Wrap(err, "Kubeconfig decode failed")
+	}
+	return &config, nil
+}
+
+// DefaultKubeconfigPath returns the first file listed in $KUBECONFIG or
+// ~/.kube/config.
+func DefaultKubeconfigPath() (string, error) {
+	if paths := filepath.SplitList(os.Getenv("KUBECONFIG")); len(paths) > 0 && paths[0] != "" {
+		return paths[0], nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrap(err, "Cannot find home directory")
+	}
+	return filepath.Join(home, ".kube", "config"), nil
+}
+
+func (c *Kubeconfig) Marshal() ([]byte, error) {
+	if c.ApiVersion == "" {
+		c.ApiVersion = "v1"
+	}
+	if c.Kind == "" {
+		c.Kind = "Config"
+	}
+	return yaml.Marshal(c)
+}
+
+// Merge adds the clusters, users and contexts of other to the config,
+// replacing entries with the same name. The current context is switched to
+// the one of other if setCurrent is true.
+func (c *Kubeconfig) Merge(other *Kubeconfig, setCurrent bool) {
+	c.Clusters = mergeNamed(c.Clusters, other.Clusters, func(cluster KubeconfigCluster) string { return cluster.Name })
+	c.Users = mergeNamed(c.Users, other.Users, func(user KubeconfigUser) string { return user.Name })
+	c.Contexts = mergeNamed(c.Contexts, other.Contexts, func(context KubeconfigContext) string { return context.Name })
+	if setCurrent || c.CurrentContext == "" {
+		c.CurrentContext = other.CurrentContext
+	}
+}
+
+func mergeNamed[T any](items []T, add []T, name func(T) string) []T {
+	for _, item := range add {
+		i := 0
+		for i < len(items) && name(items[i]) != name(item) {
+			i++
+		}
+		if i == len(items) {
+			items = append(items, item)
+		} else {
+			items[i] = item
+		}
+	}
+	return items
+}
+
+// WriteFile writes the config to path with 0600 permissions, creating the
+// parent directory if needed.
+func (c *Kubeconfig) WriteFile(path string) error {
+	b, err := c.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "Kubeconfig encode failed")
+	}
+	return WriteKubeconfig(path, b)
+}
+
+// WriteKubeconfig writes a downloaded config to path with 0600 permissions,
+// creating the parent directory if needed.
+func WriteKubeconfig(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.Wrapf(err, "Cannot create directory for %s", path)
+	}
+	// WriteFile keeps the mode of an existing file.
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return errors.Wrapf(err, "Cannot write %s", path)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		return errors.Wrapf(err, "Cannot change mode of %s", path)
+	}
+	return nil
+}
+
+// MergeKubeconfig merges config into the kubectl config at path, see
+// Kubeconfig.Merge. An empty path means DefaultKubeconfigPath.
+func MergeKubeconfig(path string, config *Kubeconfig, setCurrent bool) error {
+	if path == "" {
+		var err error
+		if path, err = DefaultKubeconfigPath(); err != nil {
+			return err
+		}
+	}
+
+	existing := &Kubeconfig{}
+	b, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return errors.Wrapf(err, "Cannot read %s", path)
+	default:
+		if existing, err = ParseKubeconfig(b); err != nil {
+			return errors.Wrapf(err, "Cannot merge into %s", path)
+		}
+	}
+
+	existing.Merge(config, setCurrent)
+	return existing.WriteFile(path)
+}
@@ -0,0 +1,235 @@
+package rustack_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+	"github.com/rustack-cloud-platform/rcp-go/rustacktest"
+)
+
+func testKubeconfig(t *testing.T, name string) *rustack.Kubeconfig {
+	t.Helper()
+	config, err := rustack.ParseKubeconfig([]byte(fmt.Sprintf(`clusters:
+- name: %[1]s
+  cluster:
+    server: https://%[1]s:6443
+users:
+- name: %[1]s
+  user:
+    token: %[1]s-token
+contexts:
+- name: %[1]s
+  context:
+    cluster: %[1]s
+    user: %[1]s
+current-context: %[1]s
+`, name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func contextNames(config *rustack.Kubeconfig) (names []string) {
+	for _, context := range config.Contexts {
+		names = append(names, context.Name)
+	}
+	return
+}
+
+func TestParseKubeconfig(t *testing.T) {
+	data := []byte(`apiVersion: v1
+kind: Config
+preferences:
+  colors: true
+clusters:
+- name: k8s
+  cluster:
+    server: https://10.0.0.1:6443
+    proxy-url: http://proxy:3128
+users:
+- name: admin
+  user:
+    exec:
+      command: rustack-auth
+contexts:
+- name: k8s
+  context:
+    cluster: k8s
+    user: admin
+    namespace: apps
+current-context: k8s
+`)
+	config, err := rustack.ParseKubeconfig(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Clusters) != 1 || config.Clusters[0].Cluster.Server != "https://10.0.0.1:6443" {
+		t.Fatalf("clusters %+v", config.Clusters)
+	}
+	if config.Contexts[0].Context.Namespace != "apps" || config.CurrentContext != "k8s" {
+		t.Fatalf("contexts %+v, current %q", config.Contexts, config.CurrentContext)
+	}
+
+	// Fields that are not modelled survive a round trip.
+	b, err := config.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := rustack.ParseKubeconfig(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, config) {
+		t.Fatalf("round trip changed the config:\n%s", b)
+	}
+	if again.Extra["preferences"] == nil || again.Clusters[0].Cluster.Extra["proxy-url"] != "http://proxy:3128" ||
+		again.Users[0].User.Extra["exec"] == nil {
+		t.Fatalf("extra fields lost:\n%s", b)
+	}
+
+	if _, err := rustack.ParseKubeconfig([]byte("clusters: {")); err == nil {
+		t.Fatal("invalid config parsed")
+	}
+}
+
+func TestMergeKubeconfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		current    string
+		setCurrent bool
+		want       string
+	}{
+		{name: "keep current", current: "a", want: "a"},
+		{name: "set current", current: "a", setCurrent: true, want: "b"},
+		{name: "empty current", want: "b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testKubeconfig(t, "a")
+			config.Merge(testKubeconfig(t, "c"), false)
+			config.CurrentContext = tt.current
+
+			// b is new, c replaces the existing entries of the same name.
+			other := testKubeconfig(t, "b")
+			other.Merge(testKubeconfig(t, "c"), false)
+			other.Clusters[1].Cluster.Server = "https://c.new:6443"
+			other.Users[1].User.Token = "new-token"
+
+			config.Merge(other, tt.setCurrent)
+			if got := contextNames(config); !reflect.DeepEqual(got, []string{"a", "c", "b"}) {
+				t.Fatalf("contexts %v", got)
+			}
+			if len(config.Clusters) != 3 || config.Clusters[1].Cluster.Server != "https://c.new:6443" {
+				t.Fatalf("clusters %+v", config.Clusters)
+			}
+			if len(config.Users) != 3 || config.Users[1].User.Token != "new-token" {
+				t.Fatalf("users %+v", config.Users)
+			}
+			if config.CurrentContext != tt.want {
+				t.Fatalf("current context %q, want %q", config.CurrentContext, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteKubeconfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kube", "config")
+	if err := rustack.WriteKubeconfig(path, []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("new file: %v, %v", info.Mode(), err)
+	}
+	if info, err := os.Stat(filepath.Dir(path)); err != nil || info.Mode().Perm() != 0700 {
+		t.Fatalf("new directory: %v, %v", info.Mode(), err)
+	}
+
+	// An existing readable file is tightened.
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := rustack.WriteKubeconfig(path, []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("existing file: %v, %v", info.Mode(), err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "second" {
+		t.Fatalf("content %q", b)
+	}
+}
+
+func TestMergeKubeconfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	t.Setenv("KUBECONFIG", path+string(os.PathListSeparator)+filepath.Join(t.TempDir(), "other"))
+
+	// An empty path is the first file of $KUBECONFIG, created on the first
+	// merge.
+	if err := rustack.MergeKubeconfig("", testKubeconfig(t, "a"), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := rustack.MergeKubeconfig(path, testKubeconfig(t, "b"), false); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := rustack.ParseKubeconfig(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := contextNames(config); !reflect.DeepEqual(got, []string{"a", "b"}) || config.CurrentContext != "a" {
+		t.Fatalf("contexts %v, current %q", got, config.CurrentContext)
+	}
+	if config.ApiVersion != "v1" || config.Kind != "Config" {
+		t.Fatalf("apiVersion %q, kind %q", config.ApiVersion, config.Kind)
+	}
+
+	os.WriteFile(path, []byte("clusters: {"), 0600)
+	if err := rustack.MergeKubeconfig(path, testKubeconfig(t, "c"), false); err == nil {
+		t.Fatal("merged into an invalid config")
+	}
+}
+
+func TestGetKubernetesConfigUrl(t *testing.T) {
+	s := rustacktest.NewServer()
+	defer s.Close()
+	vdc := s.Seed("vdc", map[string]interface{}{"name": "vdc"})
+	seeded := s.Seed("kubernetes", map[string]interface{}{"name": "k8s", "vdc": vdc})
+	k8s, err := s.Manager().GetKubernetes(seeded["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// The deprecated call saves the config in the working directory.
+	if err := k8s.GetKubernetesConfigUrl(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("kubectl-%s.yaml", k8s.ID))
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("config file: %v, %v", info, err)
+	}
+	b, _ := os.ReadFile(path)
+	config, err := rustack.ParseKubeconfig(b)
+	if err != nil || config.CurrentContext != "k8s" {
+		t.Fatalf("saved config %q, %v", b, err)
+	}
+}
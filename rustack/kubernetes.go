@@ -1,6 +1,7 @@
 package rustack
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 )
@@ -12,6 +13,7 @@ type NodePlatform struct {
 }
 
 type Kubernetes struct {
+	jobList
 	manager *Manager
 	ID      string `json:"id"`
 	Name    string `json:"name"`
@@ -76,6 +78,15 @@ func (m *Manager) ListKubernetes(extraArgs ...Arguments) (ks []*Kubernetes, err
 	return
 }
 
+func (m *Manager) IterKubernetes(ctx context.Context, args Arguments, opts ...IterOption) *Iterator[*Kubernetes] {
+	return NewIterator(ctx, m, "v1/kubernetes", args, func(k8s *Kubernetes) {
+		k8s.manager = m
+		for x := range k8s.Vms {
+			k8s.Vms[x].manager = m
+		}
+	}, opts...)
+}
+
 func (v *Vdc) GetKubernetes(extraArgs ...Arguments) (ks []*Kubernetes, err error) {
 	args := Arguments{
 		"vdc": v.ID,
@@ -91,11 +102,14 @@ func (k *Kubernetes) GetKubernetesDashBoardUrl() (dashboard_url *KubernetesDashB
 	return
 }
 
+// Deprecated: GetKubernetesConfigUrl saves the config as kubectl-<id>.yaml in
+// the working directory, use GetKubeconfig instead.
 func (k *Kubernetes) GetKubernetesConfigUrl() (err error) {
-	var config *string
-	path := fmt.Sprintf("/v1/kubernetes/%s/config", k.ID)
-	err = k.manager.Get(path, Defaults(), &config)
-	return
+	config, err := k.GetKubeconfig(k.manager.ctx)
+	if err != nil {
+		return
+	}
+	return WriteKubeconfig(fmt.Sprintf("kubectl-%s.yaml", k.ID), config)
 }
 
 func (k *Kubernetes) Update() error {
@@ -138,10 +152,31 @@ func (k *Kubernetes) Update() error {
 
 func (k *Kubernetes) Delete() error {
 	path, _ := url.JoinPath("v1/kubernetes", k.ID)
-	return k.manager.Delete(path, Defaults(), nil)
+	return k.manager.deleteResource(path, k)
 }
 
 func (k Kubernetes) WaitLock() (err error) {
 	path, _ := url.JoinPath("v1/kubernetes", k.ID)
 	return loopWaitLock(k.manager, path)
 }
+
+func (k *Kubernetes) TagNames() []string {
+	return convertTagsToNames(k.Tags)
+}
+
+func (k *Kubernetes) tagPath() string {
+	path, _ := url.JoinPath("v1/kubernetes", k.ID)
+	return path
+}
+
+func (k *Kubernetes) SetTags(tags ...string) error {
+	return k.manager.setTags(k, tags)
+}
+
+func (k *Kubernetes) AddTags(tags ...string) error {
+	return k.manager.addTags(k, tags)
+}
+
+func (k *Kubernetes) RemoveTags(tags ...string) error {
+	return k.manager.removeTags(k, tags)
+}
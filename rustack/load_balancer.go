@@ -1,11 +1,41 @@
 package rustack
 
 import (
+	"context"
 	"fmt"
 	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	PoolProtocolTCP  = "tcp"
+	PoolProtocolHTTP = "http"
+	// PoolProtocolHTTPS pools terminate TLS with their Certificate.
+	PoolProtocolHTTPS = "https"
+)
+
+const (
+	HealthMonitorHTTP = "HTTP"
+	HealthMonitorTCP  = "TCP"
+	HealthMonitorPing = "PING"
+)
+
+// Operating statuses of a PoolMember.
+const (
+	MemberOnline   = "ONLINE"
+	MemberOffline  = "OFFLINE"
+	MemberDraining = "DRAINING"
+	MemberError    = "ERROR"
+	// MemberNoMonitor members are not checked, their pool has no
+	// HealthMonitor.
+	MemberNoMonitor = "NO_MONITOR"
 )
 
 type LoadBalancer struct {
+	jobList
 	manager *Manager
 	ID      string `json:"id"`
 	Name    string `json:"name"`
@@ -20,16 +50,22 @@ type LoadBalancer struct {
 }
 
 type LoadBalancerPool struct {
-	manager *Manager
-	ID      string `json:"id"`
-	Locked  bool   `json:"locked"`
-
-	Port               int           `json:"port"`
-	Connlimit          int           `json:"connlimit"`
-	Members            []*PoolMember `json:"members"`
-	Method             string        `json:"method"`
-	Protocol           string        `json:"protocol"`
-	SessionPersistence *string       `json:"session_persistence"`
+	jobList
+	manager        *Manager
+	loadBalancerID string
+	ID             string `json:"id"`
+	Locked         bool   `json:"locked"`
+
+	Port               int            `json:"port"`
+	Connlimit          int            `json:"connlimit"`
+	Members            []*PoolMember  `json:"members"`
+	Method             string         `json:"method"`
+	Protocol           string         `json:"protocol"`
+	SessionPersistence *string        `json:"session_persistence"`
+	HealthMonitor      *HealthMonitor `json:"health_monitor"`
+	// Certificate is required by PoolProtocolHTTPS pools, and only allowed
+	// on them.
+	Certificate *Certificate `json:"certificate"`
 }
 
 type PoolMember struct {
@@ -37,6 +73,27 @@ type PoolMember struct {
 	Port   int    `json:"port"`
 	Weight int    `json:"weight"`
 	Vm     *Vm    `json:"vm"`
+	// OperatingStatus is reported by the health monitor of the pool, e.g.
+	// MemberOnline. It is ignored on create and update.
+	OperatingStatus string `json:"operating_status,omitempty"`
+}
+
+// HealthMonitor checks the members of a pool. Traffic is only sent to the
+// members passing the checks.
+type HealthMonitor struct {
+	// Type is HealthMonitorHTTP, HealthMonitorTCP or HealthMonitorPing.
+	Type string `json:"type"`
+	// Interval is the delay between checks and Timeout the time a check may
+	// take, both in seconds.
+	Interval int `json:"interval"`
+	Timeout  int `json:"timeout"`
+	// MaxRetries is the number of checks in a row a member has to pass or
+	// fail to change its status.
+	MaxRetries int `json:"max_retries"`
+	// HttpPath and ExpectedCodes are for HTTP monitors only, e.g. "/health"
+	// and "200,202" or "200-204". They default to "/" and "200".
+	HttpPath      string `json:"http_path,omitempty"`
+	ExpectedCodes string `json:"expected_codes,omitempty"`
 }
 
 func NewLoadBalancer(name string, vdc *Vdc, port *Port, floating *Port) LoadBalancer {
@@ -114,6 +171,17 @@ func (m *Manager) GetLoadBalancers(extraArgs ...Arguments) (lbaasList []*LoadBal
 	return
 }
 
+func (m *Manager) IterLoadBalancers(ctx context.Context, args Arguments, opts ...IterOption) *Iterator[*LoadBalancer] {
+	return NewIterator(ctx, m, "v1/lbaas", args, func(lb *LoadBalancer) {
+		lb.manager = m
+		lb.Port.manager = m
+		lb.Vdc.manager = m
+		if lb.Floating != nil {
+			lb.Floating.manager = m
+		}
+	}, opts...)
+}
+
 func (v *Vdc) GetLoadBalancers(extraArgs ...Arguments) (lbaasList []*LoadBalancer, err error) {
 	args := Arguments{
 		"vdc": v.ID,
@@ -158,20 +226,22 @@ func (lb *LoadBalancer) Update() (err error) {
 			args.Floating = lb.Floating.IpAddress
 		}
 	}
-	err = lb.manager.Request("PUT", path, args, lb)
+	// The lock is waited for below, which needs the job to be done.
+	err = lb.manager.waiting().Request("PUT", path, args, lb)
 	lb.WaitLock()
 	return
 }
 
 func (lb *LoadBalancer) Delete() (err error) {
 	path, _ := url.JoinPath("v1/lbaas", lb.ID)
-	return lb.manager.Delete(path, Defaults(), nil)
+	return lb.manager.deleteResource(path, lb)
 
 }
 
 func NewLoadBalancerPool(lb LoadBalancer, port int, connlimit int, members []*PoolMember, method string, protocol string, session_persistence string) LoadBalancerPool {
 	lb_pool := LoadBalancerPool{
 		manager:            lb.manager,
+		loadBalancerID:     lb.ID,
 		Port:               port,
 		Connlimit:          connlimit,
 		Members:            members,
@@ -192,12 +262,87 @@ func NewLoadBalancerPoolMember(port int, weight int, vm *Vm) PoolMember {
 	return member
 }
 
+func NewHealthMonitor(monitorType string, interval int, timeout int, maxRetries int) HealthMonitor {
+	return HealthMonitor{
+		Type:       monitorType,
+		Interval:   interval,
+		Timeout:    timeout,
+		MaxRetries: maxRetries,
+	}
+}
+
+func (h *HealthMonitor) validate() error {
+	switch h.Type {
+	case HealthMonitorHTTP:
+		if h.HttpPath != "" && !strings.HasPrefix(h.HttpPath, "/") {
+			return errors.Wrapf(ErrValidation, "Health monitor path %q must start with /", h.HttpPath)
+		}
+		if h.ExpectedCodes != "" && !validExpectedCodes(h.ExpectedCodes) {
+			return errors.Wrapf(ErrValidation, "Invalid expected codes %q", h.ExpectedCodes)
+		}
+	case HealthMonitorTCP, HealthMonitorPing:
+		if h.HttpPath != "" || h.ExpectedCodes != "" {
+			return errors.Wrapf(ErrValidation, "Path and expected codes are for %s health monitors only", HealthMonitorHTTP)
+		}
+	default:
+		return errors.Wrapf(ErrValidation, "Unknown health monitor type %q", h.Type)
+	}
+	if h.Interval <= 0 || h.Timeout <= 0 || h.MaxRetries <= 0 {
+		return errors.Wrap(ErrValidation, "Health monitor interval, timeout and max retries must be positive")
+	}
+	if h.Timeout > h.Interval {
+		return errors.Wrapf(ErrValidation, "Health monitor timeout %d exceeds interval %d", h.Timeout, h.Interval)
+	}
+	return nil
+}
+
+// validExpectedCodes accepts a code, a list of codes or a range of codes.
+func validExpectedCodes(codes string) bool {
+	parts := strings.Split(codes, ",")
+	from, to, isRange := strings.Cut(codes, "-")
+	if isRange {
+		parts = []string{from, to}
+	}
+	previous := 0
+	for _, part := range parts {
+		code, err := strconv.Atoi(part)
+		if err != nil || code < 100 || code > 599 || (isRange && code < previous) {
+			return false
+		}
+		previous = code
+	}
+	return true
+}
+
+func (pool *LoadBalancerPool) validate() error {
+	if pool.Protocol == PoolProtocolHTTPS && pool.Certificate == nil {
+		return errors.Wrap(ErrValidation, "HTTPS pools require a certificate")
+	}
+	if pool.Protocol != PoolProtocolHTTPS && pool.Certificate != nil {
+		return errors.Wrapf(ErrValidation, "Certificates are for HTTPS pools only, got protocol %q", pool.Protocol)
+	}
+	if pool.HealthMonitor != nil {
+		return pool.HealthMonitor.validate()
+	}
+	return nil
+}
+
+func (pool *LoadBalancerPool) certificateID() *string {
+	if pool.Certificate == nil {
+		return nil
+	}
+	return &pool.Certificate.ID
+}
+
 func (lb *LoadBalancer) CreatePool(pool *LoadBalancerPool) (err error) {
 	type poolMember struct {
 		Port   int    `json:"port"`
 		Weight int    `json:"weight"`
 		Vm     string `json:"vm"`
 	}
+	if err := pool.validate(); err != nil {
+		return err
+	}
 	var members []*poolMember
 	for _, member := range pool.Members {
 		members = append(members, &poolMember{
@@ -208,12 +353,14 @@ func (lb *LoadBalancer) CreatePool(pool *LoadBalancerPool) (err error) {
 	}
 
 	args := &struct {
-		Port               int           `json:"port"`
-		Connlimit          int           `json:"connlimit"`
-		Members            []*poolMember `json:"members"`
-		Method             string        `json:"method"`
-		Protocol           string        `json:"protocol"`
-		SessionPersistence *string       `json:"session_persistence"`
+		Port               int            `json:"port"`
+		Connlimit          int            `json:"connlimit"`
+		Members            []*poolMember  `json:"members"`
+		Method             string         `json:"method"`
+		Protocol           string         `json:"protocol"`
+		SessionPersistence *string        `json:"session_persistence"`
+		HealthMonitor      *HealthMonitor `json:"health_monitor"`
+		Certificate        *string        `json:"certificate"`
 	}{
 		Port:               pool.Port,
 		Connlimit:          pool.Connlimit,
@@ -221,6 +368,8 @@ func (lb *LoadBalancer) CreatePool(pool *LoadBalancerPool) (err error) {
 		Method:             pool.Method,
 		Protocol:           pool.Protocol,
 		SessionPersistence: nil,
+		HealthMonitor:      pool.HealthMonitor,
+		Certificate:        pool.certificateID(),
 	}
 
 	if pool.SessionPersistence != nil && *pool.SessionPersistence != "" {
@@ -229,6 +378,8 @@ func (lb *LoadBalancer) CreatePool(pool *LoadBalancerPool) (err error) {
 
 	path := fmt.Sprintf("v1/lbaas/%s/pool", lb.ID)
 	err = lb.manager.Request("POST", path, args, &pool)
+	pool.manager = lb.manager
+	pool.loadBalancerID = lb.ID
 	return
 }
 
@@ -239,14 +390,19 @@ func (lb *LoadBalancer) UpdatePool(pool *LoadBalancerPool) (err error) {
 		Vm     string `json:"vm"`
 	}
 	type createPool struct {
-		Port               int           `json:"port"`
-		Connlimit          int           `json:"connlimit"`
-		Members            []*poolMember `json:"members"`
-		Method             string        `json:"method"`
-		Protocol           string        `json:"protocol"`
-		SessionPersistence *string       `json:"session_persistence"`
+		Port               int            `json:"port"`
+		Connlimit          int            `json:"connlimit"`
+		Members            []*poolMember  `json:"members"`
+		Method             string         `json:"method"`
+		Protocol           string         `json:"protocol"`
+		SessionPersistence *string        `json:"session_persistence"`
+		HealthMonitor      *HealthMonitor `json:"health_monitor"`
+		Certificate        *string        `json:"certificate"`
 	}
 
+	if err := pool.validate(); err != nil {
+		return err
+	}
 	var members []*poolMember
 	for _, member := range pool.Members {
 		members = append(members, &poolMember{
@@ -263,9 +419,13 @@ func (lb *LoadBalancer) UpdatePool(pool *LoadBalancerPool) (err error) {
 		Method:             pool.Method,
 		Protocol:           pool.Protocol,
 		SessionPersistence: pool.SessionPersistence,
+		HealthMonitor:      pool.HealthMonitor,
+		Certificate:        pool.certificateID(),
 	}
 	path := fmt.Sprintf("v1/lbaas/%s/pool/%s", lb.ID, pool.ID)
 	err = lb.manager.Request("PUT", path, lbCreatePool, &pool)
+	pool.manager = lb.manager
+	pool.loadBalancerID = lb.ID
 	return
 }
 
@@ -276,12 +436,28 @@ func (lb *LoadBalancer) GetLoadBalancerPool(id string) (lbaas_pool LoadBalancerP
 		return
 	}
 	lbaas_pool.manager = lb.manager
+	lbaas_pool.loadBalancerID = lb.ID
 	return
 }
 
+func (pool LoadBalancerPool) WaitLock() (err error) {
+	path := fmt.Sprintf("v1/lbaas/%s/pool/%s", pool.loadBalancerID, pool.ID)
+	return loopWaitLock(pool.manager, path)
+}
+
+func (pool *LoadBalancerPool) Reload() error {
+	path := fmt.Sprintf("v1/lbaas/%s/pool/%s", pool.loadBalancerID, pool.ID)
+	pool.Members = nil
+	return pool.manager.Get(path, Defaults(), &pool)
+}
+
 func (lb *LoadBalancer) GetPools() (pools []*LoadBalancerPool, err error) {
 	path := fmt.Sprintf("v1/lbaas/%s/pool", lb.ID)
 	err = lb.manager.GetSubItems(path, Arguments{}, &pools)
+	for i := range pools {
+		pools[i].manager = lb.manager
+		pools[i].loadBalancerID = lb.ID
+	}
 	return pools, err
 }
 
@@ -310,3 +486,24 @@ func (lb LoadBalancer) WaitLock() (err error) {
 	path, _ := url.JoinPath("v1/lbaas", lb.ID)
 	return loopWaitLock(lb.manager, path)
 }
+
+func (lb *LoadBalancer) TagNames() []string {
+	return convertTagsToNames(lb.Tags)
+}
+
+func (lb *LoadBalancer) tagPath() string {
+	path, _ := url.JoinPath("v1/lbaas", lb.ID)
+	return path
+}
+
+func (lb *LoadBalancer) SetTags(tags ...string) error {
+	return lb.manager.setTags(lb, tags)
+}
+
+func (lb *LoadBalancer) AddTags(tags ...string) error {
+	return lb.manager.addTags(lb, tags)
+}
+
+func (lb *LoadBalancer) RemoveTags(tags ...string) error {
+	return lb.manager.removeTags(lb, tags)
+}
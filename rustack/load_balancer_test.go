@@ -0,0 +1,92 @@
+package rustack
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestValidExpectedCodes(t *testing.T) {
+	tests := []struct {
+		codes string
+		valid bool
+	}{
+		{"200", true},
+		{"200,202,301", true},
+		{"200-204", true},
+		{"200-200", true},
+		{"200-204,301", false},
+		{"204-200", false},
+		{"200-", false},
+		{"200,", false},
+		{"99", false},
+		{"600", false},
+		{"2xx", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := validExpectedCodes(tt.codes); got != tt.valid {
+			t.Errorf("validExpectedCodes(%q) = %v, want %v", tt.codes, got, tt.valid)
+		}
+	}
+}
+
+func TestHealthMonitorValidate(t *testing.T) {
+	http := func(path string, codes string) HealthMonitor {
+		h := NewHealthMonitor(HealthMonitorHTTP, 10, 5, 3)
+		h.HttpPath, h.ExpectedCodes = path, codes
+		return h
+	}
+	tests := []struct {
+		name    string
+		monitor HealthMonitor
+		valid   bool
+	}{
+		{"http", http("/health", "200-204"), true},
+		{"http defaults", http("", ""), true},
+		{"tcp", NewHealthMonitor(HealthMonitorTCP, 10, 5, 3), true},
+		{"ping", NewHealthMonitor(HealthMonitorPing, 5, 5, 1), true},
+		{"relative path", http("health", "200"), false},
+		{"mixed codes", http("/", "200-204,301"), false},
+		{"reversed range", http("/", "204-200"), false},
+		{"tcp with path", HealthMonitor{Type: HealthMonitorTCP, Interval: 10, Timeout: 5, MaxRetries: 3, HttpPath: "/"}, false},
+		{"ping with codes", HealthMonitor{Type: HealthMonitorPing, Interval: 10, Timeout: 5, MaxRetries: 3, ExpectedCodes: "200"}, false},
+		{"lowercase type", NewHealthMonitor("http", 10, 5, 3), false},
+		{"timeout exceeds interval", NewHealthMonitor(HealthMonitorTCP, 5, 10, 3), false},
+		{"no retries", NewHealthMonitor(HealthMonitorTCP, 10, 5, 0), false},
+		{"no interval", NewHealthMonitor(HealthMonitorTCP, 0, 0, 3), false},
+	}
+	for _, tt := range tests {
+		err := tt.monitor.validate()
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: got %v", tt.name, err)
+		}
+		if err != nil && !errors.Is(err, ErrValidation) {
+			t.Errorf("%s: %v is not a validation error", tt.name, err)
+		}
+	}
+}
+
+func TestLoadBalancerPoolValidate(t *testing.T) {
+	certificate := &Certificate{ID: "cert"}
+	tcp := NewHealthMonitor(HealthMonitorTCP, 10, 5, 3)
+	invalid := NewHealthMonitor(HealthMonitorTCP, 5, 10, 3)
+	tests := []struct {
+		name  string
+		pool  LoadBalancerPool
+		valid bool
+	}{
+		{"tcp", LoadBalancerPool{Protocol: PoolProtocolTCP}, true},
+		{"http", LoadBalancerPool{Protocol: PoolProtocolHTTP, HealthMonitor: &tcp}, true},
+		{"https", LoadBalancerPool{Protocol: PoolProtocolHTTPS, Certificate: certificate}, true},
+		{"https without certificate", LoadBalancerPool{Protocol: PoolProtocolHTTPS}, false},
+		{"http with certificate", LoadBalancerPool{Protocol: PoolProtocolHTTP, Certificate: certificate}, false},
+		{"invalid health monitor", LoadBalancerPool{Protocol: PoolProtocolTCP, HealthMonitor: &invalid}, false},
+	}
+	for _, tt := range tests {
+		err := tt.pool.validate()
+		if (err == nil) != tt.valid || (err != nil && !errors.Is(err, ErrValidation)) {
+			t.Errorf("%s: got %v", tt.name, err)
+		}
+	}
+}
@@ -8,15 +8,9 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
 	"reflect"
-	"regexp"
-	"strings"
 	"time"
 
-	"gopkg.in/yaml.v2"
-
 	"github.com/pkg/errors"
 )
 
@@ -24,16 +18,28 @@ const DefaultBaseURL = "https://cp.iteco.cloud"
 const RetryTime = 500    // ms
 const LockTimeout = 1200 // seconds
 const TaskTimeout = 600  // seconds
-const KubeCtlConfigURL = `/v1/kubernetes/([^/]+)/config`
 
 type Manager struct {
-	Client    *http.Client
-	ClientID  string
-	Logger    logger
-	BaseURL   string
-	Token     string
-	UserAgent string
-	ctx       context.Context
+	Client      *http.Client
+	ClientID    string
+	Logger      logger
+	BaseURL     string
+	Token       string
+	UserAgent   string
+	RetryPolicy *RetryPolicy
+	// JobTimeout and LockTimeout override TaskTimeout and LockTimeout when
+	// not zero.
+	JobTimeout  time.Duration
+	LockTimeout time.Duration
+	// MissingJobsDone makes WaitJob treat jobs the server no longer knows
+	// as finished, for API versions that purge jobs once done.
+	MissingJobsDone bool
+	// DefaultProject and DefaultVdc are the IDs configured by the profile,
+	// for tools that operate on a project or VDC when none is given.
+	DefaultProject string
+	DefaultVdc     string
+	ctx            context.Context
+	async          *jobRecorder
 }
 
 type ObjectLocked struct {
@@ -42,22 +48,18 @@ type ObjectLocked struct {
 	NonFieldErrors []interface{} `json:"non_field_errors"`
 }
 
-type Task struct {
-	Status string `json:"status"`
-	Name   string `json:"name"`
-}
-
 type logger interface {
 	Debugf(string, ...interface{})
 }
 
 func NewManager(token string) *Manager {
 	return &Manager{
-		Client:    http.DefaultClient,
-		BaseURL:   DefaultBaseURL,
-		Token:     token,
-		UserAgent: "Rustack-go",
-		ctx:       context.Background(),
+		Client:      http.DefaultClient,
+		BaseURL:     DefaultBaseURL,
+		Token:       token,
+		UserAgent:   "Rustack-go",
+		RetryPolicy: DefaultRetryPolicy(),
+		ctx:         context.Background(),
 	}
 }
 
@@ -68,11 +70,23 @@ func (m *Manager) WithContext(ctx context.Context) *Manager {
 }
 
 func (m *Manager) Request(method string, path string, args interface{}, target interface{}) error {
+	jobs, err := m.RequestAsync(method, path, args, target)
+	if err != nil {
+		return err
+	}
+	recordJobs(target, jobs)
+
+	return m.handleJobs(jobs)
+}
+
+// RequestAsync performs the request and returns the jobs it started without
+// waiting for them.
+func (m *Manager) RequestAsync(method string, path string, args interface{}, target interface{}) ([]*Job, error) {
 	m.log("[rustack] %s %s", method, path)
 
 	res, err := json.Marshal(args)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	m.log("[rustack] Send %s", res)
@@ -81,7 +95,7 @@ func (m *Manager) Request(method string, path string, args interface{}, target i
 
 	req, err := http.NewRequest(method, request_url, bytes.NewReader(res))
 	if err != nil {
-		return errors.Wrapf(err, "Invalid %s request %s", method, request_url)
+		return nil, errors.Wrapf(err, "Invalid %s request %s", method, request_url)
 	}
 
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", m.Token))
@@ -90,9 +104,11 @@ func (m *Manager) Request(method string, path string, args interface{}, target i
 	req = req.WithContext(m.ctx)
 
 	taskIds, err := m.do(req, request_url, target, res)
-	m.waitTasks(taskIds)
+	if err != nil {
+		return nil, err
+	}
 
-	return err
+	return m.newJobs(method, path, taskIds), nil
 }
 
 func (m *Manager) Get(path string, args Arguments, target interface{}) error {
@@ -129,35 +145,11 @@ func (m *Manager) GetItems(path string, args Arguments, target interface{}) erro
 
 	page := 1
 	for {
-		params.Set("page", fmt.Sprint(page))
-
-		m.log("[rustack] GET %s?%s", path, params.Encode())
-
-		request_url, _ := url.JoinPath(m.BaseURL, path)
-		urlWithParams := fmt.Sprintf("%s?%s", request_url, params.Encode())
-
-		req, err := http.NewRequest("GET", urlWithParams, nil)
+		temp, err := m.getPage(path, params, page)
 		if err != nil {
-			return errors.Wrapf(err, "Invalid GET request %s", request_url)
-		}
-
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", m.Token))
-
-		req = req.WithContext(m.ctx)
-
-		type tempStruct struct {
-			Total int             `json:"total"`
-			Limit int             `json:"limit"`
-			Items json.RawMessage // To future unmarshalling
-		}
-
-		temp := new(tempStruct)
-
-		_, err = m.do(req, request_url, temp, nil)
-		if err != nil {
-			break
+			return err
 		}
-		currentPageSize := min(temp.Total-temp.Limit*(page-1), temp.Limit)
+		currentPageSize := max(min(temp.Total-temp.Limit*(page-1), temp.Limit), 0)
 		currentItemsValue := reflect.New(targetValue.Type())
 		currentItemsValue.Elem().Set(reflect.MakeSlice(targetValue.Type(), 0, currentPageSize))
 		currentItems := currentItemsValue.Interface()
@@ -165,8 +157,11 @@ func (m *Manager) GetItems(path string, args Arguments, target interface{}) erro
 		if err != nil {
 			return errors.Wrapf(err, "JSON items decode failed on %s, page %d:", path, page)
 		}
+		if currentItemsValue.Elem().Len() == 0 {
+			break
+		}
 		targetValue.Set(reflect.AppendSlice(targetValue, currentItemsValue.Elem()))
-		if targetValue.Len() == temp.Total {
+		if targetValue.Len() >= temp.Total {
 			break
 		}
 		page++
@@ -174,6 +169,41 @@ func (m *Manager) GetItems(path string, args Arguments, target interface{}) erro
 	return nil
 }
 
+type itemsPage struct {
+	Total int             `json:"total"`
+	Limit int             `json:"limit"`
+	Items json.RawMessage // To future unmarshalling
+}
+
+func (m *Manager) getPage(path string, args url.Values, page int) (*itemsPage, error) {
+	params := url.Values{}
+	for key, values := range args {
+		params[key] = values
+	}
+	params.Set("page", fmt.Sprint(page))
+
+	m.log("[rustack] GET %s?%s", path, params.Encode())
+
+	request_url, _ := url.JoinPath(m.BaseURL, path)
+	urlWithParams := fmt.Sprintf("%s?%s", request_url, params.Encode())
+
+	req, err := http.NewRequest("GET", urlWithParams, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid GET request %s", request_url)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", m.Token))
+
+	req = req.WithContext(m.ctx)
+
+	temp := new(itemsPage)
+	_, err = m.do(req, request_url, temp, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Fetching %s, page %d", path, page)
+	}
+	return temp, nil
+}
+
 func (m *Manager) GetSubItems(path string, args Arguments, target interface{}) error {
 
 	m.log("[rustack] GET %s", path)
@@ -198,54 +228,46 @@ func (m *Manager) GetSubItems(path string, args Arguments, target interface{}) e
 }
 
 func (m *Manager) Delete(path string, args Arguments, target interface{}) error {
+	jobs, err := m.DeleteAsync(path, args, target)
+	if err != nil {
+		return err
+	}
+	recordJobs(target, jobs)
+
+	return m.handleJobs(jobs)
+}
+
+// DeleteAsync performs the request and returns the jobs it started without
+// waiting for them.
+func (m *Manager) DeleteAsync(path string, args Arguments, target interface{}) ([]*Job, error) {
 	m.log("[rustack] DELETE %s", path)
 
 	request_url, _ := url.JoinPath(m.BaseURL, path)
 
 	req, err := http.NewRequest("DELETE", request_url, nil)
 	if err != nil {
-		return errors.Wrapf(err, "Invalid DELETE request %s", request_url)
+		return nil, errors.Wrapf(err, "Invalid DELETE request %s", request_url)
 	}
 
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", m.Token))
 
+	req = req.WithContext(m.ctx)
+
 	taskIds, err := m.do(req, request_url, target, nil)
-	m.waitTasks(taskIds)
+	if err != nil {
+		return nil, err
+	}
 
-	return err
+	return m.newJobs("DELETE", path, taskIds), nil
 }
 
+// Deprecated: use WaitJob, which honours context deadlines.
 func (m *Manager) WaitTask(taskId string) error {
-	m.log("[rustack] Start waiting task %s...", taskId)
+	ctx, cancel := m.taskContext()
+	defer cancel()
 
-	path, _ := url.JoinPath("v1/job", taskId)
-	start := time.Now()
-	var task Task
-
-	for {
-		err := m.Get(path, Arguments{}, task)
-		if err != nil {
-			break
-		}
-		if task.Status == "error" {
-			return errors.New(fmt.Sprintf("Task in error status, step: %s", task.Name))
-		}
-
-		if err := m.sleep(RetryTime * time.Millisecond); err != nil {
-			return err
-		}
-
-		elapsedTime := time.Since(start)
-
-		if elapsedTime.Seconds() > float64(TaskTimeout) {
-			m.log("[rustack] Waiting task %s took more than %ds", taskId, TaskTimeout)
-			return errors.New("Task timeout")
-		}
-	}
-
-	m.log("[rustack] End waiting task %s", taskId)
-
-	return nil
+	_, err := m.WaitJob(ctx, taskId)
+	return err
 }
 
 func (m *Manager) log(format string, args ...interface{}) {
@@ -254,6 +276,13 @@ func (m *Manager) log(format string, args ...interface{}) {
 	}
 }
 
+func (m *Manager) retryDelay(method string, attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	if m.ctx != nil && m.ctx.Err() != nil {
+		return 0, false
+	}
+	return m.RetryPolicy.NextDelay(method, attempt, resp, err)
+}
+
 func (m *Manager) sleep(dur time.Duration) error {
 	if m.ctx != nil {
 		return SleepWithContext(m.ctx, dur)
@@ -267,10 +296,14 @@ func (m *Manager) sleep(dur time.Duration) error {
 // TODO: добавить 10 минут таймаута
 func (m *Manager) do(req *http.Request, url string, target interface{}, requestBody []byte) (string, error) {
 	req.Header.Set("Accept-Language", "ru-ru")
-	var locked_object ObjectLocked
+	if m.UserAgent != "" {
+		req.Header.Set("User-Agent", m.UserAgent)
+	}
 
 	start := time.Now()
 	var resp *http.Response
+	// Only retries of transient failures count, lock waits do not.
+	attempt := 1
 
 	for {
 		m.log("[rustack] Perform %s...", req.Method)
@@ -278,47 +311,60 @@ func (m *Manager) do(req *http.Request, url string, target interface{}, requestB
 		req.Body = io.NopCloser(bytes.NewReader(requestBody))
 		resp_, err := m.Client.Do(req)
 		if err != nil {
+			if delay, ok := m.retryDelay(req.Method, attempt, nil, err); ok {
+				m.log("[rustack] Request to '%s' failed: %s. Try again in %s...", url, err, delay)
+				if err := m.sleep(delay); err != nil {
+					return "", err
+				}
+				attempt++
+				continue
+			}
 			return "", errors.Wrapf(err, "HTTP request failure on %s", url)
 		}
 
-		defer resp_.Body.Close()
-
 		if resp_.StatusCode == 409 {
-			m.log("[rustack] Object '%s' locked. Try again in %dms...", url, RetryTime)
 			body, err := io.ReadAll(resp_.Body)
-			err = json.Unmarshal(body, &locked_object)
-
+			resp_.Body.Close()
 			if err != nil {
 				return "", errors.Wrapf(err, "HTTP Read error on response for %s", url)
 			}
 
-			if locked_object.ErrorAlias != nil {
-				error_alias := fmt.Sprintf("%v", locked_object.ErrorAlias[0])
-				error_details, _ := json.Marshal(locked_object.Details)
-				error_data := fmt.Sprintf("%v", locked_object.NonFieldErrors[0])
-				if error_alias != "object_locked" {
-					error_body := fmt.Sprintf("%s: %s", error_data, string(error_details))
-					return "", errors.New(error_body)
-				}
+			apiErr := newRustackApiError(url, resp_.StatusCode, body)
+			if !errors.Is(apiErr, ErrLocked) {
+				m.log("[rustack] Conflict on '%s': %v", url, apiErr.ErrorAliases())
+				return "", apiErr
 			}
 
+			elapsedTime := time.Since(start)
+
+			if elapsedTime > m.lockTimeout() {
+				m.log("[rustack] Waiting unlock for '%s' took more than %s", url, m.lockTimeout())
+				return "", errors.Wrap(apiErr, "Lock timeout")
+			}
+
+			m.log("[rustack] Object '%s' locked. Try again in %dms...", url, RetryTime)
 			if err := m.sleep(RetryTime * time.Millisecond); err != nil {
 				return "", err
 			}
 
-			elapsedTime := time.Since(start)
+			continue // try again
+		}
 
-			if elapsedTime.Seconds() > float64(LockTimeout) {
-				m.log("[rustack] Waiting unlock for '%s' took more than %ds", url, LockTimeout)
-				return "", errors.New("Lock timeout")
+		if delay, ok := m.retryDelay(req.Method, attempt, resp_, nil); ok {
+			m.log("[rustack] Response %d on '%s'. Try again in %s...", resp_.StatusCode, url, delay)
+			io.Copy(io.Discard, resp_.Body)
+			resp_.Body.Close()
+			if err := m.sleep(delay); err != nil {
+				return "", err
 			}
-
-			continue // try again
+			attempt++
+			continue
 		}
 
 		resp = resp_
 		break
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode > 299 {
 		m.log("[rustack] Error response %d on '%s'", resp.StatusCode, url)
@@ -347,55 +393,26 @@ func (m *Manager) do(req *http.Request, url string, target interface{}, requestB
 		return taskIds, nil
 	}
 
-	// if we dowload file
-	if strings.Contains(url, "config") {
-		reg_url := fmt.Sprintf("%s%s", m.BaseURL, KubeCtlConfigURL)
-		err = CreateKubeCtlConfigFile(b, url, reg_url)
-		if err != nil {
-			return "", errors.Wrapf(err, "Error while creating config file")
-		}
-	} else {
-		err = json.Unmarshal(b, target)
-		if err != nil {
-			return "", errors.Wrapf(err, "JSON decode failed on %s:\n%s", url, string(b))
-		}
-	}
-
-	return taskIds, nil
-}
-
-func CreateKubeCtlConfigFile(b []byte, url string, reg_url string) (err error) {
-	yamlMap := make(map[interface{}]interface{})
-	err = yaml.Unmarshal(b, yamlMap)
-	if err != nil {
-		return errors.Wrapf(err, "Yaml decode failed on %s:\n%s", url, string(b))
+	// raw responses, e.g. kubeconfig files
+	if raw, ok := target.(*[]byte); ok {
+		*raw = b
+		return taskIds, nil
 	}
 
-	dir, err := os.Getwd()
+	err = json.Unmarshal(b, target)
 	if err != nil {
-		return errors.Wrapf(err, "Cannot find work directory")
+		return "", errors.Wrapf(err, "JSON decode failed on %s:\n%s", url, string(b))
 	}
-	k8s_id, err := extractIDFromURL(url, reg_url)
-	// Define the file path for saving the YAML file
-	name := fmt.Sprintf("kubectl-%s.yaml", k8s_id)
-	filePath := filepath.Join(dir, name)
 
-	// Save the decoded YAML to the file
-	err = os.WriteFile(filePath, b, 0644)
-	if err != nil {
-		return errors.Wrapf(err, "Yaml save failed")
-	}
-	return nil
+	return taskIds, nil
 }
 
-func (m *Manager) waitTasks(taskIds string) error {
-	for _, taskId := range strings.Split(taskIds, ",") {
-		taskId := strings.TrimSpace(taskId)
-		if taskId == "" {
-			continue
-		}
+func (m *Manager) waitJobs(jobs []*Job) error {
+	ctx, cancel := m.taskContext()
+	defer cancel()
 
-		if err := m.WaitTask(taskId); err != nil {
+	for _, job := range jobs {
+		if err := job.Wait(ctx); err != nil {
 			return err
 		}
 	}
@@ -403,12 +420,29 @@ func (m *Manager) waitTasks(taskIds string) error {
 	return nil
 }
 
-func extractIDFromURL(url string, reg string) (string, error) {
-	re := regexp.MustCompile(reg)
-	matches := re.FindStringSubmatch(url)
-	if len(matches) < 2 {
-		return "", fmt.Errorf("No ID found in the URL")
+// taskContext returns the manager context, limited to the job timeout unless
+// the caller already set a deadline.
+func (m *Manager) taskContext() (context.Context, context.CancelFunc) {
+	ctx := m.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
 	}
+	return context.WithTimeout(ctx, m.jobTimeout())
+}
 
-	return matches[1], nil
+func (m *Manager) jobTimeout() time.Duration {
+	if m.JobTimeout > 0 {
+		return m.JobTimeout
+	}
+	return TaskTimeout * time.Second
+}
+
+func (m *Manager) lockTimeout() time.Duration {
+	if m.LockTimeout > 0 {
+		return m.LockTimeout
+	}
+	return LockTimeout * time.Second
 }
@@ -1,11 +1,13 @@
 package rustack
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 )
 
 type Network struct {
+	jobList
 	manager   *Manager
 	ID        string `json:"id"`
 	Name      string `json:"name"`
@@ -37,6 +39,12 @@ func (m *Manager) GetNetworks(extraArgs ...Arguments) (networks []*Network, err
 	return
 }
 
+func (m *Manager) IterNetworks(ctx context.Context, args Arguments, opts ...IterOption) *Iterator[*Network] {
+	return NewIterator(ctx, m, "v1/network", args, func(network *Network) {
+		network.manager = m
+	}, opts...)
+}
+
 func (v *Vdc) GetNetworks(extraArgs ...Arguments) (networks []*Network, err error) {
 	args := Arguments{
 		"vdc": v.ID,
@@ -104,10 +112,31 @@ func (n *Network) GetSubnets() (subnets []*Subnet, err error) {
 
 func (n *Network) Delete() error {
 	path, _ := url.JoinPath("v1/network", n.ID)
-	return n.manager.Delete(path, Defaults(), nil)
+	return n.manager.deleteResource(path, n)
 }
 
 func (n Network) WaitLock() (err error) {
 	path, _ := url.JoinPath("v1/network", n.ID)
 	return loopWaitLock(n.manager, path)
 }
+
+func (n *Network) TagNames() []string {
+	return convertTagsToNames(n.Tags)
+}
+
+func (n *Network) tagPath() string {
+	path, _ := url.JoinPath("v1/network", n.ID)
+	return path
+}
+
+func (n *Network) SetTags(tags ...string) error {
+	return n.manager.setTags(n, tags)
+}
+
+func (n *Network) AddTags(tags ...string) error {
+	return n.manager.addTags(n, tags)
+}
+
+func (n *Network) RemoveTags(tags ...string) error {
+	return n.manager.removeTags(n, tags)
+}
@@ -23,6 +23,7 @@ type PaasTemplate struct {
 }
 
 type PaasService struct {
+	jobList
 	manager *Manager
 	ID      string `json:"id"`
 	Name    string `json:"name"`
@@ -0,0 +1,155 @@
+package rustack
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Members are matched by ID when both have one, by VM and port otherwise.
+func findMember(members []*PoolMember, member *PoolMember) int {
+	for i, m := range members {
+		if m.ID != "" && member.ID != "" {
+			if m.ID == member.ID {
+				return i
+			}
+			continue
+		}
+		if m.Vm != nil && member.Vm != nil && m.Vm.ID == member.Vm.ID && m.Port == member.Port {
+			return i
+		}
+	}
+	return -1
+}
+
+// AddMember adds the member to the pool. A member already in the pool gets
+// the weight of the new one. Like the other member changes it must not run
+// concurrently with another change to the same pool.
+func (pool *LoadBalancerPool) AddMember(member *PoolMember) error {
+	if member.Vm == nil {
+		return errors.Wrap(ErrValidation, "Pool member requires a vm")
+	}
+	return pool.changeMembers(func(members []*PoolMember) ([]*PoolMember, error) {
+		if i := findMember(members, member); i >= 0 {
+			members[i].Weight = member.Weight
+			return members, nil
+		}
+		return append(members, member), nil
+	})
+}
+
+// RemoveMember removes the member from the pool, if it is in it.
+func (pool *LoadBalancerPool) RemoveMember(member *PoolMember) error {
+	return pool.changeMembers(func(members []*PoolMember) ([]*PoolMember, error) {
+		if i := findMember(members, member); i >= 0 {
+			members = append(members[:i], members[i+1:]...)
+		}
+		return members, nil
+	})
+}
+
+// SetMemberWeight changes the weight of a member of the pool. A weight of 0
+// sends no new connections to the member.
+func (pool *LoadBalancerPool) SetMemberWeight(member *PoolMember, weight int) error {
+	return pool.changeMembers(func(members []*PoolMember) ([]*PoolMember, error) {
+		i := findMember(members, member)
+		if i < 0 {
+			return nil, errors.Wrapf(ErrNotFound, "Vm %s is not a member of pool %d", memberVmID(member), pool.Port)
+		}
+		members[i].Weight = weight
+		return members, nil
+	})
+}
+
+// SetMembers replaces all members of the pool in one request, e.g. to change
+// several weights at once. It waits for the pool to be unlocked but, unlike
+// the other member changes, does not read the current members first: changes
+// made since the members were read are overwritten.
+func (pool *LoadBalancerPool) SetMembers(members []*PoolMember) error {
+	if err := pool.WaitLock(); err != nil {
+		return err
+	}
+	return pool.patchMembers(members)
+}
+
+// DrainMember stops sending new connections to the member, waits for the
+// current ones to finish, then removes it. When ctx is done first the member
+// is left in the pool with a weight of 0.
+func (pool *LoadBalancerPool) DrainMember(ctx context.Context, member *PoolMember, wait time.Duration) error {
+	if err := pool.SetMemberWeight(member, 0); err != nil {
+		return err
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+	return pool.RemoveMember(member)
+}
+
+// changeMembers reads the current members of the pool once it is unlocked,
+// so that changes made since the pool was fetched are kept, and sends the
+// changed list alone. The change is waited for even with an async manager,
+// for the next change to read it.
+//
+// The API has no conditional update, two changes reading the members at the
+// same time lose one of them. Changes to a pool from several goroutines or
+// processes must be serialized by the caller.
+func (pool *LoadBalancerPool) changeMembers(change func(members []*PoolMember) ([]*PoolMember, error)) error {
+	if err := pool.WaitLock(); err != nil {
+		return err
+	}
+	if err := pool.Reload(); err != nil {
+		return err
+	}
+	members, err := change(pool.Members)
+	if err != nil {
+		return err
+	}
+	return pool.patchMembers(members)
+}
+
+// patchMembers sends the members alone, leaving the other pool fields as they
+// are on the server.
+func (pool *LoadBalancerPool) patchMembers(members []*PoolMember) error {
+	type poolMember struct {
+		Port   int    `json:"port"`
+		Weight int    `json:"weight"`
+		Vm     string `json:"vm"`
+	}
+
+	args := &struct {
+		Members []*poolMember `json:"members"`
+	}{
+		Members: make([]*poolMember, 0, len(members)),
+	}
+	for _, member := range members {
+		if member.Vm == nil {
+			return errors.Wrap(ErrValidation, "Pool member requires a vm")
+		}
+		if member.Weight < 0 {
+			return errors.Wrapf(ErrValidation, "Weight of vm %s cannot be negative", memberVmID(member))
+		}
+		args.Members = append(args.Members, &poolMember{
+			Port:   member.Port,
+			Weight: member.Weight,
+			Vm:     member.Vm.ID,
+		})
+	}
+	path := fmt.Sprintf("v1/lbaas/%s/pool/%s", pool.loadBalancerID, pool.ID)
+	// The response is decoded into fresh members, the old ones may be held
+	// by the caller.
+	pool.Members = nil
+	return pool.manager.waiting().Request("PATCH", path, args, pool)
+}
+
+func memberVmID(member *PoolMember) string {
+	if member.Vm == nil {
+		return ""
+	}
+	return member.Vm.ID
+}
@@ -0,0 +1,131 @@
+package rustack_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+	"github.com/rustack-cloud-platform/rcp-go/rustacktest"
+)
+
+// seedPool seeds a load balancer with a pool and returns the pool and its
+// path.
+func seedPool(t *testing.T, s *rustacktest.Server, members ...interface{}) (*rustack.LoadBalancerPool, string) {
+	t.Helper()
+	vdc := s.Seed("vdc", map[string]interface{}{"name": "prod"})
+	network := s.Seed("network", map[string]interface{}{"name": "backend", "vdc": vdc["id"]})
+	lb := s.Seed("lbaas", map[string]interface{}{
+		"name": "front", "vdc": vdc["id"],
+		"port": map[string]interface{}{"vdc": vdc["id"], "network": network["id"]},
+	})
+	seeded := s.Seed("lbaas/"+lb["id"].(string)+"/pool", map[string]interface{}{
+		"port": 80, "protocol": "TCP", "method": "ROUND_ROBIN", "members": members,
+	})
+	l, err := s.Manager().GetLoadBalancer(lb["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := l.GetLoadBalancerPool(seeded["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &pool, "v1/lbaas/" + l.ID + "/pool/" + pool.ID
+}
+
+// weights lists the members of the pool on the server as "vm:port=weight".
+func weights(t *testing.T, pool *rustack.LoadBalancerPool) (got []string) {
+	t.Helper()
+	if err := pool.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range pool.Members {
+		got = append(got, fmt.Sprintf("%s:%d=%d", m.Vm.Name, m.Port, m.Weight))
+	}
+	return
+}
+
+func TestPoolMembers(t *testing.T) {
+	s := rustacktest.NewServer()
+	defer s.Close()
+	a := s.Seed("vm", map[string]interface{}{"name": "a"})
+	b := s.Seed("vm", map[string]interface{}{"name": "b"})
+	pool, path := seedPool(t, s,
+		map[string]interface{}{"id": "m1", "vm": a, "port": 80, "weight": 50},
+		map[string]interface{}{"id": "m2", "vm": b, "port": 80, "weight": 50},
+	)
+	vmA, vmB := &rustack.Vm{ID: a["id"].(string)}, &rustack.Vm{ID: b["id"].(string)}
+
+	// IDs take precedence over the VM and port: m2 is removed although the
+	// VM and port are those of m1.
+	if err := pool.RemoveMember(&rustack.PoolMember{ID: "m2", Vm: vmA, Port: 80}); err != nil {
+		t.Fatal(err)
+	}
+	if got := weights(t, pool); !reflect.DeepEqual(got, []string{"a:80=50"}) {
+		t.Fatalf("after remove %v", got)
+	}
+
+	// Members without an ID are matched by VM and port: adding an existing
+	// member changes its weight.
+	before := len(s.Requests())
+	if err := pool.AddMember(&rustack.PoolMember{Vm: vmA, Port: 80, Weight: 20}); err != nil {
+		t.Fatal(err)
+	}
+	if got := requestsSince(s, before); len(got) < 3 || !reflect.DeepEqual(got[:3], []string{"GET " + path, "GET " + path, "PATCH " + path}) {
+		t.Fatalf("add requests %v, want a lock wait and a reload before the patch", got)
+	}
+	if err := pool.AddMember(&rustack.PoolMember{Vm: vmA, Port: 8080, Weight: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.AddMember(&rustack.PoolMember{Vm: vmB, Port: 80, Weight: 30}); err != nil {
+		t.Fatal(err)
+	}
+	if got := weights(t, pool); !reflect.DeepEqual(got, []string{"a:80=20", "a:8080=10", "b:80=30"}) {
+		t.Fatalf("after add %v", got)
+	}
+
+	if err := pool.SetMemberWeight(&rustack.PoolMember{Vm: vmA, Port: 8080}, 40); err != nil {
+		t.Fatal(err)
+	}
+	if got := weights(t, pool); !reflect.DeepEqual(got, []string{"a:80=20", "a:8080=40", "b:80=30"}) {
+		t.Fatalf("after set weight %v", got)
+	}
+	err := pool.SetMemberWeight(&rustack.PoolMember{Vm: vmB, Port: 8080}, 40)
+	if !errors.Is(err, rustack.ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound for a missing member", err)
+	}
+	if err := pool.AddMember(&rustack.PoolMember{Port: 80}); !errors.Is(err, rustack.ErrValidation) {
+		t.Fatalf("got %v, want ErrValidation for a member without vm", err)
+	}
+
+	// A drain cancelled by ctx leaves the member without traffic.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := pool.DrainMember(ctx, &rustack.PoolMember{Vm: vmB, Port: 80}, time.Hour); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want the drain to be cancelled", err)
+	}
+	if got := weights(t, pool); !reflect.DeepEqual(got, []string{"a:80=20", "a:8080=40", "b:80=0"}) {
+		t.Fatalf("after cancelled drain %v", got)
+	}
+	if err := pool.DrainMember(context.Background(), &rustack.PoolMember{Vm: vmB, Port: 80}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := weights(t, pool); !reflect.DeepEqual(got, []string{"a:80=20", "a:8080=40"}) {
+		t.Fatalf("after drain %v", got)
+	}
+
+	// SetMembers waits for the lock but sends the members as given.
+	before = len(s.Requests())
+	if err := pool.SetMembers([]*rustack.PoolMember{{Vm: vmB, Port: 80, Weight: 100}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := requestsSince(s, before); len(got) < 2 || !reflect.DeepEqual(got[:2], []string{"GET " + path, "PATCH " + path}) {
+		t.Fatalf("set requests %v", got)
+	}
+	if got := weights(t, pool); !reflect.DeepEqual(got, []string{"b:80=100"}) {
+		t.Fatalf("after set %v", got)
+	}
+}
@@ -1,11 +1,13 @@
 package rustack
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 )
 
 type Port struct {
+	jobList
 	manager           *Manager
 	ID                string              `json:"id"`
 	IpAddress         *string             `json:"ip_address,omitempty"`
@@ -44,6 +46,15 @@ func (v *Vdc) GetPorts(extraArgs ...Arguments) (ports []*Port, err error) {
 	return
 }
 
+func (m *Manager) IterPorts(ctx context.Context, args Arguments, opts ...IterOption) *Iterator[*Port] {
+	return NewIterator(ctx, m, "v1/port", args, func(port *Port) {
+		port.manager = m
+		if port.Network != nil {
+			port.Network.manager = m
+		}
+	}, opts...)
+}
+
 func (p *Port) UpdateFirewall(firewallTemplates []*FirewallTemplate) error {
 	p.FirewallTemplates = firewallTemplates
 	return p.Update()
@@ -76,12 +87,12 @@ func (p *Port) Update() error {
 
 func (p *Port) Delete() error {
 	path, _ := url.JoinPath("v1/port", p.ID)
-	return p.manager.Delete(path, Defaults(), nil)
+	return p.manager.deleteResource(path, p)
 }
 
 func (p *Port) ForceDelete() error {
 	path := fmt.Sprintf("v1/port/%s/force", p.ID)
-	return p.manager.Delete(path, Defaults(), nil)
+	return p.manager.deleteResource(path, p)
 }
 
 func (r *Router) CreatePort(port *Port, toConnect interface{}) (err error) {
@@ -126,3 +137,24 @@ func (p Port) WaitLock() (err error) {
 	path, _ := url.JoinPath("v1/port", p.ID)
 	return loopWaitLock(p.manager, path)
 }
+
+func (p *Port) TagNames() []string {
+	return convertTagsToNames(p.Tags)
+}
+
+func (p *Port) tagPath() string {
+	path, _ := url.JoinPath("v1/port", p.ID)
+	return path
+}
+
+func (p *Port) SetTags(tags ...string) error {
+	return p.manager.setTags(p, tags)
+}
+
+func (p *Port) AddTags(tags ...string) error {
+	return p.manager.addTags(p, tags)
+}
+
+func (p *Port) RemoveTags(tags ...string) error {
+	return p.manager.removeTags(p, tags)
+}
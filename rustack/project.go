@@ -1,10 +1,12 @@
 package rustack
 
 import (
+	"context"
 	"net/url"
 )
 
 type Project struct {
+	jobList
 	manager *Manager
 	ID      string `json:"id"`
 	Name    string `json:"name"`
@@ -32,6 +34,12 @@ func (m *Manager) GetProjects(extraArgs ...Arguments) (projects []*Project, err
 	return
 }
 
+func (m *Manager) IterProjects(ctx context.Context, args Arguments, opts ...IterOption) *Iterator[*Project] {
+	return NewIterator(ctx, m, "v1/project", args, func(project *Project) {
+		project.manager = m
+	}, opts...)
+}
+
 func (m *Manager) GetProject(id string) (project *Project, err error) {
 	path, _ := url.JoinPath("v1/project", id)
 	err = m.Get(path, Defaults(), &project)
@@ -82,10 +90,31 @@ func (p *Project) Update() error {
 
 func (p *Project) Delete() error {
 	path, _ := url.JoinPath("v1/project", p.ID)
-	return p.manager.Delete(path, Defaults(), nil)
+	return p.manager.deleteResource(path, p)
 }
 
 func (p Project) WaitLock() (err error) {
 	path, _ := url.JoinPath("v1/project", p.ID)
 	return loopWaitLock(p.manager, path)
 }
+
+func (p *Project) TagNames() []string {
+	return convertTagsToNames(p.Tags)
+}
+
+func (p *Project) tagPath() string {
+	path, _ := url.JoinPath("v1/project", p.ID)
+	return path
+}
+
+func (p *Project) SetTags(tags ...string) error {
+	return p.manager.setTags(p, tags)
+}
+
+func (p *Project) AddTags(tags ...string) error {
+	return p.manager.addTags(p, tags)
+}
+
+func (p *Project) RemoveTags(tags ...string) error {
+	return p.manager.removeTags(p, tags)
+}
@@ -0,0 +1,130 @@
+package rustack_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+// response is a scripted answer of a test server.
+type response struct {
+	status int
+	body   interface{}
+	header http.Header
+}
+
+// scriptedServer answers with the responses in order, then with the last
+// one. It returns a manager using the server, with short retry backoffs, and
+// a function counting the requests received so far.
+func scriptedServer(t *testing.T, responses ...response) (*rustack.Manager, func() int) {
+	t.Helper()
+	var mu sync.Mutex
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		resp := responses[len(responses)-1]
+		if requests < len(responses) {
+			resp = responses[requests]
+		}
+		requests++
+		mu.Unlock()
+		for name, values := range resp.header {
+			w.Header()[name] = values
+		}
+		switch body := resp.body.(type) {
+		case nil:
+			w.WriteHeader(resp.status)
+		case string:
+			w.WriteHeader(resp.status)
+			w.Write([]byte(body))
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(resp.status)
+			json.NewEncoder(w).Encode(body)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	m := rustack.NewManager("token")
+	m.BaseURL = srv.URL
+	m.RetryPolicy.InitialBackoff = time.Millisecond
+	m.RetryPolicy.MaxBackoff = 10 * time.Millisecond
+	return m, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+var locked = response{status: http.StatusConflict, body: map[string]interface{}{
+	"error_alias":      []string{"object_locked"},
+	"non_field_errors": []string{"Object is locked"},
+}}
+
+func TestRetryAfterLockWaits(t *testing.T) {
+	gateway := response{status: http.StatusBadGateway}
+	m, requests := scriptedServer(t, locked, locked, locked, gateway, gateway,
+		response{status: http.StatusOK, body: map[string]interface{}{"id": "vdc", "name": "vdc"}})
+	m.RetryPolicy.MaxAttempts = 3
+	// Lock waits come first and must not use up the attempts left for the
+	// gateway errors.
+	if _, err := m.GetVdc("vdc"); err != nil {
+		t.Fatal(err)
+	}
+	if got := requests(); got != 6 {
+		t.Fatalf("got %d requests, want 6", got)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	m, requests := scriptedServer(t, response{status: http.StatusServiceUnavailable})
+	m.RetryPolicy.MaxAttempts = 3
+
+	if _, err := m.GetVdc("vdc"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := requests(); got != 3 {
+		t.Fatalf("got %d requests, want 3", got)
+	}
+}
+
+func TestNextDelay(t *testing.T) {
+	p := rustack.DefaultRetryPolicy()
+	p.Jitter = 0
+
+	tests := []struct {
+		name       string
+		method     string
+		attempt    int
+		status     int
+		retryAfter string
+		wantDelay  time.Duration
+		wantRetry  bool
+	}{
+		{"backoff", "GET", 1, http.StatusBadGateway, "", 500 * time.Millisecond, true},
+		{"backoff grows", "GET", 3, http.StatusBadGateway, "", 2 * time.Second, true},
+		{"last attempt", "GET", 5, http.StatusBadGateway, "", 0, false},
+		{"not transient", "GET", 1, http.StatusInternalServerError, "", 0, false},
+		{"unsafe post", "POST", 1, http.StatusBadGateway, "", 0, false},
+		{"throttled post", "POST", 1, http.StatusTooManyRequests, "", 500 * time.Millisecond, true},
+		{"retry after", "GET", 1, http.StatusServiceUnavailable, "3", 3 * time.Second, true},
+		{"retry after capped", "GET", 1, http.StatusServiceUnavailable, "3600", p.MaxBackoff, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			if tt.retryAfter != "" {
+				resp.Header.Set("Retry-After", tt.retryAfter)
+			}
+			delay, retry := p.NextDelay(tt.method, tt.attempt, resp, nil)
+			if retry != tt.wantRetry || delay != tt.wantDelay {
+				t.Fatalf("got %s, %v, want %s, %v", delay, retry, tt.wantDelay, tt.wantRetry)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 )
 
 type Route struct {
+	jobList
 	router      *Router
 	ID          string `json:"id"`
 	Destination string `json:"destination"`
@@ -67,7 +68,7 @@ func (route *Route) Delete() error {
 	if err != nil {
 		return err
 	}
-	return route.router.manager.Delete(path, Defaults(), nil)
+	return route.router.manager.deleteResource(path, route)
 }
 
 func (route Route) WaitLock() (err error) {
@@ -1,11 +1,13 @@
 package rustack
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 )
 
 type Router struct {
+	jobList
 	manager   *Manager
 	ID        string `json:"id"`
 	Name      string `json:"name"`
@@ -46,6 +48,18 @@ func (m *Manager) GetRouters(extraArgs ...Arguments) (routers []*Router, err err
 	return
 }
 
+func (m *Manager) IterRouters(ctx context.Context, args Arguments, opts ...IterOption) *Iterator[*Router] {
+	return NewIterator(ctx, m, "v1/router", args, func(router *Router) {
+		router.manager = m
+		for x := range router.Ports {
+			router.Ports[x].manager = m
+		}
+		for x := range router.Routes {
+			router.Routes[x].router = router
+		}
+	}, opts...)
+}
+
 func (v *Vdc) GetRouters(extraArgs ...Arguments) (routers []*Router, err error) {
 	args := Arguments{
 		"vdc": v.ID,
@@ -129,7 +143,7 @@ func (r *Router) DisconnectPort(port *Port) error {
 
 func (r *Router) Delete() error {
 	path, _ := url.JoinPath("v1/router", r.ID)
-	return r.manager.Delete(path, Defaults(), nil)
+	return r.manager.deleteResource(path, r)
 }
 
 func (r *Router) Rename(name string) error {
@@ -167,3 +181,24 @@ func (r *Router) Update() error {
 	r.WaitLock()
 	return r.manager.Request("PUT", path, args, r)
 }
+
+func (r *Router) TagNames() []string {
+	return convertTagsToNames(r.Tags)
+}
+
+func (r *Router) tagPath() string {
+	path, _ := url.JoinPath("v1/router", r.ID)
+	return path
+}
+
+func (r *Router) SetTags(tags ...string) error {
+	return r.manager.setTags(r, tags)
+}
+
+func (r *Router) AddTags(tags ...string) error {
+	return r.manager.addTags(r, tags)
+}
+
+func (r *Router) RemoveTags(tags ...string) error {
+	return r.manager.removeTags(r, tags)
+}
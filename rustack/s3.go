@@ -1,11 +1,13 @@
 package rustack
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 )
 
 type S3Storage struct {
+	jobList
 	manager        *Manager
 	ID             string `json:"id"`
 	Locked         bool   `json:"locked"`
@@ -21,6 +23,7 @@ type S3Storage struct {
 }
 
 type S3StorageBucket struct {
+	jobList
 	manager      *Manager
 	ID           string `json:"id"`
 	ExternalName string `json:"external_name"`
@@ -67,6 +70,12 @@ func (m *Manager) GetS3Storages(extraArgs ...Arguments) (s3_storages []*S3Storag
 	return
 }
 
+func (m *Manager) IterS3Storages(ctx context.Context, args Arguments, opts ...IterOption) *Iterator[*S3Storage] {
+	return NewIterator(ctx, m, "v1/s3_storage", args, func(s3 *S3Storage) {
+		s3.manager = m
+	}, opts...)
+}
+
 func (p *Project) GetS3Storages(extraArgs ...Arguments) (s3_storages []*S3Storage, err error) {
 	args := Arguments{
 		"project": p.ID,
@@ -103,7 +112,7 @@ func (s3 *S3Storage) Update() (err error) {
 
 func (s3 *S3Storage) Delete() (err error) {
 	path, _ := url.JoinPath("v1/s3_storage", s3.ID)
-	err = s3.manager.Delete(path, Defaults(), nil)
+	err = s3.manager.deleteResource(path, s3)
 	return
 }
 
@@ -173,7 +182,7 @@ func (b *S3StorageBucket) Update() (err error) {
 
 func (b *S3StorageBucket) Delete() (err error) {
 	path := fmt.Sprintf("v1/s3_storage/%s/bucket/%s", b.S3StorageId, b.ID)
-	err = b.manager.Delete(path, Defaults(), nil)
+	err = b.manager.deleteResource(path, b)
 	return
 }
 
@@ -181,3 +190,24 @@ func (s3 S3Storage) WaitLock() (err error) {
 	path, _ := url.JoinPath("v1/s3_storage", s3.ID)
 	return loopWaitLock(s3.manager, path)
 }
+
+func (s3 *S3Storage) TagNames() []string {
+	return convertTagsToNames(s3.Tags)
+}
+
+func (s3 *S3Storage) tagPath() string {
+	path, _ := url.JoinPath("v1/s3_storage", s3.ID)
+	return path
+}
+
+func (s3 *S3Storage) SetTags(tags ...string) error {
+	return s3.manager.setTags(s3, tags)
+}
+
+func (s3 *S3Storage) AddTags(tags ...string) error {
+	return s3.manager.addTags(s3, tags)
+}
+
+func (s3 *S3Storage) RemoveTags(tags ...string) error {
+	return s3.manager.removeTags(s3, tags)
+}
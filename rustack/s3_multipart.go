@@ -0,0 +1,209 @@
+package rustack
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (c *S3Client) partSize() int64 {
+	if c.PartSize <= 0 {
+		return DefaultPartSize
+	}
+	if c.PartSize < MinPartSize {
+		return MinPartSize
+	}
+	return c.PartSize
+}
+
+func (c *S3Client) parallelism() int {
+	if c.Parallelism <= 0 {
+		return DefaultUploadParallelism
+	}
+	return c.Parallelism
+}
+
+// readPart fills a part from body, io.EOF is only returned with an empty
+// part.
+func readPart(body io.Reader, size int64) ([]byte, error) {
+	part := make([]byte, size)
+	n, err := io.ReadFull(body, part)
+	if err == io.ErrUnexpectedEOF || (err == io.EOF && n > 0) {
+		err = nil
+	}
+	return part[:n], err
+}
+
+// putMultipart uploads body in parts of PartSize, Parallelism at once. The
+// upload is aborted when a part fails, so that no parts are left behind.
+func (c *S3Client) putMultipart(ctx context.Context, bucket string, key string, body io.Reader, opts S3PutOptions) (etag string, err error) {
+	first, err := readPart(body, c.partSize())
+	if err != nil && err != io.EOF {
+		return "", errors.Wrapf(err, "Cannot read %s/%s", bucket, key)
+	}
+	// A small body of unknown size is sent at once.
+	if int64(len(first)) < c.partSize() {
+		return c.PutObject(ctx, bucket, key, bytes.NewReader(first), int64(len(first)), opts)
+	}
+
+	uploadID, err := c.createMultipart(ctx, bucket, key, opts)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		parts    []completedPart
+		firstErr error
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+		mu.Unlock()
+	}
+	sem := make(chan struct{}, c.parallelism())
+
+	part := first
+	for number := 1; ; number++ {
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(number int, part []byte) {
+			defer func() { <-sem; wg.Done() }()
+			partETag, err := c.uploadPart(ctx, bucket, key, uploadID, number, part)
+			if err != nil {
+				fail(err)
+				return
+			}
+			mu.Lock()
+			parts = append(parts, completedPart{PartNumber: number, ETag: partETag})
+			mu.Unlock()
+		}(number, part)
+
+		part, err = readPart(body, c.partSize())
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fail(errors.Wrapf(err, "Cannot read %s/%s", bucket, key))
+			break
+		}
+	}
+	wg.Wait()
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	if firstErr == nil {
+		etag, firstErr = c.completeMultipart(ctx, bucket, key, uploadID, parts)
+	}
+	if firstErr != nil {
+		// The caller's context may be done, the abort still has to be sent.
+		c.abortMultipart(context.Background(), bucket, key, uploadID)
+		return "", firstErr
+	}
+	return etag, nil
+}
+
+func (c *S3Client) createMultipart(ctx context.Context, bucket string, key string, opts S3PutOptions) (string, error) {
+	u, err := c.objectURL(bucket, key, url.Values{"uploads": {""}})
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.do(ctx, http.MethodPost, u, opts.header(), nil, 0, nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "Cannot start upload of %s/%s", bucket, key)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		UploadId string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil || result.UploadId == "" {
+		return "", errors.Errorf("Cannot start upload of %s/%s: no upload id returned", bucket, key)
+	}
+	return result.UploadId, nil
+}
+
+func (c *S3Client) uploadPart(ctx context.Context, bucket string, key string, uploadID string, number int, part []byte) (string, error) {
+	query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+	u, err := c.objectURL(bucket, key, query)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.do(ctx, http.MethodPut, u, nil, nil, 0, part)
+	if err != nil {
+		return "", errors.Wrapf(err, "Cannot upload part %d of %s/%s", number, bucket, key)
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+func (c *S3Client) completeMultipart(ctx context.Context, bucket string, key string, uploadID string, parts []completedPart) (string, error) {
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	payload, err := xml.Marshal(&struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return "", err
+	}
+	u, err := c.objectURL(bucket, key, url.Values{"uploadId": {uploadID}})
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.do(ctx, http.MethodPost, u, nil, nil, 0, payload)
+	if err != nil {
+		return "", errors.Wrapf(err, "Cannot complete upload of %s/%s", bucket, key)
+	}
+	defer resp.Body.Close()
+
+	// S3 may report a failure with a 200 status once the body is sent.
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrapf(err, "Cannot complete upload of %s/%s", bucket, key)
+	}
+	var result struct {
+		XMLName xml.Name
+		ETag    string `xml:"ETag"`
+		S3Error
+	}
+	if err := xml.Unmarshal(data, &result); err == nil && result.XMLName.Local == "Error" {
+		result.S3Error.StatusCode = resp.StatusCode
+		return "", errors.Wrapf(&result.S3Error, "Cannot complete upload of %s/%s", bucket, key)
+	}
+	return result.ETag, nil
+}
+
+func (c *S3Client) abortMultipart(ctx context.Context, bucket string, key string, uploadID string) {
+	u, err := c.objectURL(bucket, key, url.Values{"uploadId": {uploadID}})
+	if err != nil {
+		return
+	}
+	if resp, err := c.do(ctx, http.MethodDelete, u, nil, nil, 0, nil); err == nil {
+		resp.Body.Close()
+	}
+}
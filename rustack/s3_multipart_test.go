@@ -0,0 +1,143 @@
+package rustack_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+// fakeMultipart is an S3 endpoint accepting a single multipart upload.
+type fakeMultipart struct {
+	mu        sync.Mutex
+	failPart  int
+	completed []int
+	aborted   bool
+	// completeBody replaces the answer to the completion, sent with a 200
+	// status.
+	completeBody string
+	sizes        map[int]int
+}
+
+func (f *fakeMultipart) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		fmt.Fprint(w, "<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>")
+	case r.Method == http.MethodPut && query.Get("uploadId") == "upload-1":
+		var number int
+		fmt.Sscan(query.Get("partNumber"), &number)
+		data, _ := io.ReadAll(r.Body)
+		// Later parts finish first.
+		time.Sleep(time.Duration(5-number) * 10 * time.Millisecond)
+		if number == f.failPart {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, "<Error><Code>InternalError</Code></Error>")
+			return
+		}
+		f.mu.Lock()
+		f.sizes[number] = len(data)
+		f.mu.Unlock()
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, number))
+	case r.Method == http.MethodPost && query.Get("uploadId") == "upload-1":
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+		xml.NewDecoder(r.Body).Decode(&complete)
+		f.mu.Lock()
+		for _, part := range complete.Parts {
+			if part.ETag != fmt.Sprintf(`"etag-%d"`, part.PartNumber) {
+				f.completed = append(f.completed, -1)
+				continue
+			}
+			f.completed = append(f.completed, part.PartNumber)
+		}
+		f.mu.Unlock()
+		if f.completeBody != "" {
+			fmt.Fprint(w, f.completeBody)
+			return
+		}
+		fmt.Fprint(w, `<CompleteMultipartUploadResult><ETag>"object-etag"</ETag></CompleteMultipartUploadResult>`)
+	case r.Method == http.MethodDelete && query.Get("uploadId") == "upload-1":
+		f.mu.Lock()
+		f.aborted = true
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestPutMultipart(t *testing.T) {
+	tests := []struct {
+		name         string
+		failPart     int
+		completeBody string
+		completed    []int
+		aborted      bool
+		s3Code       string
+	}{
+		{name: "ordered parts", completed: []int{1, 2, 3}},
+		{name: "part failure", failPart: 2, aborted: true, s3Code: "InternalError"},
+		{
+			name:         "error after complete",
+			completeBody: "<Error><Code>InternalError</Code><Message>We encountered an internal error.</Message></Error>",
+			completed:    []int{1, 2, 3},
+			aborted:      true,
+			s3Code:       "InternalError",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeMultipart{failPart: tt.failPart, completeBody: tt.completeBody, sizes: map[int]int{}}
+			srv := httptest.NewServer(fake)
+			defer srv.Close()
+
+			c := &rustack.S3Client{
+				Endpoint: srv.URL, AccessKey: "access", SecretKey: "secret",
+				PartSize: rustack.MinPartSize, Parallelism: 3,
+			}
+			body := bytes.Repeat([]byte("x"), 2*rustack.MinPartSize+100)
+			etag, err := c.PutObject(context.Background(), "bucket", "key", bytes.NewReader(body), -1, rustack.S3PutOptions{})
+
+			if tt.s3Code == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if etag != `"object-etag"` {
+					t.Fatalf("etag %s", etag)
+				}
+				if fake.sizes[1] != rustack.MinPartSize || fake.sizes[2] != rustack.MinPartSize || fake.sizes[3] != 100 {
+					t.Fatalf("part sizes %v", fake.sizes)
+				}
+			} else {
+				var s3Err *rustack.S3Error
+				if !errors.As(err, &s3Err) || s3Err.Code != tt.s3Code {
+					t.Fatalf("got %v, want S3 error %s", err, tt.s3Code)
+				}
+			}
+			if fmt.Sprint(fake.completed) != fmt.Sprint(tt.completed) {
+				t.Fatalf("completed parts %v, want %v", fake.completed, tt.completed)
+			}
+			if fake.aborted != tt.aborted {
+				t.Fatalf("aborted %v, want %v", fake.aborted, tt.aborted)
+			}
+		})
+	}
+}
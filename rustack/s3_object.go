@@ -0,0 +1,336 @@
+package rustack
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultS3Region is the region signed into requests, S3 compatible
+	// storages accept it whatever their location.
+	DefaultS3Region = "us-east-1"
+	// DefaultPartSize is the size of the parts of multipart uploads, and the
+	// size above which PutObject switches to a multipart upload.
+	DefaultPartSize = 16 << 20
+	// MinPartSize is the smallest part S3 accepts, but for the last one.
+	MinPartSize = 5 << 20
+	// DefaultUploadParallelism is the number of parts uploaded at once.
+	DefaultUploadParallelism = 4
+)
+
+// S3Client reads and writes the objects of an S3Storage, with its access
+// keys. Buckets are addressed by their ExternalName, with path-style URLs.
+type S3Client struct {
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Region    string
+	// Client sends the requests, http.DefaultClient when nil.
+	Client *http.Client
+	// PartSize and Parallelism tune multipart uploads, DefaultPartSize and
+	// DefaultUploadParallelism when zero. Uploads hold one more part than
+	// Parallelism in memory.
+	PartSize    int64
+	Parallelism int
+}
+
+// S3Object describes an object, as listed or as returned by HeadObject and
+// GetObject.
+type S3Object struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+	ContentType  string
+	// Metadata holds the x-amz-meta-* headers, by lower case name without
+	// the prefix. It is not filled by ListObjects.
+	Metadata map[string]string
+}
+
+type S3PutOptions struct {
+	ContentType string
+	Metadata    map[string]string
+}
+
+// S3Error is returned when the storage rejects a request. It matches
+// ErrNotFound, ErrUnauthorized and ErrValidation with errors.Is.
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+	RequestID  string `xml:"RequestId"`
+}
+
+func (e *S3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("S3 request failed with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("S3 request failed with status %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func (e *S3Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrValidation:
+		return e.StatusCode == http.StatusBadRequest
+	}
+	return false
+}
+
+// ObjectClient returns a client for the objects of the storage. The storage
+// has to be fetched with its keys, e.g. with GetS3Storage. The client does not
+// share the HTTP client of the manager: its timeout would cut large transfers
+// and its TLS settings are those of the API.
+func (s3 *S3Storage) ObjectClient() *S3Client {
+	return &S3Client{
+		Endpoint:  s3.ClientEndpoint,
+		AccessKey: s3.AccessKey,
+		SecretKey: s3.SecretKey,
+	}
+}
+
+func (c *S3Client) signer() *sigV4Signer {
+	region := c.Region
+	if region == "" {
+		region = DefaultS3Region
+	}
+	return &sigV4Signer{accessKey: c.AccessKey, secretKey: c.SecretKey, region: region}
+}
+
+func (c *S3Client) objectURL(bucket string, key string, query url.Values) (*url.URL, error) {
+	if bucket == "" {
+		return nil, errors.New("Bucket name is required")
+	}
+	u, err := url.Parse(c.Endpoint)
+	if err != nil || u.Host == "" {
+		return nil, errors.Errorf("Invalid S3 endpoint %q", c.Endpoint)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	// The path is sent exactly as it is signed.
+	u.RawPath = canonicalURI(u)
+	u.RawQuery = canonicalQuery(query)
+	return u, nil
+}
+
+// do signs and sends the request. body is sent as is with an unsigned
+// payload when size is not negative, payload is hashed and sent otherwise.
+// The response body has to be closed by the caller when err is nil.
+func (c *S3Client) do(ctx context.Context, method string, u *url.URL, header http.Header, body io.Reader, size int64, payload []byte) (*http.Response, error) {
+	payloadHash := unsignedPayload
+	if body == nil {
+		payloadHash = emptySHA256
+		if len(payload) > 0 {
+			sum := sha256.Sum256(payload)
+			payloadHash = hex.EncodeToString(sum[:])
+		}
+		body = bytes.NewReader(payload)
+		size = int64(len(payload))
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	c.signer().sign(req, payloadHash, time.Now())
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		s3Err := &S3Error{StatusCode: resp.StatusCode}
+		if data, _ := io.ReadAll(resp.Body); len(data) > 0 {
+			xml.Unmarshal(data, s3Err)
+		}
+		return nil, s3Err
+	}
+	return resp, nil
+}
+
+// PutObject uploads the object from body. size is the length of body, -1
+// when unknown. Bodies larger than the part size, or of unknown size, are
+// uploaded in parallel parts.
+func (c *S3Client) PutObject(ctx context.Context, bucket string, key string, body io.Reader, size int64, opts S3PutOptions) (etag string, err error) {
+	if size < 0 || size > c.partSize() {
+		return c.putMultipart(ctx, bucket, key, body, opts)
+	}
+	u, err := c.objectURL(bucket, key, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.do(ctx, http.MethodPut, u, opts.header(), io.LimitReader(body, size), size, nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "Cannot put %s/%s", bucket, key)
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+func (o S3PutOptions) header() http.Header {
+	header := http.Header{}
+	if o.ContentType != "" {
+		header.Set("Content-Type", o.ContentType)
+	}
+	for name, value := range o.Metadata {
+		header.Set("X-Amz-Meta-"+name, value)
+	}
+	return header
+}
+
+// GetObject returns the content of the object, which has to be closed.
+func (c *S3Client) GetObject(ctx context.Context, bucket string, key string) (io.ReadCloser, *S3Object, error) {
+	u, err := c.objectURL(bucket, key, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := c.do(ctx, http.MethodGet, u, nil, nil, 0, nil)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Cannot get %s/%s", bucket, key)
+	}
+	return resp.Body, objectFromHeader(key, resp.Header), nil
+}
+
+func (c *S3Client) HeadObject(ctx context.Context, bucket string, key string) (*S3Object, error) {
+	u, err := c.objectURL(bucket, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(ctx, http.MethodHead, u, nil, nil, 0, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot head %s/%s", bucket, key)
+	}
+	resp.Body.Close()
+	return objectFromHeader(key, resp.Header), nil
+}
+
+func objectFromHeader(key string, header http.Header) *S3Object {
+	o := &S3Object{
+		Key:         key,
+		ETag:        header.Get("ETag"),
+		ContentType: header.Get("Content-Type"),
+		Metadata:    make(map[string]string),
+	}
+	o.Size, _ = strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	o.LastModified, _ = http.ParseTime(header.Get("Last-Modified"))
+	for name, values := range header {
+		if meta, ok := strings.CutPrefix(strings.ToLower(name), "x-amz-meta-"); ok && len(values) > 0 {
+			o.Metadata[meta] = values[0]
+		}
+	}
+	return o
+}
+
+// DeleteObject deletes the object. Deleting a missing object succeeds.
+func (c *S3Client) DeleteObject(ctx context.Context, bucket string, key string) error {
+	u, err := c.objectURL(bucket, key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodDelete, u, nil, nil, 0, nil)
+	if err != nil {
+		return errors.Wrapf(err, "Cannot delete %s/%s", bucket, key)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ListObjects returns the objects whose key starts with prefix, in key
+// order, reading as many pages as needed.
+func (c *S3Client) ListObjects(ctx context.Context, bucket string, prefix string) ([]S3Object, error) {
+	var page struct {
+		Contents []struct {
+			Key          string    `xml:"Key"`
+			Size         int64     `xml:"Size"`
+			ETag         string    `xml:"ETag"`
+			LastModified time.Time `xml:"LastModified"`
+		} `xml:"Contents"`
+		IsTruncated           bool   `xml:"IsTruncated"`
+		NextContinuationToken string `xml:"NextContinuationToken"`
+	}
+
+	var objects []S3Object
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u, err := c.objectURL(bucket, "", query)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.do(ctx, http.MethodGet, u, nil, nil, 0, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Cannot list %s", bucket)
+		}
+		page.Contents = nil
+		page.NextContinuationToken = ""
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Cannot decode listing of %s", bucket)
+		}
+		for _, item := range page.Contents {
+			objects = append(objects, S3Object{Key: item.Key, Size: item.Size, ETag: item.ETag, LastModified: item.LastModified})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// PresignGetObject returns a URL anyone can download the object with until
+// it expires, at most 7 days later.
+func (c *S3Client) PresignGetObject(bucket string, key string, expires time.Duration) (string, error) {
+	return c.presign(http.MethodGet, bucket, key, expires)
+}
+
+// PresignPutObject returns a URL anyone can upload the object with until it
+// expires, at most 7 days later.
+func (c *S3Client) PresignPutObject(bucket string, key string, expires time.Duration) (string, error) {
+	return c.presign(http.MethodPut, bucket, key, expires)
+}
+
+func (c *S3Client) presign(method string, bucket string, key string, expires time.Duration) (string, error) {
+	if expires < time.Second || expires > 7*24*time.Hour {
+		return "", errors.Errorf("Presigned URLs expire within 1 second and 7 days, got %s", expires)
+	}
+	u, err := c.objectURL(bucket, key, nil)
+	if err != nil {
+		return "", err
+	}
+	return c.signer().presign(method, u, expires, time.Now()), nil
+}
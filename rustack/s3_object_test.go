@@ -0,0 +1,287 @@
+package rustack_test
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+	"github.com/rustack-cloud-platform/rcp-go/rustacktest"
+)
+
+type fakeObject struct {
+	data   []byte
+	header http.Header
+}
+
+// fakeBucket is an S3 endpoint serving the objects of a single bucket,
+// listed pageSize keys at a time.
+type fakeBucket struct {
+	mu       sync.Mutex
+	pageSize int
+	objects  map[string]*fakeObject
+	// lengths are the Content-Length of the uploads, tokens the continuation
+	// tokens of the listings.
+	lengths []int64
+	tokens  []string
+}
+
+func newFakeBucket(pageSize int) *fakeBucket {
+	return &fakeBucket{pageSize: pageSize, objects: make(map[string]*fakeObject)}
+}
+
+func (f *fakeBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != "bucket" {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "<Error><Code>NoSuchBucket</Code></Error>")
+		return
+	}
+	if key == "" && r.Method == http.MethodGet {
+		f.list(w, r.URL.Query())
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.lengths = append(f.lengths, r.ContentLength)
+		header := http.Header{}
+		header.Set("Content-Type", r.Header.Get("Content-Type"))
+		for name, values := range r.Header {
+			if strings.HasPrefix(name, "X-Amz-Meta-") {
+				header[name] = values
+			}
+		}
+		header.Set("ETag", fmt.Sprintf(`"etag-%d"`, len(data)))
+		header.Set("Last-Modified", "Mon, 02 Jan 2023 15:04:05 GMT")
+		f.objects[key] = &fakeObject{data: data, header: header}
+		w.Header().Set("ETag", header.Get("ETag"))
+	case http.MethodGet, http.MethodHead:
+		o := f.objects[key]
+		if o == nil {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>")
+			return
+		}
+		for name, values := range o.header {
+			w.Header()[name] = values
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(o.data)))
+		if r.Method == http.MethodGet {
+			w.Write(o.data)
+		}
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (f *fakeBucket) list(w http.ResponseWriter, query url.Values) {
+	if query.Get("list-type") != "2" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, query.Get("prefix")) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	token := query.Get("continuation-token")
+	f.tokens = append(f.tokens, token)
+	start := 0
+	if token != "" {
+		start, _ = strconv.Atoi(strings.TrimPrefix(token, "token-"))
+	}
+	end := start + f.pageSize
+	if end > len(keys) {
+		end = len(keys)
+	}
+
+	type content struct {
+		Key          string
+		Size         int
+		ETag         string
+		LastModified string
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []content
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+	}{IsTruncated: end < len(keys)}
+	for _, key := range keys[start:end] {
+		o := f.objects[key]
+		result.Contents = append(result.Contents, content{Key: key, Size: len(o.data), ETag: o.header.Get("ETag"), LastModified: "2023-01-02T15:04:05.000Z"})
+	}
+	if result.IsTruncated {
+		result.NextContinuationToken = fmt.Sprintf("token-%d", end)
+	}
+	xml.NewEncoder(w).Encode(result)
+}
+
+func TestS3Objects(t *testing.T) {
+	fake := newFakeBucket(2)
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	c := &rustack.S3Client{Endpoint: srv.URL, AccessKey: "access", SecretKey: "secret"}
+	ctx := context.Background()
+
+	// A single request sends size bytes of the body, however long it is.
+	etag, err := c.PutObject(ctx, "bucket", "docs/readme.txt", strings.NewReader("hello world"), 5, rustack.S3PutOptions{
+		ContentType: "text/plain",
+		Metadata:    map[string]string{"Owner": "shop", "build": "42"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if etag != `"etag-5"` || string(fake.objects["docs/readme.txt"].data) != "hello" {
+		t.Fatalf("put etag %s, data %q", etag, fake.objects["docs/readme.txt"].data)
+	}
+	for _, key := range []string{"docs/b", "docs/a", "images/logo.png", "docs/c"} {
+		if _, err := c.PutObject(ctx, "bucket", key, strings.NewReader(""), 0, rustack.S3PutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(fake.lengths, []int64{5, 0, 0, 0, 0}) {
+		t.Fatalf("content lengths %v", fake.lengths)
+	}
+
+	body, object, err := c.GetObject(ctx, "bucket", "docs/readme.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "hello" || object.Size != 5 || object.ContentType != "text/plain" || object.ETag != `"etag-5"` {
+		t.Fatalf("got %q, %+v", data, object)
+	}
+
+	head, err := c.HeadObject(ctx, "bucket", "docs/readme.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC)
+	if head.Key != "docs/readme.txt" || head.Size != 5 || !head.LastModified.Equal(modified) {
+		t.Fatalf("head %+v", head)
+	}
+	if want := map[string]string{"owner": "shop", "build": "42"}; !reflect.DeepEqual(head.Metadata, want) {
+		t.Fatalf("metadata %v, want %v", head.Metadata, want)
+	}
+
+	// Listings follow the continuation tokens.
+	objects, err := c.ListObjects(ctx, "bucket", "docs/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, o := range objects {
+		keys = append(keys, o.Key)
+	}
+	if want := []string{"docs/a", "docs/b", "docs/c", "docs/readme.txt"}; !reflect.DeepEqual(keys, want) {
+		t.Fatalf("listed %v, want %v", keys, want)
+	}
+	if !reflect.DeepEqual(fake.tokens, []string{"", "token-2"}) {
+		t.Fatalf("continuation tokens %v", fake.tokens)
+	}
+	if objects[3].Size != 5 || objects[3].ETag != `"etag-5"` || !objects[3].LastModified.Equal(modified) {
+		t.Fatalf("listed %+v", objects[3])
+	}
+	fake.tokens = nil
+	if objects, err := c.ListObjects(ctx, "bucket", "images/"); err != nil || len(objects) != 1 || len(fake.tokens) != 1 {
+		t.Fatalf("listed %v, %v with tokens %v", objects, err, fake.tokens)
+	}
+
+	if err := c.DeleteObject(ctx, "bucket", "docs/readme.txt"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.HeadObject(ctx, "bucket", "docs/readme.txt")
+	if !errors.Is(err, rustack.ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound after the delete", err)
+	}
+	var s3Err *rustack.S3Error
+	if _, _, err := c.GetObject(ctx, "bucket", "docs/readme.txt"); !errors.As(err, &s3Err) || s3Err.Code != "NoSuchKey" {
+		t.Fatalf("got %v, want NoSuchKey", err)
+	}
+	if _, err := c.ListObjects(ctx, "other", ""); !errors.Is(err, rustack.ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound for a missing bucket", err)
+	}
+	unsigned := &rustack.S3Client{Endpoint: srv.URL}
+	if err := unsigned.DeleteObject(ctx, "bucket", "docs/a"); !errors.Is(err, rustack.ErrUnauthorized) {
+		t.Fatalf("got %v, want ErrUnauthorized without keys", err)
+	}
+}
+
+func TestPresign(t *testing.T) {
+	c := &rustack.S3Client{Endpoint: "https://s3.example.com", AccessKey: "access", SecretKey: "secret"}
+	tests := []struct {
+		expires time.Duration
+		valid   bool
+	}{
+		{0, false},
+		{500 * time.Millisecond, false},
+		{time.Second, true},
+		{time.Hour, true},
+		{7 * 24 * time.Hour, true},
+		{7*24*time.Hour + time.Second, false},
+	}
+	for _, tt := range tests {
+		presigned, err := c.PresignGetObject("bucket", "docs/readme.txt", tt.expires)
+		if (err == nil) != tt.valid {
+			t.Errorf("expiring in %s: got %v", tt.expires, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		u, err := url.Parse(presigned)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Path != "/bucket/docs/readme.txt" || u.Query().Get("X-Amz-Expires") != strconv.Itoa(int(tt.expires.Seconds())) {
+			t.Errorf("expiring in %s: got %s", tt.expires, presigned)
+		}
+	}
+	if _, err := c.PresignPutObject("bucket", "docs/readme.txt", 8*24*time.Hour); err == nil {
+		t.Error("presigned upload expiring in 8 days")
+	}
+}
+
+func TestObjectClient(t *testing.T) {
+	s := rustacktest.NewServer()
+	defer s.Close()
+	m := s.Manager()
+	m.Client = &http.Client{Timeout: time.Second}
+	seeded := s.Seed("s3_storage", map[string]interface{}{"name": "files"})
+	storage, err := m.GetS3Storage(seeded["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The API timeout would cut large transfers.
+	c := storage.ObjectClient()
+	if c.Client != nil || c.Endpoint != storage.ClientEndpoint || c.AccessKey != storage.AccessKey || c.SecretKey != storage.SecretKey {
+		t.Fatalf("got %+v", c)
+	}
+}
@@ -15,6 +15,7 @@ type SubnetRoute struct {
 }
 
 type Subnet struct {
+	jobList
 	manager *Manager
 	ID      string `json:"id"`
 	CIDR    string `json:"cidr"`
@@ -51,7 +52,7 @@ func NewSubnetRoute(cidr string, gateway string, metric int) SubnetRoute {
 
 func (s *Subnet) Delete() error {
 	path := fmt.Sprintf("v1/network/%s/subnet/%s", s.network.ID, s.ID)
-	return s.manager.Delete(path, Defaults(), nil)
+	return s.manager.deleteResource(path, s)
 }
 
 func (s *Subnet) update() error {
@@ -1,5 +1,12 @@
 package rustack
 
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
 type Tag struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
@@ -12,3 +19,164 @@ func convertTagsToNames(tags []Tag) []string {
 	}
 	return tagNames
 }
+
+// Taggable is implemented by the resources carrying tags. Its methods change
+// only the tags of the resource, leaving the other fields as they are on the
+// server, and refresh the resource from the response.
+type Taggable interface {
+	// TagNames returns the names of the current tags.
+	TagNames() []string
+	// SetTags replaces all tags.
+	SetTags(tags ...string) error
+	// AddTags adds the tags not carried yet.
+	AddTags(tags ...string) error
+	// RemoveTags removes the tags, ignoring the ones not carried.
+	RemoveTags(tags ...string) error
+}
+
+// tagged is implemented by the Taggable resources, their tags are patched
+// at tagPath.
+type tagged interface {
+	TagNames() []string
+	tagPath() string
+}
+
+// setTags replaces the tags of the resource once it is unlocked, and
+// refreshes it from the response.
+func (m *Manager) setTags(r tagged, tags []string) error {
+	for _, tag := range tags {
+		if tag == "" {
+			return errors.New("Tag cannot be empty")
+		}
+	}
+	path := r.tagPath()
+	if err := loopWaitLock(m, path); err != nil {
+		return err
+	}
+	args := &struct {
+		Tags []string `json:"tags"`
+	}{
+		Tags: mergeTags(nil, tags),
+	}
+	return m.Request("PATCH", path, args, r)
+}
+
+func (m *Manager) addTags(r tagged, tags []string) error {
+	return m.setTags(r, mergeTags(r.TagNames(), tags))
+}
+
+func (m *Manager) removeTags(r tagged, tags []string) error {
+	return m.setTags(r, withoutTags(r.TagNames(), tags))
+}
+
+// mergeTags returns current with the tags not in it appended. The result is
+// never nil, so that it is sent as an empty list.
+func mergeTags(current []string, tags []string) []string {
+	merged := make([]string, 0, len(current)+len(tags))
+	for _, tag := range append(current, tags...) {
+		if !contains(merged, tag) {
+			merged = append(merged, tag)
+		}
+	}
+	return merged
+}
+
+func withoutTags(current []string, tags []string) []string {
+	kept := make([]string, 0, len(current))
+	for _, tag := range current {
+		if !contains(tags, tag) {
+			kept = append(kept, tag)
+		}
+	}
+	return kept
+}
+
+// TagChange is applied by RetagResources. When Set is not nil it replaces the
+// current tags, then Add are added and Remove removed.
+type TagChange struct {
+	Set    []string
+	Add    []string
+	Remove []string
+}
+
+// Apply returns the tags resulting from the change on current.
+func (c TagChange) Apply(current []string) []string {
+	if c.Set != nil {
+		current = c.Set
+	}
+	return withoutTags(mergeTags(current, c.Add), c.Remove)
+}
+
+type RetagOutcome struct {
+	Resource Taggable
+	// Changed is false when the resource already had the resulting tags and
+	// was not updated.
+	Changed bool
+	Err     error
+}
+
+// RetagResources applies the change to every resource, with one request per
+// resource and up to parallelism requests at once, 1 when zero. Outcomes are
+// returned in the order of resources, the error counts the failures.
+func (m *Manager) RetagResources(ctx context.Context, resources []Taggable, change TagChange, parallelism int) ([]RetagOutcome, error) {
+	for _, tag := range append(append(append([]string{}, change.Set...), change.Add...), change.Remove...) {
+		if tag == "" {
+			return nil, errors.New("Tag cannot be empty")
+		}
+	}
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+
+	outcomes := make([]RetagOutcome, len(resources))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, r := range resources {
+		outcomes[i].Resource = r
+		if err := ctx.Err(); err != nil {
+			outcomes[i].Err = err
+			continue
+		}
+		current := r.TagNames()
+		tags := change.Apply(current)
+		if sameTags(current, tags) {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, r Taggable) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			outcomes[i].Changed = true
+			outcomes[i].Err = r.SetTags(tags...)
+		}(i, r)
+	}
+	wg.Wait()
+
+	failed := 0
+	var first error
+	for _, o := range outcomes {
+		if o.Err != nil {
+			if first == nil {
+				first = o.Err
+			}
+			failed++
+		}
+	}
+	if failed > 0 {
+		return outcomes, errors.Errorf("Cannot retag %d of %d resources, first error: %s", failed, len(resources), first)
+	}
+	return outcomes, nil
+}
+
+func sameTags(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, tag := range a {
+		if !contains(b, tag) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,134 @@
+package rustack
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// TaggedResource is a resource found by FindByTags.
+type TaggedResource struct {
+	Kind ResourceKind `json:"kind"`
+	ID   string       `json:"id"`
+	Name string       `json:"name"`
+	Tags []string     `json:"tags"`
+	// Object is the resource itself, e.g. a *Vm for KindVm.
+	Object interface{} `json:"-"`
+}
+
+// taggedKinds are the kinds searched by FindByTags, in result order.
+var taggedKinds = []ResourceKind{
+	KindVm, KindDisk, KindNetwork, KindRouter, KindPort,
+	KindLoadBalancer, KindDns, KindS3Storage, KindKubernetes,
+}
+
+// FindByTags returns the resources carrying all the tags, of the given kinds
+// or of every kind supporting tags when none is given. Results are grouped by
+// kind, in the order of the kinds argument. Kinds are searched concurrently.
+func (m *Manager) FindByTags(ctx context.Context, tags []string, kinds ...ResourceKind) ([]TaggedResource, error) {
+	if len(tags) == 0 {
+		return nil, errors.New("At least one tag is required")
+	}
+	args := Defaults()
+	if err := setTagsArg(args, tags); err != nil {
+		return nil, err
+	}
+	if len(kinds) == 0 {
+		kinds = taggedKinds
+	}
+	for _, kind := range kinds {
+		if !containsKind(taggedKinds, kind) {
+			return nil, errors.Errorf("Cannot search %s by tags", kind)
+		}
+	}
+
+	results := make([][]TaggedResource, len(kinds))
+	errs := make([]error, len(kinds))
+	var wg sync.WaitGroup
+	for i, kind := range kinds {
+		wg.Add(1)
+		go func(i int, kind ResourceKind) {
+			defer wg.Done()
+			results[i], errs[i] = m.findByTags(ctx, kind, args, tags)
+			errs[i] = errors.Wrapf(errs[i], "Cannot search %s", kind)
+		}(i, kind)
+	}
+	wg.Wait()
+
+	var found []TaggedResource
+	for i := range kinds {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		found = append(found, results[i]...)
+	}
+	return found, nil
+}
+
+func (m *Manager) findByTags(ctx context.Context, kind ResourceKind, args Arguments, tags []string) ([]TaggedResource, error) {
+	switch kind {
+	case KindVm:
+		return collectTagged(kind, m.IterVms(ctx, args), tags, func(v *Vm) (string, string, []Tag) { return v.ID, v.Name, v.Tags })
+	case KindDisk:
+		return collectTagged(kind, m.IterDisks(ctx, args), tags, func(d *Disk) (string, string, []Tag) { return d.ID, d.Name, d.Tags })
+	case KindNetwork:
+		return collectTagged(kind, m.IterNetworks(ctx, args), tags, func(n *Network) (string, string, []Tag) { return n.ID, n.Name, n.Tags })
+	case KindRouter:
+		return collectTagged(kind, m.IterRouters(ctx, args), tags, func(r *Router) (string, string, []Tag) { return r.ID, r.Name, r.Tags })
+	case KindPort:
+		return collectTagged(kind, m.IterPorts(ctx, args), tags, func(p *Port) (string, string, []Tag) {
+			name := ""
+			if p.IpAddress != nil {
+				name = *p.IpAddress
+			}
+			return p.ID, name, p.Tags
+		})
+	case KindLoadBalancer:
+		return collectTagged(kind, m.IterLoadBalancers(ctx, args), tags, func(lb *LoadBalancer) (string, string, []Tag) { return lb.ID, lb.Name, lb.Tags })
+	case KindDns:
+		return collectTagged(kind, m.IterDnss(ctx, args), tags, func(d *Dns) (string, string, []Tag) { return d.ID, d.Name, d.Tags })
+	case KindS3Storage:
+		return collectTagged(kind, m.IterS3Storages(ctx, args), tags, func(s3 *S3Storage) (string, string, []Tag) { return s3.ID, s3.Name, s3.Tags })
+	case KindKubernetes:
+		return collectTagged(kind, m.IterKubernetes(ctx, args), tags, func(k *Kubernetes) (string, string, []Tag) { return k.ID, k.Name, k.Tags })
+	}
+	return nil, errors.Errorf("Cannot search %s by tags", kind)
+}
+
+// collectTagged reads the iterator and keeps the items carrying all tags, as
+// the API may match any of them.
+func collectTagged[T any](kind ResourceKind, it *Iterator[T], tags []string, describe func(T) (string, string, []Tag)) ([]TaggedResource, error) {
+	items, err := it.Collect()
+	if err != nil {
+		return nil, err
+	}
+	var found []TaggedResource
+	for _, item := range items {
+		id, name, itemTags := describe(item)
+		names := convertTagsToNames(itemTags)
+		if !hasTags(names, tags) {
+			continue
+		}
+		found = append(found, TaggedResource{Kind: kind, ID: id, Name: name, Tags: names, Object: item})
+	}
+	return found, nil
+}
+
+func hasTags(names []string, tags []string) bool {
+	for _, tag := range tags {
+		if !contains(names, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsKind(kinds []ResourceKind, kind ResourceKind) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
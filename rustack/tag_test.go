@@ -0,0 +1,150 @@
+package rustack_test
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+	"github.com/rustack-cloud-platform/rcp-go/rustacktest"
+)
+
+func TestRetagResources(t *testing.T) {
+	s := rustacktest.NewServer()
+	defer s.Close()
+	m := s.Manager()
+
+	tests := []struct {
+		name    string
+		tags    []string
+		fault   bool
+		changed bool
+		failed  bool
+		want    []string
+	}{
+		{name: "add and remove", tags: []string{"old", "web"}, changed: true, want: []string{"web", "prod"}},
+		{name: "unchanged", tags: []string{"web", "prod"}, want: []string{"web", "prod"}},
+		{name: "untagged", changed: true, want: []string{"prod"}},
+		{name: "failed", tags: []string{"old"}, fault: true, changed: true, failed: true, want: []string{"old"}},
+	}
+	var resources []rustack.Taggable
+	for _, tt := range tests {
+		tags := []interface{}{}
+		for _, tag := range tt.tags {
+			tags = append(tags, map[string]interface{}{"id": tag, "name": tag})
+		}
+		seeded := s.Seed("vdc", map[string]interface{}{"name": tt.name, "tags": tags})
+		vdc, err := m.GetVdc(seeded["id"].(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.fault {
+			s.InjectFault(rustacktest.Fault{Method: http.MethodPatch, Path: "v1/vdc/" + vdc.ID, Status: http.StatusBadRequest})
+		}
+		resources = append(resources, vdc)
+	}
+
+	before := len(s.Requests())
+	outcomes, err := m.RetagResources(context.Background(), resources, rustack.TagChange{Add: []string{"prod"}, Remove: []string{"old"}}, 2)
+	if err == nil {
+		t.Fatal("expected the failure to be reported")
+	}
+	for i, tt := range tests {
+		o := outcomes[i]
+		if o.Resource != resources[i] || o.Changed != tt.changed || (o.Err != nil) != tt.failed {
+			t.Errorf("%s: got changed %v, error %v", tt.name, o.Changed, o.Err)
+		}
+		if got := o.Resource.TagNames(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: tags %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Tags are only patched once the resource is unlocked.
+	last := map[string]string{}
+	for _, r := range s.Requests()[before:] {
+		if r.Method == http.MethodPatch && last[r.Path] != http.MethodGet {
+			t.Fatalf("%s patched without waiting for the lock", r.Path)
+		}
+		last[r.Path] = r.Method
+	}
+
+	if _, err := m.RetagResources(context.Background(), resources, rustack.TagChange{Add: []string{""}}, 1); err == nil {
+		t.Fatal("expected empty tags to be rejected")
+	}
+}
+
+func TestFindByTags(t *testing.T) {
+	s := rustacktest.NewServer()
+	defer s.Close()
+	m := s.Manager()
+
+	project := s.Seed("project", map[string]interface{}{"name": "shop"})
+	vdc := s.Seed("vdc", map[string]interface{}{"name": "prod", "project": project["id"]})
+	both := []interface{}{"web", "prod"}
+	s.Seed("vm", map[string]interface{}{"name": "web", "vdc": vdc["id"], "tags": both})
+	s.Seed("vm", map[string]interface{}{"name": "dev", "vdc": vdc["id"], "tags": []interface{}{"web"}})
+	s.Seed("disk", map[string]interface{}{"name": "data", "vdc": vdc["id"], "tags": []interface{}{"prod", "web", "ssd"}})
+	s.Seed("network", map[string]interface{}{"name": "backend", "vdc": vdc["id"], "tags": []interface{}{"prod"}})
+	s.Seed("dns", map[string]interface{}{"name": "shop.example.", "project": project["id"], "tags": both})
+
+	found := func(resources []rustack.TaggedResource) (got []string) {
+		for _, r := range resources {
+			got = append(got, string(r.Kind)+" "+r.Name)
+		}
+		return
+	}
+	tests := []struct {
+		name  string
+		tags  []string
+		kinds []rustack.ResourceKind
+		want  []string
+	}{
+		{name: "every kind", tags: []string{"web", "prod"}, want: []string{"vm web", "disk data", "dns shop.example."}},
+		{name: "one tag", tags: []string{"prod"}, want: []string{"vm web", "disk data", "network backend", "dns shop.example."}},
+		{name: "kind order", tags: []string{"web", "prod"}, kinds: []rustack.ResourceKind{rustack.KindDns, rustack.KindVm}, want: []string{"dns shop.example.", "vm web"}},
+		{name: "none", tags: []string{"web", "stage"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resources, err := m.FindByTags(context.Background(), tt.tags, tt.kinds...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := found(resources); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("found %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Resources matching only some of the tags are dropped, should the API
+	// return them.
+	network := s.Objects("network")[0]
+	s.InjectFault(rustacktest.Fault{Method: http.MethodGet, Path: "v1/network", Status: http.StatusOK, Times: 1,
+		Body: map[string]interface{}{"total": 1, "limit": 1, "items": []interface{}{network}}})
+	if resources, err := m.FindByTags(context.Background(), []string{"web", "prod"}, rustack.KindNetwork); err != nil || len(resources) != 0 {
+		t.Fatalf("found %v, %v", found(resources), err)
+	}
+	if resources, _ := m.FindByTags(context.Background(), []string{"prod"}, rustack.KindVm); resources[0].Object.(*rustack.Vm).Name != "web" {
+		t.Fatalf("found %+v", resources[0])
+	}
+
+	for _, tt := range []struct {
+		tags  []string
+		kinds []rustack.ResourceKind
+	}{
+		{tags: nil},
+		{tags: []string{"a,b"}},
+		{tags: []string{"web"}, kinds: []rustack.ResourceKind{rustack.KindVdc}},
+	} {
+		if _, err := m.FindByTags(context.Background(), tt.tags, tt.kinds...); err == nil {
+			t.Errorf("searching %v of %v succeeded", tt.tags, tt.kinds)
+		}
+	}
+	s.InjectFault(rustacktest.Fault{Method: http.MethodGet, Path: "v1/disk", Status: http.StatusInternalServerError})
+	m.RetryPolicy = nil
+	if _, err := m.FindByTags(context.Background(), []string{"web"}); err == nil || !strings.Contains(err.Error(), "Cannot search disk") {
+		t.Fatalf("got %v, want the disk search to fail", err)
+	}
+}
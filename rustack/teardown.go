@@ -0,0 +1,222 @@
+package rustack
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+type DeleteStatus string
+
+const (
+	// DeletePlanned resources would be deleted by a dry run.
+	DeletePlanned DeleteStatus = "planned"
+	DeleteDone    DeleteStatus = "deleted"
+	DeleteFailed  DeleteStatus = "failed"
+	// DeleteSkipped resources were not deleted because a resource
+	// referencing them could not be, or because the context was done.
+	DeleteSkipped DeleteStatus = "skipped"
+)
+
+type DeleteOptions struct {
+	// DryRun lists what would be deleted, in order, without deleting.
+	DryRun bool
+	// Parallelism is the number of independent resources deleted at once,
+	// 1 when zero.
+	Parallelism int
+	// OnOutcome is called for every resource once it is handled. Calls come
+	// from a single goroutine.
+	OnOutcome func(DeleteOutcome)
+}
+
+type DeleteOutcome struct {
+	Resource *Resource
+	Status   DeleteStatus
+	Err      error
+}
+
+func (o DeleteOutcome) MarshalJSON() ([]byte, error) {
+	out := struct {
+		*Resource
+		Status DeleteStatus `json:"status"`
+		Error  string       `json:"error,omitempty"`
+	}{Resource: o.Resource, Status: o.Status}
+	if o.Err != nil {
+		out.Error = o.Err.Error()
+	}
+	return json.Marshal(out)
+}
+
+// DeleteResult lists the outcome of every resource of the graph, in the
+// order they were handled.
+type DeleteResult struct {
+	Outcomes []DeleteOutcome
+}
+
+// Failed returns the outcomes of the resources that could not be deleted.
+func (r *DeleteResult) Failed() []DeleteOutcome {
+	var failed []DeleteOutcome
+	for _, o := range r.Outcomes {
+		if o.Status == DeleteFailed {
+			failed = append(failed, o)
+		}
+	}
+	return failed
+}
+
+// DeleteRecursive deletes the VDC with everything in it. Resources are
+// deleted after the resources referencing them: Kubernetes clusters and load
+// balancers first, then VMs, routers, ports, disks and networks, and the VDC
+// last. Data disks are detached from their VM before they are deleted, ports
+// still connected to the default router are force deleted. Locked resources
+// are waited for.
+//
+// A failure does not stop the teardown, but the resources the failed one
+// references are skipped. The returned error counts the failures, the result
+// tells which resources failed and why.
+func (v *Vdc) DeleteRecursive(ctx context.Context, opts DeleteOptions) (*DeleteResult, error) {
+	g, err := v.DependencyGraph()
+	if err != nil {
+		return nil, err
+	}
+	return g.Delete(ctx, opts)
+}
+
+// DeleteRecursive deletes the project, its VDCs with everything in them, its
+// DNS zones, S3 storages and certificates. See Vdc.DeleteRecursive.
+func (p *Project) DeleteRecursive(ctx context.Context, opts DeleteOptions) (*DeleteResult, error) {
+	g, err := p.DependencyGraph()
+	if err != nil {
+		return nil, err
+	}
+	return g.Delete(ctx, opts)
+}
+
+// Delete deletes the resources of the graph in DeleteOrder.
+func (g *DependencyGraph) Delete(ctx context.Context, opts DeleteOptions) (*DeleteResult, error) {
+	batches, err := g.DeleteOrder()
+	if err != nil {
+		return nil, err
+	}
+	parallelism := opts.Parallelism
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+
+	result := &DeleteResult{}
+	status := make(map[*Resource]DeleteStatus, len(g.Resources))
+	record := func(o DeleteOutcome) {
+		status[o.Resource] = o.Status
+		result.Outcomes = append(result.Outcomes, o)
+		if opts.OnOutcome != nil {
+			opts.OnOutcome(o)
+		}
+	}
+
+	for _, batch := range batches {
+		var todo []*Resource
+		for _, r := range batch {
+			if opts.DryRun {
+				record(DeleteOutcome{Resource: r, Status: DeletePlanned})
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				record(DeleteOutcome{Resource: r, Status: DeleteSkipped, Err: err})
+				continue
+			}
+			if blocker := blockingDependent(r, status); blocker != nil {
+				err := errors.Errorf("%s %s was not deleted", blocker.Kind, blocker.ID)
+				record(DeleteOutcome{Resource: r, Status: DeleteSkipped, Err: err})
+				continue
+			}
+			todo = append(todo, r)
+		}
+
+		outcomes := make([]DeleteOutcome, len(todo))
+		sem := make(chan struct{}, parallelism)
+		var wg sync.WaitGroup
+		for i, r := range todo {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, r *Resource) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				outcomes[i] = DeleteOutcome{Resource: r, Status: DeleteDone}
+				if err := g.deleteResource(r); err != nil {
+					outcomes[i] = DeleteOutcome{Resource: r, Status: DeleteFailed, Err: errors.Wrapf(err, "Cannot delete %s %s", r.Kind, r.ID)}
+				}
+			}(i, r)
+		}
+		wg.Wait()
+		for _, o := range outcomes {
+			record(o)
+		}
+	}
+
+	if failed := result.Failed(); len(failed) > 0 {
+		return result, errors.Errorf("Cannot delete %d of %d resources, first error: %s", len(failed), len(g.Resources), failed[0].Err)
+	}
+	if err := ctx.Err(); err != nil && !opts.DryRun {
+		return result, err
+	}
+	return result, nil
+}
+
+func blockingDependent(r *Resource, status map[*Resource]DeleteStatus) *Resource {
+	for _, d := range r.Dependents {
+		if status[d] != DeleteDone {
+			return d
+		}
+	}
+	return nil
+}
+
+func (g *DependencyGraph) deleteResource(r *Resource) error {
+	if r.Locked {
+		if l, ok := r.Object.(interface{ WaitLock() error }); ok {
+			if err := l.WaitLock(); err != nil {
+				return err
+			}
+		}
+	}
+
+	var err error
+	switch obj := r.Object.(type) {
+	case *Disk:
+		if obj.Vm != nil {
+			vm := &Vm{manager: obj.manager, ID: obj.Vm.ID}
+			if err := vm.DetachDisk(obj); err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+		}
+		err = obj.Delete()
+	case *Port:
+		// Ports of resources kept, such as the default router, cannot be
+		// deleted while connected.
+		if obj.Connected != nil && g.connectedResource(obj) == nil {
+			err = obj.ForceDelete()
+		} else {
+			err = obj.Delete()
+		}
+	case interface{ Delete() error }:
+		err = obj.Delete()
+	default:
+		return errors.Errorf("Cannot delete %s", r.Kind)
+	}
+	// Ports and disks may be removed together with their owner.
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (g *DependencyGraph) connectedResource(port *Port) *Resource {
+	for _, kind := range []ResourceKind{KindVm, KindRouter, KindLoadBalancer} {
+		if r := g.Get(kind, port.Connected.ID); r != nil {
+			return r
+		}
+	}
+	return nil
+}
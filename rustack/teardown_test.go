@@ -0,0 +1,103 @@
+package rustack_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+	"github.com/rustack-cloud-platform/rcp-go/rustacktest"
+)
+
+func TestDeleteRecursive(t *testing.T) {
+	s := rustacktest.NewServer()
+	defer s.Close()
+	// Resources still in use cannot be deleted, as with the real API.
+	s.StrictDeletes = true
+	m := s.Manager()
+
+	project := s.Seed("project", map[string]interface{}{"name": "shop"})
+	seeded := s.Seed("vdc", map[string]interface{}{"name": "prod", "project": project["id"]})
+	vdcID := seeded["id"].(string)
+	network := s.Seed("network", map[string]interface{}{"name": "backend", "vdc": vdcID})
+	vm := s.Seed("vm", map[string]interface{}{
+		"name": "web", "vdc": vdcID,
+		"disks": []interface{}{
+			map[string]interface{}{"name": "root", "size": 10},
+			map[string]interface{}{"name": "data", "size": 50},
+		},
+	})
+	s.Seed("port", map[string]interface{}{"vdc": vdcID, "network": network["id"], "vm": vm["id"]})
+	lb := s.Seed("lbaas", map[string]interface{}{
+		"name": "front", "vdc": vdcID,
+		"port": map[string]interface{}{"vdc": vdcID, "network": network["id"]},
+	})
+	s.Seed("lbaas/"+lb["id"].(string)+"/pool", map[string]interface{}{
+		"port": 80, "protocol": "TCP", "method": "ROUND_ROBIN",
+		"members": []interface{}{map[string]interface{}{"id": "member", "vm": vm, "port": 8080, "weight": 50}},
+	})
+	var dataID string
+	for _, disk := range s.Objects("disk") {
+		if disk["name"] == "data" {
+			dataID = disk["id"].(string)
+		}
+	}
+
+	vdc, err := m.GetVdc(vdcID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := len(s.Requests())
+	result, err := vdc.DeleteRecursive(context.Background(), rustack.DeleteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The root disk goes with its VM, the LB port with the LB.
+	deleted := map[rustack.ResourceKind]int{}
+	for _, o := range result.Outcomes {
+		if o.Status != rustack.DeleteDone {
+			t.Errorf("%s %s %s: %v", o.Resource.Kind, o.Resource.ID, o.Status, o.Err)
+		}
+		deleted[o.Resource.Kind]++
+	}
+	want := map[rustack.ResourceKind]int{
+		rustack.KindVdc: 1, rustack.KindNetwork: 1, rustack.KindPort: 2, rustack.KindVm: 1,
+		rustack.KindDisk: 1, rustack.KindLoadBalancer: 1,
+	}
+	for kind, n := range want {
+		if deleted[kind] != n {
+			t.Errorf("deleted %d %s, want %d", deleted[kind], kind, n)
+		}
+	}
+	for _, collection := range []string{"vdc", "network", "port", "vm", "disk", "lbaas"} {
+		if left := s.Objects(collection); len(left) != 0 {
+			t.Errorf("%d %s left", len(left), collection)
+		}
+	}
+
+	// The data disk is detached before it is deleted, the VM deleted after
+	// the disk and the load balancer using it.
+	index := map[string]int{}
+	for i, r := range requestsSince(s, before) {
+		if _, ok := index[r]; !ok {
+			index[r] = i
+		}
+	}
+	order := []string{
+		"POST v1/disk/" + dataID + "/detach",
+		"DELETE v1/disk/" + dataID,
+		"DELETE v1/vm/" + vm["id"].(string),
+		"DELETE v1/network/" + network["id"].(string),
+		"DELETE v1/vdc/" + vdcID,
+	}
+	for i, r := range order {
+		if _, ok := index[r]; !ok {
+			t.Fatalf("no %s in %v", r, requestsSince(s, before))
+		}
+		if i > 0 && index[r] < index[order[i-1]] {
+			t.Fatalf("%s before %s", r, order[i-1])
+		}
+	}
+	if index["DELETE v1/lbaas/"+lb["id"].(string)] > index[order[2]] {
+		t.Fatal("vm deleted before the load balancer using it")
+	}
+}
@@ -1,10 +1,12 @@
 package rustack
 
 import (
+	"context"
 	"net/url"
 )
 
 type Vdc struct {
+	jobList
 	manager    *Manager
 	ID         string     `json:"id"`
 	Name       string     `json:"name"`
@@ -35,6 +37,12 @@ func (m *Manager) GetVdcs(extraArgs ...Arguments) (vdcs []*Vdc, err error) {
 	return
 }
 
+func (m *Manager) IterVdcs(ctx context.Context, args Arguments, opts ...IterOption) *Iterator[*Vdc] {
+	return NewIterator(ctx, m, "v1/vdc", args, func(vdc *Vdc) {
+		vdc.manager = m
+	}, opts...)
+}
+
 func (v *Vdc) GetVdcs(extraArgs ...Arguments) (vdcs []*Vdc, err error) {
 	args := Arguments{
 		"vdc": v.ID,
@@ -94,7 +102,7 @@ func (v *Vdc) Update() error {
 
 func (v *Vdc) Delete() error {
 	path, _ := url.JoinPath("v1/vdc", v.ID)
-	return v.manager.Delete(path, Defaults(), nil)
+	return v.manager.deleteResource(path, v)
 }
 
 func (v *Vdc) CreateNetwork(network *Network) error {
@@ -298,6 +306,7 @@ func (v *Vdc) CreateDisk(disk *Disk) error {
 		Vm             *string  `json:"vm,omitempty"`
 		Size           int      `json:"size"`
 		StorageProfile string   `json:"storage_profile"`
+		Snapshot       *string  `json:"snapshot,omitempty"`
 		Tags           []string `json:"tags"`
 	}{
 		Name:           disk.Name,
@@ -312,6 +321,9 @@ func (v *Vdc) CreateDisk(disk *Disk) error {
 		args.Vm = &disk.Vm.ID
 		args.Vdc = nil
 	}
+	if disk.Snapshot != nil {
+		args.Snapshot = &disk.Snapshot.ID
+	}
 
 	err := v.manager.Request("POST", "v1/disk", args, &disk)
 	if err == nil {
@@ -394,3 +406,24 @@ func (v Vdc) Create(lb *LoadBalancer) (err error) {
 	}
 	return
 }
+
+func (v *Vdc) TagNames() []string {
+	return convertTagsToNames(v.Tags)
+}
+
+func (v *Vdc) tagPath() string {
+	path, _ := url.JoinPath("v1/vdc", v.ID)
+	return path
+}
+
+func (v *Vdc) SetTags(tags ...string) error {
+	return v.manager.setTags(v, tags)
+}
+
+func (v *Vdc) AddTags(tags ...string) error {
+	return v.manager.addTags(v, tags)
+}
+
+func (v *Vdc) RemoveTags(tags ...string) error {
+	return v.manager.removeTags(v, tags)
+}
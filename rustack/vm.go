@@ -1,11 +1,13 @@
 package rustack
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 )
 
 type Vm struct {
+	jobList
 	manager     *Manager
 	ID          string        `json:"id"`
 	Name        string        `json:"name"`
@@ -59,6 +61,22 @@ func (m *Manager) GetVms(extraArgs ...Arguments) (vms []*Vm, err error) {
 	return
 }
 
+func (m *Manager) IterVms(ctx context.Context, args Arguments, opts ...IterOption) *Iterator[*Vm] {
+	return NewIterator(ctx, m, "v1/vm", args, func(vm *Vm) {
+		vm.manager = m
+		for x := range vm.Ports {
+			vm.Ports[x].manager = m
+		}
+		for x := range vm.Disks {
+			vm.Disks[x].manager = m
+		}
+		vm.Vdc.manager = m
+		if vm.Floating != nil {
+			vm.Floating.manager = m
+		}
+	}, opts...)
+}
+
 func (v *Vdc) GetVms(extraArgs ...Arguments) (vms []*Vm, err error) {
 	args := Arguments{
 		"vdc": v.ID,
@@ -147,7 +165,7 @@ func (v *Vm) ConnectPort(port *Port, exsist bool) error {
 
 func (v *Vm) DisconnectPort(port *Port) error {
 	path := fmt.Sprintf("v1/port/%s/disconnect", port.ID)
-	err := v.manager.Request("PATCH", path, nil, nil)
+	err := v.manager.action("PATCH", path, nil, port)
 	if err != nil {
 		return err
 	}
@@ -221,10 +239,31 @@ func (v *Vm) PowerOff() error {
 
 func (v *Vm) Delete() error {
 	path, _ := url.JoinPath("v1/vm", v.ID)
-	return v.manager.Delete(path, Defaults(), nil)
+	return v.manager.deleteResource(path, v)
 }
 
 func (v Vm) WaitLock() (err error) {
 	path, _ := url.JoinPath("v1/vm", v.ID)
 	return loopWaitLock(v.manager, path)
 }
+
+func (v *Vm) TagNames() []string {
+	return convertTagsToNames(v.Tags)
+}
+
+func (v *Vm) tagPath() string {
+	path, _ := url.JoinPath("v1/vm", v.ID)
+	return path
+}
+
+func (v *Vm) SetTags(tags ...string) error {
+	return v.manager.setTags(v, tags)
+}
+
+func (v *Vm) AddTags(tags ...string) error {
+	return v.manager.addTags(v, tags)
+}
+
+func (v *Vm) RemoveTags(tags ...string) error {
+	return v.manager.removeTags(v, tags)
+}
@@ -0,0 +1,83 @@
+package rustack
+
+import (
+	"net/url"
+)
+
+type Snapshot struct {
+	jobList
+	manager *Manager
+	vm      *Vm
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	// WithMemory is set for snapshots that include the memory state of a
+	// running VM, reverting to them resumes the VM where it was.
+	WithMemory bool   `json:"with_memory"`
+	CreatedAt  string `json:"created_at"`
+	Locked     bool   `json:"locked,omitempty"`
+}
+
+func (v *Vm) CreateSnapshot(name string, withMemory bool) (snapshot *Snapshot, err error) {
+	path, _ := url.JoinPath("v1/vm", v.ID, "snapshot")
+	args := &struct {
+		Name       string `json:"name"`
+		WithMemory bool   `json:"with_memory"`
+	}{
+		Name:       name,
+		WithMemory: withMemory,
+	}
+
+	err = v.manager.Request("POST", path, args, &snapshot)
+	if err != nil {
+		return
+	}
+	snapshot.manager = v.manager
+	snapshot.vm = v
+	return
+}
+
+func (v *Vm) GetSnapshots(extraArgs ...Arguments) (snapshots []*Snapshot, err error) {
+	args := Defaults()
+	args.merge(extraArgs)
+
+	path, _ := url.JoinPath("v1/vm", v.ID, "snapshot")
+	err = v.manager.GetItems(path, args, &snapshots)
+	for i := range snapshots {
+		snapshots[i].manager = v.manager
+		snapshots[i].vm = v
+	}
+	return
+}
+
+func (v *Vm) GetSnapshot(id string) (snapshot *Snapshot, err error) {
+	path, _ := url.JoinPath("v1/vm", v.ID, "snapshot", id)
+	err = v.manager.Get(path, Defaults(), &snapshot)
+	if err != nil {
+		return
+	}
+	snapshot.manager = v.manager
+	snapshot.vm = v
+	return
+}
+
+// Revert returns the VM to the state of the snapshot. The VM is reloaded
+// afterwards, as its power state and disks may have changed, so Revert waits
+// for its job even with an async manager.
+func (s *Snapshot) Revert() error {
+	path, _ := url.JoinPath("v1/vm", s.vm.ID, "snapshot", s.ID, "revert")
+	err := s.manager.waiting().action("POST", path, nil, s)
+	if err != nil {
+		return err
+	}
+	return s.vm.Reload()
+}
+
+func (s *Snapshot) Delete() error {
+	path, _ := url.JoinPath("v1/vm", s.vm.ID, "snapshot", s.ID)
+	return s.manager.deleteResource(path, s)
+}
+
+func (s Snapshot) WaitLock() (err error) {
+	path, _ := url.JoinPath("v1/vm", s.vm.ID, "snapshot", s.ID)
+	return loopWaitLock(s.manager, path)
+}
@@ -0,0 +1,95 @@
+package rustack_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+	"github.com/rustack-cloud-platform/rcp-go/rustacktest"
+)
+
+// requestsSince returns the method and path of the requests made after the
+// first n ones.
+func requestsSince(s *rustacktest.Server, n int) (requests []string) {
+	for _, r := range s.Requests()[n:] {
+		requests = append(requests, r.Method+" "+r.Path)
+	}
+	return
+}
+
+func TestVmSnapshots(t *testing.T) {
+	s := rustacktest.NewServer()
+	defer s.Close()
+	vdc := s.Seed("vdc", map[string]interface{}{"name": "vdc"})
+	seeded := s.Seed("vm", map[string]interface{}{"name": "vm", "vdc": vdc})
+	m := s.Manager().WithAsync()
+	vm, err := m.GetVm(seeded["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := len(s.Requests())
+	snapshot, err := vm.CreateSnapshot("before upgrade", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Name != "before upgrade" || !snapshot.WithMemory || snapshot.CreatedAt == "" {
+		t.Fatalf("created %+v", snapshot)
+	}
+	var body map[string]interface{}
+	json.Unmarshal(s.Requests()[before].Body, &body)
+	if !reflect.DeepEqual(body, map[string]interface{}{"name": "before upgrade", "with_memory": true}) {
+		t.Fatalf("create body %v", body)
+	}
+	if len(m.Jobs()) != 1 {
+		t.Fatal("create job not recorded")
+	}
+
+	snapshots, err := vm.GetSnapshots()
+	if err != nil || len(snapshots) != 1 || snapshots[0].ID != snapshot.ID {
+		t.Fatalf("listed %v, %v", snapshots, err)
+	}
+	if got, err := vm.GetSnapshot(snapshot.ID); err != nil || got.Name != "before upgrade" {
+		t.Fatalf("got %+v, %v", got, err)
+	}
+
+	// Revert waits for its job even with an async manager, then reloads the
+	// VM.
+	base := "v1/vm/" + vm.ID + "/snapshot/" + snapshot.ID
+	before = len(s.Requests())
+	if err := snapshot.Revert(); err != nil {
+		t.Fatal(err)
+	}
+	jobs := s.Jobs()
+	want := []string{"POST " + base + "/revert", "GET v1/job/" + jobs[len(jobs)-1], "GET v1/vm/" + vm.ID}
+	if got := requestsSince(s, before); !reflect.DeepEqual(got, want) {
+		t.Fatalf("revert requests %v, want %v", got, want)
+	}
+	if len(m.Jobs()) != 0 {
+		t.Fatal("revert job left to the caller")
+	}
+
+	s.FailNextJob("revert_snapshot")
+	var jobErr *rustack.JobError
+	if err := snapshot.Revert(); !errors.As(err, &jobErr) || jobErr.Step != "revert_snapshot" {
+		t.Fatalf("failed revert returned %v", err)
+	}
+
+	// Delete returns once the API accepted it.
+	if err := snapshot.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Jobs()) != 1 || !reflect.DeepEqual(m.Jobs(), snapshot.Jobs()) {
+		t.Fatalf("delete jobs %v", snapshot.Jobs())
+	}
+	if err := rustack.WaitAll(context.Background(), snapshot.Jobs()...); err != nil {
+		t.Fatal(err)
+	}
+	if snapshots, err := vm.GetSnapshots(); err != nil || len(snapshots) != 0 {
+		t.Fatalf("left %v, %v", snapshots, err)
+	}
+}
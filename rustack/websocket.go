@@ -0,0 +1,280 @@
+package rustack
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A minimal RFC 6455 client, enough to tunnel binary console streams.
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+type websocketConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	// remaining is the unread payload of the current data frame.
+	remaining uint64
+	mask      []byte
+	maskPos   int
+
+	writeMu sync.Mutex
+	closed  bool
+}
+
+// dialWebsocket opens a websocket to rawURL (ws or wss). TLS settings are
+// taken from tlsConfig when not nil.
+func dialWebsocket(ctx context.Context, rawURL string, header http.Header, tlsConfig *tls.Config) (*websocketConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid websocket URL %s", rawURL)
+	}
+
+	host := u.Host
+	var dialer net.Dialer
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws", "http":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+		conn, err = dialer.DialContext(ctx, "tcp", host)
+	case "wss", "https":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		}
+		config := &tls.Config{}
+		if tlsConfig != nil {
+			config = tlsConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName = u.Hostname()
+		}
+		tlsDialer := tls.Dialer{NetDialer: &dialer, Config: config}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", host)
+	default:
+		return nil, errors.Errorf("Unsupported websocket scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Websocket dial failure on %s", u.Host)
+	}
+
+	ws, err := websocketHandshake(ctx, conn, u, header)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+func websocketHandshake(ctx context.Context, conn net.Conn, u *url.URL, header http.Header) (*websocketConn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+
+	httpURL := *u
+	switch u.Scheme {
+	case "ws":
+		httpURL.Scheme = "http"
+	case "wss":
+		httpURL.Scheme = "https"
+	}
+	req, err := http.NewRequest(http.MethodGet, httpURL.String(), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid websocket request %s", u)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		return nil, errors.Wrapf(err, "Websocket handshake failure on %s", u.Host)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Websocket handshake failure on %s", u.Host)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, newRustackApiError(u.String(), resp.StatusCode, body)
+	}
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		return nil, errors.Errorf("Websocket handshake failure on %s: invalid accept key", u.Host)
+	}
+
+	return &websocketConn{conn: conn, reader: reader}, nil
+}
+
+// Read reads the payload of data frames, answering pings on the way. It
+// returns io.EOF once the server closes the connection.
+func (ws *websocketConn) Read(p []byte) (int, error) {
+	for ws.remaining == 0 {
+		if err := ws.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	if uint64(len(p)) > ws.remaining {
+		p = p[:ws.remaining]
+	}
+	n, err := ws.reader.Read(p)
+	ws.unmask(p[:n])
+	ws.remaining -= uint64(n)
+	return n, err
+}
+
+// Write sends p as a single binary frame.
+func (ws *websocketConn) Write(p []byte) (int, error) {
+	if err := ws.writeFrame(wsBinary, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (ws *websocketConn) Close() error {
+	ws.writeFrame(wsClose, []byte{0x03, 0xe8}) // 1000, normal closure
+	return ws.conn.Close()
+}
+
+func (ws *websocketConn) nextFrame() error {
+	var head [2]byte
+	if _, err := io.ReadFull(ws.reader, head[:]); err != nil {
+		return err
+	}
+	opcode := head[0] & 0x0f
+	masked := head[1]&0x80 != 0
+
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	ws.mask = nil
+	ws.maskPos = 0
+	if masked {
+		ws.mask = make([]byte, 4)
+		if _, err := io.ReadFull(ws.reader, ws.mask); err != nil {
+			return err
+		}
+	}
+
+	switch opcode {
+	case wsContinuation, wsText, wsBinary:
+		ws.remaining = length
+		return nil
+	}
+
+	// Control frames carry at most 125 bytes.
+	if length > 125 {
+		return errors.Errorf("Websocket protocol error: control frame of %d bytes", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return err
+	}
+	ws.unmask(payload)
+
+	switch opcode {
+	case wsPing:
+		return ws.writeFrame(wsPong, payload)
+	case wsPong:
+		return nil
+	case wsClose:
+		ws.writeFrame(wsClose, payload)
+		return io.EOF
+	}
+	return errors.Errorf("Websocket protocol error: unknown opcode %d", opcode)
+}
+
+func (ws *websocketConn) unmask(p []byte) {
+	if ws.mask == nil {
+		return
+	}
+	for i := range p {
+		p[i] ^= ws.mask[ws.maskPos%4]
+		ws.maskPos++
+	}
+}
+
+// writeFrame writes a final frame. Client frames are always masked.
+func (ws *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	if ws.closed {
+		return net.ErrClosed
+	}
+	if opcode == wsClose {
+		ws.closed = true
+	}
+
+	frame := make([]byte, 0, len(payload)+14)
+	frame = append(frame, 0x80|opcode)
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	_, err := ws.conn.Write(frame)
+	return err
+}
@@ -0,0 +1,194 @@
+package rustack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// bufferConn is a net.Conn reading from in and writing to out.
+type bufferConn struct {
+	net.Conn
+	in  io.Reader
+	out bytes.Buffer
+}
+
+func (c *bufferConn) Read(p []byte) (int, error)  { return c.in.Read(p) }
+func (c *bufferConn) Write(p []byte) (int, error) { return c.out.Write(p) }
+func (c *bufferConn) Close() error                { return nil }
+
+func newTestWebsocket(in []byte) (*websocketConn, *bufferConn) {
+	conn := &bufferConn{in: bytes.NewReader(in)}
+	return &websocketConn{conn: conn, reader: bufio.NewReader(conn)}, conn
+}
+
+// serverFrame encodes a frame as a server would, masked when mask is set.
+func serverFrame(fin bool, opcode byte, payload []byte, mask []byte) []byte {
+	head := opcode
+	if fin {
+		head |= 0x80
+	}
+	frame := []byte{head}
+	maskBit := byte(0)
+	if mask != nil {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	if mask == nil {
+		return append(frame, payload...)
+	}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+type clientFrame struct {
+	fin       bool
+	opcode    byte
+	lengthLen int
+	payload   []byte
+}
+
+// readClientFrames decodes the frames written by the client, checking that
+// they are masked.
+func readClientFrames(t *testing.T, data []byte) []clientFrame {
+	var frames []clientFrame
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		var head [2]byte
+		io.ReadFull(r, head[:])
+		if head[1]&0x80 == 0 {
+			t.Fatal("client frame not masked")
+		}
+		f := clientFrame{fin: head[0]&0x80 != 0, opcode: head[0] & 0x0f}
+		length := uint64(head[1] & 0x7f)
+		switch length {
+		case 126:
+			var ext [2]byte
+			io.ReadFull(r, ext[:])
+			length = uint64(binary.BigEndian.Uint16(ext[:]))
+			f.lengthLen = 2
+		case 127:
+			var ext [8]byte
+			io.ReadFull(r, ext[:])
+			length = binary.BigEndian.Uint64(ext[:])
+			f.lengthLen = 8
+		}
+		var mask [4]byte
+		io.ReadFull(r, mask[:])
+		f.payload = make([]byte, length)
+		if _, err := io.ReadFull(r, f.payload); err != nil {
+			t.Fatal("truncated client frame")
+		}
+		for i := range f.payload {
+			f.payload[i] ^= mask[i%4]
+		}
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+func TestWebsocketWriteFrame(t *testing.T) {
+	tests := []struct {
+		size      int
+		lengthLen int
+	}{
+		{0, 0},
+		{125, 0},
+		{126, 2},
+		{0xffff, 2},
+		{0x10000, 8},
+	}
+	for _, tt := range tests {
+		payload := bytes.Repeat([]byte{0xa5}, tt.size)
+		ws, conn := newTestWebsocket(nil)
+		if n, err := ws.Write(payload); err != nil || n != tt.size {
+			t.Fatalf("size %d: wrote %d, %v", tt.size, n, err)
+		}
+		frames := readClientFrames(t, conn.out.Bytes())
+		if len(frames) != 1 {
+			t.Fatalf("size %d: got %d frames", tt.size, len(frames))
+		}
+		f := frames[0]
+		if !f.fin || f.opcode != wsBinary || f.lengthLen != tt.lengthLen || !bytes.Equal(f.payload, payload) {
+			t.Fatalf("size %d: got fin %v, opcode %d, length bytes %d", tt.size, f.fin, f.opcode, f.lengthLen)
+		}
+	}
+}
+
+func TestWebsocketRead(t *testing.T) {
+	medium := bytes.Repeat([]byte("m"), 300)
+	large := bytes.Repeat([]byte("l"), 70000)
+
+	var in []byte
+	in = append(in, serverFrame(true, wsPing, []byte("are you there"), nil)...)
+	// A fragmented message, its frames only carry data.
+	in = append(in, serverFrame(false, wsText, []byte("hel"), nil)...)
+	in = append(in, serverFrame(false, wsContinuation, []byte("lo "), []byte{1, 2, 3, 4})...)
+	in = append(in, serverFrame(true, wsPong, nil, nil)...)
+	in = append(in, serverFrame(true, wsContinuation, []byte("world"), nil)...)
+	in = append(in, serverFrame(true, wsBinary, medium, nil)...)
+	in = append(in, serverFrame(true, wsBinary, large, []byte{9, 8, 7, 6})...)
+	in = append(in, serverFrame(true, wsClose, []byte{0x03, 0xe8}, nil)...)
+
+	ws, conn := newTestWebsocket(in)
+	got, err := io.ReadAll(ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(append([]byte("hello world"), medium...), large...)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("read %d bytes, want %d", len(got), len(want))
+	}
+
+	replies := readClientFrames(t, conn.out.Bytes())
+	if len(replies) != 2 {
+		t.Fatalf("got %d replies, want pong and close", len(replies))
+	}
+	if replies[0].opcode != wsPong || string(replies[0].payload) != "are you there" {
+		t.Fatalf("bad pong %+v", replies[0])
+	}
+	if replies[1].opcode != wsClose || !bytes.Equal(replies[1].payload, []byte{0x03, 0xe8}) {
+		t.Fatalf("bad close %+v", replies[1])
+	}
+
+	// Nothing can be written once closed.
+	if _, err := ws.Write([]byte("late")); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("write after close: %v", err)
+	}
+}
+
+func TestWebsocketProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{"long control frame", serverFrame(true, wsPing, make([]byte, 126), nil)},
+		{"unknown opcode", serverFrame(true, 0x3, nil, nil)},
+		{"truncated length", []byte{0x82, 127, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws, _ := newTestWebsocket(tt.frame)
+			if _, err := ws.Read(make([]byte, 16)); err == nil || err == io.EOF {
+				t.Fatalf("got %v, want a protocol error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package rustacktest
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// consoleGreeting is sent on console websockets before echoing, the same
+// way a VNC server announces its protocol version.
+const consoleGreeting = "RFB 003.008\n"
+
+func vmConsole(s *Server, kind string, id string, args map[string]interface{}) (int, interface{}) {
+	ticket := newID()
+	s.consoles[ticket] = id
+	return http.StatusOK, map[string]interface{}{
+		"url":      fmt.Sprintf("ws%s/console/%s", strings.TrimPrefix(s.URL, "http"), ticket),
+		"ticket":   ticket,
+		"protocol": "vnc",
+		"password": "",
+	}
+}
+
+// serveConsole serves the websocket of a console ticket. Tickets are single
+// use. After the greeting everything the client sends is echoed back.
+func (s *Server) serveConsole(w http.ResponseWriter, r *http.Request, ticket string) {
+	s.mu.Lock()
+	_, ok := s.consoles[ticket]
+	delete(s.consoles, ticket)
+	s.mu.Unlock()
+	if !ok {
+		notFound(w)
+		return
+	}
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"detail": "Websocket upgrade expected."})
+		return
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n", base64.StdEncoding.EncodeToString(sum[:]))
+	if r.Header.Get("Sec-WebSocket-Protocol") != "" {
+		fmt.Fprintf(rw, "Sec-WebSocket-Protocol: binary\r\n")
+	}
+	fmt.Fprintf(rw, "\r\n")
+	writeFrame(rw.Writer, 0x2, []byte(consoleGreeting))
+	if rw.Flush() != nil {
+		return
+	}
+
+	for {
+		opcode, payload, err := readFrame(rw.Reader)
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case 0x8:
+			writeFrame(rw.Writer, 0x8, payload)
+			rw.Flush()
+			return
+		case 0x9:
+			writeFrame(rw.Writer, 0xa, payload)
+		case 0x0, 0x1, 0x2:
+			writeFrame(rw.Writer, 0x2, payload)
+		}
+		if rw.Flush() != nil {
+			return
+		}
+	}
+}
+
+func readFrame(r *bufio.Reader) (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	var mask [4]byte
+	masked := head[1]&0x80 != 0
+	if masked {
+		if _, err := io.ReadFull(r, mask[:]); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return head[0] & 0x0f, payload, nil
+}
+
+// writeFrame writes an unmasked server frame.
+func writeFrame(w *bufio.Writer, opcode byte, payload []byte) {
+	w.WriteByte(0x80 | opcode)
+	switch n := len(payload); {
+	case n <= 125:
+		w.WriteByte(byte(n))
+	case n <= 0xffff:
+		w.WriteByte(126)
+		binary.Write(w, binary.BigEndian, uint16(n))
+	default:
+		w.WriteByte(127)
+		binary.Write(w, binary.BigEndian, uint64(n))
+	}
+	w.Write(payload)
+}
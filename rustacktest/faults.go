@@ -0,0 +1,104 @@
+package rustacktest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Fault is an injected response returned instead of the regular one.
+type Fault struct {
+	// Method to match, empty matches any method.
+	Method string
+	// Path to match without the leading slash, e.g. "v1/vm/<id>". A trailing
+	// "*" matches any path with the given prefix.
+	Path   string
+	Status int
+	Body   interface{}
+	Header http.Header
+	// Times is the number of requests the fault applies to. Zero or less
+	// means forever.
+	Times int
+}
+
+func (f *Fault) matches(method string, path string) bool {
+	if f.Method != "" && f.Method != method {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(f.Path, "*"); ok {
+		return strings.HasPrefix(path, strings.Trim(prefix, "/"))
+	}
+	return strings.Trim(f.Path, "/") == path
+}
+
+func (f *Fault) write(w http.ResponseWriter) {
+	for key, values := range f.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	switch body := f.Body.(type) {
+	case nil:
+		w.WriteHeader(f.Status)
+	case string:
+		w.WriteHeader(f.Status)
+		w.Write([]byte(body))
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(f.Status)
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+// InjectFault registers a fault. Faults are matched in registration order.
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// Lock makes the next times requests to path answer 409 object_locked.
+func (s *Server) Lock(path string, times int) {
+	s.InjectFault(Fault{
+		Path:   path,
+		Status: http.StatusConflict,
+		Body: map[string]interface{}{
+			"error_alias":      []string{"object_locked"},
+			"non_field_errors": []string{"Object is locked"},
+			"details":          map[string]interface{}{},
+		},
+		Times: times,
+	})
+}
+
+// FailNextJob makes the next started job finish in the error state on the
+// given step.
+func (s *Server) FailNextJob(step string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failJobs = append(s.failJobs, step)
+}
+
+// ClearFaults removes all injected faults and pending job failures.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+	s.failJobs = nil
+}
+
+func (s *Server) matchFault(method string, path string) *Fault {
+	for i, f := range s.faults {
+		if !f.matches(method, path) {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
@@ -0,0 +1,468 @@
+package rustacktest
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type action struct {
+	method string
+	fn     func(s *Server, kind string, id string, args map[string]interface{}) (int, interface{})
+}
+
+// actions are the non-CRUD endpoints of the form v1/<kind>/<id>/<action>.
+var actions = map[string]action{
+	"vm/state":             {http.MethodPost, vmState},
+	"vm/console":           {http.MethodGet, vmConsole},
+	"disk/attach":          {http.MethodPost, diskAttach},
+	"disk/detach":          {http.MethodPost, diskDetach},
+	"port/disconnect":      {http.MethodPatch, portDisconnect},
+	"port/force":           {http.MethodDelete, portForceDelete},
+	"kubernetes/config":    {http.MethodGet, kubernetesConfig},
+	"kubernetes/dashboard": {http.MethodGet, kubernetesDashboard},
+	"backup_policy/attach": {http.MethodPost, backupPolicyAttach},
+	"backup_policy/detach": {http.MethodPost, backupPolicyDetach},
+}
+
+// subActions are the actions on sub objects, of the form
+// v1/<kind>/<id>/<sub>/<id>/<action>. Their kind is the sub collection.
+var subActions = map[string]action{
+	"vm/snapshot/revert": {http.MethodPost, snapshotRevert},
+}
+
+func (st *store) onCreate(kind string, obj map[string]interface{}) {
+	switch kind {
+	case "vm":
+		createVm(st, obj)
+	case "port":
+		createPort(st, obj)
+	case "router":
+		createRouter(st, obj)
+	case "lbaas":
+		createLoadBalancer(st, obj)
+	case "network":
+		createNetwork(st, obj)
+	case "s3_storage":
+		createS3Storage(st, obj)
+	case "kubernetes":
+		createKubernetes(st, obj)
+	case "snapshot":
+		createSnapshot(st, obj)
+	case "disk_snapshot":
+		createDiskSnapshot(st, obj)
+	case "backup_policy":
+		createBackupPolicy(st, obj)
+	case "certificate":
+		delete(obj, "private_key")
+	case "pool":
+		expandCertificate(st, obj)
+	}
+}
+
+func (st *store) onUpdate(kind string, obj map[string]interface{}, args map[string]interface{}) {
+	switch kind {
+	case "router":
+		updateRouter(st, obj, args)
+	case "certificate":
+		delete(obj, "private_key")
+	case "pool":
+		expandCertificate(st, obj)
+	}
+}
+
+func (st *store) onDelete(kind string, obj map[string]interface{}) {
+	switch kind {
+	case "vm":
+		deleteVm(st, obj)
+	case "router", "lbaas":
+		deleteConnectedPorts(st, obj)
+	}
+}
+
+// inUse returns why a resource cannot be deleted, empty if it can.
+func (st *store) inUse(kind string, obj map[string]interface{}) string {
+	id := obj["id"]
+	switch kind {
+	case "project":
+		for _, child := range []string{"vdc", "dns", "s3_storage", "certificate"} {
+			if referencedBy(st, child, "project", id, nil) {
+				return fmt.Sprintf("Project has %s resources", child)
+			}
+		}
+	case "vdc":
+		custom := func(o map[string]interface{}) bool { return o["is_default"] != true }
+		for _, child := range []string{"vm", "disk", "lbaas", "kubernetes", "router", "network"} {
+			if referencedBy(st, child, "vdc", id, custom) {
+				return fmt.Sprintf("Vdc has %s resources", child)
+			}
+		}
+	case "network":
+		if referencedBy(st, "port", "network", id, nil) {
+			return "Network has ports"
+		}
+	case "port":
+		if obj["connected"] != nil {
+			return "Port is connected"
+		}
+	case "disk":
+		if obj["vm"] != nil {
+			return "Disk is attached to a vm"
+		}
+	}
+	return ""
+}
+
+func referencedBy(st *store, kind string, key string, id interface{}, match func(map[string]interface{}) bool) bool {
+	for _, o := range st.list(kind) {
+		if refID(o[key]) == id && (match == nil || match(o)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (st *store) onRender(kind string, obj map[string]interface{}) {
+	switch kind {
+	case "vm":
+		renderVm(st, obj)
+	case "router":
+		renderRouter(st, obj)
+	case "network":
+		renderNetwork(st, obj)
+	case "project":
+		renderProject(st, obj)
+	}
+}
+
+func createVm(st *store, vm map[string]interface{}) {
+	if _, ok := vm["power"]; !ok {
+		vm["power"] = true
+	}
+	if disks, ok := vm["disks"].([]interface{}); ok {
+		for i, item := range disks {
+			disk, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			disk = copyValue(disk).(map[string]interface{})
+			disk["vm"] = st.ref("vm", vm["id"].(string))
+			disk["vdc"] = copyValue(vm["vdc"])
+			disk["is_root"] = i == 0
+			st.create("disk", disk)
+		}
+	}
+	connectPorts(st, vm, "vm")
+	delete(vm, "disks")
+	delete(vm, "ports")
+}
+
+func createPort(st *store, port map[string]interface{}) {
+	for _, key := range []string{"vm", "router", "lbaas"} {
+		if ref, ok := port[key].(map[string]interface{}); ok {
+			port["connected"] = connectedRef(ref, key)
+		}
+		delete(port, key)
+	}
+	if _, ok := port["connected"]; !ok {
+		port["connected"] = nil
+	}
+	if ip, _ := port["ip_address"].(string); ip == "" {
+		port["ip_address"] = randomIP()
+	}
+}
+
+func createRouter(st *store, router map[string]interface{}) {
+	if _, ok := router["is_default"]; !ok {
+		router["is_default"] = false
+	}
+	connectPorts(st, router, "router")
+	if routes, ok := router["routes"].([]interface{}); ok {
+		name := fmt.Sprintf("router/%s/route", router["id"])
+		for _, item := range routes {
+			if route, ok := item.(map[string]interface{}); ok {
+				st.create(name, route)
+			}
+		}
+	}
+	delete(router, "ports")
+	delete(router, "routes")
+}
+
+func updateRouter(st *store, router map[string]interface{}, args map[string]interface{}) {
+	delete(router, "ports")
+	delete(router, "routes")
+}
+
+func createLoadBalancer(st *store, lb map[string]interface{}) {
+	port, ok := lb["port"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	port = copyValue(port).(map[string]interface{})
+	port["connected"] = connectedRef(lb, "lbaas")
+	created := st.create("port", port)
+	lb["port"] = st.ref("port", created["id"].(string))
+}
+
+func createNetwork(st *store, network map[string]interface{}) {
+	if _, ok := network["is_default"]; !ok {
+		network["is_default"] = false
+	}
+	delete(network, "subnets")
+}
+
+func createS3Storage(st *store, s3 map[string]interface{}) {
+	s3["client_endpoint"] = fmt.Sprintf("https://%s.s3.rustacktest.local", s3["id"])
+	s3["access_key"] = newID()
+	s3["secret_key"] = newID()
+}
+
+func createKubernetes(st *store, k8s map[string]interface{}) {
+	if _, ok := k8s["vms"]; !ok {
+		k8s["vms"] = []interface{}{}
+	}
+	k8s["job_id"] = newID()
+}
+
+func createSnapshot(st *store, snapshot map[string]interface{}) {
+	snapshot["created_at"] = time.Now().UTC().Format(time.RFC3339)
+}
+
+func createDiskSnapshot(st *store, snapshot map[string]interface{}) {
+	createSnapshot(st, snapshot)
+	if disk, ok := snapshot["disk"].(map[string]interface{}); ok {
+		snapshot["size"] = disk["size"]
+	}
+	if _, ok := snapshot["type"]; !ok {
+		snapshot["type"] = "manual"
+	}
+}
+
+func createBackupPolicy(st *store, policy map[string]interface{}) {
+	for _, key := range []string{"vms", "disks"} {
+		if _, ok := policy[key]; !ok {
+			policy[key] = []interface{}{}
+		}
+	}
+}
+
+// expandCertificate replaces the certificate ID of a pool with the
+// certificate. It is not in refCollections, as certificates have a
+// "certificate" field of their own.
+func expandCertificate(st *store, pool map[string]interface{}) {
+	if id, ok := pool["certificate"].(string); ok {
+		pool["certificate"] = st.ref("certificate", id)
+	}
+}
+
+func deleteVm(st *store, vm map[string]interface{}) {
+	for _, disk := range st.list("disk") {
+		if refID(disk["vm"]) == vm["id"] {
+			st.delete("disk", disk["id"].(string))
+		}
+	}
+	for _, port := range st.list("port") {
+		if refID(port["connected"]) == vm["id"] {
+			port["connected"] = nil
+		}
+	}
+}
+
+func deleteConnectedPorts(st *store, owner map[string]interface{}) {
+	for _, port := range st.list("port") {
+		if refID(port["connected"]) == owner["id"] {
+			st.delete("port", port["id"].(string))
+		}
+	}
+}
+
+func renderVm(st *store, vm map[string]interface{}) {
+	vm["ports"] = connectedPorts(st, vm["id"])
+	disks := []interface{}{}
+	for _, disk := range st.list("disk") {
+		if refID(disk["vm"]) == vm["id"] {
+			disks = append(disks, st.render("disk", disk))
+		}
+	}
+	vm["disks"] = disks
+}
+
+func renderRouter(st *store, router map[string]interface{}) {
+	router["ports"] = connectedPorts(st, router["id"])
+	routes := []interface{}{}
+	for _, route := range st.list(fmt.Sprintf("router/%s/route", router["id"])) {
+		routes = append(routes, copyValue(route))
+	}
+	router["routes"] = routes
+}
+
+func renderNetwork(st *store, network map[string]interface{}) {
+	subnets := []interface{}{}
+	for _, subnet := range st.list(fmt.Sprintf("network/%s/subnet", network["id"])) {
+		subnets = append(subnets, copyValue(subnet))
+	}
+	network["subnets"] = subnets
+}
+
+// renderProject adds the hypervisors allowed to the client, which references
+// leave out as lists.
+func renderProject(st *store, project map[string]interface{}) {
+	client, ok := project["client"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	if id, _ := client["id"].(string); id != "" {
+		if obj := st.get("client", id); obj != nil && obj["allowed_hypervisors"] != nil {
+			client["allowed_hypervisors"] = copyValue(obj["allowed_hypervisors"])
+		}
+	}
+}
+
+func vmState(s *Server, kind string, id string, args map[string]interface{}) (int, interface{}) {
+	vm := s.store.get(kind, id)
+	switch args["state"] {
+	case "power_on", "reboot":
+		vm["power"] = true
+	case "power_off":
+		vm["power"] = false
+	default:
+		return http.StatusBadRequest, map[string]interface{}{"state": []string{"Unknown state"}}
+	}
+	return http.StatusOK, s.store.render(kind, vm)
+}
+
+func diskAttach(s *Server, kind string, id string, args map[string]interface{}) (int, interface{}) {
+	disk := s.store.get(kind, id)
+	vmID, _ := args["vm"].(string)
+	if s.store.get("vm", vmID) == nil {
+		return http.StatusBadRequest, map[string]interface{}{"vm": []string{"Object does not exist"}}
+	}
+	disk["vm"] = s.store.ref("vm", vmID)
+	return http.StatusOK, s.store.render(kind, disk)
+}
+
+func snapshotRevert(s *Server, collection string, id string, args map[string]interface{}) (int, interface{}) {
+	return http.StatusOK, s.store.render(collection, s.store.get(collection, id))
+}
+
+func diskDetach(s *Server, kind string, id string, args map[string]interface{}) (int, interface{}) {
+	disk := s.store.get(kind, id)
+	disk["vm"] = nil
+	return http.StatusOK, s.store.render(kind, disk)
+}
+
+func backupPolicyAttach(s *Server, kind string, id string, args map[string]interface{}) (int, interface{}) {
+	policy := s.store.get(kind, id)
+	for _, key := range []string{"vm", "disk"} {
+		refID, ok := args[key].(string)
+		if !ok {
+			continue
+		}
+		if s.store.get(key, refID) == nil {
+			return http.StatusBadRequest, map[string]interface{}{key: []string{"Object does not exist"}}
+		}
+		list, _ := policy[key+"s"].([]interface{})
+		policy[key+"s"] = append(removeRef(list, refID), s.store.ref(key, refID))
+	}
+	return http.StatusOK, s.store.render(kind, policy)
+}
+
+func backupPolicyDetach(s *Server, kind string, id string, args map[string]interface{}) (int, interface{}) {
+	policy := s.store.get(kind, id)
+	for _, key := range []string{"vm", "disk"} {
+		if refID, ok := args[key].(string); ok {
+			list, _ := policy[key+"s"].([]interface{})
+			policy[key+"s"] = removeRef(list, refID)
+		}
+	}
+	return http.StatusOK, s.store.render(kind, policy)
+}
+
+func portDisconnect(s *Server, kind string, id string, args map[string]interface{}) (int, interface{}) {
+	port := s.store.get(kind, id)
+	port["connected"] = nil
+	return http.StatusOK, s.store.render(kind, port)
+}
+
+func portForceDelete(s *Server, kind string, id string, args map[string]interface{}) (int, interface{}) {
+	s.store.delete(kind, id)
+	return http.StatusNoContent, nil
+}
+
+func kubernetesConfig(s *Server, kind string, id string, args map[string]interface{}) (int, interface{}) {
+	k8s := s.store.get(kind, id)
+	name := fmt.Sprint(k8s["name"])
+	config := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: %[1]s
+  cluster:
+    server: https://%[2]s:6443
+    certificate-authority-data: cnVzdGFja3Rlc3Q=
+users:
+- name: %[1]s-admin
+  user:
+    token: %[3]s
+contexts:
+- name: %[1]s
+  context:
+    cluster: %[1]s
+    user: %[1]s-admin
+current-context: %[1]s
+`, name, randomIP(), newID())
+	return http.StatusOK, []byte(config)
+}
+
+func kubernetesDashboard(s *Server, kind string, id string, args map[string]interface{}) (int, interface{}) {
+	return http.StatusOK, map[string]interface{}{"url": fmt.Sprintf("https://dashboard.rustacktest.local/%s", id)}
+}
+
+func connectPorts(st *store, owner map[string]interface{}, kind string) {
+	items, _ := owner["ports"].([]interface{})
+	for _, item := range items {
+		ref, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if port := st.get("port", fmt.Sprint(ref["id"])); port != nil {
+			port["connected"] = connectedRef(owner, kind)
+		}
+	}
+}
+
+func connectedPorts(st *store, ownerID interface{}) []interface{} {
+	ports := []interface{}{}
+	for _, port := range st.list("port") {
+		if refID(port["connected"]) == ownerID {
+			ports = append(ports, st.render("port", port))
+		}
+	}
+	return ports
+}
+
+func connectedRef(owner map[string]interface{}, kind string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":   owner["id"],
+		"name": owner["name"],
+		"type": kind,
+		"vdc":  copyValue(owner["vdc"]),
+	}
+}
+
+func removeRef(list []interface{}, id string) []interface{} {
+	out := []interface{}{}
+	for _, item := range list {
+		if refID(item) != id {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func refID(value interface{}) interface{} {
+	if ref, ok := value.(map[string]interface{}); ok {
+		return ref["id"]
+	}
+	return nil
+}
@@ -0,0 +1,368 @@
+// Package rustacktest provides an in-process fake of the Rustack v1 API for
+// testing code built on rustack.Manager.
+//
+// The fake keeps resources in memory and serves them with the same shapes the
+// real API uses: paginated {total, limit, items} lists when a page is
+// requested, X-Esu-Tasks headers on mutating calls and /v1/job polling. Locks
+// and arbitrary failures can be injected per path.
+package rustacktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+)
+
+const DefaultToken = "rustacktest-token"
+
+type Server struct {
+	*httptest.Server
+
+	// Token expected in the Authorization header. Empty disables the check.
+	Token string
+	// PageSize is used for paginated lists when the request has no limit.
+	PageSize int
+	// JobPolls is the number of times a job reports in_progress before it
+	// is done.
+	JobPolls int
+	// StrictDeletes makes deletes of resources still in use by others fail
+	// with 409, as on the real API: VDCs with resources, networks with
+	// ports, connected ports and attached disks.
+	StrictDeletes bool
+
+	mu       sync.Mutex
+	store    *store
+	jobs     map[string]*job
+	jobOrder []string
+	faults   []*Fault
+	failJobs []string
+	requests []Request
+	consoles map[string]string
+}
+
+// Request is a request received by the fake server.
+type Request struct {
+	Method string
+	Path   string
+	Query  string
+	Header http.Header
+	Body   []byte
+}
+
+type job struct {
+	ID     string
+	Name   string
+	Polls  int
+	Failed bool
+}
+
+func NewServer() *Server {
+	s := NewUnstartedServer()
+	s.Start()
+	return s
+}
+
+func NewUnstartedServer() *Server {
+	s := &Server{
+		Token:    DefaultToken,
+		PageSize: 100,
+		store:    newStore(),
+		jobs:     make(map[string]*job),
+		consoles: make(map[string]string),
+	}
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Manager returns a manager configured to talk to the fake server with short
+// retry backoffs.
+func (s *Server) Manager() *rustack.Manager {
+	m := rustack.NewManager(s.Token)
+	m.BaseURL = s.URL
+	m.Client = s.Client()
+	m.RetryPolicy.InitialBackoff = time.Millisecond
+	m.RetryPolicy.MaxBackoff = 10 * time.Millisecond
+	return m
+}
+
+// Seed stores obj in the collection and returns the stored copy. Collection is
+// the API path without the version prefix, e.g. "vdc" or
+// "network/<id>/subnet". String values of reference fields such as "vdc" or
+// "project" are expanded to objects the same way as on create.
+func (s *Server) Seed(collection string, obj map[string]interface{}) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	created := s.store.create(collection, obj)
+	return s.store.render(collection, created)
+}
+
+// Object returns a copy of the stored object or nil.
+func (s *Server) Object(collection string, id string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj := s.store.get(collection, id)
+	if obj == nil {
+		return nil
+	}
+	return s.store.render(collection, obj)
+}
+
+// Objects returns copies of all objects in the collection in creation order.
+func (s *Server) Objects(collection string) []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var objs []map[string]interface{}
+	for _, obj := range s.store.list(collection) {
+		objs = append(objs, s.store.render(collection, obj))
+	}
+	return objs
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Jobs returns the IDs of the jobs started so far.
+func (s *Server) Jobs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.jobOrder...)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	path := strings.Trim(r.URL.Path, "/")
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: path, Query: r.URL.RawQuery, Header: r.Header.Clone(), Body: body})
+	s.mu.Unlock()
+
+	// Console websockets authenticate with the ticket in the path.
+	if ticket, ok := strings.CutPrefix(path, "console/"); ok {
+		s.serveConsole(w, r, ticket)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.Token {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"detail": "Invalid token."})
+		return
+	}
+
+	if fault := s.matchFault(r.Method, path); fault != nil {
+		fault.write(w)
+		return
+	}
+
+	segments := strings.Split(path, "/")
+	if len(segments) < 2 || segments[0] != "v1" {
+		notFound(w)
+		return
+	}
+	segments = segments[1:]
+
+	if segments[0] == "job" && len(segments) == 2 && r.Method == http.MethodGet {
+		s.serveJob(w, segments[1])
+		return
+	}
+
+	var args map[string]interface{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &args); err != nil && r.Method != http.MethodGet {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"non_field_errors": []string{"Invalid JSON"}})
+			return
+		}
+	}
+	if args == nil {
+		args = make(map[string]interface{})
+	}
+
+	status, result := s.route(r, segments, args)
+	if status == http.StatusNotFound {
+		notFound(w)
+		return
+	}
+
+	if r.Method != http.MethodGet && status < 300 {
+		w.Header().Set("X-Esu-Tasks", s.startJob(r.Method, segments))
+	}
+
+	switch v := result.(type) {
+	case nil:
+		w.WriteHeader(status)
+	case []byte:
+		w.WriteHeader(status)
+		w.Write(v)
+	default:
+		writeJSON(w, status, v)
+	}
+}
+
+func (s *Server) route(r *http.Request, segments []string, args map[string]interface{}) (int, interface{}) {
+	st := s.store
+
+	switch len(segments) {
+	case 1:
+		return s.serveCollection(r, segments[0], args)
+	case 2:
+		return s.serveObject(r, segments[0], segments[1], args)
+	case 3:
+		kind, id, sub := segments[0], segments[1], segments[2]
+		if st.get(kind, id) == nil {
+			return http.StatusNotFound, nil
+		}
+		if action, ok := actions[kind+"/"+sub]; ok && (action.method == r.Method) {
+			return action.fn(s, kind, id, args)
+		}
+		return s.serveCollection(r, subCollection(kind, id, sub), args)
+	case 4:
+		kind, id, sub, subID := segments[0], segments[1], segments[2], segments[3]
+		if st.get(kind, id) == nil {
+			return http.StatusNotFound, nil
+		}
+		return s.serveObject(r, subCollection(kind, id, sub), subID, args)
+	case 5:
+		// Actions on sub objects, e.g. POST v1/vm/<id>/snapshot/<id>/revert.
+		collection := subCollection(segments[0], segments[1], segments[2])
+		if st.get(segments[0], segments[1]) == nil || st.get(collection, segments[3]) == nil {
+			return http.StatusNotFound, nil
+		}
+		action, ok := subActions[segments[0]+"/"+segments[2]+"/"+segments[4]]
+		if !ok {
+			return http.StatusNotFound, nil
+		}
+		if action.method != r.Method {
+			return http.StatusMethodNotAllowed, map[string]interface{}{"detail": "Method not allowed."}
+		}
+		return action.fn(s, collection, segments[3], args)
+	}
+	return http.StatusNotFound, nil
+}
+
+func (s *Server) serveCollection(r *http.Request, collection string, args map[string]interface{}) (int, interface{}) {
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		items := s.store.filter(collection, query)
+		if !query.Has("page") {
+			return http.StatusOK, items
+		}
+		page, _ := strconv.Atoi(query.Get("page"))
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		if limit <= 0 {
+			limit = s.PageSize
+		}
+		return http.StatusOK, paginate(items, page, limit)
+	case http.MethodPost:
+		obj := s.store.create(collection, args)
+		return http.StatusCreated, s.store.render(collection, obj)
+	}
+	return http.StatusMethodNotAllowed, map[string]interface{}{"detail": "Method not allowed."}
+}
+
+func (s *Server) serveObject(r *http.Request, collection string, id string, args map[string]interface{}) (int, interface{}) {
+	obj := s.store.get(collection, id)
+	if obj == nil {
+		return http.StatusNotFound, nil
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		return http.StatusOK, s.store.render(collection, obj)
+	case http.MethodPut, http.MethodPatch:
+		s.store.update(collection, obj, args)
+		return http.StatusOK, s.store.render(collection, obj)
+	case http.MethodDelete:
+		if s.StrictDeletes {
+			if reason := s.store.inUse(kindOf(collection), obj); reason != "" {
+				return http.StatusConflict, map[string]interface{}{"error_alias": []string{"object_in_use"}, "non_field_errors": []string{reason}}
+			}
+		}
+		s.store.delete(collection, id)
+		return http.StatusNoContent, nil
+	}
+	return http.StatusMethodNotAllowed, map[string]interface{}{"detail": "Method not allowed."}
+}
+
+func (s *Server) startJob(method string, segments []string) string {
+	j := &job{
+		ID:   newID(),
+		Name: strings.ToLower(method) + "_" + strings.Join(segments, "_"),
+	}
+	if len(s.failJobs) > 0 {
+		j.Failed = true
+		if s.failJobs[0] != "" {
+			j.Name = s.failJobs[0]
+		}
+		s.failJobs = s.failJobs[1:]
+	}
+	s.jobs[j.ID] = j
+	s.jobOrder = append(s.jobOrder, j.ID)
+	return j.ID
+}
+
+func (s *Server) serveJob(w http.ResponseWriter, id string) {
+	j, ok := s.jobs[id]
+	if !ok {
+		notFound(w)
+		return
+	}
+	j.Polls++
+
+	status := "done"
+	if j.Polls <= s.JobPolls {
+		status = "in_progress"
+	} else if j.Failed {
+		status = "error"
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"id": j.ID, "status": status, "name": j.Name})
+}
+
+func paginate(items []map[string]interface{}, page int, limit int) map[string]interface{} {
+	if page < 1 {
+		page = 1
+	}
+	start := (page - 1) * limit
+	end := start + limit
+	if start > len(items) {
+		start = len(items)
+	}
+	if end > len(items) {
+		end = len(items)
+	}
+	return map[string]interface{}{
+		"total": len(items),
+		"limit": limit,
+		"items": items[start:end],
+	}
+}
+
+func subCollection(kind string, id string, sub string) string {
+	if alias, ok := subAliases[kind+"/"+sub]; ok {
+		sub = alias
+	}
+	return fmt.Sprintf("%s/%s/%s", kind, id, sub)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func notFound(w http.ResponseWriter) {
+	writeJSON(w, http.StatusNotFound, map[string]interface{}{"detail": "Not found."})
+}
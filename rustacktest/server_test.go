@@ -0,0 +1,185 @@
+package rustacktest_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/rustack-cloud-platform/rcp-go/rustack"
+	"github.com/rustack-cloud-platform/rcp-go/rustacktest"
+)
+
+func TestPagination(t *testing.T) {
+	tests := []struct {
+		name     string
+		items    int
+		pageSize int
+		prefetch bool
+		pages    int
+	}{
+		{name: "empty", items: 0, pageSize: 2, pages: 1},
+		{name: "one page", items: 2, pageSize: 5, pages: 1},
+		{name: "exact pages", items: 6, pageSize: 2, pages: 3},
+		{name: "partial last page", items: 7, pageSize: 3, pages: 3},
+		{name: "prefetch", items: 7, pageSize: 3, prefetch: true, pages: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := rustacktest.NewServer()
+			defer s.Close()
+			for i := 0; i < tt.items; i++ {
+				s.Seed("vdc", map[string]interface{}{"name": fmt.Sprintf("vdc-%d", i)})
+			}
+
+			opts := []rustack.IterOption{rustack.WithPageSize(tt.pageSize)}
+			if tt.prefetch {
+				opts = append(opts, rustack.WithPrefetch())
+			}
+			it := s.Manager().IterVdcs(context.Background(), nil, opts...)
+			defer it.Close()
+			var names []string
+			for it.Next() {
+				names = append(names, it.Value().Name)
+			}
+			if err := it.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if len(names) != tt.items {
+				t.Fatalf("got %d items, want %d", len(names), tt.items)
+			}
+			for i, name := range names {
+				if name != fmt.Sprintf("vdc-%d", i) {
+					t.Fatalf("item %d is %s", i, name)
+				}
+			}
+
+			pages := 0
+			for _, r := range s.Requests() {
+				query, _ := url.ParseQuery(r.Query)
+				if r.Path == "v1/vdc" && query.Has("page") {
+					pages++
+					if query.Get("limit") != fmt.Sprint(tt.pageSize) {
+						t.Errorf("page requested with limit %q", query.Get("limit"))
+					}
+				}
+			}
+			if pages != tt.pages {
+				t.Fatalf("fetched %d pages, want %d", pages, tt.pages)
+			}
+		})
+	}
+}
+
+func TestPageError(t *testing.T) {
+	s := rustacktest.NewServer()
+	defer s.Close()
+	for i := 0; i < 5; i++ {
+		s.Seed("vdc", map[string]interface{}{"name": fmt.Sprintf("vdc-%d", i)})
+	}
+	s.InjectFault(rustacktest.Fault{Method: http.MethodGet, Path: "v1/vdc", Status: http.StatusInternalServerError})
+
+	if _, err := s.Manager().GetVdcs(); err == nil {
+		t.Fatal("expected the page error")
+	}
+}
+
+func TestJobs(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		args   interface{}
+		jobs   int
+	}{
+		{name: "create", method: http.MethodPost, path: "v1/vdc", args: map[string]string{"name": "new"}, jobs: 1},
+		{name: "update", method: http.MethodPut, path: "v1/vdc/%s", args: map[string]string{"name": "renamed"}, jobs: 1},
+		{name: "read", method: http.MethodGet, path: "v1/vdc/%s", jobs: 0},
+		{name: "not found", method: http.MethodPut, path: "v1/vdc/missing", jobs: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := rustacktest.NewServer()
+			defer s.Close()
+			s.JobPolls = 1
+			vdc := s.Seed("vdc", map[string]interface{}{"name": "vdc"})
+			path := tt.path
+			if path == "v1/vdc/%s" {
+				path = fmt.Sprintf(path, vdc["id"])
+			}
+
+			m := s.Manager()
+			jobs, err := m.RequestAsync(tt.method, path, tt.args, nil)
+			if len(jobs) != tt.jobs {
+				t.Fatalf("got %d jobs, want %d (%v)", len(jobs), tt.jobs, err)
+			}
+			if tt.jobs == 0 {
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if jobs[0].ID != s.Jobs()[0] || jobs[0].Method != tt.method || jobs[0].Path != path {
+				t.Fatalf("unexpected job %+v", jobs[0])
+			}
+			job, err := m.WaitJob(context.Background(), jobs[0].ID)
+			if err != nil || job.Status != rustack.JobDone {
+				t.Fatalf("got %v, %v", job, err)
+			}
+		})
+	}
+}
+
+func TestLockWait(t *testing.T) {
+	s := rustacktest.NewServer()
+	defer s.Close()
+	vdc := s.Seed("vdc", map[string]interface{}{"name": "vdc"})
+	path := "v1/vdc/" + vdc["id"].(string)
+	s.Lock(path, 2)
+
+	if err := s.Manager().Request(http.MethodPut, path, map[string]string{"name": "renamed"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(s.Requests()); got < 3 {
+		t.Fatalf("got %d requests, want the 2 locked ones retried", got)
+	}
+	if s.Object("vdc", vdc["id"].(string))["name"] != "renamed" {
+		t.Fatal("vdc not updated")
+	}
+}
+
+func TestSubObjectActions(t *testing.T) {
+	s := rustacktest.NewServer()
+	defer s.Close()
+	vm := s.Seed("vm", map[string]interface{}{"name": "vm"})
+	vmID := vm["id"].(string)
+	snapshot := s.Seed("vm/"+vmID+"/snapshot", map[string]interface{}{"name": "snap"})
+	base := fmt.Sprintf("v1/vm/%s/snapshot/%s/", vmID, snapshot["id"])
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodPost, base + "revert", http.StatusOK},
+		{http.MethodGet, base + "revert", http.StatusMethodNotAllowed},
+		{http.MethodPost, base + "unknown", http.StatusNotFound},
+		{http.MethodPost, fmt.Sprintf("v1/vm/%s/snapshot/missing/revert", vmID), http.StatusNotFound},
+		{http.MethodPost, fmt.Sprintf("v1/vm/missing/snapshot/%s/revert", snapshot["id"]), http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, s.URL+"/"+tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+s.Token)
+			resp, err := s.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Fatalf("got %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,411 @@
+package rustacktest
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// refCollections maps request fields holding an ID to the collection of the
+// referenced object. On create and update the ID is replaced with a copy of
+// the referenced object, as the API does in its responses.
+var refCollections = map[string]string{
+	"client":               "client",
+	"project":              "project",
+	"vdc":                  "vdc",
+	"vm":                   "vm",
+	"network":              "network",
+	"router":               "router",
+	"disk":                 "disk",
+	"lbaas":                "lbaas",
+	"kubernetes":           "kubernetes",
+	"template":             "template",
+	"hypervisor":           "hypervisor",
+	"storage_profile":      "storage_profile",
+	"node_storage_profile": "storage_profile",
+	"node_platform":        "platform",
+	"field":                "field",
+	"snapshot":             "disk_snapshot",
+}
+
+// subAliases maps sub collection names used for listing to the name used for
+// creating, e.g. records are created at dns/<id>/record but listed at
+// dns/<id>/dns_record.
+var subAliases = map[string]string{
+	"dns/dns_record": "record",
+}
+
+type collection struct {
+	order   []string
+	objects map[string]map[string]interface{}
+}
+
+type store struct {
+	collections map[string]*collection
+}
+
+func newStore() *store {
+	return &store{collections: make(map[string]*collection)}
+}
+
+func (st *store) collection(name string) *collection {
+	c, ok := st.collections[name]
+	if !ok {
+		c = &collection{objects: make(map[string]map[string]interface{})}
+		st.collections[name] = c
+	}
+	return c
+}
+
+func (st *store) get(name string, id string) map[string]interface{} {
+	c, ok := st.collections[name]
+	if !ok {
+		return nil
+	}
+	return c.objects[id]
+}
+
+func (st *store) list(name string) []map[string]interface{} {
+	c, ok := st.collections[name]
+	if !ok {
+		return nil
+	}
+	objs := make([]map[string]interface{}, 0, len(c.order))
+	for _, id := range c.order {
+		objs = append(objs, c.objects[id])
+	}
+	return objs
+}
+
+func (st *store) create(name string, args map[string]interface{}) map[string]interface{} {
+	obj := copyValue(args).(map[string]interface{})
+
+	id, _ := obj["id"].(string)
+	if id == "" {
+		id = newID()
+	}
+	obj["id"] = id
+	if _, ok := obj["locked"]; !ok {
+		obj["locked"] = false
+	}
+	if _, ok := obj["tags"]; !ok {
+		obj["tags"] = []interface{}{}
+	}
+
+	st.expand(obj)
+	st.inherit(obj)
+
+	c := st.collection(name)
+	c.objects[id] = obj
+	c.order = append(c.order, id)
+
+	st.onCreate(kindOf(name), obj)
+	return obj
+}
+
+func (st *store) update(name string, obj map[string]interface{}, args map[string]interface{}) {
+	args = copyValue(args).(map[string]interface{})
+	delete(args, "id")
+	st.expand(args)
+	for key, value := range args {
+		obj[key] = value
+	}
+	st.onUpdate(kindOf(name), obj, args)
+}
+
+func (st *store) delete(name string, id string) {
+	c, ok := st.collections[name]
+	if !ok {
+		return
+	}
+	obj := c.objects[id]
+	delete(c.objects, id)
+	for i, oid := range c.order {
+		if oid == id {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+
+	prefix := name + "/" + id + "/"
+	for sub := range st.collections {
+		if strings.HasPrefix(sub, prefix) {
+			delete(st.collections, sub)
+		}
+	}
+
+	if obj != nil {
+		st.onDelete(kindOf(name), obj)
+	}
+}
+
+// render returns a copy of the object as it is sent to clients.
+func (st *store) render(name string, obj map[string]interface{}) map[string]interface{} {
+	out := copyValue(obj).(map[string]interface{})
+	st.onRender(kindOf(name), out)
+	return out
+}
+
+// ref returns the representation of a referenced object embedded into other
+// objects: its scalar fields and nested references, without lists.
+func (st *store) ref(name string, id string) interface{} {
+	if id == "" {
+		return nil
+	}
+	target := st.get(name, id)
+	if target == nil {
+		return map[string]interface{}{"id": id}
+	}
+	ref := make(map[string]interface{})
+	for key, value := range target {
+		if _, isList := value.([]interface{}); isList {
+			continue
+		}
+		ref[key] = copyValue(value)
+	}
+	return ref
+}
+
+func (st *store) expand(obj map[string]interface{}) {
+	for key, value := range obj {
+		switch v := value.(type) {
+		case string:
+			if key == "floating" {
+				obj[key] = floatingRef(v)
+			} else if name, ok := refCollections[key]; ok {
+				obj[key] = st.ref(name, v)
+			}
+		case []interface{}:
+			switch key {
+			case "tags":
+				obj[key] = tagRefs(v)
+			case "fw_templates":
+				obj[key] = st.refList("firewall", v)
+			case "vms", "disks":
+				if isRefList(v) {
+					obj[key] = st.refList(strings.TrimSuffix(key, "s"), v)
+				}
+			default:
+				for _, item := range v {
+					if m, ok := item.(map[string]interface{}); ok {
+						st.expand(m)
+					}
+				}
+			}
+		case map[string]interface{}:
+			st.expand(v)
+		}
+	}
+}
+
+// isRefList reports whether the list holds IDs, as opposed to objects to be
+// created such as the disks of a new VM.
+func isRefList(items []interface{}) bool {
+	for _, item := range items {
+		if _, ok := item.(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (st *store) refList(name string, items []interface{}) []interface{} {
+	refs := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			refs = append(refs, st.ref(name, v))
+		case map[string]interface{}:
+			id, _ := v["id"].(string)
+			refs = append(refs, st.ref(name, id))
+		}
+	}
+	return refs
+}
+
+// inherit copies vdc and project from referenced objects, so that e.g. ports
+// can be filtered by the vdc of their network.
+func (st *store) inherit(obj map[string]interface{}) {
+	for _, key := range []string{"vdc", "project"} {
+		if obj[key] != nil {
+			continue
+		}
+		for _, source := range []string{"network", "vm", "router", "vdc", "disk"} {
+			ref, ok := obj[source].(map[string]interface{})
+			if !ok || ref[key] == nil {
+				continue
+			}
+			obj[key] = copyValue(ref[key])
+			break
+		}
+	}
+}
+
+func (st *store) filter(name string, query url.Values) []map[string]interface{} {
+	var items []map[string]interface{}
+	for _, obj := range st.list(name) {
+		rendered := st.render(name, obj)
+		if matchQuery(rendered, query) {
+			items = append(items, rendered)
+		}
+	}
+	if sortBy := query.Get("sort"); sortBy != "" {
+		sortItems(items, strings.Split(sortBy, ","))
+	}
+	if items == nil {
+		items = []map[string]interface{}{}
+	}
+	return items
+}
+
+func matchQuery(obj map[string]interface{}, query url.Values) bool {
+	for key := range query {
+		switch key {
+		case "page", "limit", "sort":
+			continue
+		}
+		value, ok := obj[key]
+		if !ok {
+			// Unknown filters are ignored, as the API ignores them.
+			continue
+		}
+		if !matchValue(key, value, query.Get(key)) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchValue(key string, value interface{}, expected string) bool {
+	switch v := value.(type) {
+	case nil:
+		return expected == "" || expected == "null"
+	case string:
+		if key == "name" {
+			return strings.Contains(strings.ToLower(v), strings.ToLower(expected))
+		}
+		return v == expected
+	case map[string]interface{}:
+		return fmt.Sprint(v["id"]) == expected
+	case []interface{}:
+		names := make(map[string]bool)
+		for _, item := range v {
+			if m, ok := item.(map[string]interface{}); ok {
+				names[fmt.Sprint(m["name"])] = true
+				names[fmt.Sprint(m["id"])] = true
+			} else {
+				names[fmt.Sprint(item)] = true
+			}
+		}
+		for _, want := range strings.Split(expected, ",") {
+			if !names[want] {
+				return false
+			}
+		}
+		return true
+	}
+	return formatValue(value) == expected
+}
+
+func sortItems(items []map[string]interface{}, fields []string) {
+	sort.SliceStable(items, func(i, j int) bool {
+		for _, field := range fields {
+			desc := strings.HasPrefix(field, "-")
+			field = strings.TrimPrefix(field, "-")
+			c := compareValues(items[i][field], items[j][field])
+			if c == 0 {
+				continue
+			}
+			return (c < 0) != desc
+		}
+		return false
+	})
+}
+
+func compareValues(a interface{}, b interface{}) int {
+	af, aok := a.(float64)
+	bf, bok := b.(float64)
+	if aok && bok {
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(formatValue(a), formatValue(b))
+}
+
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}:
+		return fmt.Sprint(v["id"])
+	}
+	return fmt.Sprint(value)
+}
+
+func tagRefs(items []interface{}) []interface{} {
+	tags := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			tags = append(tags, map[string]interface{}{"id": "tag-" + v, "name": v})
+		case map[string]interface{}:
+			tags = append(tags, v)
+		}
+	}
+	return tags
+}
+
+func floatingRef(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	ip := value
+	if strings.Count(value, ".") != 3 {
+		ip = randomIP()
+	}
+	return map[string]interface{}{"id": newID(), "ip_address": ip}
+}
+
+func kindOf(name string) string {
+	return name[strings.LastIndex(name, "/")+1:]
+}
+
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = copyValue(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = copyValue(item)
+		}
+		return out
+	}
+	return value
+}
+
+func newID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func randomIP() string {
+	var b [2]byte
+	rand.Read(b[:])
+	return fmt.Sprintf("10.255.%d.%d", b[0], b[1]%254+1)
+}